@@ -27,8 +27,11 @@ function initializeAccountPage() {
     if (emailElement) emailElement.textContent = user.email;
     console.log("User info populated:", user.username, user.email);
 
-    // Load posts and comments
+    // Load the settings, posts, drafts, saved posts and comments
+    loadAccountSettings();
     fetchUserPosts();
+    fetchUserDrafts();
+    fetchUserBookmarks();
     fetchUserComments();
 }
 
@@ -82,6 +85,11 @@ async function fetchUserPosts() {
             const meta = document.createElement("p");
             meta.className = "post-meta text-muted small";
             meta.textContent = `Posted on ${formatDate(post.created_at)}`;
+            if (post.status === "scheduled") {
+                meta.textContent = `Scheduled for ${formatDate(post.publish_at)}`;
+            } else if (post.expires_at) {
+                meta.textContent += `, expires on ${formatDate(post.expires_at)}`;
+            }
 
             const excerpt = document.createElement("p");
             excerpt.className = "post-excerpt";
@@ -91,6 +99,9 @@ async function fetchUserPosts() {
             div.appendChild(title);
             div.appendChild(meta);
             div.appendChild(excerpt);
+            if (post.status === "scheduled") {
+                div.appendChild(createCancelScheduleButton(post));
+            }
             container.appendChild(div);
         });
         
@@ -107,6 +118,168 @@ async function fetchUserPosts() {
     }
 }
 
+function createCancelScheduleButton(post) {
+    const cancel = document.createElement("button");
+    cancel.type = "button";
+    cancel.className = "btn btn-sm btn-outline-danger";
+    cancel.textContent = "Cancel";
+    cancel.addEventListener("click", async () => {
+        if (!confirm("Cancel this scheduled post? It will be deleted.")) return;
+        const res = await fetch(`/api/posts/scheduled/${post.id}`, { method: "DELETE", credentials: "include" });
+        if (res.ok) {
+            fetchUserPosts();
+        } else if (res.status === 409) {
+            alert("This post has already been published.");
+            fetchUserPosts();
+        } else {
+            alert("Failed to cancel the post.");
+        }
+    });
+    return cancel;
+}
+
+async function fetchUserDrafts() {
+    const container = document.getElementById("user-drafts-list");
+    if (!container) {
+        console.warn("User drafts list container not found");
+        return;
+    }
+
+    try {
+        const res = await fetch("/api/drafts", { credentials: "include" });
+        if (!res.ok) {
+            throw new Error(`HTTP ${res.status}: ${res.statusText}`);
+        }
+        const data = await res.json();
+        const drafts = Array.isArray(data.drafts) ? data.drafts : [];
+
+        clearContainer(container);
+        if (drafts.length === 0) {
+            const message = document.createElement("p");
+            message.className = "text-muted text-center py-4";
+            message.textContent = "You have no drafts. Posts you start writing are saved here.";
+            container.appendChild(message);
+            return;
+        }
+
+        drafts.forEach((draft) => container.appendChild(createDraftElement(draft)));
+    } catch (err) {
+        console.error("Failed to load drafts:", err);
+        clearContainer(container);
+        showError(container, "Failed to load your drafts. Please try again later.");
+    }
+}
+
+function createDraftElement(draft) {
+    const div = document.createElement("div");
+    div.className = "draft-item border-bottom pb-3 mb-3";
+
+    const title = document.createElement("h5");
+    title.textContent = draft.title || "Untitled draft";
+
+    const meta = document.createElement("p");
+    meta.className = "text-muted small";
+    meta.textContent = `Saved on ${formatDate(draft.updated_at)}`;
+
+    const excerpt = document.createElement("p");
+    excerpt.className = "post-excerpt";
+    const content = draft.content || "";
+    excerpt.textContent = content.length > 100 ? content.slice(0, 100) + "..." : content;
+
+    const edit = document.createElement("button");
+    edit.type = "button";
+    edit.className = "btn btn-sm btn-primary me-2";
+    edit.textContent = "Continue";
+    edit.addEventListener("click", () => {
+        // createpost.js opens the draft left here
+        sessionStorage.setItem("editDraftId", draft.id);
+        window.navigateTo("create-post");
+    });
+
+    const remove = document.createElement("button");
+    remove.type = "button";
+    remove.className = "btn btn-sm btn-outline-danger";
+    remove.textContent = "Delete";
+    remove.addEventListener("click", async () => {
+        if (!confirm("Delete this draft?")) return;
+        const res = await fetch(`/api/drafts/${draft.id}`, { method: "DELETE", credentials: "include" });
+        if (res.ok) {
+            fetchUserDrafts();
+        } else {
+            alert("Failed to delete the draft.");
+        }
+    });
+
+    div.append(title, meta, excerpt, edit, remove);
+    return div;
+}
+
+async function fetchUserBookmarks() {
+    const container = document.getElementById("user-bookmarks-list");
+    if (!container) {
+        console.warn("User bookmarks list container not found");
+        return;
+    }
+
+    try {
+        const res = await fetch("/api/bookmarks?limit=50", { credentials: "include" });
+        if (!res.ok) {
+            throw new Error(`HTTP ${res.status}: ${res.statusText}`);
+        }
+        const data = await res.json();
+        const bookmarks = Array.isArray(data.bookmarks) ? data.bookmarks : [];
+
+        clearContainer(container);
+        if (bookmarks.length === 0) {
+            const message = document.createElement("p");
+            message.className = "text-muted text-center py-4";
+            message.textContent = "You have no saved posts. Save posts to read them later.";
+            container.appendChild(message);
+            return;
+        }
+
+        bookmarks.forEach((bookmark) => container.appendChild(createBookmarkElement(bookmark)));
+    } catch (err) {
+        console.error("Failed to load saved posts:", err);
+        clearContainer(container);
+        showError(container, "Failed to load your saved posts. Please try again later.");
+    }
+}
+
+function createBookmarkElement(bookmark) {
+    const div = document.createElement("div");
+    div.className = "bookmark-item border-bottom pb-3 mb-3";
+
+    const title = document.createElement("h5");
+    const link = document.createElement("a");
+    link.href = `#/post/${bookmark.post.id}`;
+    link.textContent = bookmark.post.title;
+    title.appendChild(link);
+
+    const meta = document.createElement("p");
+    meta.className = "text-muted small";
+    meta.textContent = `By ${bookmark.post.author}, saved on ${formatDate(bookmark.saved_at)}`;
+    if (bookmark.collection) {
+        meta.textContent += ` in ${bookmark.collection}`;
+    }
+
+    const remove = document.createElement("button");
+    remove.type = "button";
+    remove.className = "btn btn-sm btn-outline-danger";
+    remove.textContent = "Remove";
+    remove.addEventListener("click", async () => {
+        const res = await fetch(`/api/bookmarks/${bookmark.post.id}`, { method: "DELETE", credentials: "include" });
+        if (res.ok) {
+            fetchUserBookmarks();
+        } else {
+            alert("Failed to remove the saved post.");
+        }
+    });
+
+    div.append(title, meta, remove);
+    return div;
+}
+
 async function fetchUserComments() {
     console.log("Fetching user comments");
     
@@ -168,6 +341,158 @@ async function fetchUserComments() {
 
 // ✅ UTILITY FUNCTIONS
 
+async function loadAccountSettings() {
+    const profileForm = document.getElementById("account-profile-form");
+    if (!profileForm) return;
+
+    try {
+        const res = await fetch("/api/account", { credentials: "include" });
+        if (!res.ok) {
+            throw new Error(`HTTP ${res.status}: ${res.statusText}`);
+        }
+        const data = await res.json();
+        ["first_name", "last_name", "username", "bio"].forEach((field) => {
+            profileForm.elements[field].value = data.user[field] || "";
+        });
+        showAvatar(data.avatar_url);
+        showPendingEmail(data.pending_email);
+        showDeleteAfter(data.user.delete_after);
+    } catch (err) {
+        console.error("Failed to load account settings:", err);
+        showSettingsStatus("Failed to load your settings. Please try again later.", true);
+    }
+
+    profileForm.onsubmit = async (event) => {
+        event.preventDefault();
+        const body = {};
+        ["first_name", "last_name", "username", "bio"].forEach((field) => {
+            body[field] = profileForm.elements[field].value;
+        });
+        const data = await sendSettings("/api/account/profile", body);
+        if (!data) return;
+        // Keep the stored user in step with the new username
+        const user = JSON.parse(localStorage.getItem("user")) || {};
+        localStorage.setItem("user", JSON.stringify({ ...user, ...data.user }));
+        const usernameElement = document.getElementById("account-username");
+        if (usernameElement) usernameElement.textContent = data.user.username;
+        showSettingsStatus("Profile saved");
+    };
+
+    const emailForm = document.getElementById("account-email-form");
+    emailForm.onsubmit = async (event) => {
+        event.preventDefault();
+        const data = await sendSettings("/api/account/email", { email: emailForm.elements.email.value });
+        if (!data) return;
+        emailForm.reset();
+        showPendingEmail(data.pending_email);
+        showSettingsStatus(data.message);
+    };
+
+    const passwordForm = document.getElementById("account-password-form");
+    passwordForm.onsubmit = async (event) => {
+        event.preventDefault();
+        const data = await sendSettings("/api/account/password", {
+            current_password: passwordForm.elements.current_password.value,
+            new_password: passwordForm.elements.new_password.value,
+        });
+        if (!data) return;
+        passwordForm.reset();
+        showSettingsStatus(data.message);
+    };
+
+    const avatarInput = document.getElementById("account-avatar-input");
+    avatarInput.onchange = async () => {
+        if (!avatarInput.files.length) return;
+        const form = new FormData();
+        form.append("file", avatarInput.files[0]);
+        const data = await sendSettings("/api/account/avatar", form);
+        avatarInput.value = "";
+        if (!data) return;
+        showAvatar(data.avatar_url);
+        showSettingsStatus("Avatar updated");
+    };
+
+    document.getElementById("account-avatar-remove").onclick = async () => {
+        const data = await sendSettings("/api/account/avatar", null, "DELETE");
+        if (!data) return;
+        showAvatar("");
+        showSettingsStatus("Avatar removed");
+    };
+
+    const deleteForm = document.getElementById("account-delete-form");
+    deleteForm.onsubmit = async (event) => {
+        event.preventDefault();
+        if (!confirm("Delete your account? Your posts and comments stay, shown as \"deleted user\".")) return;
+        const data = await sendSettings("/api/account/delete", { password: deleteForm.elements.password.value }, "POST");
+        deleteForm.reset();
+        if (!data) return;
+        showDeleteAfter(data.delete_after);
+        showSettingsStatus(data.message);
+    };
+
+    document.getElementById("account-delete-cancel").onclick = async () => {
+        const data = await sendSettings("/api/account/delete", null, "DELETE");
+        if (!data) return;
+        showDeleteAfter(null);
+        showSettingsStatus(data.message);
+    };
+}
+
+// sendSettings sends body, JSON or a form, and returns the response, or
+// shows what went wrong and returns null.
+async function sendSettings(url, body, method = "PUT") {
+    const options = { method, credentials: "include" };
+    if (body instanceof FormData) {
+        options.body = body;
+    } else if (body) {
+        options.headers = { "Content-Type": "application/json" };
+        options.body = JSON.stringify(body);
+    }
+    try {
+        const res = await fetch(url, options);
+        const data = await res.json().catch(() => ({}));
+        if (!res.ok) {
+            showSettingsStatus(Array.isArray(data.errors) ? data.errors.join(", ") : (data.message || `HTTP ${res.status}`), true);
+            return null;
+        }
+        return data;
+    } catch (err) {
+        console.error("Failed to save settings:", err);
+        showSettingsStatus("Failed to save. Please try again later.", true);
+        return null;
+    }
+}
+
+function showSettingsStatus(message, isError = false) {
+    const status = document.getElementById("account-settings-status");
+    if (!status) return;
+    status.textContent = message;
+    status.className = `settings-status ${isError ? "error" : "success"}`;
+}
+
+function showAvatar(url) {
+    const avatar = document.getElementById("account-avatar");
+    if (!avatar) return;
+    avatar.classList.toggle("d-none", !url);
+    if (url) {
+        avatar.src = `${url}?t=${Date.now()}`;
+    } else {
+        avatar.removeAttribute("src");
+    }
+}
+
+function showPendingEmail(email) {
+    const pending = document.getElementById("account-pending-email");
+    if (pending) pending.textContent = email ? `Waiting for confirmation: ${email}` : "";
+}
+
+function showDeleteAfter(when) {
+    const deleteAfter = document.getElementById("account-delete-after");
+    if (deleteAfter) deleteAfter.textContent = when ? `Your account will be deleted on ${new Date(when).toLocaleString()}` : "";
+    const cancel = document.getElementById("account-delete-cancel");
+    if (cancel) cancel.classList.toggle("d-none", !when);
+}
+
 function clearContainer(container) {
     if (container) {
         container.innerHTML = '';
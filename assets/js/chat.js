@@ -24,6 +24,10 @@ class ChatManager {
         this.isUpdating = false;
         this.isInitialized = false;
         this.lastAuthStatus = null;
+        this.ownPresence = null;
+        this.lastSeq = 0;
+        this.ackTimer = null;
+        this.userListReloadTimer = null;
         this.updateTimeout = null;
         
         // Request notification permission
@@ -45,6 +49,7 @@ class ChatManager {
         
         // Always setup UI elements
         this.setupEventListeners();
+        this.setupActivityTracking();
         this.setupScrollPagination();
         
         // Update UI based on auth status
@@ -217,6 +222,12 @@ updateForAuthStatus() {
             this.ws.onclose = (event) => {
                 console.log('❌ WebSocket disconnected:', event.code, event.reason);
                 this.ws = null;
+
+                // 4009: the account was deleted and its sessions are gone
+                if (event.code === 4009) {
+                    window.location.reload();
+                    return;
+                }
                 
                 // ✅ FIXED: Only refresh if authenticated and not already loading
                 if (window.appState?.isAuthenticated && !this.isLoadingMessages) {
@@ -225,9 +236,11 @@ updateForAuthStatus() {
                     }, 1000);
                 }
                 
-                // Reconnect if still authenticated
+                // Reconnect if still authenticated, waiting longer after each
+                // failed attempt (1012 means the server is restarting)
                 if (window.appState?.isAuthenticated && this.connectionAttempts < this.maxConnectionAttempts) {
-                    setTimeout(() => this.connectWebSocket(), 3000);
+                    const delay = Math.min(3000 * Math.max(this.connectionAttempts, 1), 15000);
+                    setTimeout(() => this.connectWebSocket(), delay);
                 }
             };
             
@@ -305,6 +318,33 @@ updateForAuthStatus() {
         }
     }
 
+    // Report user activity so the server does not mark us as away
+    setupActivityTracking() {
+        const reportActivity = this.throttle(() => {
+            if (this.ws && this.ws.readyState === WebSocket.OPEN) {
+                this.ws.send(JSON.stringify({ type: 'activity', data: {} }));
+            }
+        }, 60000);
+
+        ['mousemove', 'keydown', 'click', 'scroll', 'touchstart'].forEach(eventName => {
+            document.addEventListener(eventName, reportActivity, { passive: true });
+        });
+    }
+
+    // Change our own presence: status is one of available, away, dnd, invisible
+    setPresence(status, customStatus, showLastSeen) {
+        if (!this.ws || this.ws.readyState !== WebSocket.OPEN) {
+            return;
+        }
+
+        const data = {};
+        if (status !== undefined) data.status = status;
+        if (customStatus !== undefined) data.custom_status = customStatus;
+        if (showLastSeen !== undefined) data.show_last_seen = showLastSeen;
+
+        this.ws.send(JSON.stringify({ type: 'presence', data }));
+    }
+
     showMainLoginPrompt() {
         this.showTemporaryMessage('Please login to the website first to start chatting');
     }
@@ -419,8 +459,36 @@ updateForAuthStatus() {
 
     handleWebSocketMessage(message) {
         console.log('📨 Handling WebSocket message type:', message.type);
+
+        // Durable events carry a seq; a replay can overlap live delivery
+        if (message.seq) {
+            if (message.seq <= this.lastSeq) {
+                return;
+            }
+            this.lastSeq = message.seq;
+            this.scheduleAck();
+        }
         
         switch (message.type) {
+            case 'sync':
+                (message.data.events || []).forEach(event => this.handleWebSocketMessage(event));
+                if (message.data.truncated) {
+                    this.loadChatUsers();
+                }
+                break;
+            case 'messages_read':
+                console.log('👀 Messages read by', message.data.reader_id);
+                break;
+            case 'notification':
+                if (message.data.kind === 'comment') {
+                    this.showTemporaryMessage(`New comment on "${message.data.post_title}"`);
+                } else if (message.data.kind === 'post_published') {
+                    this.showTemporaryMessage(`Your scheduled post "${message.data.post_title}" is now published`);
+                }
+                break;
+            case 'post_published':
+                this.showTemporaryMessage(`New post by ${message.data.author}: "${message.data.title}"`);
+                break;
             case 'new_message':
                 this.handleNewMessage(message.data);
                 break;
@@ -431,15 +499,31 @@ updateForAuthStatus() {
             case 'user_status':
                 this.handleUserStatusChange(message.data);
                 break;
-            case 'force_refresh':
-                console.log('🔄 Force refreshing user list');
-                this.loadChatUsers();
+            case 'presence':
+                this.ownPresence = message.data;
+                break;
+            case 'error':
+                this.showTemporaryMessage(message.data.message);
+                break;
+            case 'presence_snapshot':
+                (message.data || []).forEach(presence => this.handleUserStatusChange(presence));
                 break;
             default:
                 console.log('❓ Unknown message type:', message.type);
         }
     }
 
+    // Acknowledge the latest durable event so it is not replayed on reconnect
+    scheduleAck() {
+        clearTimeout(this.ackTimer);
+        clearTimeout(this.userListReloadTimer);
+        this.ackTimer = setTimeout(() => {
+            if (this.ws && this.ws.readyState === WebSocket.OPEN) {
+                this.ws.send(JSON.stringify({ type: 'ack', data: { seq: this.lastSeq } }));
+            }
+        }, 1000);
+    }
+
     handleNewMessage(messageData) {
         console.log('💬 Handling new message:', messageData);
         
@@ -478,14 +562,12 @@ updateForAuthStatus() {
     handleUserStatusChange(data) {
         console.log('👤 User status change received:', data);
         
-        // Update individual user status
-        this.updateUserOnlineStatus(data.user_id, data.is_online);
-        
-        // ✅ FIXED: Reduce refresh frequency
-        if (window.appState?.isAuthenticated && !this.isLoadingMessages) {
-            setTimeout(() => {
-                this.loadChatUsers();
-            }, 500);
+        // Status changes arrive as deltas; only users we have never seen
+        // (e.g. just registered) need a reload of the list
+        const known = this.updateUserOnlineStatus(data.user_id, data.is_online, data.status);
+        if (!known && window.appState?.isAuthenticated) {
+            clearTimeout(this.userListReloadTimer);
+            this.userListReloadTimer = setTimeout(() => this.loadChatUsers(), 1000);
         }
     }
 
@@ -619,8 +701,13 @@ updateForAuthStatus() {
 
     createUserElement(user) {
         const li = document.createElement('li');
-        li.className = `user ${user.is_online ? 'online' : 'offline'}`;
+        li.className = `user ${user.is_online ? 'online' : 'offline'} status-${user.status || 'offline'}`;
         li.dataset.userId = user.id;
+        if (user.custom_status) {
+            li.title = user.custom_status;
+        } else if (!user.is_online && user.last_seen) {
+            li.title = `Last seen ${this.getTimeAgo(user.last_seen)}`;
+        }
 
         const userInfo = document.createElement('div');
         userInfo.className = 'user-info';
@@ -1165,13 +1252,17 @@ showTypingIndicator(isTyping, username) {
     }
 
     // ✅ ENHANCED: More robust online status updating
-    updateUserOnlineStatus(userId, isOnline) {
-        console.log(`🟢 Updating user ${userId} online status to: ${isOnline}`);
+    updateUserOnlineStatus(userId, isOnline, status) {
+        console.log(`🟢 Updating user ${userId} online status to: ${isOnline} (${status})`);
         
         const userElement = document.querySelector(`[data-user-id="${userId}"]`);
         if (userElement) {
             // Update user class
-            userElement.className = `user ${isOnline ? 'online' : 'offline'}`;
+            const hasUnread = userElement.classList.contains('has-unread');
+            userElement.className = `user ${isOnline ? 'online' : 'offline'} status-${status || (isOnline ? 'available' : 'offline')}`;
+            if (hasUnread) {
+                userElement.classList.add('has-unread');
+            }
             
             // ✅ ENHANCED: Better indicator management
             const userDetails = userElement.querySelector('.user-details');
@@ -1195,9 +1286,11 @@ showTypingIndicator(isTyping, username) {
             }
             
             console.log(`✅ User ${userId} status updated in UI - Online: ${isOnline}`);
-        } else {
-            console.log(`⚠️ User element not found for ${userId} - will be updated on next refresh`);
+            return true;
         }
+
+        console.log(`⚠️ User element not found for ${userId} - will be updated on next refresh`);
+        return false;
     }
 
     clearUnreadIndicator(userId) {
@@ -1213,6 +1306,7 @@ showTypingIndicator(isTyping, username) {
     destroy() {
         this.disconnectWebSocket();
         clearTimeout(this.typingTimer);
+        clearTimeout(this.ackTimer);
         if (this.updateTimeout) {
             clearTimeout(this.updateTimeout);
         }
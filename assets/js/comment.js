@@ -29,7 +29,7 @@ async function loadSinglePost(postId) {
     postElement.querySelector('.post-title').textContent = post.title;
     postElement.querySelector('.post-author').textContent = `By ${post.author}`;
     postElement.querySelector('.post-date').textContent = new Date(post.date).toLocaleString();
-    postElement.querySelector('.post-content').textContent = post.content;
+    setContent(postElement.querySelector('.post-content'), post);
     
     // Update comment count
     postElement.querySelector('.comment-count').textContent = comments.length;
@@ -128,6 +128,16 @@ async function loadSinglePost(postId) {
   }
 }
 
+// setContent shows Markdown as the HTML the server sanitized, plain
+// text as text.
+function setContent(element, item) {
+  if (item.content_format === 'markdown') {
+    element.innerHTML = item.content_html;
+  } else {
+    element.textContent = item.content;
+  }
+}
+
 // Rest of your functions remain the same...
 function displayComments(comments) {
   const commentsList = document.querySelector('.comments-list');
@@ -145,7 +155,7 @@ function displayComments(comments) {
     const commentElement = commentTemplate.content.cloneNode(true);
     commentElement.querySelector('.comment-author').textContent = comment.author;
     commentElement.querySelector('.comment-date').textContent = new Date(comment.created_at).toLocaleString();
-    commentElement.querySelector('.comment-content').textContent = comment.content;
+    setContent(commentElement.querySelector('.comment-content'), comment);
     commentsList.appendChild(commentElement);
   });
 }
@@ -179,7 +189,8 @@ async function addComment(postId, commentText) {
       credentials: 'include',
       body: JSON.stringify({
         post_id: postId,
-        content: commentText
+        content: commentText,
+        format: 'markdown'
       })
     });
     
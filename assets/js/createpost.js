@@ -49,6 +49,8 @@
     topicCheckboxes.forEach(cb => cb.addEventListener('change', updateCheckboxStates));
     updateCheckboxStates();
 
+    const drafts = setupDraftAutosave(form, topicCheckboxes, updateCheckboxStates);
+
     const inputs = form.querySelectorAll('input[type="text"], textarea, input[type="checkbox"]');
     inputs.forEach(input => {
       input.addEventListener('input', () => {
@@ -87,44 +89,189 @@
       const newPost = {
         title,
         content,
-        topics: checkedTopics.map(cb => parseInt(cb.value, 10)),
-        createdAt: new Date().toISOString()
+        format: 'markdown',
+        topics: checkedTopics.map(cb => parseInt(cb.value, 10))
       };
+      // Empty times publish now and never expire
+      const publishAt = form.querySelector('#input-create-post-publish-at').value;
+      const expiresAt = form.querySelector('#input-create-post-expires-at').value;
+      if (publishAt) newPost.publish_at = new Date(publishAt).toISOString();
+      if (expiresAt) newPost.expires_at = new Date(expiresAt).toISOString();
 
-      fetch('/api/create-post', {
-        method: 'POST',
-        headers: {
-          'Content-Type': 'application/json'
-        },
-        credentials: 'include', // include session_token cookie
-        body: JSON.stringify(newPost)
-      })
-      .then(response => {
-        if (!response.ok) {
-          // If the server returned 401 (or any other error), read it as text
-          return response.text().then(errText => {
-            throw new Error(errText || `HTTP ${response.status}`);
-          });
+      // A post with a draft is published from it, once its last changes are saved
+      drafts.publish(newPost)
+      .then(response => response.json().catch(() => ({})).then(data => {
+        if (response.status === 409) {
+          if (data.draft) drafts.showConflict(data.draft);
+          throw new Error('the draft was changed on another device');
         }
-        // Otherwise parse JSON normally
-        return response.json();
-      })
-      .then(data => {
-        // At this point data is guaranteed to be a parsed JSON object
-        if (data.success) {
-          console.log("Post created successfully in DB:", data);
-          window.navigateTo('home');
-        } else {
-          // In case your handler ever returns { success: false, errors: [...] }
-          throw new Error(data.errors ? data.errors.join(', ') : data.message || "Unknown error");
+        if (!response.ok || !data.success) {
+          // Validation problems come as { errors: [...] }, others as { message }
+          throw new Error(data.errors ? data.errors.join(', ') : data.message || `HTTP ${response.status}`);
         }
+        return data;
+      }))
+      .then(data => {
+        console.log("Post created successfully in DB:", data);
+        window.navigateTo(data.post && data.post.status === 'scheduled' ? 'my-account' : 'home');
       })
       .catch(err => {
         console.error("Error creating post:", err);
         const errorContainer = form.querySelector('.validation-errors');
-        errorContainer.innerHTML = `<p class="error">Failed to create post: ${err.message}</p>`;
+        const message = document.createElement('p');
+        message.classList.add('error');
+        message.textContent = `Failed to create post: ${err.message}`;
+        errorContainer.replaceChildren(message);
         errorContainer.style.display = 'block';
       });
     });
   }
+
+  // setupDraftAutosave saves the form as a draft a moment after each change.
+  // Every save sends the revision it is based on; a 409 means another device
+  // saved the draft since, and the user picks which version to keep.
+  function setupDraftAutosave(form, topicCheckboxes, updateCheckboxStates) {
+    const titleInput = form.querySelector('#input-create-post-title');
+    const contentInput = form.querySelector('#textarea-create-post-content');
+    const status = form.querySelector('.draft-status');
+    let draftId = null;
+    let revision = 0;
+    let timer = null;
+    let saving = Promise.resolve();
+    let conflict = false;
+    let saveFailed = false;
+
+    function fields() {
+      return {
+        title: titleInput.value,
+        content: contentInput.value,
+        format: 'markdown',
+        topics: topicCheckboxes.filter(cb => cb.checked).map(cb => parseInt(cb.value, 10))
+      };
+    }
+
+    function fill(draft) {
+      draftId = draft.id;
+      revision = draft.revision;
+      titleInput.value = draft.title;
+      contentInput.value = draft.content;
+      topicCheckboxes.forEach(cb => {
+        cb.checked = draft.topics.includes(parseInt(cb.value, 10));
+      });
+      updateCheckboxStates();
+    }
+
+    function setStatus(text) {
+      status.classList.remove('conflict');
+      status.textContent = text;
+    }
+
+    function save() {
+      clearTimeout(timer);
+      timer = null;
+      saving = saving.then(() => {
+        if (conflict) return;
+        const body = fields();
+        if (!draftId && !body.title.trim() && !body.content.trim() && body.topics.length === 0) return;
+
+        body.revision = revision;
+        return fetch(draftId ? `/api/drafts/${draftId}` : '/api/drafts', {
+          method: draftId ? 'PUT' : 'POST',
+          headers: { 'Content-Type': 'application/json' },
+          credentials: 'include',
+          body: JSON.stringify(body)
+        })
+        .then(response => response.json().catch(() => ({})).then(data => {
+          if (response.status === 409) {
+            showConflict(data.draft);
+            return;
+          }
+          if (!response.ok || !data.success) {
+            throw new Error(data.errors ? data.errors.join(', ') : data.message || `HTTP ${response.status}`);
+          }
+          draftId = data.draft.id;
+          revision = data.draft.revision;
+          saveFailed = false;
+          setStatus(`Draft saved at ${new Date(data.draft.updated_at).toLocaleTimeString()}`);
+        }))
+        .catch(err => {
+          saveFailed = true;
+          setStatus(`Draft not saved: ${err.message}`);
+        });
+      });
+      return saving;
+    }
+
+    function showConflict(current) {
+      conflict = true;
+      status.classList.add('conflict');
+      status.textContent = 'This draft was changed on another device.';
+
+      const load = document.createElement('button');
+      load.type = 'button';
+      load.textContent = 'Load that version';
+      load.addEventListener('click', () => {
+        conflict = false;
+        fill(current);
+        setStatus('Loaded the latest version of the draft');
+      });
+
+      const keep = document.createElement('button');
+      keep.type = 'button';
+      keep.textContent = 'Keep mine';
+      keep.addEventListener('click', () => {
+        conflict = false;
+        revision = current.revision;
+        save();
+      });
+      status.append(load, keep);
+    }
+
+    form.addEventListener('input', () => {
+      clearTimeout(timer);
+      timer = setTimeout(save, 1500);
+    });
+    // Save what is pending when leaving the page
+    window.addEventListener('hashchange', () => {
+      if (timer) save();
+    }, { once: true });
+
+    // The account page opens a draft by leaving its ID here
+    const openId = sessionStorage.getItem('editDraftId');
+    sessionStorage.removeItem('editDraftId');
+    if (openId) {
+      fetch(`/api/drafts/${encodeURIComponent(openId)}`, { credentials: 'include' })
+        .then(response => response.ok ? response.json() : Promise.reject(new Error(`HTTP ${response.status}`)))
+        .then(data => {
+          fill(data.draft);
+          setStatus('Editing a saved draft');
+        })
+        .catch(err => setStatus(`Could not open the draft: ${err.message}`));
+    }
+
+    return {
+      showConflict,
+      publish(post) {
+        const pending = draftId || timer ? save() : Promise.resolve();
+        return pending.then(() => {
+          if (conflict) return new Response('{}', { status: 409 });
+          // Without an up to date draft the form itself is posted
+          if (!draftId || saveFailed) {
+            return fetch('/api/create-post', {
+              method: 'POST',
+              headers: { 'Content-Type': 'application/json' },
+              credentials: 'include', // include session_token cookie
+              body: JSON.stringify(post)
+            });
+          }
+          return fetch(`/api/drafts/${draftId}/publish`, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            credentials: 'include',
+            body: JSON.stringify({ revision, publish_at: post.publish_at, expires_at: post.expires_at })
+          });
+        });
+      }
+    };
+  }
 })();
@@ -2,7 +2,8 @@
 
 class FeedManager {
   constructor() {
-    this.currentPage = 1;
+    this.nextCursor = null;
+    this.feedMode = 'all';
     this.postsPerPage = 10;
     this.isLoading = false;
     this.hasMorePosts = true;
@@ -11,6 +12,7 @@ class FeedManager {
 
   async initializeFeedPage() {
     console.log('Initializing feed page');
+    this.setupFeedModeButtons();
     this.setupInfiniteScroll();
     await this.loadInitialPosts();
   }
@@ -18,9 +20,13 @@ class FeedManager {
   async loadInitialPosts() {
     try {
       this.showLoading(true);
-      const posts = await this.fetchPosts(1, this.postsPerPage);
+      this.nextCursor = null;
+      const posts = await this.fetchPosts(this.postsPerPage);
       this.posts = posts;
       this.renderPosts(posts, true);
+      if (posts.length === 0 && this.feedMode === 'following') {
+        this.showError('Follow topics or users to see their posts here.');
+      }
       this.setupLoadMoreButton();
     } catch (error) {
       console.error('Error loading initial posts:', error);
@@ -37,8 +43,7 @@ class FeedManager {
       this.isLoading = true;
       this.showLoadMoreLoading(true);
 
-      this.currentPage++;
-      const newPosts = await this.fetchPosts(this.currentPage, this.postsPerPage);
+      const newPosts = await this.fetchPosts(this.postsPerPage, this.nextCursor);
 
       if (newPosts.length === 0) {
         this.hasMorePosts = false;
@@ -49,15 +54,16 @@ class FeedManager {
       }
     } catch (error) {
       console.error('Error loading more posts:', error);
-      this.currentPage--; // Revert page increment
     } finally {
       this.isLoading = false;
       this.showLoadMoreLoading(false);
     }
   }
 
-  async fetchPosts(page, limit) {
-    const response = await fetch(`/api/feed/posts?page=${page}&limit=${limit}`, {
+  async fetchPosts(limit, cursor = null) {
+    const params = new URLSearchParams({ limit, feed: this.feedMode });
+    if (cursor) params.set('cursor', cursor);
+    const response = await fetch(`/api/feed/posts?${params}`, {
       credentials: 'include'
     });
 
@@ -72,6 +78,7 @@ class FeedManager {
     }
 
     this.hasMorePosts = data.has_more;
+    this.nextCursor = data.next_cursor || null;
     return data.posts;
   }
 
@@ -275,6 +282,25 @@ class FeedManager {
   // ❌ REMOVED: handlePostComment method
   // ❌ REMOVED: findPostElementInDOM method (no longer needed for comments)
 
+  // The "Following" feed only lists posts by followed users or in followed topics
+  setupFeedModeButtons() {
+    document.querySelectorAll('[data-feed-mode]').forEach(button => {
+      button.classList.toggle('active', button.dataset.feedMode === this.feedMode);
+      button.addEventListener('click', () => {
+        if (this.isLoading || button.dataset.feedMode === this.feedMode) return;
+        this.feedMode = button.dataset.feedMode;
+        document.querySelectorAll('[data-feed-mode]').forEach(other => {
+          const active = other === button;
+          other.classList.toggle('active', active);
+          other.classList.toggle('btn-light', active);
+          other.classList.toggle('btn-outline-light', !active);
+        });
+        this.hasMorePosts = true;
+        this.loadInitialPosts();
+      });
+    });
+  }
+
   setupLoadMoreButton() {
     const loadMoreBtn = document.getElementById('expand-feed-btn');
     if (loadMoreBtn) {
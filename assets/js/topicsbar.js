@@ -94,8 +94,10 @@ window.renderPostsForTopic = function (topicSlug) {
     return;
   }
 
-  // Fetch posts
-  fetch(`/api/posts/topic/${topicId}`, {
+  setupTopicFollowButton(document.querySelector('.btn-follow-topic'), topicId);
+
+  // Fetch the 50 newest posts, the most a page of the topic API holds
+  fetch(`/api/posts/topic/${topicId}?limit=50`, {
     method: 'GET',
     credentials: 'include'
   })
@@ -113,6 +115,76 @@ window.renderPostsForTopic = function (topicSlug) {
     });
 };
 
+// setupTopicFollowButton shows whether the user follows the topic and
+// toggles it on click
+function setupTopicFollowButton(button, topicId) {
+  if (!button) return;
+  let following = false;
+
+  const render = () => {
+    button.textContent = following ? 'Following' : 'Follow';
+    button.classList.toggle('btn-light', following);
+    button.classList.toggle('btn-outline-light', !following);
+    button.classList.remove('d-none');
+  };
+
+  fetch(`/api/topics/follow/${topicId}`, { credentials: 'include' })
+    .then(response => response.ok ? response.json() : null)
+    .then(data => {
+      if (!data) return;
+      following = data.following;
+      render();
+    })
+    .catch(error => console.error('Error loading topic follow:', error));
+
+  button.onclick = function () {
+    fetch(`/api/topics/follow/${topicId}`, {
+      method: following ? 'DELETE' : 'PUT',
+      credentials: 'include'
+    })
+      .then(response => {
+        if (!response.ok) throw new Error(`HTTP ${response.status}`);
+        return response.json();
+      })
+      .then(data => {
+        following = data.following;
+        render();
+      })
+      .catch(error => console.error('Error following topic:', error));
+  };
+}
+
+// createBookmarkButton saves a post to read later, or unsaves it
+function createBookmarkButton(post) {
+  const button = document.createElement('button');
+  button.type = 'button';
+  button.className = 'btn btn-sm btn-outline-secondary bookmark-toggle';
+
+  let bookmarked = Boolean(post.bookmarked);
+  const render = () => {
+    button.textContent = bookmarked ? 'Saved' : 'Save for later';
+    button.classList.toggle('bookmarked', bookmarked);
+  };
+  render();
+
+  button.addEventListener('click', () => {
+    fetch(`/api/bookmarks/${post.id}`, {
+      method: bookmarked ? 'DELETE' : 'PUT',
+      credentials: 'include'
+    })
+      .then(response => {
+        if (!response.ok) throw new Error(`HTTP ${response.status}`);
+        return response.json();
+      })
+      .then(data => {
+        bookmarked = data.bookmarked;
+        render();
+      })
+      .catch(error => console.error('Error saving post:', error));
+  });
+  return button;
+}
+
 function renderTopicPostsHTML(posts) {
   const contentElement = document.querySelector('.topic-posts-content');
 
@@ -192,6 +264,7 @@ function renderTopicPostsHTML(posts) {
     }
 
     card.appendChild(topicsDiv);
+    card.appendChild(createBookmarkButton(post));
 
     // ADD COMMENT SECTION - SIMPLE VERSION
     const commentsSection = document.createElement('div');
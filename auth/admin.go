@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"realtimeforum/database"
+	"realtimeforum/model"
+	"realtimeforum/utils"
+
+	"github.com/google/uuid"
+)
+
+// Roles stored in users.role.
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// CreateUser validates and inserts a user with the given role and returns
+// the new user ID.
+func CreateUser(username, email, password, firstName, lastName string, age int, gender, role string) (string, error) {
+	if err := utils.ValidateInputs(username, email, password, firstName, lastName, age, gender, true); err != nil {
+		return "", err
+	}
+	if role != RoleUser && role != RoleAdmin {
+		return "", fmt.Errorf("invalid role %q", role)
+	}
+	if existingID, err := database.Users.IDByIdentity(username); err != nil {
+		return "", err
+	} else if existingID != "" {
+		return "", errors.New("username already exists")
+	}
+	if existingID, err := database.Users.IDByIdentity(email); err != nil {
+		return "", err
+	} else if existingID != "" {
+		return "", errors.New("email already exists")
+	}
+
+	hashedPassword, err := utils.HashPassword(password)
+	if err != nil {
+		return "", err
+	}
+
+	user := &model.User{
+		ID:            uuid.New().String(),
+		Username:      username,
+		Email:         email,
+		PasswordHash:  hashedPassword,
+		FirstName:     firstName,
+		LastName:      lastName,
+		Age:           age,
+		Gender:        gender,
+		TermsAccepted: true,
+		Role:          role,
+	}
+	if err := database.Users.Create(user); err != nil {
+		return "", err
+	}
+	return user.ID, nil
+}
+
+// SetUserRole makes a user an admin or a regular user again.
+func SetUserRole(userID, role string) error {
+	if role != RoleUser && role != RoleAdmin {
+		return fmt.Errorf("invalid role %q", role)
+	}
+	return database.Users.SetRole(userID, role)
+}
+
+// ResetPassword sets a new password and logs the user out everywhere.
+func ResetPassword(userID, password string) error {
+	if len(password) < 8 {
+		return errors.New("password must be at least 8 characters")
+	}
+
+	hashedPassword, err := utils.HashPassword(password)
+	if err != nil {
+		return err
+	}
+	return database.Users.ResetPassword(userID, hashedPassword)
+}
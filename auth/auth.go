@@ -1,7 +1,6 @@
 package auth
 
 import (
-	"database/sql"
 	"errors"
 	"fmt"
 	"log"
@@ -14,6 +13,16 @@ import (
 	"github.com/google/uuid"
 )
 
+// DefaultSessionLifetime is how long logins last unless configured.
+const DefaultSessionLifetime = 24 * time.Hour
+
+// Sessions holds the session settings: how long logins last and whether
+// the session cookie is only sent over HTTPS.
+type Sessions struct {
+	Lifetime time.Duration
+	Secure   bool
+}
+
 type LoginRequest struct {
 	Identity string `json:"identity"`
 	Password string `json:"password"`
@@ -25,14 +34,14 @@ type LoginResponse struct {
 	ExpiresIn int         `json:"expires_in"`
 }
 
-func LoginUser(usernameOrEmail, password string) (*LoginResponse, error) {
+func (s Sessions) LoginUser(usernameOrEmail, password string) (*LoginResponse, error) {
 	log.Printf("Starting authentication process for identity: %s", usernameOrEmail)
 
 	// Fetch user data
-	user, err := database.GetUserByIdentity(usernameOrEmail)
+	user, err := database.Users.GetByIdentity(usernameOrEmail)
 	if err != nil {
 		log.Printf("Error finding user by identity: %v", err)
-		if errors.Is(err, sql.ErrNoRows) {
+		if errors.Is(err, database.ErrUserNotFound) {
 			return nil, errors.New("invalid credentials")
 		}
 		return nil, fmt.Errorf("database error: %w", err)
@@ -45,23 +54,16 @@ func LoginUser(usernameOrEmail, password string) (*LoginResponse, error) {
 		return nil, errors.New("invalid credentials")
 	}
 
-	// ✅ REMOVED: Don't delete existing sessions - allow multiple concurrent sessions
-	// ✅ Optional: Clean up only expired sessions
-	_, err = database.DB.Exec("DELETE FROM sessions WHERE user_id = ? AND session_expiry < ?", user.ID, time.Now())
-	if err != nil {
+	// Don't delete the user's other sessions - allow multiple concurrent sessions
+	if _, err := database.Sessions.DeleteExpired(); err != nil {
 		log.Printf("Failed to clean expired sessions: %v", err)
 	}
 
 	// Generate a new session token
 	token := uuid.New().String()
-	expiryTime := time.Now().Add(24 * time.Hour) // 24 hour session
+	expiryTime := time.Now().Add(s.Lifetime)
 
-	// Insert the new session in the database
-	_, err = database.DB.Exec(`
-		INSERT INTO sessions (user_id, session_token, session_expiry)
-		VALUES (?, ?, ?)`,
-		user.ID, token, expiryTime)
-	if err != nil {
+	if err := database.Sessions.Create(user.ID, token, expiryTime); err != nil {
 		log.Printf("Failed to create new session: %v", err)
 		return nil, fmt.Errorf("failed to create session: %w", err)
 	}
@@ -71,42 +73,22 @@ func LoginUser(usernameOrEmail, password string) (*LoginResponse, error) {
 	return &LoginResponse{
 		User:      user,
 		Token:     token,
-		ExpiresIn: 86400, // 24 hours in seconds
+		ExpiresIn: int(s.Lifetime.Seconds()),
 	}, nil
 }
 
 func GetUserBySessionToken(sessionToken string) (*model.User, error) {
-	var user model.User
-
-	err := database.DB.QueryRow(`
-		SELECT u.id, u.first_name, u.last_name, u.username, u.email, u.password_hash, 
-		       u.age, u.gender, u.terms_accepted, u.created_at, s.session_expiry
-		FROM users u
-		JOIN sessions s ON u.id = s.user_id
-		WHERE s.session_token = ? AND s.session_expiry > ?`,
-		sessionToken, time.Now()).
-		Scan(&user.ID, &user.FirstName, &user.LastName, &user.Username, &user.Email,
-			&user.PasswordHash, &user.Age, &user.Gender, &user.TermsAccepted,
-			&user.CreatedAt, &user.SessionExpiry)
-
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, errors.New("invalid session token")
-		}
-		return nil, err
-	}
-	return &user, nil
+	return database.Sessions.User(sessionToken)
 }
 
 func LogoutUser(sessionToken string) error {
 	// Delete the specific session
-	result, err := database.DB.Exec("DELETE FROM sessions WHERE session_token = ?", sessionToken)
+	found, err := database.Sessions.Delete(sessionToken)
 	if err != nil {
 		return err
 	}
 
-	rowsAffected, _ := result.RowsAffected()
-	log.Printf("Logout: deleted %d sessions", rowsAffected)
+	log.Printf("Logout: session found: %v", found)
 	return nil
 }
 
@@ -124,15 +106,15 @@ func CheckUserLoggedIn(r *http.Request) (bool, string) {
 	return true, user.ID
 }
 
-func SetSessionCookie(w http.ResponseWriter, token string) {
+func (s Sessions) SetSessionCookie(w http.ResponseWriter, token string) {
 	http.SetCookie(w, &http.Cookie{
 		Name:     "session_token",
 		Value:    token,
 		Path:     "/",
 		HttpOnly: true,
-		Secure:   false, // Set to true in production with HTTPS
+		Secure:   s.Secure,
 		SameSite: http.SameSiteLaxMode,
-		Expires:  time.Now().Add(24 * time.Hour),
+		Expires:  time.Now().Add(s.Lifetime),
 	})
 }
 
@@ -147,37 +129,31 @@ func ClearSessionCookie(w http.ResponseWriter) {
 	})
 }
 
-func UserExist(db *sql.DB, identity string) (string, error) {
-	var id string
-	err := db.QueryRow(`SELECT id FROM users WHERE username = ? OR email = ?`, identity, identity).Scan(&id)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return "", nil
-		}
-		return "", err
-	}
-	return id, nil
+func UserExist(identity string) (string, error) {
+	return database.Users.IDByIdentity(identity)
 }
 
-func AddUser(db *sql.DB, username, email, password, firstName, lastName string, age int, gender string, termsAccepted bool) error {
+func AddUser(username, email, password, firstName, lastName string, age int, gender string, termsAccepted bool) error {
 	hashedPassword, err := utils.HashPassword(password)
 	if err != nil {
 		return err
 	}
 
-	_, err = db.Exec(`
-		INSERT INTO users (
-			id, username, email, password_hash, 
-			first_name, last_name, age, gender, terms_accepted
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-		uuid.New().String(), username, email, hashedPassword,
-		firstName, lastName, age, gender, termsAccepted,
-	)
-	return err
+	return database.Users.Create(&model.User{
+		ID:            uuid.New().String(),
+		Username:      username,
+		Email:         email,
+		PasswordHash:  hashedPassword,
+		FirstName:     firstName,
+		LastName:      lastName,
+		Age:           age,
+		Gender:        gender,
+		TermsAccepted: termsAccepted,
+	})
 }
 
 // Clean up expired sessions
 func CleanupExpiredSessions() error {
-	_, err := database.DB.Exec("DELETE FROM sessions WHERE session_expiry < ?", time.Now())
+	_, err := database.Sessions.DeleteExpired()
 	return err
 }
@@ -0,0 +1,211 @@
+// Command chatbench measures concurrent chat writes on a fresh SQLite
+// database. Every sender stores messages the way the hub does (message,
+// last message of the conversation and the receiver's event) while
+// readers keep loading chat lists and conversations.
+//
+//	go run ./cmd/chatbench -senders 50 -messages 200
+//
+// With -legacy the database is opened like before the tuning: one pool,
+// rollback journal and no busy timeout.
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"realtimeforum/database"
+	"realtimeforum/model"
+
+	"github.com/google/uuid"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func main() {
+	senders := flag.Int("senders", 50, "number of users sending at the same time")
+	messages := flag.Int("messages", 200, "messages sent by each user")
+	readers := flag.Int("readers", 8, "goroutines loading chat lists while messages are sent")
+	legacy := flag.Bool("legacy", false, "open the database without WAL, busy timeout and separate pools")
+	flag.Parse()
+
+	dir, err := os.MkdirTemp("", "chatbench")
+	if err != nil {
+		fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "chatbench.db")
+	if err := open(path, *legacy); err != nil {
+		fatal(err)
+	}
+	defer database.Close()
+
+	users, err := createUsers(*senders)
+	if err != nil {
+		fatal(err)
+	}
+
+	var (
+		wg        sync.WaitGroup
+		latencies = make([][]time.Duration, *senders)
+		failures  atomic.Int64
+		lastError atomic.Value
+		reads     atomic.Int64
+		readFails atomic.Int64
+		done      = make(chan struct{})
+	)
+
+	for i := 0; i < *readers; i++ {
+		go func(i int) {
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				user := users[i%len(users)]
+				_, err := database.Chat.Contacts(user)
+				if err == nil {
+					_, err = database.Chat.Conversation(user, users[(i+1)%len(users)], 10, 0)
+				}
+				if err != nil {
+					readFails.Add(1)
+					lastError.Store(err)
+					continue
+				}
+				reads.Add(1)
+			}
+		}(i)
+	}
+
+	began := time.Now()
+	for i := range users {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sender, receiver := users[i], users[(i+1)%len(users)]
+			for m := 0; m < *messages; m++ {
+				started := time.Now()
+				if err := send(sender, receiver, fmt.Sprintf("message %d from %d", m, i)); err != nil {
+					failures.Add(1)
+					lastError.Store(err)
+					continue
+				}
+				latencies[i] = append(latencies[i], time.Since(started))
+			}
+		}(i)
+	}
+	wg.Wait()
+	elapsed := time.Since(began)
+	close(done)
+
+	var all []time.Duration
+	for _, l := range latencies {
+		all = append(all, l...)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i] < all[j] })
+
+	var stored int
+	database.ReadDB.QueryRow("SELECT COUNT(*) FROM chat_messages").Scan(&stored)
+
+	mode := "tuned (WAL, busy timeout, one writer, read pool)"
+	if *legacy {
+		mode = "legacy (rollback journal, one shared pool)"
+	}
+	total := *senders * *messages
+	fmt.Printf("mode:              %s\n", mode)
+	fmt.Printf("messages stored:   %d/%d in %s (%.0f msg/s)\n",
+		stored, total, elapsed.Round(time.Millisecond), float64(len(all))/elapsed.Seconds())
+	if len(all) > 0 {
+		fmt.Printf("send latency:      p50 %s  p95 %s  p99 %s  max %s\n",
+			percentile(all, 50), percentile(all, 95), percentile(all, 99), all[len(all)-1].Round(time.Microsecond))
+	}
+	fmt.Printf("failed sends:      %d\n", failures.Load())
+	fmt.Printf("chat list reads:   %d (%d failed)\n", reads.Load(), readFails.Load())
+	if err, ok := lastError.Load().(error); ok {
+		fmt.Printf("last error:        %v\n", err)
+	}
+
+	if failures.Load() > 0 || stored != total {
+		os.Exit(1)
+	}
+}
+
+// open sets up the repositories on a migrated database at path.
+func open(path string, legacy bool) error {
+	if legacy {
+		db, err := sql.Open("sqlite3", path)
+		if err != nil {
+			return err
+		}
+		if _, err := database.Migrate(db, false); err != nil {
+			return err
+		}
+		database.Use(db, db)
+		return nil
+	}
+
+	db, err := database.OpenDatabase(database.SQLite, path)
+	if err != nil {
+		return err
+	}
+	if _, err := database.Migrate(db, false); err != nil {
+		return err
+	}
+	readDB, err := database.OpenReadPool(database.SQLite, path, db)
+	if err != nil {
+		return err
+	}
+	database.Use(db, readDB)
+	return nil
+}
+
+// send stores a message like the hub's chat handler does.
+func send(senderID, receiverID, text string) error {
+	message, err := database.Chat.SaveMessage(senderID, receiverID, text)
+	if err != nil {
+		return err
+	}
+	if err := database.Chat.SetLastMessage(senderID, receiverID, message.ID); err != nil {
+		return err
+	}
+	_, err = database.Events.Append(receiverID, "new_message", `{"message":"`+text+`"}`)
+	return err
+}
+
+func createUsers(n int) ([]string, error) {
+	ids := make([]string, n)
+	for i := range ids {
+		user := &model.User{
+			ID:            uuid.New().String(),
+			Username:      fmt.Sprintf("bench_%d", i),
+			Email:         fmt.Sprintf("bench_%d@example.com", i),
+			PasswordHash:  "x",
+			FirstName:     "Bench",
+			LastName:      "User",
+			Age:           30,
+			Gender:        "other",
+			TermsAccepted: true,
+		}
+		if err := database.Users.Create(user); err != nil {
+			return nil, err
+		}
+		ids[i] = user.ID
+	}
+	return ids, nil
+}
+
+func percentile(sorted []time.Duration, p int) time.Duration {
+	return sorted[(len(sorted)-1)*p/100].Round(time.Microsecond)
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "chatbench:", err)
+	os.Exit(1)
+}
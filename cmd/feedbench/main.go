@@ -0,0 +1,170 @@
+// Command feedbench times the feed, topic and profile post lists on a
+// large generated dataset, 100 000 posts by default, in every feed sort. Requests go through
+// the real handlers, so the numbers include every query they make.
+//
+//	go run ./cmd/feedbench -posts 100000 -db /tmp/feedbench.db
+//
+// Generating the data takes a while; with -db the database is kept and
+// reused by the next run as long as it has enough posts.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"realtimeforum/database"
+	"realtimeforum/handler"
+
+	"github.com/google/uuid"
+)
+
+type benchmark struct {
+	name    string
+	url     string
+	handler http.HandlerFunc
+}
+
+func main() {
+	posts := flag.Int("posts", 100000, "posts in the dataset")
+	users := flag.Int("users", 1000, "users in the dataset")
+	comments := flag.Int("comments", 300000, "comments in the dataset")
+	likes := flag.Int("likes", 300000, "post likes in the dataset")
+	runs := flag.Int("runs", 20, "requests per benchmark")
+	path := flag.String("db", "", "database to generate or reuse (default a temporary file)")
+	verbose := flag.Bool("v", false, "keep the handlers' log output")
+	flag.Parse()
+
+	if !*verbose {
+		log.SetOutput(io.Discard)
+	}
+
+	if *path == "" {
+		dir, err := os.MkdirTemp("", "feedbench")
+		if err != nil {
+			fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		*path = filepath.Join(dir, "feedbench.db")
+	}
+
+	db, err := database.InitDatabase(database.SQLite, *path)
+	if err != nil {
+		fatal(err)
+	}
+	readDB, err := database.OpenReadPool(database.SQLite, *path, db)
+	if err != nil {
+		fatal(err)
+	}
+	database.Use(db, readDB)
+	defer database.Close()
+
+	count, err := database.Posts.Count()
+	if err != nil {
+		fatal(err)
+	}
+	if count < *posts {
+		fmt.Printf("Generating %d users, %d posts, %d comments and %d likes...\n", *users, *posts-count, *comments, *likes)
+		began := time.Now()
+		size := database.DemoSize{Users: *users, Posts: *posts - count, Comments: *comments, Likes: *likes}
+		if err := database.GenerateDemoData(db, size, "x", rand.New(rand.NewSource(1))); err != nil {
+			fatal(err)
+		}
+		fmt.Printf("Generated in %s\n", time.Since(began).Round(time.Millisecond))
+		if count, err = database.Posts.Count(); err != nil {
+			fatal(err)
+		}
+	}
+
+	// The busiest topics and author are the worst case of their lists
+	var topicID, nextTopicID int
+	var userID string
+	err = readDB.QueryRow("SELECT topic_id FROM posts_topics GROUP BY topic_id ORDER BY COUNT(*) DESC LIMIT 1").Scan(&topicID)
+	if err == nil {
+		err = readDB.QueryRow("SELECT topic_id FROM posts_topics GROUP BY topic_id ORDER BY COUNT(*) DESC LIMIT 1 OFFSET 1").Scan(&nextTopicID)
+	}
+	if err == nil {
+		err = readDB.QueryRow("SELECT user_id FROM posts GROUP BY user_id ORDER BY COUNT(*) DESC LIMIT 1").Scan(&userID)
+	}
+	if err != nil {
+		fatal(err)
+	}
+
+	token := uuid.New().String()
+	if err := database.Sessions.Create(userID, token, time.Now().Add(time.Hour)); err != nil {
+		fatal(err)
+	}
+	defer database.Sessions.Delete(token)
+
+	// Page 100 is reached by following the cursors once, untimed
+	cursor := ""
+	for page := 1; page < 100; page++ {
+		rec := get(handler.GetFeedHandler, "/api/feed/posts?limit=50&cursor="+cursor, token)
+		var body struct {
+			NextCursor string `json:"next_cursor"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body.NextCursor == "" {
+			fatal(fmt.Errorf("feed page %d: status %d: %s", page, rec.Code, rec.Body.String()))
+		}
+		cursor = body.NextCursor
+	}
+
+	benchmarks := []benchmark{
+		{"feed, first page of 50", "/api/feed/posts?limit=50", handler.GetFeedHandler},
+		{"feed, page 100 of 50", "/api/feed/posts?limit=50&cursor=" + cursor, handler.GetFeedHandler},
+		{"feed, most commented", "/api/feed/posts?limit=50&sort=most_commented", handler.GetFeedHandler},
+		{"feed, most liked", "/api/feed/posts?limit=50&sort=most_liked", handler.GetFeedHandler},
+		{"feed, trending", "/api/feed/posts?limit=50&sort=trending", handler.GetFeedHandler},
+		{"feed, two busiest topics", fmt.Sprintf("/api/feed/posts?limit=50&topics=%d,%d", topicID, nextTopicID), handler.GetFeedHandler},
+		{"busiest topic", fmt.Sprintf("/api/posts/topic/%d?limit=50", topicID), handler.GetPostsByTopicHandler},
+		{"user posts", "/api/user/posts", handler.GetUserPostsHandler},
+	}
+
+	fmt.Printf("%d posts, %d runs each\n\n", count, *runs)
+	fmt.Printf("%-26s %10s %10s %10s %12s\n", "REQUEST", "P50", "P95", "MAX", "RESPONSE")
+	for _, b := range benchmarks {
+		var durations []time.Duration
+		var size int
+		for i := 0; i < *runs; i++ {
+			began := time.Now()
+			rec := get(b.handler, b.url, token)
+			durations = append(durations, time.Since(began))
+
+			if rec.Code != http.StatusOK {
+				fatal(fmt.Errorf("%s: status %d: %s", b.name, rec.Code, rec.Body.String()))
+			}
+			size = rec.Body.Len()
+		}
+
+		sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+		fmt.Printf("%-26s %10s %10s %10s %9d KB\n", b.name,
+			percentile(durations, 50), percentile(durations, 95), durations[len(durations)-1].Round(time.Microsecond), size/1024)
+	}
+}
+
+// get calls h as the user of the session token.
+func get(h http.HandlerFunc, url, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, url, nil)
+	req.AddCookie(&http.Cookie{Name: "session_token", Value: token})
+	rec := httptest.NewRecorder()
+	h(rec, req)
+	return rec
+}
+
+func percentile(sorted []time.Duration, p int) time.Duration {
+	return sorted[(len(sorted)-1)*p/100].Round(time.Microsecond)
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "feedbench:", err)
+	os.Exit(1)
+}
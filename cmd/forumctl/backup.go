@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"path/filepath"
+	"realtimeforum/config"
+	"realtimeforum/database"
+	"sort"
+	"time"
+)
+
+func backup(dir string, args []string) error {
+	fs := flag.NewFlagSet("backup", flag.ContinueOnError)
+	out := fs.String("out", "", "backup file (default <backup dir>/forum-<time>.db)")
+	if _, err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *out == "" {
+		*out = filepath.Join(dir, database.BackupFileName(time.Now()))
+	}
+
+	started := time.Now()
+	if err := database.Backup(context.Background(), database.ReadDB, *out); err != nil {
+		return err
+	}
+	fmt.Printf("Backup written to %s in %s\n", *out, time.Since(started).Round(time.Millisecond))
+	return nil
+}
+
+func export(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	out := fs.String("out", "", "directory of the JSON Lines files (default export-<time>)")
+	if _, err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *out == "" {
+		*out = "export-" + time.Now().UTC().Format("20060102-150405")
+	}
+
+	manifest, err := database.Export(context.Background(), database.ReadDB, *out)
+	if err != nil {
+		return err
+	}
+
+	table := newTable()
+	fmt.Fprintln(table, "TABLE\tROWS")
+	names := make([]string, 0, len(manifest.Tables))
+	for name := range manifest.Tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(table, "%s\t%d\n", name, manifest.Tables[name])
+	}
+	table.Flush()
+	fmt.Printf("Exported schema version %d to %s\n", manifest.SchemaVersion, *out)
+	return nil
+}
+
+// restore runs before the database is opened: the file is replaced.
+func restore(cfg *config.Config, args []string) error {
+	if cfg.DatabaseDriver != "sqlite" {
+		return errors.New("restore needs the sqlite driver; restore PostgreSQL with pg_restore")
+	}
+	target := cfg.DatabasePath
+
+	fs := flag.NewFlagSet("restore", flag.ContinueOnError)
+	from := fs.String("from", "", "backup file to restore (required)")
+	yes := fs.Bool("yes", false, "confirm that the server is stopped")
+	if _, err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *from == "" {
+		return errors.New("-from is required")
+	}
+	if !*yes {
+		return fmt.Errorf("restoring replaces %s; stop the server and pass -yes", target)
+	}
+
+	previous, err := database.Restore(context.Background(), *from, target)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Restored %s from %s\n", target, *from)
+	if previous != "" {
+		fmt.Printf("The previous database was kept as %s\n", previous)
+	}
+	return nil
+}
+
+func verify(args []string) error {
+	if len(args) != 1 {
+		return errors.New("expected a database file")
+	}
+	if err := database.VerifyIntegrity(args[0]); err != nil {
+		return err
+	}
+	fmt.Printf("%s is intact\n", args[0])
+	return nil
+}
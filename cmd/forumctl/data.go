@@ -0,0 +1,104 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"realtimeforum/config"
+	"realtimeforum/database"
+	"realtimeforum/utils"
+	"time"
+)
+
+func migrate(cfg *config.Config, args []string) error {
+	db, err := database.OpenDatabase(database.Dialect(cfg.DatabaseDriver), cfg.DatabaseSource())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	mode := "up"
+	if len(args) > 0 {
+		mode = args[0]
+	}
+
+	switch mode {
+	case "up", "dry-run":
+		dryRun := mode == "dry-run"
+		applied, err := database.Migrate(db, dryRun)
+		for _, migration := range applied {
+			if dryRun {
+				fmt.Printf("Would apply %04d_%s\n", migration.Version, migration.Name)
+			} else {
+				fmt.Printf("Applied %04d_%s\n", migration.Version, migration.Name)
+			}
+		}
+		if err == nil && len(applied) == 0 {
+			fmt.Println("Database is up to date")
+		}
+		return err
+
+	case "status":
+		statuses, err := database.MigrationStatuses(db)
+		if err != nil {
+			return err
+		}
+		table := newTable()
+		fmt.Fprintln(table, "VERSION\tNAME\tAPPLIED")
+		for _, status := range statuses {
+			applied := "pending"
+			if status.AppliedAt != nil {
+				applied = status.AppliedAt.Local().Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(table, "%04d\t%s\t%s\n", status.Version, status.Name, applied)
+		}
+		return table.Flush()
+
+	default:
+		return fmt.Errorf("unknown migrate mode %q, expected status or dry-run", mode)
+	}
+}
+
+func seed(args []string) error {
+	fs := flag.NewFlagSet("seed", flag.ContinueOnError)
+	demo := fs.Bool("demo", false, "insert the fixed demo data of seed.sql")
+	users := fs.Int("users", 0, "generated users")
+	posts := fs.Int("posts", 0, "generated posts")
+	comments := fs.Int("comments", 0, "generated comments")
+	likes := fs.Int("likes", 0, "generated post likes")
+	messages := fs.Int("messages", 0, "generated chat messages")
+	randSeed := fs.Int64("rand-seed", time.Now().UnixNano(), "seed of the generator, for repeatable content")
+	if _, err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	size := database.DemoSize{Users: *users, Posts: *posts, Comments: *comments, Likes: *likes, Messages: *messages}
+	if !*demo && size == (database.DemoSize{}) {
+		*demo = true
+	}
+
+	if *demo {
+		if err := database.Seed(database.DB); err != nil {
+			return err
+		}
+		fmt.Println("Inserted the demo data (password: password123)")
+	}
+
+	if size == (database.DemoSize{}) {
+		return nil
+	}
+
+	// Hashing once keeps large runs fast; every generated user shares it
+	hash, err := utils.HashPassword("password123")
+	if err != nil {
+		return err
+	}
+
+	started := time.Now()
+	if err := database.GenerateDemoData(database.DB, size, hash, rand.New(rand.NewSource(*randSeed))); err != nil {
+		return err
+	}
+	fmt.Printf("Generated %d users, %d posts, %d comments, %d likes and %d messages in %s (password: password123)\n",
+		size.Users, size.Posts, size.Comments, size.Likes, size.Messages, time.Since(started).Round(time.Millisecond))
+	return nil
+}
@@ -0,0 +1,158 @@
+// Command forumctl administers a forum database directly, without the
+// HTTP API. The database is chosen like for the server: -db-driver, -db,
+// -db-url, -config, the DATABASE_* variables or ./mydatabase.db.
+//
+//	go run ./cmd/forumctl [-db file | -db-driver postgres -db-url URL] <command> [arguments]
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"realtimeforum/config"
+	"realtimeforum/database"
+	"text/tabwriter"
+)
+
+const usage = `usage: forumctl [-db file | -db-driver postgres -db-url URL] <command> [arguments]
+
+users list [-admins]
+users create -username NAME -email EMAIL [-password PASS] [-admin] [-first NAME -last NAME -age N -gender G]
+users promote USERNAME          make USERNAME an admin
+users demote USERNAME           make USERNAME a regular user
+users reset-password USERNAME [-password PASS]
+sessions list [-user USERNAME]
+sessions revoke TOKEN | -user USERNAME
+sessions purge                  delete expired sessions
+topics list [-archived]
+topics add NAME EMOJI [-description TEXT]
+topics update ID [-name NAME] [-emoji EMOJI] [-description TEXT] [-position N] [-archived[=false]]
+topics delete ID
+migrate [status | dry-run]
+backup [-out FILE]              online backup into the backup directory, safe while the server runs
+restore -from FILE -yes         replace the database with a verified backup
+verify FILE                     check a backup or database file
+export [-out DIR]               one JSON Lines file per table
+seed [-demo] [-users N] [-posts N] [-comments N] [-likes N] [-messages N] [-rand-seed N]`
+
+type command func(args []string) error
+
+var commands = map[string]map[string]command{
+	"users": {
+		"list":           listUsers,
+		"create":         createUser,
+		"promote":        promoteUser,
+		"demote":         demoteUser,
+		"reset-password": resetPassword,
+	},
+	"sessions": {
+		"list":   listSessions,
+		"revoke": revokeSessions,
+		"purge":  purgeSessions,
+	},
+	"topics": {
+		"list":   listTopics,
+		"add":    addTopic,
+		"update": updateTopic,
+		"delete": deleteTopic,
+	},
+}
+
+// fileCommands get the configuration instead of an open database.
+var fileCommands = map[string]func(cfg *config.Config, args []string) error{
+	"migrate": migrate,
+	"restore": restore,
+	"verify":  func(_ *config.Config, args []string) error { return verify(args) },
+}
+
+func main() {
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		fatal(err)
+	}
+
+	if len(cfg.Command) == 0 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+	name, args := cfg.Command[0], cfg.Command[1:]
+
+	// These work on database files that may not be migrated, or exist, yet
+	if run, ok := fileCommands[name]; ok {
+		if err := run(cfg, args); err != nil {
+			fatal(err)
+		}
+		return
+	}
+
+	dialect := database.Dialect(cfg.DatabaseDriver)
+	db, err := database.OpenDatabase(dialect, cfg.DatabaseSource())
+	if err != nil {
+		fatal(err)
+	}
+	readDB, err := database.OpenReadPool(dialect, cfg.DatabaseSource(), db)
+	if err != nil {
+		db.Close()
+		fatal(err)
+	}
+	database.Use(db, readDB)
+	defer database.Close()
+
+	if pending, err := database.Migrate(db, true); err != nil {
+		fatal(err)
+	} else if len(pending) > 0 {
+		database.Close()
+		fatal(fmt.Errorf("%d pending migrations, run \"forumctl migrate\" first", len(pending)))
+	}
+
+	var run command
+	switch name {
+	case "seed":
+		run = seed
+	case "backup":
+		run = func(args []string) error { return backup(cfg.Backup.Dir, args) }
+	case "export":
+		run = export
+	default:
+		if group, ok := commands[name]; ok && len(args) > 0 {
+			run = group[args[0]]
+			args = args[1:]
+		}
+	}
+	if run == nil {
+		fmt.Fprintln(os.Stderr, usage)
+		database.Close()
+		os.Exit(2)
+	}
+
+	if err := run(args); err != nil {
+		database.Close()
+		fatal(err)
+	}
+}
+
+// parseFlags parses flags wherever they appear among the arguments and
+// returns the positional arguments.
+func parseFlags(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+func newTable() *tabwriter.Writer {
+	return tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "forumctl:", err)
+	os.Exit(1)
+}
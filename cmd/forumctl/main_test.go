@@ -0,0 +1,89 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"realtimeforum/config"
+	"realtimeforum/database"
+	"realtimeforum/database/dbtest"
+	"strings"
+	"testing"
+)
+
+func TestParseFlags(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	admin := fs.Bool("admin", false, "")
+	password := fs.String("password", "", "")
+
+	positional, err := parseFlags(fs, []string{"erin", "-admin", "extra", "-password", "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(positional, " ") != "erin extra" || !*admin || *password != "secret" {
+		t.Errorf("got %v, admin %v, password %q", positional, *admin, *password)
+	}
+	if _, err := parseFlags(fs, []string{"-unknown"}); err == nil {
+		t.Error("an unknown flag was accepted")
+	}
+}
+
+func TestMigrateCommand(t *testing.T) {
+	cfg := config.Default()
+	cfg.DatabasePath = filepath.Join(t.TempDir(), "forum.db")
+
+	for _, args := range [][]string{{"dry-run"}, {"status"}, nil, {"status"}} {
+		if err := migrate(cfg, args); err != nil {
+			t.Fatalf("migrate %v: %v", args, err)
+		}
+	}
+	if err := migrate(cfg, []string{"sideways"}); err == nil {
+		t.Error("an unknown mode was accepted")
+	}
+	if err := database.VerifyIntegrity(cfg.DatabasePath); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestBackupCommands backs the database up, checks and exports it, then
+// restores the backup to a new file.
+func TestBackupCommands(t *testing.T) {
+	dbtest.Open(t, database.SQLite)
+	dir := t.TempDir()
+
+	if err := backup(filepath.Join(dir, "backups"), nil); err != nil {
+		t.Fatal(err)
+	}
+	backups, err := filepath.Glob(filepath.Join(dir, "backups", "forum-*.db"))
+	if err != nil || len(backups) != 1 {
+		t.Fatalf("backups %v, %v", backups, err)
+	}
+	if err := verify(backups); err != nil {
+		t.Error(err)
+	}
+	if err := verify(nil); err == nil {
+		t.Error("verify without a file succeeded")
+	}
+	if err := export([]string{"-out", filepath.Join(dir, "export")}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "export", "manifest.json")); err != nil {
+		t.Error(err)
+	}
+
+	cfg := config.Default()
+	cfg.DatabasePath = filepath.Join(dir, "restored.db")
+	if err := restore(cfg, []string{"-from", backups[0]}); err == nil || !strings.Contains(err.Error(), "-yes") {
+		t.Errorf("restore without -yes: %v", err)
+	}
+	if err := restore(cfg, []string{"-from", backups[0], "-yes"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.VerifyIntegrity(cfg.DatabasePath); err != nil {
+		t.Error(err)
+	}
+	cfg.DatabaseDriver = "postgres"
+	if err := restore(cfg, []string{"-from", backups[0], "-yes"}); err == nil {
+		t.Error("restored with the postgres driver")
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"realtimeforum/database"
+	"time"
+)
+
+func listSessions(args []string) error {
+	fs := flag.NewFlagSet("sessions list", flag.ContinueOnError)
+	user := fs.String("user", "", "only list the sessions of this user")
+	if _, err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	var userID string
+	if *user != "" {
+		var err error
+		if userID, err = lookupUser(*user); err != nil {
+			return err
+		}
+	}
+
+	sessions, err := database.Sessions.List(userID)
+	if err != nil {
+		return err
+	}
+
+	table := newTable()
+	fmt.Fprintln(table, "TOKEN\tUSERNAME\tCREATED\tEXPIRES")
+	for _, s := range sessions {
+		expires := s.Expiry.Local().Format("2006-01-02 15:04")
+		if time.Now().After(s.Expiry) {
+			expires += " (expired)"
+		}
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\n", s.Token, s.Username, s.CreatedAt.Local().Format("2006-01-02 15:04"), expires)
+	}
+	return table.Flush()
+}
+
+func revokeSessions(args []string) error {
+	fs := flag.NewFlagSet("sessions revoke", flag.ContinueOnError)
+	user := fs.String("user", "", "revoke every session of this user")
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case *user != "" && len(positional) == 0:
+		userID, err := lookupUser(*user)
+		if err != nil {
+			return err
+		}
+		count, err := database.Sessions.DeleteForUser(userID)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Revoked %d sessions of %s\n", count, *user)
+
+	case *user == "" && len(positional) == 1:
+		found, err := database.Sessions.Delete(positional[0])
+		if err != nil {
+			return err
+		}
+		if !found {
+			return errors.New("no such session")
+		}
+		fmt.Println("Session revoked")
+
+	default:
+		return errors.New("expected a session token or -user USERNAME")
+	}
+	return nil
+}
+
+func purgeSessions(args []string) error {
+	count, err := database.Sessions.DeleteExpired()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Deleted %d expired sessions\n", count)
+	return nil
+}
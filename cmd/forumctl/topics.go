@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"realtimeforum/database"
+	"strconv"
+)
+
+func listTopics(args []string) error {
+	fs := flag.NewFlagSet("topics list", flag.ContinueOnError)
+	archived := fs.Bool("archived", false, "include archived topics")
+	if _, err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	topics, err := database.Topics.List(*archived)
+	if err != nil {
+		return err
+	}
+
+	table := newTable()
+	fmt.Fprintln(table, "ID\tPOS\tEMOJI\tNAME\tPOSTS\tLAST ACTIVITY\tARCHIVED")
+	for _, t := range topics {
+		last := "-"
+		if !t.LastActivity.IsZero() {
+			last = t.LastActivity.Local().Format("2006-01-02 15:04")
+		}
+		fmt.Fprintf(table, "%d\t%d\t%s\t%s\t%d\t%s\t%t\n", t.ID, t.Position, t.Emoji, t.Name, t.PostCount, last, t.Archived)
+	}
+	return table.Flush()
+}
+
+func addTopic(args []string) error {
+	fs := flag.NewFlagSet("topics add", flag.ContinueOnError)
+	description := fs.String("description", "", "what the topic is about")
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 2 {
+		return errors.New("expected a name and an emoji")
+	}
+	id, err := database.Topics.Create(positional[0], positional[1], *description)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Created topic %d\n", id)
+	return nil
+}
+
+func updateTopic(args []string) error {
+	fs := flag.NewFlagSet("topics update", flag.ContinueOnError)
+	name := fs.String("name", "", "new name")
+	emoji := fs.String("emoji", "", "new emoji")
+	description := fs.String("description", "", "new description, empty to remove it")
+	position := fs.Int("position", 0, "place in the topic list, lowest first")
+	archived := fs.Bool("archived", false, "archive the topic, -archived=false to reopen it")
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return errors.New("expected a topic ID")
+	}
+	id, err := strconv.Atoi(positional[0])
+	if err != nil {
+		return fmt.Errorf("invalid topic ID %q", positional[0])
+	}
+
+	// Only the flags given are changed
+	var changes database.TopicChanges
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "name":
+			changes.Name = name
+		case "emoji":
+			changes.Emoji = emoji
+		case "description":
+			changes.Description = description
+		case "position":
+			changes.Position = position
+		case "archived":
+			changes.Archived = archived
+		}
+	})
+	if changes == (database.TopicChanges{}) {
+		return errors.New("nothing to change, use -name, -emoji, -description, -position or -archived")
+	}
+
+	if err := database.Topics.Update(id, changes); err != nil {
+		return err
+	}
+	fmt.Printf("Updated topic %d\n", id)
+	return nil
+}
+
+func deleteTopic(args []string) error {
+	if len(args) != 1 {
+		return errors.New("expected a topic ID")
+	}
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid topic ID %q", args[0])
+	}
+	if err := database.Topics.Delete(id); err != nil {
+		return err
+	}
+	fmt.Printf("Deleted topic %d\n", id)
+	return nil
+}
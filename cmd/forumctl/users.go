@@ -0,0 +1,143 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"realtimeforum/auth"
+	"realtimeforum/database"
+)
+
+func listUsers(args []string) error {
+	fs := flag.NewFlagSet("users list", flag.ContinueOnError)
+	adminsOnly := fs.Bool("admins", false, "only list admins")
+	if _, err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	users, err := database.Users.List(*adminsOnly)
+	if err != nil {
+		return err
+	}
+
+	table := newTable()
+	fmt.Fprintln(table, "USERNAME\tEMAIL\tROLE\tCREATED\tPOSTS\tSESSIONS")
+	for _, u := range users {
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%d\t%d\n", u.Username, u.Email, u.Role,
+			u.CreatedAt.Local().Format("2006-01-02 15:04"), u.Posts, u.Sessions)
+	}
+	return table.Flush()
+}
+
+func createUser(args []string) error {
+	fs := flag.NewFlagSet("users create", flag.ContinueOnError)
+	username := fs.String("username", "", "username (required)")
+	email := fs.String("email", "", "email (required)")
+	password := fs.String("password", "", "password, generated when empty")
+	firstName := fs.String("first", "Forum", "first name")
+	lastName := fs.String("last", "User", "last name")
+	age := fs.Int("age", 30, "age")
+	gender := fs.String("gender", "other", "male, female or other")
+	admin := fs.Bool("admin", false, "create an admin")
+	if _, err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *username == "" || *email == "" {
+		return errors.New("-username and -email are required")
+	}
+
+	generated := *password == ""
+	if generated {
+		*password = randomPassword()
+	}
+
+	role := auth.RoleUser
+	if *admin {
+		role = auth.RoleAdmin
+	}
+
+	id, err := auth.CreateUser(*username, *email, *password, *firstName, *lastName, *age, *gender, role)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Created %s %s (%s)\n", role, *username, id)
+	if generated {
+		fmt.Printf("Password: %s\n", *password)
+	}
+	return nil
+}
+
+func promoteUser(args []string) error {
+	return setRole(args, auth.RoleAdmin)
+}
+
+func demoteUser(args []string) error {
+	return setRole(args, auth.RoleUser)
+}
+
+func setRole(args []string, role string) error {
+	if len(args) != 1 {
+		return errors.New("expected a username")
+	}
+	userID, err := lookupUser(args[0])
+	if err != nil {
+		return err
+	}
+	if err := auth.SetUserRole(userID, role); err != nil {
+		return err
+	}
+	fmt.Printf("Role of %s is now %s\n", args[0], role)
+	return nil
+}
+
+func resetPassword(args []string) error {
+	fs := flag.NewFlagSet("users reset-password", flag.ContinueOnError)
+	password := fs.String("password", "", "new password, generated when empty")
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return errors.New("expected a username")
+	}
+
+	userID, err := lookupUser(positional[0])
+	if err != nil {
+		return err
+	}
+
+	generated := *password == ""
+	if generated {
+		*password = randomPassword()
+	}
+	if err := auth.ResetPassword(userID, *password); err != nil {
+		return err
+	}
+
+	fmt.Printf("Password of %s reset, all sessions revoked\n", positional[0])
+	if generated {
+		fmt.Printf("Password: %s\n", *password)
+	}
+	return nil
+}
+
+// lookupUser returns the ID of the user with this username or email.
+func lookupUser(identity string) (string, error) {
+	userID, err := database.Users.IDByIdentity(identity)
+	if err != nil {
+		return "", err
+	}
+	if userID == "" {
+		return "", fmt.Errorf("no user %q", identity)
+	}
+	return userID, nil
+}
+
+func randomPassword() string {
+	buf := make([]byte, 12)
+	rand.Read(buf)
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
@@ -0,0 +1,239 @@
+// Command hubload opens hundreds of simultaneous WebSocket connections
+// against the real chat handler and hub, and reports how long each
+// client waits for its welcome messages and how long the database takes
+// to show everyone online.
+//
+//	go run ./cmd/hubload -clients 500
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"realtimeforum/database"
+	"realtimeforum/handler"
+	"realtimeforum/websocket"
+
+	"github.com/google/uuid"
+	gorilla "github.com/gorilla/websocket"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+type result struct {
+	welcome time.Duration // dial until the "sync" event arrived
+	err     error
+}
+
+func main() {
+	clients := flag.Int("clients", 500, "number of simultaneous connections")
+	timeout := flag.Duration("timeout", 30*time.Second, "give up waiting after this long")
+	verbose := flag.Bool("v", false, "keep the server's log output")
+	flag.Parse()
+
+	if !*verbose {
+		log.SetOutput(io.Discard)
+	}
+
+	dir, err := os.MkdirTemp("", "hubload")
+	if err != nil {
+		fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "hubload.db")
+	db, err := database.OpenDatabase(database.SQLite, path)
+	if err != nil {
+		fatal(err)
+	}
+	if _, err := database.Migrate(db, false); err != nil {
+		fatal(err)
+	}
+	readDB, err := database.OpenReadPool(database.SQLite, path, db)
+	if err != nil {
+		fatal(err)
+	}
+	database.Use(db, readDB)
+	defer database.Close()
+
+	tokens, err := createUsers(db, *clients)
+	if err != nil {
+		fatal(err)
+	}
+
+	hub := websocket.NewHub(websocket.DefaultHubConfig())
+	hub.Start()
+	chat := handler.NewChat(hub, handler.ChatThrottle{})
+	server := httptest.NewServer(http.HandlerFunc(chat.WebSocketHandler))
+	defer server.Close()
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	fmt.Printf("Connecting %d clients at once...\n", *clients)
+
+	var (
+		start    = make(chan struct{})
+		results  = make([]result, *clients)
+		received atomic.Int64
+		welcomed sync.WaitGroup
+		conns    = make([]*gorilla.Conn, *clients)
+	)
+	welcomed.Add(*clients)
+
+	for i, token := range tokens {
+		go func(i int, token string) {
+			<-start
+			header := http.Header{}
+			header.Set("Cookie", "session_token="+token)
+
+			began := time.Now()
+			conn, _, err := gorilla.DefaultDialer.Dial(wsURL, header)
+			if err != nil {
+				results[i].err = err
+				welcomed.Done()
+				return
+			}
+			conns[i] = conn
+
+			done := false
+			for {
+				_, data, err := conn.ReadMessage()
+				if err != nil {
+					if !done {
+						results[i].err = err
+						welcomed.Done()
+					}
+					return
+				}
+				received.Add(1)
+
+				var message struct {
+					Type string `json:"type"`
+				}
+				json.Unmarshal(data, &message)
+				if message.Type == "sync" && !done {
+					done = true
+					results[i].welcome = time.Since(began)
+					welcomed.Done()
+				}
+			}
+		}(i, token)
+	}
+
+	began := time.Now()
+	close(start)
+
+	if !waitTimeout(&welcomed, *timeout) {
+		fatal(fmt.Errorf("not every client was welcomed within %s", *timeout))
+	}
+	allWelcomed := time.Since(began)
+
+	// The presence writer runs behind the hub loop; wait for it to catch up
+	var online int
+	for time.Since(began) < *timeout {
+		readDB.QueryRow("SELECT COUNT(*) FROM user_online WHERE is_online = 1").Scan(&online)
+		if online == *clients {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	allOnline := time.Since(began)
+
+	// Give the last presence deltas a moment to arrive
+	time.Sleep(500 * time.Millisecond)
+
+	var latencies []time.Duration
+	failures := 0
+	for _, r := range results {
+		if r.err != nil {
+			failures++
+			continue
+		}
+		latencies = append(latencies, r.welcome)
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+
+	fmt.Printf("clients welcomed:      %d/%d in %s\n", len(latencies), *clients, allWelcomed.Round(time.Millisecond))
+	fmt.Printf("marked online in DB:   %d/%d in %s\n", online, *clients, allOnline.Round(time.Millisecond))
+	if len(latencies) > 0 {
+		fmt.Printf("welcome latency:       p50 %s  p95 %s  max %s\n",
+			percentile(latencies, 50), percentile(latencies, 95), latencies[len(latencies)-1].Round(time.Millisecond))
+	}
+	fmt.Printf("messages received:     %d\n", received.Load())
+	fmt.Printf("failed connections:    %d\n", failures)
+
+	for _, conn := range conns {
+		if conn != nil {
+			conn.Close()
+		}
+	}
+
+	if failures > 0 || online != *clients {
+		os.Exit(1)
+	}
+}
+
+// createUsers inserts n users with a valid session each and returns the
+// session tokens.
+func createUsers(db *sql.DB, n int) ([]string, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	expiry := time.Now().Add(time.Hour)
+	tokens := make([]string, n)
+	for i := range tokens {
+		id := uuid.New().String()
+		_, err := tx.Exec(`
+			INSERT INTO users (id, username, email, password_hash, first_name, last_name, age, gender, terms_accepted)
+			VALUES (?, ?, ?, 'x', 'Load', 'Test', 30, 'other', 1)`,
+			id, fmt.Sprintf("load_%d", i), fmt.Sprintf("load_%d@example.com", i))
+		if err != nil {
+			return nil, err
+		}
+
+		tokens[i] = uuid.New().String()
+		_, err = tx.Exec("INSERT INTO sessions (user_id, session_token, session_expiry) VALUES (?, ?, ?)",
+			id, tokens[i], expiry)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return tokens, tx.Commit()
+}
+
+func waitTimeout(wg *sync.WaitGroup, timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+func percentile(sorted []time.Duration, p int) time.Duration {
+	return sorted[(len(sorted)-1)*p/100].Round(time.Millisecond)
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "hubload:", err)
+	os.Exit(1)
+}
@@ -0,0 +1,492 @@
+// config/config.go
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds every setting the server reads at startup. Values come
+// from the defaults below, then the optional JSON file, then environment
+// variables, then command-line flags; each source overrides the previous.
+type Config struct {
+	ListenAddr      string   `json:"listen_addr"`
+	DatabaseDriver  string   `json:"database_driver"`
+	DatabasePath    string   `json:"database_path"`
+	DatabaseURL     string   `json:"database_url"`
+	SessionLifetime Duration `json:"session_lifetime"`
+	Throttle        Throttle `json:"throttle"`
+	AllowedOrigins  []string `json:"allowed_origins"`
+	LogLevel        string   `json:"log_level"`
+	TLS             TLS      `json:"tls"`
+	BrokerURL       string   `json:"broker_url"`
+	ShutdownTimeout Duration `json:"shutdown_timeout"`
+	Backup          Backup   `json:"backup"`
+	Uploads         Uploads  `json:"uploads"`
+	Mail            Mail     `json:"mail"`
+
+	// Slow consumer policy of WebSocket clients
+	SendBufferSize     int `json:"send_buffer_size"`
+	MaxPendingMessages int `json:"max_pending_messages"`
+
+	// Command is what follows the flags on the command line, e.g.
+	// ["migrate", "status"]; empty means run the server.
+	Command []string `json:"-"`
+}
+
+// Throttle is the minimum time between two requests of the same user.
+type Throttle struct {
+	Messages Duration `json:"messages"`
+	UserList Duration `json:"user_list"`
+}
+
+// Backup schedules online backups of the database; an Interval of zero
+// disables them.
+type Backup struct {
+	Dir      string   `json:"dir"`
+	Interval Duration `json:"interval"`
+	Keep     int      `json:"keep"`
+}
+
+// Uploads says where attachments are stored, "local" files under Dir or
+// an "s3" bucket, and how large they may be in bytes.
+type Uploads struct {
+	Store   string `json:"store"`
+	Dir     string `json:"dir"`
+	MaxSize int    `json:"max_size"`
+	S3      S3     `json:"s3"`
+}
+
+// S3 is a bucket of an S3-compatible service such as AWS or MinIO.
+type S3 struct {
+	Endpoint  string `json:"endpoint"`
+	Bucket    string `json:"bucket"`
+	Region    string `json:"region"`
+	AccessKey string `json:"access_key"`
+	SecretKey string `json:"secret_key"`
+}
+
+// Mail is the SMTP server that sends the confirmations of new emails.
+// Without a Host the forum sends no mail and emails cannot be changed.
+type Mail struct {
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	From     string `json:"from"`
+}
+
+// DatabaseSource is what the driver connects to: the SQLite file, or the
+// PostgreSQL connection URL.
+func (c *Config) DatabaseSource() string {
+	if c.DatabaseDriver == "postgres" {
+		return c.DatabaseURL
+	}
+	return c.DatabasePath
+}
+
+// TLS enables HTTPS when both files are set.
+type TLS struct {
+	CertFile string `json:"cert_file"`
+	KeyFile  string `json:"key_file"`
+}
+
+// Enabled reports whether the server should serve HTTPS.
+func (t TLS) Enabled() bool {
+	return t.CertFile != "" && t.KeyFile != ""
+}
+
+// Duration is a time.Duration written as "24h" or "500ms" in the file.
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return fmt.Errorf("duration must be a string like \"24h\": %w", err)
+	}
+	parsed, err := time.ParseDuration(text)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// Default returns the settings used when nothing else is given.
+func Default() *Config {
+	return &Config{
+		ListenAddr:      ":8080",
+		DatabaseDriver:  "sqlite",
+		DatabasePath:    "./mydatabase.db",
+		SessionLifetime: Duration(24 * time.Hour),
+		Throttle: Throttle{
+			Messages: Duration(500 * time.Millisecond),
+			UserList: Duration(200 * time.Millisecond),
+		},
+		LogLevel:           "info",
+		ShutdownTimeout:    Duration(15 * time.Second),
+		Backup:             Backup{Dir: "./backups", Keep: 7},
+		Uploads:            Uploads{Store: "local", Dir: "./uploads", MaxSize: 10 << 20, S3: S3{Region: "us-east-1"}},
+		Mail:               Mail{Port: 587},
+		SendBufferSize:     256,
+		MaxPendingMessages: 1024,
+	}
+}
+
+// Load builds the configuration from the command-line arguments (without
+// the program name) and the environment, and validates it.
+func Load(args []string) (*Config, error) {
+	cfg := Default()
+
+	fs := flag.NewFlagSet("realtimeforum", flag.ContinueOnError)
+	configFile := fs.String("config", os.Getenv("CONFIG_FILE"), "optional JSON configuration file")
+	listenAddr := fs.String("addr", "", "address to listen on, e.g. :8080 (env LISTEN_ADDR, or PORT)")
+	databaseDriver := fs.String("db-driver", "", "sqlite or postgres (env DATABASE_DRIVER)")
+	databasePath := fs.String("db", "", "SQLite database file (env DATABASE_PATH)")
+	databaseURL := fs.String("db-url", "", "PostgreSQL connection URL, e.g. postgres://forum@localhost/forum (env DATABASE_URL)")
+	sessionLifetime := fs.Duration("session-lifetime", 0, "how long a login stays valid (env SESSION_LIFETIME)")
+	messageThrottle := fs.Duration("throttle-messages", 0, "minimum time between chat history requests (env THROTTLE_MESSAGES)")
+	userListThrottle := fs.Duration("throttle-user-list", 0, "minimum time between user list requests (env THROTTLE_USER_LIST)")
+	origins := fs.String("allowed-origins", "", "comma-separated origins allowed to open WebSockets (env ALLOWED_ORIGINS)")
+	logLevel := fs.String("log-level", "", "debug, info, warn or error (env LOG_LEVEL)")
+	certFile := fs.String("tls-cert", "", "TLS certificate file (env TLS_CERT_FILE)")
+	keyFile := fs.String("tls-key", "", "TLS private key file (env TLS_KEY_FILE)")
+	brokerURL := fs.String("broker-url", "", "Redis URL shared by several instances (env BROKER_URL)")
+	shutdownTimeout := fs.Duration("shutdown-timeout", 0, "how long to wait for requests and connections to finish on exit (env SHUTDOWN_TIMEOUT)")
+	sendBufferSize := fs.Int("ws-send-buffer", 0, "WebSocket messages a client may have waiting before stale events are dropped (env WS_SEND_BUFFER)")
+	maxPendingMessages := fs.Int("ws-max-pending", 0, "WebSocket messages a client may have waiting before it is disconnected (env WS_MAX_PENDING)")
+	backupDir := fs.String("backup-dir", "", "directory of scheduled backups (env BACKUP_DIR)")
+	backupInterval := fs.Duration("backup-interval", 0, "time between scheduled backups, 0 disables them (env BACKUP_INTERVAL)")
+	backupKeep := fs.Int("backup-keep", 0, "number of scheduled backups to keep (env BACKUP_KEEP)")
+	uploadStore := fs.String("upload-store", "", "local or s3 (env UPLOAD_STORE)")
+	uploadDir := fs.String("upload-dir", "", "directory of uploads with the local store (env UPLOAD_DIR)")
+	uploadMaxSize := fs.Int("upload-max-size", 0, "largest upload in bytes (env UPLOAD_MAX_SIZE)")
+	s3Endpoint := fs.String("s3-endpoint", "", "S3-compatible endpoint, e.g. http://localhost:9000 (env S3_ENDPOINT); keys come from S3_ACCESS_KEY and S3_SECRET_KEY")
+	s3Bucket := fs.String("s3-bucket", "", "bucket of uploads (env S3_BUCKET)")
+	s3Region := fs.String("s3-region", "", "region of the bucket (env S3_REGION)")
+	smtpHost := fs.String("smtp-host", "", "SMTP server sending email confirmations, none turns email changes off (env SMTP_HOST); login from SMTP_USERNAME and SMTP_PASSWORD")
+	smtpPort := fs.Int("smtp-port", 0, "port of the SMTP server (env SMTP_PORT)")
+	mailFrom := fs.String("mail-from", "", "sender of the forum's emails, e.g. forum@example.com (env MAIL_FROM)")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if *configFile != "" {
+		if err := cfg.loadFile(*configFile); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := cfg.loadEnv(); err != nil {
+		return nil, err
+	}
+
+	// Only flags given explicitly override the other sources
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "addr":
+			cfg.ListenAddr = *listenAddr
+		case "db-driver":
+			cfg.DatabaseDriver = *databaseDriver
+		case "db":
+			cfg.DatabasePath = *databasePath
+		case "db-url":
+			cfg.DatabaseURL = *databaseURL
+		case "session-lifetime":
+			cfg.SessionLifetime = Duration(*sessionLifetime)
+		case "throttle-messages":
+			cfg.Throttle.Messages = Duration(*messageThrottle)
+		case "throttle-user-list":
+			cfg.Throttle.UserList = Duration(*userListThrottle)
+		case "allowed-origins":
+			cfg.AllowedOrigins = splitList(*origins)
+		case "log-level":
+			cfg.LogLevel = *logLevel
+		case "tls-cert":
+			cfg.TLS.CertFile = *certFile
+		case "tls-key":
+			cfg.TLS.KeyFile = *keyFile
+		case "broker-url":
+			cfg.BrokerURL = *brokerURL
+		case "shutdown-timeout":
+			cfg.ShutdownTimeout = Duration(*shutdownTimeout)
+		case "ws-send-buffer":
+			cfg.SendBufferSize = *sendBufferSize
+		case "ws-max-pending":
+			cfg.MaxPendingMessages = *maxPendingMessages
+		case "backup-dir":
+			cfg.Backup.Dir = *backupDir
+		case "backup-interval":
+			cfg.Backup.Interval = Duration(*backupInterval)
+		case "backup-keep":
+			cfg.Backup.Keep = *backupKeep
+		case "upload-store":
+			cfg.Uploads.Store = *uploadStore
+		case "upload-dir":
+			cfg.Uploads.Dir = *uploadDir
+		case "upload-max-size":
+			cfg.Uploads.MaxSize = *uploadMaxSize
+		case "s3-endpoint":
+			cfg.Uploads.S3.Endpoint = *s3Endpoint
+		case "s3-bucket":
+			cfg.Uploads.S3.Bucket = *s3Bucket
+		case "s3-region":
+			cfg.Uploads.S3.Region = *s3Region
+		case "smtp-host":
+			cfg.Mail.Host = *smtpHost
+		case "smtp-port":
+			cfg.Mail.Port = *smtpPort
+		case "mail-from":
+			cfg.Mail.From = *mailFrom
+		}
+	})
+
+	cfg.Command = fs.Args()
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config file: %w", err)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(c); err != nil {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+	return nil
+}
+
+func (c *Config) loadEnv() error {
+	// PORT is what most hosting platforms (and docker-compose.yml) set
+	if port := os.Getenv("PORT"); port != "" {
+		c.ListenAddr = ":" + port
+	}
+	setString(&c.ListenAddr, "LISTEN_ADDR")
+	setString(&c.DatabaseDriver, "DATABASE_DRIVER")
+	setString(&c.DatabasePath, "DATABASE_PATH")
+	setString(&c.DatabaseURL, "DATABASE_URL")
+	setString(&c.LogLevel, "LOG_LEVEL")
+	setString(&c.TLS.CertFile, "TLS_CERT_FILE")
+	setString(&c.TLS.KeyFile, "TLS_KEY_FILE")
+	setString(&c.BrokerURL, "BROKER_URL")
+	setString(&c.Backup.Dir, "BACKUP_DIR")
+	setString(&c.Uploads.Store, "UPLOAD_STORE")
+	setString(&c.Uploads.Dir, "UPLOAD_DIR")
+	setString(&c.Uploads.S3.Endpoint, "S3_ENDPOINT")
+	setString(&c.Uploads.S3.Bucket, "S3_BUCKET")
+	setString(&c.Uploads.S3.Region, "S3_REGION")
+	setString(&c.Uploads.S3.AccessKey, "S3_ACCESS_KEY")
+	setString(&c.Uploads.S3.SecretKey, "S3_SECRET_KEY")
+	setString(&c.Mail.Host, "SMTP_HOST")
+	setString(&c.Mail.Username, "SMTP_USERNAME")
+	setString(&c.Mail.Password, "SMTP_PASSWORD")
+	setString(&c.Mail.From, "MAIL_FROM")
+	if origins := os.Getenv("ALLOWED_ORIGINS"); origins != "" {
+		c.AllowedOrigins = splitList(origins)
+	}
+
+	var errs []error
+	errs = append(errs, setDuration(&c.SessionLifetime, "SESSION_LIFETIME"))
+	errs = append(errs, setDuration(&c.Throttle.Messages, "THROTTLE_MESSAGES"))
+	errs = append(errs, setDuration(&c.Throttle.UserList, "THROTTLE_USER_LIST"))
+	errs = append(errs, setDuration(&c.ShutdownTimeout, "SHUTDOWN_TIMEOUT"))
+	errs = append(errs, setDuration(&c.Backup.Interval, "BACKUP_INTERVAL"))
+	errs = append(errs, setInt(&c.Backup.Keep, "BACKUP_KEEP"))
+	errs = append(errs, setInt(&c.SendBufferSize, "WS_SEND_BUFFER"))
+	errs = append(errs, setInt(&c.MaxPendingMessages, "WS_MAX_PENDING"))
+	errs = append(errs, setInt(&c.Uploads.MaxSize, "UPLOAD_MAX_SIZE"))
+	errs = append(errs, setInt(&c.Mail.Port, "SMTP_PORT"))
+	return errors.Join(errs...)
+}
+
+// Validate reports every invalid setting at once.
+func (c *Config) Validate() error {
+	var errs []error
+	invalid := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if _, port, err := net.SplitHostPort(c.ListenAddr); err != nil {
+		invalid("listen address %q must look like host:port or :port", c.ListenAddr)
+	} else if n, err := strconv.Atoi(port); err != nil || n < 0 || n > 65535 {
+		invalid("listen address %q has an invalid port", c.ListenAddr)
+	}
+
+	switch c.DatabaseDriver {
+	case "sqlite":
+		if strings.TrimSpace(c.DatabasePath) == "" {
+			invalid("database path must not be empty")
+		}
+	case "postgres":
+		if u, err := url.Parse(c.DatabaseURL); err != nil || (u.Scheme != "postgres" && u.Scheme != "postgresql") {
+			invalid("database URL must start with postgres:// when the driver is postgres")
+		}
+		if c.Backup.Interval > 0 {
+			invalid("scheduled backups need the sqlite driver; back up PostgreSQL with pg_dump")
+		}
+	default:
+		invalid("database driver %q must be sqlite or postgres", c.DatabaseDriver)
+	}
+
+	if c.SessionLifetime < Duration(time.Minute) {
+		invalid("session lifetime %s is too short (minimum 1m)", time.Duration(c.SessionLifetime))
+	}
+	if c.Throttle.Messages < 0 || c.Throttle.UserList < 0 {
+		invalid("throttle intervals must not be negative")
+	}
+	if c.ShutdownTimeout <= 0 {
+		invalid("shutdown timeout must be positive")
+	}
+	if c.Backup.Interval < 0 {
+		invalid("backup interval must not be negative")
+	} else if c.Backup.Interval > 0 {
+		if c.Backup.Interval < Duration(time.Minute) {
+			invalid("backup interval %s is too short (minimum 1m)", time.Duration(c.Backup.Interval))
+		}
+		if strings.TrimSpace(c.Backup.Dir) == "" {
+			invalid("scheduled backups need a backup directory")
+		}
+		if c.Backup.Keep < 1 {
+			invalid("scheduled backups must keep at least one backup")
+		}
+	}
+
+	for _, origin := range c.AllowedOrigins {
+		if origin == "*" {
+			continue
+		}
+		u, err := url.Parse(origin)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || (u.Path != "" && u.Path != "/") {
+			invalid("allowed origin %q must look like https://example.com", origin)
+		}
+	}
+
+	if _, ok := logLevels[c.LogLevel]; !ok {
+		invalid("log level %q must be one of debug, info, warn, error", c.LogLevel)
+	}
+
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		invalid("TLS needs both a certificate and a key file")
+	}
+	for _, file := range []string{c.TLS.CertFile, c.TLS.KeyFile} {
+		if file == "" {
+			continue
+		}
+		if _, err := os.Stat(file); err != nil {
+			invalid("TLS file: %v", err)
+		}
+	}
+
+	if c.BrokerURL != "" {
+		if u, err := url.Parse(c.BrokerURL); err != nil || (u.Scheme != "redis" && u.Scheme != "rediss") {
+			invalid("broker URL %q must start with redis:// or rediss://", c.BrokerURL)
+		}
+	}
+
+	switch c.Uploads.Store {
+	case "local":
+		if strings.TrimSpace(c.Uploads.Dir) == "" {
+			invalid("the local upload store needs a directory")
+		}
+	case "s3":
+		if u, err := url.Parse(c.Uploads.S3.Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			invalid("S3 endpoint %q must look like https://s3.example.com", c.Uploads.S3.Endpoint)
+		}
+		if c.Uploads.S3.Bucket == "" {
+			invalid("the s3 upload store needs a bucket")
+		}
+		if c.Uploads.S3.AccessKey == "" || c.Uploads.S3.SecretKey == "" {
+			invalid("the s3 upload store needs S3_ACCESS_KEY and S3_SECRET_KEY")
+		}
+	default:
+		invalid("upload store %q must be local or s3", c.Uploads.Store)
+	}
+	if c.Uploads.MaxSize < 1<<10 || c.Uploads.MaxSize > 1<<30 {
+		invalid("upload max size %d must be between 1 KB and 1 GB", c.Uploads.MaxSize)
+	}
+
+	if c.Mail.Host != "" {
+		if c.Mail.Port < 1 || c.Mail.Port > 65535 {
+			invalid("SMTP port %d must be between 1 and 65535", c.Mail.Port)
+		}
+		if _, err := mail.ParseAddress(c.Mail.From); err != nil {
+			invalid("sending mail needs a sender address like forum@example.com, %q is not one", c.Mail.From)
+		}
+	}
+
+	if c.SendBufferSize < 1 {
+		invalid("send buffer size must be at least 1")
+	}
+	if c.MaxPendingMessages < c.SendBufferSize {
+		invalid("max pending messages (%d) must not be lower than the send buffer size (%d)",
+			c.MaxPendingMessages, c.SendBufferSize)
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration:\n%w", errors.Join(errs...))
+	}
+	return nil
+}
+
+func setString(target *string, name string) {
+	if value := os.Getenv(name); value != "" {
+		*target = value
+	}
+}
+
+func setDuration(target *Duration, name string) error {
+	value := os.Getenv(name)
+	if value == "" {
+		return nil
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return fmt.Errorf("%s: %q is not a duration like 24h or 500ms", name, value)
+	}
+	*target = Duration(parsed)
+	return nil
+}
+
+func setInt(target *int, name string) error {
+	value := os.Getenv(name)
+	if value == "" {
+		return nil
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		return fmt.Errorf("%s: %q is not a number", name, value)
+	}
+	*target = parsed
+	return nil
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
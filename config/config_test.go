@@ -0,0 +1,252 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"realtimeforum/config"
+)
+
+// environment lists every variable Load reads.
+var environment = []string{
+	"CONFIG_FILE", "PORT", "LISTEN_ADDR", "DATABASE_DRIVER", "DATABASE_PATH", "DATABASE_URL",
+	"SESSION_LIFETIME", "THROTTLE_MESSAGES", "THROTTLE_USER_LIST", "ALLOWED_ORIGINS", "LOG_LEVEL",
+	"TLS_CERT_FILE", "TLS_KEY_FILE", "BROKER_URL", "SHUTDOWN_TIMEOUT", "WS_SEND_BUFFER", "WS_MAX_PENDING",
+	"BACKUP_DIR", "BACKUP_INTERVAL", "BACKUP_KEEP", "UPLOAD_STORE", "UPLOAD_DIR", "UPLOAD_MAX_SIZE",
+	"S3_ENDPOINT", "S3_BUCKET", "S3_REGION", "S3_ACCESS_KEY", "S3_SECRET_KEY",
+	"SMTP_HOST", "SMTP_PORT", "SMTP_USERNAME", "SMTP_PASSWORD", "MAIL_FROM",
+}
+
+// load runs Load with only the given file, environment and arguments.
+func load(t *testing.T, file string, env map[string]string, args ...string) (*config.Config, error) {
+	t.Helper()
+	for _, name := range environment {
+		t.Setenv(name, env[name])
+	}
+	if file != "" {
+		path := filepath.Join(t.TempDir(), "config.json")
+		if err := os.WriteFile(path, []byte(file), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		args = append([]string{"-config", path}, args...)
+	}
+	return config.Load(args)
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		file string
+		env  map[string]string
+		args []string
+		got  func(*config.Config) interface{}
+		want interface{}
+	}{
+		{
+			name: "default",
+			got:  func(c *config.Config) interface{} { return c.ListenAddr },
+			want: ":8080",
+		},
+		{
+			name: "file over default",
+			file: `{"listen_addr": ":9000"}`,
+			got:  func(c *config.Config) interface{} { return c.ListenAddr },
+			want: ":9000",
+		},
+		{
+			name: "environment over file",
+			file: `{"listen_addr": ":9000"}`,
+			env:  map[string]string{"LISTEN_ADDR": ":9100"},
+			got:  func(c *config.Config) interface{} { return c.ListenAddr },
+			want: ":9100",
+		},
+		{
+			name: "PORT",
+			env:  map[string]string{"PORT": "3000"},
+			got:  func(c *config.Config) interface{} { return c.ListenAddr },
+			want: ":3000",
+		},
+		{
+			name: "LISTEN_ADDR over PORT",
+			env:  map[string]string{"PORT": "3000", "LISTEN_ADDR": ":9100"},
+			got:  func(c *config.Config) interface{} { return c.ListenAddr },
+			want: ":9100",
+		},
+		{
+			name: "flag over environment",
+			file: `{"listen_addr": ":9000"}`,
+			env:  map[string]string{"LISTEN_ADDR": ":9100"},
+			args: []string{"-addr", ":9200"},
+			got:  func(c *config.Config) interface{} { return c.ListenAddr },
+			want: ":9200",
+		},
+		{
+			name: "flag set to the default",
+			env:  map[string]string{"LISTEN_ADDR": ":9100"},
+			args: []string{"-addr", ":8080"},
+			got:  func(c *config.Config) interface{} { return c.ListenAddr },
+			want: ":8080",
+		},
+		{
+			name: "file duration",
+			file: `{"session_lifetime": "2h", "throttle": {"messages": "1s"}}`,
+			got: func(c *config.Config) interface{} {
+				return time.Duration(c.SessionLifetime) + time.Duration(c.Throttle.Messages)
+			},
+			want: 2*time.Hour + time.Second,
+		},
+		{
+			name: "environment duration",
+			file: `{"session_lifetime": "2h"}`,
+			env:  map[string]string{"SESSION_LIFETIME": "90m"},
+			got:  func(c *config.Config) interface{} { return time.Duration(c.SessionLifetime) },
+			want: 90 * time.Minute,
+		},
+		{
+			name: "flag duration",
+			env:  map[string]string{"SESSION_LIFETIME": "90m"},
+			args: []string{"-session-lifetime", "3h"},
+			got:  func(c *config.Config) interface{} { return time.Duration(c.SessionLifetime) },
+			want: 3 * time.Hour,
+		},
+		{
+			name: "send buffer from the file",
+			file: `{"send_buffer_size": 64, "max_pending_messages": 128}`,
+			got:  func(c *config.Config) interface{} { return [2]int{c.SendBufferSize, c.MaxPendingMessages} },
+			want: [2]int{64, 128},
+		},
+		{
+			name: "send buffer from the environment",
+			file: `{"send_buffer_size": 64, "max_pending_messages": 128}`,
+			env:  map[string]string{"WS_SEND_BUFFER": "32", "WS_MAX_PENDING": "256"},
+			got:  func(c *config.Config) interface{} { return [2]int{c.SendBufferSize, c.MaxPendingMessages} },
+			want: [2]int{32, 256},
+		},
+		{
+			name: "send buffer from flags",
+			env:  map[string]string{"WS_SEND_BUFFER": "32", "WS_MAX_PENDING": "256"},
+			args: []string{"-ws-send-buffer", "16", "-ws-max-pending", "512"},
+			got:  func(c *config.Config) interface{} { return [2]int{c.SendBufferSize, c.MaxPendingMessages} },
+			want: [2]int{16, 512},
+		},
+		{
+			name: "allowed origins",
+			env:  map[string]string{"ALLOWED_ORIGINS": "https://a.example.com, ,https://b.example.com"},
+			got:  func(c *config.Config) interface{} { return strings.Join(c.AllowedOrigins, " ") },
+			want: "https://a.example.com https://b.example.com",
+		},
+		{
+			name: "command",
+			args: []string{"-addr", ":9000", "migrate", "status"},
+			got:  func(c *config.Config) interface{} { return strings.Join(c.Command, " ") },
+			want: "migrate status",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			cfg, err := load(t, test.file, test.env, test.args...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := test.got(cfg); got != test.want {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		file string
+		env  map[string]string
+		args []string
+		want string
+	}{
+		{name: "number as a duration", file: `{"session_lifetime": 5}`, want: `duration must be a string like "24h"`},
+		{name: "unknown unit", file: `{"session_lifetime": "24 hours"}`, want: "unknown unit"},
+		{name: "unknown key", file: `{"listen_adress": ":9000"}`, want: "unknown field"},
+		{name: "missing file", args: []string{"-config", "does-not-exist.json"}, want: "config file"},
+		{name: "environment duration", env: map[string]string{"SESSION_LIFETIME": "soon"}, want: `SESSION_LIFETIME: "soon" is not a duration`},
+		{name: "environment number", env: map[string]string{"WS_MAX_PENDING": "lots"}, want: `WS_MAX_PENDING: "lots" is not a number`},
+		{name: "flag duration", args: []string{"-session-lifetime", "soon"}, want: "invalid value"},
+		{name: "invalid result", args: []string{"-ws-send-buffer", "0"}, want: "send buffer size must be at least 1"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := load(t, test.file, test.env, test.args...)
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("got %v, want an error containing %q", err, test.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		change func(*config.Config)
+		want   string
+	}{
+		{"default", func(c *config.Config) {}, ""},
+		{"listen address without port", func(c *config.Config) { c.ListenAddr = "8080" }, "must look like host:port"},
+		{"listen port out of range", func(c *config.Config) { c.ListenAddr = ":70000" }, "has an invalid port"},
+		{"unknown driver", func(c *config.Config) { c.DatabaseDriver = "mysql" }, `database driver "mysql"`},
+		{"empty database path", func(c *config.Config) { c.DatabasePath = " " }, "database path must not be empty"},
+		{"postgres without URL", func(c *config.Config) { c.DatabaseDriver = "postgres" }, "database URL must start with postgres://"},
+		{"postgres backups", func(c *config.Config) {
+			c.DatabaseDriver, c.DatabaseURL = "postgres", "postgres://forum@localhost/forum"
+			c.Backup.Interval = config.Duration(time.Hour)
+		}, "back up PostgreSQL with pg_dump"},
+		{"short session", func(c *config.Config) { c.SessionLifetime = config.Duration(30 * time.Second) }, "session lifetime 30s is too short"},
+		{"negative throttle", func(c *config.Config) { c.Throttle.UserList = config.Duration(-time.Second) }, "throttle intervals must not be negative"},
+		{"no shutdown timeout", func(c *config.Config) { c.ShutdownTimeout = 0 }, "shutdown timeout must be positive"},
+		{"short backup interval", func(c *config.Config) { c.Backup.Interval = config.Duration(30 * time.Second) }, "backup interval 30s is too short"},
+		{"backups kept", func(c *config.Config) {
+			c.Backup.Interval, c.Backup.Keep = config.Duration(time.Hour), 0
+		}, "must keep at least one backup"},
+		{"origin without scheme", func(c *config.Config) { c.AllowedOrigins = []string{"forum.example.com"} }, "must look like https://example.com"},
+		{"any origin", func(c *config.Config) { c.AllowedOrigins = []string{"*", "https://forum.example.com/"} }, ""},
+		{"log level", func(c *config.Config) { c.LogLevel = "verbose" }, `log level "verbose"`},
+		{"TLS without key", func(c *config.Config) { c.TLS.CertFile = "cert.pem" }, "TLS needs both"},
+		{"broker scheme", func(c *config.Config) { c.BrokerURL = "http://localhost:6379" }, "must start with redis://"},
+		{"s3 incomplete", func(c *config.Config) { c.Uploads.Store = "s3" }, "the s3 upload store needs a bucket"},
+		{"upload size", func(c *config.Config) { c.Uploads.MaxSize = 10 }, "upload max size 10"},
+		{"mail without sender", func(c *config.Config) { c.Mail.Host = "smtp.example.com" }, "sending mail needs a sender address"},
+		{"mail port", func(c *config.Config) {
+			c.Mail.Host, c.Mail.From, c.Mail.Port = "smtp.example.com", "forum@example.com", 0
+		}, "SMTP port 0"},
+		{"send buffer", func(c *config.Config) { c.SendBufferSize = 0 }, "send buffer size must be at least 1"},
+		{"pending below buffer", func(c *config.Config) { c.MaxPendingMessages = 100 }, "max pending messages (100) must not be lower than the send buffer size (256)"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := config.Default()
+			test.change(cfg)
+			err := cfg.Validate()
+			switch {
+			case test.want == "" && err != nil:
+				t.Errorf("got %v, want a valid configuration", err)
+			case test.want != "" && (err == nil || !strings.Contains(err.Error(), test.want)):
+				t.Errorf("got %v, want an error containing %q", err, test.want)
+			}
+		})
+	}
+}
+
+func TestValidateReportsEverySetting(t *testing.T) {
+	cfg := config.Default()
+	cfg.LogLevel = "verbose"
+	cfg.Uploads.Store = "ftp"
+	cfg.SendBufferSize = 0
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("invalid configuration accepted")
+	}
+	for _, want := range []string{"log level", "upload store", "send buffer size"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("%q is not reported in:\n%v", want, err)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+// config/logging.go
+package config
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"os"
+)
+
+// Log levels, from the most to the least verbose.
+const (
+	LevelDebug = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var logLevels = map[string]int{
+	"debug": LevelDebug,
+	"info":  LevelInfo,
+	"warn":  LevelWarn,
+	"error": LevelError,
+}
+
+// The code base logs with log.Printf and marks each line with an emoji;
+// the level of a line is derived from its marker.
+var (
+	errorMarkers = [][]byte{[]byte("❌")}
+	warnMarkers  = [][]byte{[]byte("⚠️"), []byte("🚫")}
+	debugMarkers = [][]byte{[]byte("📨"), []byte("📤"), []byte("📥"), []byte("🔵"), []byte("🔍")}
+)
+
+// levelWriter drops log lines below the configured level.
+type levelWriter struct {
+	out   io.Writer
+	level int
+}
+
+func (w *levelWriter) Write(line []byte) (int, error) {
+	if lineLevel(line) < w.level {
+		return len(line), nil
+	}
+	return w.out.Write(line)
+}
+
+func lineLevel(line []byte) int {
+	switch {
+	case containsAny(line, errorMarkers):
+		return LevelError
+	case containsAny(line, warnMarkers):
+		return LevelWarn
+	case containsAny(line, debugMarkers):
+		return LevelDebug
+	default:
+		return LevelInfo
+	}
+}
+
+func containsAny(line []byte, markers [][]byte) bool {
+	for _, marker := range markers {
+		if bytes.Contains(line, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetupLogging applies the log level to the standard logger.
+func (c *Config) SetupLogging() {
+	log.SetOutput(&levelWriter{out: os.Stderr, level: logLevels[c.LogLevel]})
+}
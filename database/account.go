@@ -0,0 +1,217 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+func (r *sqlUsers) SetPassword(id, passwordHash, keepToken string) error {
+	return r.inTx(func(tx sqlTx) error {
+		result, err := tx.exec("UPDATE users SET password_hash = ? WHERE id = ?", passwordHash, id)
+		if err != nil {
+			return dbError(err)
+		}
+		if err := requireOneRow(result, ErrUserNotFound); err != nil {
+			return err
+		}
+		if _, err := tx.exec("DELETE FROM sessions WHERE user_id = ? AND session_token <> ?", id, keepToken); err != nil {
+			return dbError(err)
+		}
+		return nil
+	})
+}
+
+func (r *sqlUsers) RequestEmailChange(id, email, token string, expiry time.Time) error {
+	_, err := r.exec(`
+		INSERT INTO email_changes (user_id, email, token, expires_at, created_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (user_id) DO UPDATE
+		SET email = excluded.email, token = excluded.token, expires_at = excluded.expires_at, created_at = excluded.created_at`,
+		id, email, token, timeArg(expiry), time.Now())
+	if err != nil {
+		return dbError(err)
+	}
+	return nil
+}
+
+func (r *sqlUsers) CancelEmailChange(id, token string) error {
+	if _, err := r.exec("DELETE FROM email_changes WHERE user_id = ? AND token = ?", id, token); err != nil {
+		return dbError(err)
+	}
+	return nil
+}
+
+func (r *sqlUsers) PendingEmail(id string) (string, error) {
+	var email string
+	err := r.queryRow("SELECT email FROM email_changes WHERE user_id = ? AND expires_at > ?", id, time.Now()).Scan(&email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", dbError(err)
+	}
+	return email, nil
+}
+
+func (r *sqlUsers) ConfirmEmailChange(token string) (string, error) {
+	var userID string
+	err := r.inTx(func(tx sqlTx) error {
+		var email string
+		err := tx.queryRow("SELECT user_id, email FROM email_changes WHERE token = ? AND expires_at > ?", token, time.Now()).
+			Scan(&userID, &email)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrInvalidToken
+		}
+		if err != nil {
+			return dbError(err)
+		}
+
+		_, err = tx.exec("UPDATE users SET email = ? WHERE id = ?", email, userID)
+		if isUniqueViolation(err) {
+			return ErrEmailTaken
+		}
+		if err != nil {
+			return dbError(err)
+		}
+		if _, err := tx.exec("DELETE FROM email_changes WHERE user_id = ?", userID); err != nil {
+			return dbError(err)
+		}
+		return nil
+	})
+	return userID, err
+}
+
+func (r *sqlUsers) SetAvatar(id, attachmentID string) (string, error) {
+	var previous string
+	err := r.inTx(func(tx sqlTx) error {
+		err := tx.queryRow("SELECT COALESCE(avatar_id, '') FROM users WHERE id = ?", id).Scan(&previous)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrUserNotFound
+		}
+		if err != nil {
+			return dbError(err)
+		}
+
+		var avatar interface{}
+		if attachmentID != "" {
+			var usable bool
+			err := tx.queryRow(`
+				SELECT EXISTS (
+					SELECT 1 FROM attachments
+					WHERE id = ? AND user_id = ? AND thumbnail_key <> ''
+					  AND post_id IS NULL AND message_id IS NULL)`,
+				attachmentID, id).Scan(&usable)
+			if err != nil {
+				return dbError(err)
+			}
+			if !usable {
+				return ErrAttachmentNotFound
+			}
+			avatar = attachmentID
+		}
+		if _, err := tx.exec("UPDATE users SET avatar_id = ? WHERE id = ?", avatar, id); err != nil {
+			return dbError(err)
+		}
+		return nil
+	})
+	return previous, err
+}
+
+func (r *sqlUsers) ScheduleDeletion(id string, at time.Time) error {
+	if id == DeletedUserID {
+		return ErrForbidden
+	}
+	result, err := r.exec("UPDATE users SET delete_after = ? WHERE id = ?", timeArg(at), id)
+	if err != nil {
+		return dbError(err)
+	}
+	return requireOneRow(result, ErrUserNotFound)
+}
+
+func (r *sqlUsers) DueForDeletion(now time.Time) ([]string, error) {
+	rows, err := r.query("SELECT id FROM users WHERE delete_after <= ? ORDER BY delete_after", now)
+	if err != nil {
+		return nil, dbError(err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, dbError(err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, dbError(err)
+	}
+	return ids, nil
+}
+
+func (r *sqlUsers) Purge(id string) ([]StoredAttachment, error) {
+	if id == DeletedUserID {
+		return nil, ErrForbidden
+	}
+	var deleted []StoredAttachment
+	err := r.inTx(func(tx sqlTx) error {
+		// Uploads on nothing, the avatar, and the files of the messages
+		// the account sent or received all go
+		rows, err := tx.query(`
+			SELECT `+attachmentColumns+`
+			FROM attachments a
+			LEFT JOIN chat_messages m ON m.id = a.message_id
+			WHERE (a.user_id = ? AND a.post_id IS NULL)
+			   OR m.sender_id = ? OR m.receiver_id = ?`,
+			id, id, id)
+		if err != nil {
+			return dbError(err)
+		}
+		for rows.Next() {
+			a, err := scanAttachment(rows)
+			if err != nil {
+				rows.Close()
+				return dbError(err)
+			}
+			deleted = append(deleted, *a)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return dbError(err)
+		}
+
+		steps := []string{
+			"UPDATE users SET avatar_id = NULL WHERE id = ?",
+			"DELETE FROM attachments WHERE user_id = ? AND post_id IS NULL",
+			"UPDATE posts SET user_id = '" + DeletedUserID + "' WHERE user_id = ?",
+			"UPDATE comments SET user_id = '" + DeletedUserID + "' WHERE user_id = ?",
+			"UPDATE attachments SET user_id = '" + DeletedUserID + "' WHERE user_id = ?",
+		}
+		for _, step := range steps {
+			if _, err := tx.exec(step, id); err != nil {
+				return dbError(err)
+			}
+		}
+		// Events replayed to others name the account in their payload:
+		// its messages and read receipts go with the chat, notifications
+		// of its comments stay, from the placeholder
+		mention := `%"` + id + `"%`
+		if _, err := tx.exec("DELETE FROM user_events WHERE type <> 'notification' AND payload LIKE ?", mention); err != nil {
+			return dbError(err)
+		}
+		if _, err := tx.exec("UPDATE user_events SET payload = REPLACE(payload, ?, ?) WHERE type = 'notification' AND payload LIKE ?",
+			`"`+id+`"`, `"`+DeletedUserID+`"`, mention); err != nil {
+			return dbError(err)
+		}
+		// The rest is the account's own and goes with it
+		result, err := tx.exec("DELETE FROM users WHERE id = ?", id)
+		if err != nil {
+			return dbError(err)
+		}
+		return requireOneRow(result, ErrUserNotFound)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return deleted, nil
+}
@@ -0,0 +1,155 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"realtimeforum/model"
+	"time"
+)
+
+// AttachmentPath is where attachments are downloaded from, followed by
+// their ID, and by /thumbnail for the thumbnail.
+const AttachmentPath = "/api/attachments/"
+
+const attachmentColumns = `a.id, a.filename, a.content_type, a.size, a.width, a.height, a.created_at,
+	a.user_id, a.blob_key, a.thumbnail_key, COALESCE(a.post_id, 0), COALESCE(a.message_id, 0)`
+
+// isAvatar holds for the attachments a that are the avatar of a user:
+// anyone may see them, and they are neither attached to anything else
+// nor deleted as uploads.
+const isAvatar = "EXISTS (SELECT 1 FROM users av WHERE av.avatar_id = a.id)"
+
+type sqlAttachments struct{ sqlRepository }
+
+func scanAttachment(row rowScanner) (*StoredAttachment, error) {
+	var a StoredAttachment
+	var createdAt nullTime
+	err := row.Scan(&a.ID, &a.Filename, &a.ContentType, &a.Size, &a.Width, &a.Height, &createdAt,
+		&a.UserID, &a.BlobKey, &a.ThumbnailKey, &a.PostID, &a.MessageID)
+	if err != nil {
+		return nil, err
+	}
+	a.CreatedAt = createdAt.Time
+	a.URL = AttachmentPath + a.ID
+	if a.ThumbnailKey != "" {
+		a.ThumbnailURL = a.URL + "/thumbnail"
+	}
+	return &a, nil
+}
+
+func (r *sqlAttachments) Create(a *StoredAttachment) error {
+	if a.CreatedAt.IsZero() {
+		a.CreatedAt = time.Now()
+	}
+	_, err := r.exec(`
+		INSERT INTO attachments (id, user_id, filename, content_type, size, width, height, blob_key, thumbnail_key, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		a.ID, a.UserID, a.Filename, a.ContentType, a.Size, a.Width, a.Height, a.BlobKey, a.ThumbnailKey, a.CreatedAt)
+	if err != nil {
+		return dbError(err)
+	}
+	a.URL = AttachmentPath + a.ID
+	if a.ThumbnailKey != "" {
+		a.ThumbnailURL = a.URL + "/thumbnail"
+	}
+	return nil
+}
+
+func (r *sqlAttachments) Get(id, userID string) (*StoredAttachment, error) {
+	a, err := scanAttachment(r.queryRow(`
+		SELECT `+attachmentColumns+`
+		FROM attachments a
+		LEFT JOIN posts p ON p.id = a.post_id
+		LEFT JOIN chat_messages m ON m.id = a.message_id
+		WHERE a.id = ?
+		  AND (a.user_id = ? OR (a.post_id IS NOT NULL AND `+visiblePost+`)
+		       OR m.sender_id = ? OR m.receiver_id = ? OR `+isAvatar+`)`,
+		id, userID, model.PostPublished, time.Now(), userID, userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrAttachmentNotFound
+	}
+	if err != nil {
+		return nil, dbError(err)
+	}
+	return a, nil
+}
+
+func (r *sqlAttachments) Delete(id, userID string) (*StoredAttachment, error) {
+	var a *StoredAttachment
+	err := r.inTx(func(tx sqlTx) error {
+		var err error
+		a, err = scanAttachment(tx.queryRow(`
+			SELECT `+attachmentColumns+`
+			FROM attachments a
+			WHERE a.id = ? AND a.user_id = ? AND a.post_id IS NULL AND a.message_id IS NULL AND NOT `+isAvatar,
+			id, userID))
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrAttachmentNotFound
+		}
+		if err != nil {
+			return dbError(err)
+		}
+		if _, err := tx.exec("DELETE FROM attachments WHERE id = ?", id); err != nil {
+			return dbError(err)
+		}
+		return nil
+	})
+	return a, err
+}
+
+// attach gives the uploads ids of userID to a post or chat message,
+// column being post_id or message_id. Any other ID is
+// ErrAttachmentNotFound.
+func attach(tx sqlTx, column, userID string, targetID int, ids []string) error {
+	seen := make(map[string]bool)
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		result, err := tx.exec(`
+			UPDATE attachments SET `+column+` = ?
+			WHERE id = ? AND user_id = ? AND post_id IS NULL AND message_id IS NULL
+			  AND NOT EXISTS (SELECT 1 FROM users av WHERE av.avatar_id = attachments.id)`,
+			targetID, id, userID)
+		if err != nil {
+			return dbError(err)
+		}
+		if err := requireOneRow(result, ErrAttachmentNotFound); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// attachmentsOf returns the attachments of the posts or chat messages IN
+// ids, a list of placeholders, by post or message ID, oldest first.
+// column is post_id or message_id.
+func (r sqlRepository) attachmentsOf(column, ids string, args ...interface{}) (map[int][]model.Attachment, error) {
+	rows, err := r.query(`
+		SELECT `+attachmentColumns+`
+		FROM attachments a
+		WHERE a.`+column+` IN `+ids+`
+		ORDER BY a.created_at, a.id`, args...)
+	if err != nil {
+		return nil, dbError(err)
+	}
+	defer rows.Close()
+
+	attachments := make(map[int][]model.Attachment)
+	for rows.Next() {
+		a, err := scanAttachment(rows)
+		if err != nil {
+			return nil, dbError(err)
+		}
+		owner := a.PostID
+		if column == "message_id" {
+			owner = a.MessageID
+		}
+		attachments[owner] = append(attachments[owner], a.Attachment)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, dbError(err)
+	}
+	return attachments, nil
+}
@@ -0,0 +1,273 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// The online backup copies backupPagesPerStep pages at a time and pauses
+// in between, so writers only ever wait for one short step.
+const (
+	backupPagesPerStep = 256
+	backupPause        = 10 * time.Millisecond
+)
+
+// Backup copies the live database to destPath with the SQLite backup API.
+// The copy is written next to destPath, checked with VerifyIntegrity and
+// only then renamed into place, so destPath is never a partial backup.
+// Pass the read pool: the backup holds its connection for every step.
+func Backup(ctx context.Context, db *sql.DB, destPath string) error {
+	if DialectOf(db) != SQLite {
+		return errors.New("online backups need SQLite; back up PostgreSQL with pg_dump")
+	}
+	if err := os.MkdirAll(filepath.Dir(destPath), 0o755); err != nil {
+		return err
+	}
+
+	tmpPath := destPath + ".partial"
+	os.Remove(tmpPath)
+	defer os.Remove(tmpPath)
+
+	dest, err := sql.Open("sqlite3", tmpPath)
+	if err != nil {
+		return err
+	}
+	if err := copyDatabase(ctx, db, dest); err != nil {
+		dest.Close()
+		return fmt.Errorf("backup failed: %w", err)
+	}
+	// The copy inherits WAL mode from the live database; a backup should
+	// be a single file
+	if _, err := dest.Exec("PRAGMA journal_mode = DELETE"); err != nil {
+		dest.Close()
+		return fmt.Errorf("backup failed: %w", err)
+	}
+	if err := dest.Close(); err != nil {
+		return err
+	}
+
+	if err := VerifyIntegrity(tmpPath); err != nil {
+		return fmt.Errorf("backup is corrupt: %w", err)
+	}
+	return os.Rename(tmpPath, destPath)
+}
+
+// copyDatabase runs the backup API from src into dest, step by step.
+func copyDatabase(ctx context.Context, src, dest *sql.DB) error {
+	srcConn, err := src.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer srcConn.Close()
+
+	destConn, err := dest.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer destConn.Close()
+
+	return destConn.Raw(func(destDriver interface{}) error {
+		return srcConn.Raw(func(srcDriver interface{}) error {
+			destSQLite, ok := destDriver.(*sqlite3.SQLiteConn)
+			srcSQLite, ok2 := srcDriver.(*sqlite3.SQLiteConn)
+			if !ok || !ok2 {
+				return errors.New("backups need SQLite connections")
+			}
+
+			backup, err := destSQLite.Backup("main", srcSQLite, "main")
+			if err != nil {
+				return err
+			}
+
+			for {
+				done, err := backup.Step(backupPagesPerStep)
+				if err != nil {
+					backup.Finish()
+					return err
+				}
+				if done {
+					return backup.Finish()
+				}
+
+				select {
+				case <-ctx.Done():
+					backup.Finish()
+					return ctx.Err()
+				case <-time.After(backupPause):
+				}
+			}
+		})
+	})
+}
+
+// VerifyIntegrity opens a database file read-only and checks that SQLite
+// finds no corruption and that it is a forum database.
+func VerifyIntegrity(path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+
+	db, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	rows, err := db.Query("PRAGMA integrity_check")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var problems []string
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			return err
+		}
+		if line != "ok" {
+			problems = append(problems, line)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("integrity check failed: %s", strings.Join(problems, "; "))
+	}
+
+	var version int
+	if err := db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version); err != nil {
+		return fmt.Errorf("not a forum database: %w", err)
+	}
+	return nil
+}
+
+// Restore replaces the database at targetPath with a verified backup. The
+// server must be stopped. The previous file is kept as
+// targetPath.before-restore-<time> and its path returned.
+func Restore(ctx context.Context, backupPath, targetPath string) (string, error) {
+	if err := VerifyIntegrity(backupPath); err != nil {
+		return "", fmt.Errorf("refusing to restore %s: %w", backupPath, err)
+	}
+
+	var previous string
+	if _, err := os.Stat(targetPath); err == nil {
+		previous = fmt.Sprintf("%s.before-restore-%s", targetPath, time.Now().Format("20060102-150405"))
+		if err := os.Rename(targetPath, previous); err != nil {
+			return "", err
+		}
+		// Leftover journals belong to the old file
+		for _, suffix := range []string{"-wal", "-shm", "-journal"} {
+			os.Rename(targetPath+suffix, previous+suffix)
+		}
+	}
+
+	if err := restoreFrom(ctx, backupPath, targetPath); err != nil {
+		// Put the previous database back
+		for _, suffix := range []string{"", "-wal", "-shm", "-journal"} {
+			os.Remove(targetPath + suffix)
+		}
+		if previous != "" {
+			for _, suffix := range []string{"", "-wal", "-shm", "-journal"} {
+				os.Rename(previous+suffix, targetPath+suffix)
+			}
+		}
+		return "", err
+	}
+	return previous, nil
+}
+
+func restoreFrom(ctx context.Context, backupPath, targetPath string) error {
+	src, err := sql.Open("sqlite3", "file:"+backupPath+"?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dest, err := sql.Open("sqlite3", targetPath)
+	if err != nil {
+		return err
+	}
+	if err := copyDatabase(ctx, src, dest); err != nil {
+		dest.Close()
+		return fmt.Errorf("restore failed: %w", err)
+	}
+	if err := dest.Close(); err != nil {
+		return err
+	}
+
+	if err := VerifyIntegrity(targetPath); err != nil {
+		return fmt.Errorf("restored database is corrupt: %w", err)
+	}
+	return nil
+}
+
+// ScheduleBackups backs the database up into dir every interval, keeping
+// the newest keep backups, until ctx is cancelled.
+func ScheduleBackups(ctx context.Context, db *sql.DB, dir string, interval time.Duration, keep int) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		started := time.Now()
+		path := filepath.Join(dir, BackupFileName(started))
+		if err := Backup(ctx, db, path); err != nil {
+			log.Printf("❌ Scheduled backup failed: %v", err)
+			continue
+		}
+		log.Printf("💾 Backup written to %s in %s", path, time.Since(started).Round(time.Millisecond))
+
+		deleted, err := PruneBackups(dir, keep)
+		if err != nil {
+			log.Printf("❌ Failed to delete old backups: %v", err)
+		}
+		for _, old := range deleted {
+			log.Printf("🧹 Deleted old backup %s", old)
+		}
+	}
+}
+
+// BackupFileName is the name of a scheduled backup taken at t.
+func BackupFileName(t time.Time) string {
+	return "forum-" + t.UTC().Format("20060102-150405") + ".db"
+}
+
+// PruneBackups deletes the oldest scheduled backups in dir so that at most
+// keep remain, and returns the deleted paths.
+func PruneBackups(dir string, keep int) ([]string, error) {
+	matches, err := filepath.Glob(filepath.Join(dir, "forum-*.db"))
+	if err != nil {
+		return nil, err
+	}
+	if len(matches) <= keep {
+		return nil, nil
+	}
+
+	// The names sort chronologically
+	sort.Strings(matches)
+	var deleted []string
+	for _, path := range matches[:len(matches)-keep] {
+		if err := os.Remove(path); err != nil {
+			return deleted, err
+		}
+		deleted = append(deleted, path)
+	}
+	return deleted, nil
+}
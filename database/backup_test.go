@@ -0,0 +1,212 @@
+package database_test
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"realtimeforum/database"
+	"realtimeforum/database/dbtest"
+	"slices"
+	"testing"
+	"time"
+)
+
+// countUsers counts the users in a database file without changing it.
+func countUsers(t *testing.T, path string) int {
+	t.Helper()
+	db, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM users").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+// TestBackupAndRestore backs the live database up twice, a user apart,
+// and restores the first backup over the second.
+func TestBackupAndRestore(t *testing.T) {
+	dbtest.Open(t, database.SQLite)
+	ctx := context.Background()
+	dir := t.TempDir()
+	first, second := filepath.Join(dir, "first.db"), filepath.Join(dir, "second.db")
+
+	var existing int
+	if err := database.ReadDB.QueryRow("SELECT COUNT(*) FROM users").Scan(&existing); err != nil {
+		t.Fatal(err)
+	}
+	createUsers(t, 2)
+	if err := database.Backup(ctx, database.ReadDB, first); err != nil {
+		t.Fatal(err)
+	}
+	createUser(t, "written_after_the_backup")
+	if err := database.Backup(ctx, database.ReadDB, second); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "users in the first backup", countUsers(t, first), existing+2)
+	expect(t, "users in the second backup", countUsers(t, second), existing+3)
+	for _, suffix := range []string{".partial", "-wal"} {
+		if _, err := os.Stat(first + suffix); !os.IsNotExist(err) {
+			t.Errorf("backup left %s behind", first+suffix)
+		}
+	}
+
+	previous, err := database.Restore(ctx, first, second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "users restored", countUsers(t, second), existing+2)
+	expect(t, "users kept aside", countUsers(t, previous), existing+3)
+	expect(t, "restored file verified", database.VerifyIntegrity(second), nil)
+}
+
+func TestVerifyIntegrity(t *testing.T) {
+	dbtest.Open(t, database.SQLite)
+	dir := t.TempDir()
+	backup := filepath.Join(dir, "forum.db")
+	if err := database.Backup(context.Background(), database.ReadDB, backup); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(backup)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every page after the header is overwritten
+	corrupt := slices.Clone(data)
+	for i := 100; i < len(corrupt); i++ {
+		corrupt[i] = 0xA5
+	}
+	notSQLite := []byte("SQLite format 3 is what this file is not")
+	other, err := sql.Open("sqlite3", filepath.Join(dir, "other.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.Exec("CREATE TABLE notes (body TEXT)"); err != nil {
+		t.Fatal(err)
+	}
+	other.Close()
+
+	files := map[string][]byte{"corrupt.db": corrupt, "text.db": notSQLite}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), content, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{"corrupt.db", "text.db", "other.db", "missing.db"} {
+		path := filepath.Join(dir, name)
+		if err := database.VerifyIntegrity(path); err == nil {
+			t.Errorf("%s passed the check", name)
+		}
+		if _, err := database.Restore(context.Background(), path, backup); err == nil {
+			t.Errorf("%s was restored", name)
+		}
+	}
+	expect(t, "backup intact", database.VerifyIntegrity(backup), nil)
+}
+
+func TestPruneBackups(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)
+	var names []string
+	for i := 0; i < 5; i++ {
+		names = append(names, database.BackupFileName(start.Add(time.Duration(i)*time.Hour)))
+	}
+	for _, name := range append(slices.Clone(names), "notes.txt") {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deleted, err := database.PruneBackups(dir, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "deleted", len(deleted), 3)
+	for i, name := range append(slices.Clone(names), "notes.txt") {
+		_, err := os.Stat(filepath.Join(dir, name))
+		expect(t, name+" kept", err == nil, i >= 3)
+	}
+	again, err := database.PruneBackups(dir, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "deleted again", len(again), 0)
+}
+
+// readRows decodes a JSON Lines export of one table.
+func readRows(t *testing.T, path string) []map[string]interface{} {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var rows []map[string]interface{}
+	lines := bufio.NewScanner(file)
+	for lines.Scan() {
+		var row map[string]interface{}
+		if err := json.Unmarshal(lines.Bytes(), &row); err != nil {
+			t.Fatal(err)
+		}
+		rows = append(rows, row)
+	}
+	if err := lines.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return rows
+}
+
+func TestExport(t *testing.T) {
+	for _, dialect := range dbtest.Dialects {
+		t.Run(string(dialect), func(t *testing.T) {
+			dbtest.Open(t, dialect)
+			f := newFixture(t)
+			if _, err := database.Comments.Create(plain("Exported comment"), f.bob.ID, f.postID); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := database.Chat.SaveMessage(f.bob.ID, f.alice.ID, "Exported message"); err != nil {
+				t.Fatal(err)
+			}
+			migrations, err := database.Migrations(dialect)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			dir := filepath.Join(t.TempDir(), "export")
+			manifest, err := database.Export(context.Background(), database.ReadDB, dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expect(t, "schema version", manifest.SchemaVersion, migrations[len(migrations)-1].Version)
+			if _, err := os.Stat(filepath.Join(dir, "manifest.json")); err != nil {
+				t.Error(err)
+			}
+
+			posts := readRows(t, filepath.Join(dir, "posts.jsonl"))
+			comments := readRows(t, filepath.Join(dir, "comments.jsonl"))
+			messages := readRows(t, filepath.Join(dir, "chat_messages.jsonl"))
+			expect(t, "posts", len(posts), 1)
+			expect(t, "comments", len(comments), 1)
+			expect(t, "messages", len(messages), 1)
+			if len(posts) == 1 && len(comments) == 1 && len(messages) == 1 {
+				expect(t, "post author", posts[0]["user_id"], f.alice.ID)
+				expect(t, "post title", posts[0]["title"], "Contract post")
+				expect(t, "comment author", comments[0]["user_id"], f.bob.ID)
+				expect(t, "comment", comments[0]["content"], "Exported comment")
+				expect(t, "message sender", messages[0]["sender_id"], f.bob.ID)
+				expect(t, "message", messages[0]["message"], "Exported message")
+			}
+			for table, count := range manifest.Tables {
+				expect(t, table+" rows", len(readRows(t, filepath.Join(dir, table+".jsonl"))), count)
+			}
+		})
+	}
+}
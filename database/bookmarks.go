@@ -0,0 +1,225 @@
+package database
+
+import (
+	"fmt"
+	"realtimeforum/model"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// CollectionNameMax is the longest name of a bookmark collection, in
+// characters.
+const CollectionNameMax = 50
+
+type sqlBookmarks struct{ sqlRepository }
+
+func (r *sqlBookmarks) Set(userID string, postID, collectionID int, saved bool) error {
+	if !saved {
+		if _, err := r.exec("DELETE FROM bookmarks WHERE user_id = ? AND post_id = ?", userID, postID); err != nil {
+			return dbError(err)
+		}
+		return nil
+	}
+
+	return r.inTx(func(tx sqlTx) error {
+		if err := requireVisiblePost(tx, postID); err != nil {
+			return err
+		}
+
+		var collection interface{}
+		if collectionID != 0 {
+			var exists bool
+			err := tx.queryRow("SELECT EXISTS (SELECT 1 FROM bookmark_collections WHERE id = ? AND user_id = ?)", collectionID, userID).Scan(&exists)
+			if err != nil {
+				return dbError(err)
+			}
+			if !exists {
+				return ErrCollectionNotFound
+			}
+			collection = collectionID
+		}
+
+		// Saving again only moves the bookmark
+		_, err := tx.exec(`
+			INSERT INTO bookmarks (user_id, post_id, collection_id, created_at) VALUES (?, ?, ?, ?)
+			ON CONFLICT (user_id, post_id) DO UPDATE SET collection_id = excluded.collection_id`,
+			userID, postID, collection, time.Now())
+		if err != nil {
+			return dbError(err)
+		}
+		return nil
+	})
+}
+
+func (r *sqlBookmarks) List(userID string, collectionID, limit, offset int) ([]model.Bookmark, int, error) {
+	where := "b.user_id = ? AND " + visiblePost
+	args := []interface{}{userID, model.PostPublished, time.Now()}
+	if collectionID != 0 {
+		where += " AND b.collection_id = ?"
+		args = append(args, collectionID)
+	}
+
+	var total int
+	err := r.queryRow(`
+		SELECT COUNT(*)
+		FROM bookmarks b
+		JOIN posts p ON p.id = b.post_id
+		WHERE `+where, args...).Scan(&total)
+	if err != nil {
+		return nil, 0, dbError(err)
+	}
+
+	rows, err := r.query(`
+		SELECT `+postColumns+`, b.created_at, COALESCE(c.id, 0), COALESCE(c.name, '')
+		FROM bookmarks b
+		JOIN posts p ON p.id = b.post_id
+		JOIN users u ON p.user_id = u.id
+		LEFT JOIN bookmark_collections c ON c.id = b.collection_id
+		WHERE `+where+`
+		ORDER BY b.created_at DESC, b.post_id DESC
+		LIMIT ? OFFSET ?`, append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, dbError(err)
+	}
+	defer rows.Close()
+
+	bookmarks := []model.Bookmark{}
+	for rows.Next() {
+		var bookmark model.Bookmark
+		var savedAt nullTime
+		post, err := scanPost(trailingScanner{rows, []interface{}{&savedAt, &bookmark.CollectionID, &bookmark.Collection}})
+		if err != nil {
+			return nil, 0, dbError(err)
+		}
+		bookmark.Post, bookmark.SavedAt = *post, savedAt.Time
+		bookmarks = append(bookmarks, bookmark)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, dbError(err)
+	}
+	rows.Close()
+	if len(bookmarks) == 0 {
+		return bookmarks, total, nil
+	}
+
+	ids := make([]interface{}, len(bookmarks))
+	for i, bookmark := range bookmarks {
+		ids[i] = bookmark.Post.ID
+	}
+	in := "(" + placeholders(len(ids)) + ")"
+	posts := sqlPosts{r.sqlRepository}
+	topics, err := posts.topicNames(in, ids...)
+	if err != nil {
+		return nil, 0, err
+	}
+	attachments, err := r.attachmentsOf("post_id", in, ids...)
+	if err != nil {
+		return nil, 0, err
+	}
+	for i := range bookmarks {
+		post := &bookmarks[i].Post
+		post.Topics = topics[post.ID]
+		post.Attachments = attachments[post.ID]
+		if post.Attachments == nil {
+			post.Attachments = []model.Attachment{}
+		}
+	}
+	return bookmarks, total, nil
+}
+
+func (r *sqlBookmarks) Saved(userID string, postID int) (bool, error) {
+	var saved bool
+	err := r.queryRow("SELECT EXISTS (SELECT 1 FROM bookmarks WHERE user_id = ? AND post_id = ?)", userID, postID).Scan(&saved)
+	if err != nil {
+		return false, dbError(err)
+	}
+	return saved, nil
+}
+
+func (r *sqlBookmarks) Collections(userID string) ([]model.BookmarkCollection, error) {
+	rows, err := r.query(`
+		SELECT c.id, c.name, c.created_at, (SELECT COUNT(*) FROM bookmarks b WHERE b.collection_id = c.id)
+		FROM bookmark_collections c
+		WHERE c.user_id = ?
+		ORDER BY c.name, c.id`, userID)
+	if err != nil {
+		return nil, dbError(err)
+	}
+	defer rows.Close()
+
+	collections := []model.BookmarkCollection{}
+	for rows.Next() {
+		var collection model.BookmarkCollection
+		var createdAt nullTime
+		if err := rows.Scan(&collection.ID, &collection.Name, &createdAt, &collection.Count); err != nil {
+			return nil, dbError(err)
+		}
+		collection.CreatedAt = createdAt.Time
+		collections = append(collections, collection)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, dbError(err)
+	}
+	return collections, nil
+}
+
+func (r *sqlBookmarks) CreateCollection(userID, name string) (*model.BookmarkCollection, error) {
+	collection := model.BookmarkCollection{Name: strings.TrimSpace(name), CreatedAt: time.Now()}
+	if err := validateCollection(collection.Name); err != nil {
+		return nil, err
+	}
+	err := r.insert(`
+		INSERT INTO bookmark_collections (user_id, name, created_at) VALUES (?, ?, ?)
+		RETURNING id`,
+		userID, collection.Name, collection.CreatedAt).Scan(&collection.ID)
+	if isUniqueViolation(err) {
+		return nil, ErrDuplicateCollection
+	}
+	if err != nil {
+		return nil, dbError(err)
+	}
+	return &collection, nil
+}
+
+func (r *sqlBookmarks) RenameCollection(id int, userID, name string) error {
+	name = strings.TrimSpace(name)
+	if err := validateCollection(name); err != nil {
+		return err
+	}
+	result, err := r.exec("UPDATE bookmark_collections SET name = ? WHERE id = ? AND user_id = ?", name, id, userID)
+	if isUniqueViolation(err) {
+		return ErrDuplicateCollection
+	}
+	if err != nil {
+		return dbError(err)
+	}
+	return requireOneRow(result, ErrCollectionNotFound)
+}
+
+func (r *sqlBookmarks) DeleteCollection(id int, userID string) error {
+	result, err := r.exec("DELETE FROM bookmark_collections WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		return dbError(err)
+	}
+	return requireOneRow(result, ErrCollectionNotFound)
+}
+
+func validateCollection(name string) error {
+	if name == "" || utf8.RuneCountInString(name) > CollectionNameMax {
+		return fmt.Errorf("%w: the name must be 1 to %d characters", ErrInvalidCollection, CollectionNameMax)
+	}
+	return nil
+}
+
+// trailingScanner scans the columns of row into the destinations given to
+// Scan, then into extra, so that scanPost can read rows with more
+// columns.
+type trailingScanner struct {
+	row   rowScanner
+	extra []interface{}
+}
+
+func (s trailingScanner) Scan(dest ...interface{}) error {
+	return s.row.Scan(append(dest, s.extra...)...)
+}
@@ -0,0 +1,112 @@
+package database_test
+
+import (
+	"fmt"
+	"realtimeforum/database"
+	"testing"
+	"time"
+)
+
+func testBookmarks(t *testing.T) {
+	f := newFixture(t)
+	var ids []int
+	for i := 1; i <= 3; i++ {
+		ids = append(ids, createPost(t, f.alice.ID, fmt.Sprintf("Bookmarked post %d", i), f.topicIDs[0]))
+	}
+	scheduled, err := database.Posts.Create(database.NewPost{Title: "Unsaveable post", Content: plain("Not published yet"),
+		UserID: f.alice.ID, TopicIDs: f.topicIDs[:1], PostSchedule: database.PostSchedule{PublishAt: time.Now().Add(time.Hour)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recipes, err := database.Bookmarks.CreateCollection(f.bob.ID, " Recipes ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "collection name trimmed", recipes.Name, "Recipes")
+	_, err = database.Bookmarks.CreateCollection(f.bob.ID, "Recipes")
+	expectError(t, "duplicate collection", err, database.ErrDuplicateCollection)
+	_, err = database.Bookmarks.CreateCollection(f.bob.ID, "  ")
+	expectError(t, "empty collection name", err, database.ErrInvalidCollection)
+	others, err := database.Bookmarks.CreateCollection(f.alice.ID, "Recipes")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range ids {
+		time.Sleep(5 * time.Millisecond)
+		if err := database.Bookmarks.Set(f.bob.ID, id, 0, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Moving keeps the save time; saving twice and unsaving twice are fine
+	if err := database.Bookmarks.Set(f.bob.ID, ids[0], recipes.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := database.Bookmarks.Set(f.bob.ID, ids[1], 0, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expectError(t, "unpublished post", database.Bookmarks.Set(f.bob.ID, scheduled, 0, true), database.ErrPostNotFound)
+	expectError(t, "collection of another user", database.Bookmarks.Set(f.bob.ID, ids[1], others.ID, true), database.ErrCollectionNotFound)
+
+	all, total, err := database.Bookmarks.List(f.bob.ID, 0, 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "total", total, 2)
+	if len(all) != 1 {
+		t.Fatalf("got %d bookmarks, want 1", len(all))
+	}
+	expect(t, "latest saved first", all[0].Post.ID, ids[2])
+	expect(t, "bookmark topics", len(all[0].Post.Topics), 1)
+	second, _, err := database.Bookmarks.List(f.bob.ID, 0, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(second) != 1 {
+		t.Fatalf("got %d bookmarks on the second page, want 1", len(second))
+	}
+	expect(t, "second page", second[0].Post.ID, ids[0])
+	expect(t, "second page collection", second[0].Collection, "Recipes")
+	inRecipes, inRecipesTotal, err := database.Bookmarks.List(f.bob.ID, recipes.ID, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "in collection", inRecipesTotal, 1)
+	expect(t, "in collection", inRecipes[0].Post.ID, ids[0])
+
+	page, err := database.Posts.Feed(database.FeedQuery{Author: f.alice.Username, Limit: 50, ViewerID: f.bob.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	flags := make(map[int]bool)
+	for _, post := range page.Posts {
+		flags[post.ID] = post.Bookmarked
+	}
+	expect(t, "feed flags", fmt.Sprint(flags[ids[0]], flags[ids[1]], flags[ids[2]]), "true false true")
+	saved, err := database.Bookmarks.Saved(f.bob.ID, ids[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "saved", saved, true)
+
+	if err := database.Bookmarks.RenameCollection(recipes.ID, f.bob.ID, "Cooking"); err != nil {
+		t.Fatal(err)
+	}
+	expectError(t, "rename of another user's collection", database.Bookmarks.RenameCollection(others.ID, f.bob.ID, "Mine"), database.ErrCollectionNotFound)
+	if err := database.Bookmarks.DeleteCollection(recipes.ID, f.bob.ID); err != nil {
+		t.Fatal(err)
+	}
+	_, left, err := database.Bookmarks.List(f.bob.ID, 0, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "bookmarks kept with their collection deleted", left, 2)
+	collections, err := database.Bookmarks.Collections(f.bob.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "collections left", len(collections), 0)
+}
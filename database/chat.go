@@ -0,0 +1,375 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"realtimeforum/model"
+	"time"
+)
+
+type sqlChat struct{ sqlRepository }
+
+func (r *sqlChat) SaveMessage(senderID, receiverID, message string, attachmentIDs ...string) (*model.ChatMessage, error) {
+	now := time.Now()
+	var id int
+	err := r.inTx(func(tx sqlTx) error {
+		err := tx.queryRow(`
+			INSERT INTO chat_messages (sender_id, receiver_id, message, created_at, is_read)
+			VALUES (?, ?, ?, ?, ?)
+			RETURNING id`,
+			senderID, receiverID, message, now, false).Scan(&id)
+		if err != nil {
+			return err
+		}
+		return attach(tx, "message_id", senderID, id, attachmentIDs)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	senderName := "Unknown"
+	r.queryRow("SELECT username FROM users WHERE id = ?", senderID).Scan(&senderName)
+
+	attachments := []model.Attachment{}
+	if len(attachmentIDs) > 0 {
+		byMessage, err := r.attachmentsOf("message_id", "(?)", id)
+		if err != nil {
+			return nil, err
+		}
+		attachments = byMessage[id]
+	}
+
+	return &model.ChatMessage{
+		ID:          id,
+		SenderID:    senderID,
+		ReceiverID:  receiverID,
+		Message:     message,
+		Attachments: attachments,
+		CreatedAt:   now,
+		IsRead:      false,
+		SenderName:  senderName,
+	}, nil
+}
+
+func (r *sqlChat) SetLastMessage(userID, otherID string, messageID int) error {
+	// Ensure consistent ordering
+	if userID > otherID {
+		userID, otherID = otherID, userID
+	}
+	_, err := r.exec(`
+		INSERT INTO user_chat_last_message (user1_id, user2_id, last_message_id)
+		VALUES (?, ?, ?)
+		ON CONFLICT (user1_id, user2_id) DO UPDATE SET
+			last_message_id = excluded.last_message_id`,
+		userID, otherID, messageID)
+	return err
+}
+
+func (r *sqlChat) Conversation(userID, otherID string, limit, offset int) ([]model.ChatMessage, error) {
+	return r.messages(`
+		SELECT cm.id, cm.sender_id, cm.receiver_id, cm.message, cm.created_at, cm.is_read, u.username
+		FROM chat_messages cm
+		JOIN users u ON cm.sender_id = u.id
+		WHERE (cm.sender_id = ? AND cm.receiver_id = ?)
+		   OR (cm.sender_id = ? AND cm.receiver_id = ?)
+		ORDER BY cm.created_at DESC, cm.id DESC
+		LIMIT ? OFFSET ?`,
+		userID, otherID, otherID, userID, limit, offset)
+}
+
+func (r *sqlChat) Messages(userID string) ([]model.ChatMessage, error) {
+	return r.messages(`
+		SELECT cm.id, cm.sender_id, cm.receiver_id, cm.message, cm.created_at, cm.is_read, u.username
+		FROM chat_messages cm
+		JOIN users u ON cm.sender_id = u.id
+		WHERE cm.sender_id = ? OR cm.receiver_id = ?
+		ORDER BY cm.created_at, cm.id`,
+		userID, userID)
+}
+
+// messages runs a query for chat messages and adds their attachments.
+func (r *sqlChat) messages(query string, args ...interface{}) ([]model.ChatMessage, error) {
+	rows, err := r.query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := make([]model.ChatMessage, 0)
+	for rows.Next() {
+		var msg model.ChatMessage
+		var createdAt nullTime
+		if err := rows.Scan(&msg.ID, &msg.SenderID, &msg.ReceiverID, &msg.Message,
+			&createdAt, &msg.IsRead, &msg.SenderName); err != nil {
+			return nil, err
+		}
+		msg.CreatedAt = createdAt.Time
+		messages = append(messages, msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+	if len(messages) == 0 {
+		return messages, nil
+	}
+
+	ids := make([]interface{}, len(messages))
+	for i, msg := range messages {
+		ids[i] = msg.ID
+	}
+	attachments, err := r.attachmentsOf("message_id", "("+placeholders(len(ids))+")", ids...)
+	if err != nil {
+		return nil, err
+	}
+	for i := range messages {
+		messages[i].Attachments = attachments[messages[i].ID]
+		if messages[i].Attachments == nil {
+			messages[i].Attachments = []model.Attachment{}
+		}
+	}
+	return messages, nil
+}
+
+func (r *sqlChat) MarkRead(receiverID, senderID string) (int64, error) {
+	result, err := r.exec(`
+		UPDATE chat_messages SET is_read = ?
+		WHERE receiver_id = ? AND sender_id = ? AND is_read = ?`,
+		true, receiverID, senderID, false)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (r *sqlChat) Contacts(userID string) ([]ChatContact, error) {
+	rows, err := r.query(`
+		SELECT `+presenceColumns+`,
+		       COALESCE(cm.message, ''),
+		       COALESCE(cm.created_at, u.created_at),
+		       COALESCE(unread.count, 0)
+		FROM users u
+		LEFT JOIN user_online uo ON u.id = uo.user_id
+		LEFT JOIN (
+			SELECT
+				CASE WHEN sender_id = ? THEN receiver_id ELSE sender_id END AS other_user_id,
+				message,
+				created_at,
+				ROW_NUMBER() OVER (
+					PARTITION BY CASE WHEN sender_id = ? THEN receiver_id ELSE sender_id END
+					ORDER BY created_at DESC, id DESC
+				) AS rn
+			FROM chat_messages
+			WHERE sender_id = ? OR receiver_id = ?
+		) cm ON u.id = cm.other_user_id AND cm.rn = 1
+		LEFT JOIN (
+			SELECT sender_id, COUNT(*) AS count
+			FROM chat_messages
+			WHERE receiver_id = ? AND is_read = ?
+			GROUP BY sender_id
+		) unread ON u.id = unread.sender_id
+		WHERE u.id != ? AND u.id <> '`+DeletedUserID+`'
+		ORDER BY u.username`,
+		userID, userID, userID, userID, userID, false, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	contacts := make([]ChatContact, 0)
+	for rows.Next() {
+		var contact ChatContact
+		var lastMessageTime nullTime
+		presence, err := scanPresence(rows, &contact.LastMessage, &lastMessageTime, &contact.UnreadCount)
+		if err != nil {
+			return nil, err
+		}
+		contact.Presence = presence
+		contact.LastMessageTime = lastMessageTime.Time
+		contacts = append(contacts, contact)
+	}
+	return contacts, rows.Err()
+}
+
+type sqlPresence struct{ sqlRepository }
+
+const presenceColumns = `u.id, u.username,
+	       COALESCE(uo.is_online, FALSE),
+	       COALESCE(uo.status, 'available'),
+	       COALESCE(uo.custom_status, ''),
+	       COALESCE(uo.is_idle, FALSE),
+	       COALESCE(uo.show_last_seen, TRUE),
+	       COALESCE(uo.last_activity, u.created_at)`
+
+const presenceQuery = `
+	SELECT ` + presenceColumns + `
+	FROM users u
+	LEFT JOIN user_online uo ON u.id = uo.user_id`
+
+func scanPresence(row rowScanner, extra ...interface{}) (PresenceRecord, error) {
+	var record PresenceRecord
+	var lastActivity nullTime
+
+	dest := append([]interface{}{&record.UserID, &record.Username, &record.IsOnline, &record.Status,
+		&record.CustomStatus, &record.IsIdle, &record.ShowLastSeen, &lastActivity}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return record, err
+	}
+	record.LastActivity = lastActivity.Time
+	return record, nil
+}
+
+func (r *sqlPresence) Load(userID string) (PresenceRecord, error) {
+	record, err := scanPresence(r.queryRow(presenceQuery+" WHERE u.id = ?", userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return record, ErrUserNotFound
+	}
+	return record, err
+}
+
+func (r *sqlPresence) LoadMany(userIDs []string) ([]PresenceRecord, error) {
+	if len(userIDs) == 0 {
+		return nil, nil
+	}
+
+	args := make([]interface{}, len(userIDs))
+	for i, id := range userIDs {
+		args[i] = id
+	}
+	return r.list(presenceQuery+" WHERE u.id IN ("+placeholders(len(userIDs))+")", args...)
+}
+
+func (r *sqlPresence) All() ([]PresenceRecord, error) {
+	return r.list(presenceQuery + " WHERE u.id <> '" + DeletedUserID + "' ORDER BY u.username")
+}
+
+func (r *sqlPresence) list(query string, args ...interface{}) ([]PresenceRecord, error) {
+	rows, err := r.query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []PresenceRecord
+	for rows.Next() {
+		record, err := scanPresence(rows)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+func (r *sqlPresence) Save(record PresenceRecord) error {
+	_, err := r.exec(`
+		INSERT INTO user_online (user_id, status, custom_status, show_last_seen, last_activity)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (user_id) DO UPDATE SET
+			status = excluded.status,
+			custom_status = excluded.custom_status,
+			show_last_seen = excluded.show_last_seen`,
+		record.UserID, record.Status, record.CustomStatus, record.ShowLastSeen, time.Now())
+	return err
+}
+
+func (r *sqlPresence) SetIdle(userID string, idle bool) error {
+	_, err := r.exec("UPDATE user_online SET is_idle = ? WHERE user_id = ?", idle, userID)
+	return err
+}
+
+func (r *sqlPresence) SetOnline(statuses map[string]bool) error {
+	return r.inTx(func(tx sqlTx) error {
+		// Upsert so the user's chosen status and privacy settings survive reconnects
+		stmt, err := tx.prepare(`
+			INSERT INTO user_online (user_id, is_online, is_idle, last_activity)
+			VALUES (?, ?, FALSE, ?)
+			ON CONFLICT (user_id) DO UPDATE SET
+				is_online = excluded.is_online,
+				is_idle = FALSE,
+				last_activity = excluded.last_activity`)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+
+		now := time.Now()
+		for userID, isOnline := range statuses {
+			if _, err := stmt.Exec(userID, isOnline, now); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+type sqlEvents struct{ sqlRepository }
+
+func (r *sqlEvents) Append(userID, eventType, payload string) (int64, error) {
+	var seq int64
+	err := r.insert(`
+		INSERT INTO user_events (user_id, type, payload, created_at)
+		VALUES (?, ?, ?, ?)
+		RETURNING seq`,
+		userID, eventType, payload, time.Now()).Scan(&seq)
+	return seq, err
+}
+
+func (r *sqlEvents) Ack(userID string, seq int64) error {
+	_, err := r.exec(`
+		INSERT INTO user_sync_cursor (user_id, last_ack_seq, updated_at)
+		VALUES (?, ?, ?)
+		ON CONFLICT (user_id) DO UPDATE SET
+			last_ack_seq = `+r.dialect.greatest("user_sync_cursor.last_ack_seq", "excluded.last_ack_seq")+`,
+			updated_at = excluded.updated_at`,
+		userID, seq, time.Now())
+	return err
+}
+
+func (r *sqlEvents) Cursor(userID string) (int64, time.Time, bool, error) {
+	var seq int64
+	var updated nullTime
+	err := r.queryRow("SELECT last_ack_seq, updated_at FROM user_sync_cursor WHERE user_id = ?", userID).Scan(&seq, &updated)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, time.Time{}, false, nil
+	}
+	if err != nil {
+		return 0, time.Time{}, false, err
+	}
+	return seq, updated.Time, true, nil
+}
+
+func (r *sqlEvents) Since(userID string, seq int64, since time.Time, limit int) ([]model.WebSocketMessage, error) {
+	rows, err := r.query(`
+		SELECT seq, type, payload
+		FROM user_events
+		WHERE user_id = ? AND seq > ? AND created_at >= ?
+		ORDER BY seq DESC
+		LIMIT ?`,
+		userID, seq, since, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []model.WebSocketMessage
+	for rows.Next() {
+		var event model.WebSocketMessage
+		var payload string
+		if err := rows.Scan(&event.Seq, &event.Type, &payload); err != nil {
+			return nil, err
+		}
+		event.Data = json.RawMessage(payload)
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+func (r *sqlEvents) Prune(before time.Time) (int64, error) {
+	result, err := r.exec("DELETE FROM user_events WHERE created_at < ?", before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
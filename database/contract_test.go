@@ -0,0 +1,698 @@
+package database_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"realtimeforum/database"
+	"realtimeforum/database/dbtest"
+	"realtimeforum/model"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// The contract every backend must honour. Each test gets a fresh
+// database; run them against PostgreSQL too by setting
+// FORUM_TEST_POSTGRES_DSN.
+var contract = []struct {
+	name string
+	run  func(t *testing.T)
+}{
+	{"users/create and get", testUsers},
+	{"users/duplicate username", testDuplicateUser},
+	{"users/update, role and list", testUserAdmin},
+	{"users/password reset revokes sessions", testResetPassword},
+	{"users/purge clears them from the events of others", testPurgeEvents},
+	{"sessions/create, lookup and user", testSessions},
+	{"sessions/expired are hidden and purged", testExpiredSessions},
+	{"sessions/foreign keys are enforced", testForeignKeys},
+	{"topics/create, rename and list", testTopics},
+	{"topics/delete keeps the posts", testDeleteTopic},
+	{"posts/create with topics and get", testPosts},
+	{"posts/feed, by topic and by user", testPostLists},
+	{"comments/create and list", testComments},
+	{"feed/likes, filters, sorts and cursors", testFeed},
+	{"follows/users, topics and the following feed", testFollows},
+	{"bookmarks/collections, pages and flags", testBookmarks},
+	{"profiles/counts, activity and privacy", testProfiles},
+	{"chat/messages, contacts and read state", testChat},
+	{"presence/defaults, save, idle and online", testPresence},
+	{"events/append, ack, replay and prune", testEvents},
+}
+
+func TestContract(t *testing.T) {
+	for _, dialect := range dbtest.Dialects {
+		t.Run(string(dialect), func(t *testing.T) {
+			for _, c := range contract {
+				t.Run(c.name, func(t *testing.T) {
+					dbtest.Open(t, dialect)
+					c.run(t)
+				})
+			}
+		})
+	}
+}
+
+// fixture is the data most tests start from: two users, three topics and
+// a post of alice in all of them.
+type fixture struct {
+	alice, bob *model.User
+	topicIDs   []int
+	postID     int
+}
+
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+	f := &fixture{alice: createUser(t, "alice"), bob: createUser(t, "bob")}
+	for i, emoji := range []string{"🧪", "🧫", "🧬"} {
+		id, err := database.Topics.Create(fmt.Sprintf("Topic %d", i), emoji, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.topicIDs = append(f.topicIDs, id)
+	}
+	f.postID = createPost(t, f.alice.ID, "Contract post", f.topicIDs...)
+	return f
+}
+
+func newUser(name string) *model.User {
+	return &model.User{
+		ID:            uuid.New().String(),
+		Username:      name,
+		Email:         name + "@example.com",
+		PasswordHash:  "hash",
+		FirstName:     "First",
+		LastName:      "Last",
+		Age:           30,
+		Gender:        "other",
+		TermsAccepted: true,
+	}
+}
+
+func createUser(t *testing.T, name string) *model.User {
+	t.Helper()
+	user := newUser(name)
+	if err := database.Users.Create(user); err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func createPost(t *testing.T, userID, title string, topicIDs ...int) int {
+	t.Helper()
+	id, err := database.Posts.Create(database.NewPost{Title: title, Content: plain("Content of " + title), UserID: userID, TopicIDs: topicIDs})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// plain is content stored as written.
+func plain(text string) database.Content {
+	return database.Content{Text: text, Format: model.ContentPlain}
+}
+
+// expect reports a mismatch without stopping the test.
+func expect(t *testing.T, what string, got, want interface{}) {
+	t.Helper()
+	if got != want {
+		t.Errorf("%s = %v, want %v", what, got, want)
+	}
+}
+
+func expectError(t *testing.T, what string, err, want error) {
+	t.Helper()
+	if !errors.Is(err, want) {
+		t.Errorf("%s: got error %v, want %v", what, err, want)
+	}
+}
+
+func testUsers(t *testing.T) {
+	alice, bob := createUser(t, "alice"), createUser(t, "bob")
+
+	byID, err := database.Users.GetByID(alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byEmail, err := database.Users.GetByIdentity(alice.Email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := database.Users.IDByIdentity(bob.Username)
+	if err != nil {
+		t.Fatal(err)
+	}
+	missing, err := database.Users.IDByIdentity("nobody")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, notFound := database.Users.GetByID(uuid.New().String())
+
+	expect(t, "username", byID.Username, alice.Username)
+	expect(t, "terms accepted", byID.TermsAccepted, true)
+	expect(t, "default role", byID.Role, "user")
+	expect(t, "created at set", byID.CreatedAt.IsZero(), false)
+	expect(t, "user by email", byEmail.ID, alice.ID)
+	expect(t, "ID by username", id, bob.ID)
+	expect(t, "ID of unknown user", missing, "")
+	expectError(t, "unknown user", notFound, database.ErrUserNotFound)
+}
+
+func testDuplicateUser(t *testing.T) {
+	createUser(t, "alice")
+	duplicate := newUser("alice")
+	duplicate.Email = "other_" + duplicate.Email
+	if err := database.Users.Create(duplicate); err == nil {
+		t.Error("a second user with the same username was created")
+	}
+}
+
+func testUserAdmin(t *testing.T) {
+	bob := createUser(t, "bob")
+	if err := database.Users.Update(bob.ID, "Robert", "Smith", bob.Username, "Cooks on a budget"); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.Users.SetRole(bob.ID, "admin"); err != nil {
+		t.Fatal(err)
+	}
+	unknown := database.Users.SetRole(uuid.New().String(), "admin")
+
+	bob, err := database.Users.GetByID(bob.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	admins, err := database.Users.List(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(admins) != 1 || admins[0].Username != bob.Username {
+		t.Errorf("admins = %v, want only %s", admins, bob.Username)
+	}
+
+	expect(t, "first name", bob.FirstName, "Robert")
+	expect(t, "bio", bob.Bio, "Cooks on a budget")
+	expect(t, "role", bob.Role, "admin")
+	expectError(t, "unknown user", unknown, database.ErrUserNotFound)
+}
+
+func testResetPassword(t *testing.T) {
+	alice := createUser(t, "alice")
+	token := uuid.New().String()
+	if err := database.Sessions.Create(alice.ID, token, time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.Users.ResetPassword(alice.ID, "new hash"); err != nil {
+		t.Fatal(err)
+	}
+	_, _, lookup := database.Sessions.Lookup(token)
+	alice, err := database.Users.GetByID(alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	revoked, err := database.Sessions.DeleteForUser(alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectError(t, "session after reset", lookup, database.ErrSessionNotFound)
+	expect(t, "password hash", alice.PasswordHash, "new hash")
+	expect(t, "sessions left", revoked, int64(0))
+}
+
+func testSessions(t *testing.T) {
+	alice := createUser(t, "alice")
+	token := uuid.New().String()
+	expiry := time.Now().Add(time.Hour).Truncate(time.Second)
+	if err := database.Sessions.Create(alice.ID, token, expiry); err != nil {
+		t.Fatal(err)
+	}
+
+	userID, gotExpiry, err := database.Sessions.Lookup(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := database.Sessions.User(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessions, err := database.Sessions.List(alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, unknown := database.Sessions.Lookup(uuid.New().String())
+	if len(sessions) != 1 {
+		t.Fatalf("got %d sessions, want 1", len(sessions))
+	}
+
+	expect(t, "session user", userID, alice.ID)
+	expect(t, "session expiry", gotExpiry.Equal(expiry), true)
+	expect(t, "user of session", user.ID, alice.ID)
+	expect(t, "session expiry of user", user.SessionExpiry != nil && user.SessionExpiry.Equal(expiry), true)
+	expect(t, "listed username", sessions[0].Username, alice.Username)
+	expectError(t, "unknown session", unknown, database.ErrSessionNotFound)
+}
+
+func testExpiredSessions(t *testing.T) {
+	alice, bob := createUser(t, "alice"), createUser(t, "bob")
+	live, expired := uuid.New().String(), uuid.New().String()
+	if err := database.Sessions.Create(alice.ID, live, time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.Sessions.Create(bob.ID, expired, time.Now().Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	_, hidden := database.Sessions.User(expired)
+
+	purged, err := database.Sessions.DeleteExpired()
+	if err != nil {
+		t.Fatal(err)
+	}
+	found, err := database.Sessions.Delete(expired)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, kept := database.Sessions.Lookup(live)
+
+	expectError(t, "expired session", hidden, database.ErrSessionNotFound)
+	expect(t, "purged", purged, int64(1))
+	expect(t, "purged session found", found, false)
+	expect(t, "live session lookup error", kept, nil)
+}
+
+func testForeignKeys(t *testing.T) {
+	// Several attempts, in case the pool hands out different connections
+	for i := 0; i < 3; i++ {
+		token := uuid.New().String()
+		if err := database.Sessions.Create(uuid.New().String(), token, time.Now().Add(time.Hour)); err == nil {
+			t.Fatal("a session of an unknown user was stored")
+		}
+	}
+}
+
+func testTopics(t *testing.T) {
+	alice := createUser(t, "alice")
+	var topicIDs []int
+	for i, emoji := range []string{"🧪", "🧫", "🧬"} {
+		id, err := database.Topics.Create(fmt.Sprintf("Topic %d", i), emoji, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		topicIDs = append(topicIDs, id)
+	}
+	_, sameName := database.Topics.Create("topic 0", "🔁", "")
+	_, sameEmoji := database.Topics.Create("Another", "🧪", "")
+	_, noName := database.Topics.Create(" ", "🔁", "")
+
+	renamed := "Renamed"
+	if err := database.Topics.Update(topicIDs[0], database.TopicChanges{Name: &renamed}); err != nil {
+		t.Fatal(err)
+	}
+	unknown := database.Topics.Update(-1, database.TopicChanges{Name: &renamed})
+	taken := "TOPIC 1"
+	renamedTaken := database.Topics.Update(topicIDs[0], database.TopicChanges{Name: &taken})
+	id, err := database.Topics.IDByName(renamed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, missing := database.Topics.IDByName("Topic 0")
+
+	// An archived topic is listed on request and takes no posts
+	archivedID, err := database.Topics.Create("Archived", "🗄", "Old posts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	archived, position := true, -1
+	if err := database.Topics.Update(archivedID, database.TopicChanges{Archived: &archived, Position: &position}); err != nil {
+		t.Fatal(err)
+	}
+	_, archivedPost := database.Posts.Create(database.NewPost{Title: "Archived topic post", Content: plain("Content of the post"), UserID: alice.ID, TopicIDs: []int{archivedID}})
+	_, unknownPost := database.Posts.Create(database.NewPost{Title: "Unknown topic post", Content: plain("Content of the post"), UserID: alice.ID, TopicIDs: []int{-1}})
+
+	open, err := database.Topics.List(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	all, err := database.Topics.List(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var emoji string
+	var listedArchived bool
+	for _, topic := range open {
+		if topic.ID == topicIDs[0] {
+			emoji = topic.Emoji
+		}
+		listedArchived = listedArchived || topic.ID == archivedID
+	}
+	topic, err := database.Topics.Get(archivedID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, unknownGet := database.Topics.Get(-1)
+
+	expect(t, "renamed topic ID", id, topicIDs[0])
+	expect(t, "emoji kept by rename", emoji, "🧪")
+	expectError(t, "old name", missing, database.ErrTopicNotFound)
+	expectError(t, "unknown topic", unknown, database.ErrTopicNotFound)
+	expectError(t, "name differing in case", sameName, database.ErrDuplicateTopic)
+	expectError(t, "rename to a name differing in case", renamedTaken, database.ErrDuplicateTopic)
+	expectError(t, "taken emoji", sameEmoji, database.ErrDuplicateTopic)
+	expectError(t, "empty name", noName, database.ErrInvalidTopic)
+	expect(t, "archived topic in the open list", listedArchived, false)
+	expect(t, "archived topic first in the full list", all[0].ID, archivedID)
+	expect(t, "archived topic description", topic.Description, "Old posts")
+	expect(t, "archived topic flag", topic.Archived, true)
+	expectError(t, "post in an archived topic", archivedPost, database.ErrTopicArchived)
+	expectError(t, "post in an unknown topic", unknownPost, database.ErrTopicNotFound)
+	expectError(t, "unknown topic get", unknownGet, database.ErrTopicNotFound)
+}
+
+func testDeleteTopic(t *testing.T) {
+	f := newFixture(t)
+	if err := database.Follows.SetTopic(f.bob.ID, f.topicIDs[2], true); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.Topics.Delete(f.topicIDs[2]); err != nil {
+		t.Fatal(err)
+	}
+	again := database.Topics.Delete(f.topicIDs[2])
+
+	names, err := database.Topics.NamesForPost(f.postID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.Posts.GetByID(f.postID); err != nil {
+		t.Fatal(err)
+	}
+	followed, err := database.Follows.Topics(f.bob.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect(t, "topics left on the post", len(names), 2)
+	expect(t, "follows of the topic", len(followed), 0)
+	expectError(t, "second delete", again, database.ErrTopicNotFound)
+}
+
+func testPosts(t *testing.T) {
+	f := newFixture(t)
+	before, err := database.Posts.Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A repeated topic is stored once
+	topicIDs := []int{f.topicIDs[0], f.topicIDs[1], f.topicIDs[2], f.topicIDs[0]}
+	id := createPost(t, f.alice.ID, "Second post", topicIDs...)
+
+	post, err := database.Posts.GetByID(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names, err := database.Topics.NamesForPost(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	after, err := database.Posts.Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, missing := database.Posts.GetByID(-1)
+
+	expect(t, "title", post.Title, "Second post")
+	expect(t, "author", post.Author, f.alice.Username)
+	expect(t, "created at set", post.CreatedAt.IsZero(), false)
+	expect(t, "topics", len(names), 3)
+	expect(t, "count", after, before+1)
+	expectError(t, "unknown post", missing, database.ErrPostNotFound)
+}
+
+func testPostLists(t *testing.T) {
+	f := newFixture(t)
+	feed, err := database.Posts.Feed(database.FeedQuery{Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	byTopic, err := database.Posts.Feed(database.FeedQuery{TopicIDs: []int{f.topicIDs[1]}, Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	byUser, err := database.Posts.ByUser(f.alice.ID, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(feed.Posts) != 1 || len(byTopic.Posts) != 1 || len(byUser) != 1 {
+		t.Fatalf("got %d feed, %d topic and %d user posts, want 1 each", len(feed.Posts), len(byTopic.Posts), len(byUser))
+	}
+	topic, err := database.Topics.Get(f.topicIDs[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect(t, "topic post count", topic.PostCount, 1)
+	expect(t, "topic last activity", topic.LastActivity.IsZero(), false)
+	expect(t, "newest feed post", feed.Posts[0].ID, f.postID)
+	expect(t, "feed topics", len(feed.Posts[0].Topics), 3)
+	expect(t, "feed created at", feed.Posts[0].CreatedAt != "", true)
+	expect(t, "topic post", byTopic.Posts[0].ID, f.postID)
+	expect(t, "topic post topics", len(byTopic.Posts[0].Topics), 3)
+	expect(t, "last topic page", byTopic.NextCursor, "")
+	expect(t, "user post", byUser[0].ID, f.postID)
+	expect(t, "user post topics", len(byUser[0].Topics), 3)
+}
+
+func testComments(t *testing.T) {
+	f := newFixture(t)
+	for _, content := range []string{"First comment", "Second comment"} {
+		if _, err := database.Comments.Create(plain(content), f.bob.ID, f.postID); err != nil {
+			t.Fatal(err)
+		}
+		// Comments are ordered by time
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	all, err := database.Comments.ByPost(f.postID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, err := database.Comments.ByPostPage(f.postID, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	count, err := database.Comments.CountByPost(f.postID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byUser, err := database.Comments.ByUser(f.bob.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newest, err := database.Posts.Feed(database.FeedQuery{Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	feed := newest.Posts
+	if len(all) != 2 || len(page) != 1 || len(byUser) != 2 || len(feed) != 1 || len(feed[0].RecentComments) != 2 {
+		t.Fatalf("got %d comments, %d on the page, %d by bob and %d feed posts, want 2, 1, 2 and 1 with 2 comments",
+			len(all), len(page), len(byUser), len(feed))
+	}
+
+	expect(t, "oldest comment first", all[0].Content, "First comment")
+	expect(t, "comment author", all[0].Author, f.bob.Username)
+	expect(t, "second page", page[0].Content, "Second comment")
+	expect(t, "count", count, 2)
+	expect(t, "newest user comment first", byUser[0].Content, "Second comment")
+	expect(t, "post title of user comment", byUser[0].PostTitle, "Contract post")
+	expect(t, "feed comment count", feed[0].CommentsCount, 2)
+	expect(t, "feed oldest comment first", feed[0].RecentComments[0].Content, "First comment")
+}
+
+func testChat(t *testing.T) {
+	alice, bob := createUser(t, "alice"), createUser(t, "bob")
+	var last *model.ChatMessage
+	for _, m := range []struct{ from, to, text string }{
+		{alice.ID, bob.ID, "hi bob"},
+		{bob.ID, alice.ID, "hi alice"},
+		{bob.ID, alice.ID, "how are you?"},
+	} {
+		msg, err := database.Chat.SaveMessage(m.from, m.to, m.text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := database.Chat.SetLastMessage(m.from, m.to, msg.ID); err != nil {
+			t.Fatal(err)
+		}
+		last = msg
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	conversation, err := database.Chat.Conversation(alice.ID, bob.ID, 2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conversation) != 2 {
+		t.Fatalf("got %d messages, want 2", len(conversation))
+	}
+	contacts, err := database.Chat.Contacts(alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(contacts) != 1 || contacts[0].Presence.UserID != bob.ID {
+		t.Fatalf("contacts of alice = %v, want only bob", contacts)
+	}
+	read, err := database.Chat.MarkRead(alice.ID, bob.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := database.Chat.MarkRead(alice.ID, bob.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect(t, "sender name", last.SenderName, bob.Username)
+	expect(t, "newest message first", conversation[0].Message, "how are you?")
+	expect(t, "message unread", conversation[0].IsRead, false)
+	expect(t, "last message", contacts[0].LastMessage, "how are you?")
+	expect(t, "unread count", contacts[0].UnreadCount, 2)
+	expect(t, "marked read", read, int64(2))
+	expect(t, "marked read twice", again, int64(0))
+}
+
+func testPresence(t *testing.T) {
+	alice, bob := createUser(t, "alice"), createUser(t, "bob")
+	defaults, err := database.Presence.Load(alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "default online", defaults.IsOnline, false)
+	expect(t, "default status", defaults.Status, "available")
+	expect(t, "default last seen", defaults.ShowLastSeen, true)
+	expect(t, "default last activity", defaults.LastActivity.IsZero(), false)
+
+	if err := database.Presence.SetOnline(map[string]bool{alice.ID: true, bob.ID: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.Presence.Save(database.PresenceRecord{
+		UserID: alice.ID, Status: "dnd", CustomStatus: "Busy", ShowLastSeen: false,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.Presence.SetIdle(alice.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	// Reconnecting keeps the status and clears the idle flag
+	if err := database.Presence.SetOnline(map[string]bool{alice.ID: true, bob.ID: false}); err != nil {
+		t.Fatal(err)
+	}
+
+	states, err := database.Presence.LoadMany([]string{alice.ID, bob.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	all, err := database.Presence.All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, missing := database.Presence.Load(uuid.New().String())
+
+	byID := make(map[string]database.PresenceRecord)
+	for _, s := range states {
+		byID[s.UserID] = s
+	}
+	a, b := byID[alice.ID], byID[bob.ID]
+
+	expect(t, "loaded", len(states), 2)
+	expect(t, "alice online", a.IsOnline, true)
+	expect(t, "alice status", a.Status, "dnd")
+	expect(t, "alice custom status", a.CustomStatus, "Busy")
+	expect(t, "alice last seen hidden", a.ShowLastSeen, false)
+	expect(t, "alice idle", a.IsIdle, false)
+	expect(t, "bob online", b.IsOnline, false)
+	expect(t, "everyone listed", len(all), 2)
+	expectError(t, "unknown user", missing, database.ErrUserNotFound)
+}
+
+func testEvents(t *testing.T) {
+	alice := createUser(t, "alice")
+	if _, _, found, err := database.Events.Cursor(alice.ID); err != nil || found {
+		t.Fatalf("new user has a cursor (%v)", err)
+	}
+
+	var seqs []int64
+	for i := 0; i < 3; i++ {
+		seq, err := database.Events.Append(alice.ID, "notification", fmt.Sprintf(`{"n":%d}`, i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		seqs = append(seqs, seq)
+	}
+	if seqs[0] >= seqs[1] || seqs[1] >= seqs[2] {
+		t.Fatalf("sequence numbers %v are not increasing", seqs)
+	}
+
+	// The cursor only moves forward
+	if err := database.Events.Ack(alice.ID, seqs[1]); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.Events.Ack(alice.ID, seqs[0]); err != nil {
+		t.Fatal(err)
+	}
+	acked, _, found, err := database.Events.Cursor(alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	missed, err := database.Events.Since(alice.ID, acked, time.Now().Add(-time.Hour), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(missed) != 1 {
+		t.Fatalf("got %d missed events, want 1", len(missed))
+	}
+	if _, err := database.Events.Prune(time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	pruned, err := database.Events.Since(alice.ID, 0, time.Time{}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect(t, "cursor found", found, true)
+	expect(t, "acked seq", acked, seqs[1])
+	expect(t, "missed seq", missed[0].Seq, seqs[2])
+	expect(t, "missed payload", string(missed[0].Data.(json.RawMessage)), `{"n":2}`)
+	expect(t, "events after prune", len(pruned), 0)
+}
+
+func testPurgeEvents(t *testing.T) {
+	f := newFixture(t)
+	mention := `"` + f.bob.ID + `"`
+	for _, event := range []struct{ userID, eventType, payload string }{
+		{f.alice.ID, "new_message", `{"sender_id":` + mention + `,"message":"Goodbye"}`},
+		{f.alice.ID, "messages_read", `{"reader_id":` + mention + `,"count":1}`},
+		{f.alice.ID, "notification", `{"kind":"comment","user_id":` + mention + `}`},
+		{f.alice.ID, "notification", `{"kind":"post_published","post_id":1}`},
+		{f.bob.ID, "notification", `{"kind":"post_published","post_id":2}`},
+	} {
+		if _, err := database.Events.Append(event.userID, event.eventType, event.payload); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := database.Users.Purge(f.bob.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := database.Events.Since(f.alice.ID, 0, time.Time{}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var payloads []string
+	for _, event := range events {
+		payloads = append(payloads, string(event.Data.(json.RawMessage)))
+	}
+	// Newest first
+	expect(t, "events left", strings.Join(payloads, " "),
+		`{"kind":"post_published","post_id":1} {"kind":"comment","user_id":"`+database.DeletedUserID+`"}`)
+}
@@ -3,47 +3,100 @@ package database
 import (
     "database/sql"
     "fmt"
-    "os"
+    "runtime"
     "strings"
+    "time"
 
+    _ "github.com/lib/pq"
     _ "github.com/mattn/go-sqlite3"
 )
 
-func RunSQLFromFile(db *sql.DB, filepath string) error {
-    content, err := os.ReadFile(filepath)
-    if err != nil {
-        return fmt.Errorf("failed to read %s: %w", filepath, err)
+// sqliteBusyTimeout is how long a SQLite connection waits for another
+// process holding the write lock, forumctl for example, before it fails
+// with "database is locked".
+const sqliteBusyTimeout = 5 * time.Second
+
+// OpenDatabase opens the database without touching its schema. source is
+// the SQLite file, or the connection URL for PostgreSQL.
+//
+// For SQLite this is the write pool. It holds a single connection, so
+// writers of this process queue in database/sql instead of competing for
+// the file lock, and every connection gets WAL mode, the busy timeout
+// and foreign keys, which SQLite otherwise turns off per connection.
+func OpenDatabase(dialect Dialect, source string) (*sql.DB, error) {
+    if dialect == SQLite {
+        // Transactions take the write lock when they begin, not on their
+        // first write, so they never fail halfway through
+        source = sqliteDSN(source, "_journal_mode=WAL", "_synchronous=NORMAL", "_txlock=immediate")
     }
 
-    queries := strings.Split(string(content), ";")
-    for _, query := range queries {
-        cleaned := strings.TrimSpace(query)
-        if cleaned == "" {
-            continue
-        }
-        _, err := db.Exec(cleaned)
-        if err != nil {
-            return fmt.Errorf("error executing query from %s: %s\nQuery: %s", filepath, err, cleaned)
-        }
+    db, err := sql.Open(dialect.driverName(), source)
+    if err != nil {
+        return nil, fmt.Errorf("failed to open database: %w", err)
+    }
+    if dialect == SQLite {
+        db.SetMaxOpenConns(1)
+        db.SetConnMaxLifetime(0)
     }
-    return nil
+    if err := db.Ping(); err != nil {
+        db.Close()
+        return nil, fmt.Errorf("failed to open %s database: %w", dialect, err)
+    }
+    return db, nil
 }
 
-func InitDatabase() (*sql.DB, error) {
-    db, err := sql.Open("sqlite3", "./mydatabase.db")
+// OpenReadPool opens the connections queries go through, next to the
+// write pool db returned by OpenDatabase. SQLite readers see the last
+// committed state in WAL mode and never wait for the writer; they are
+// query-only so a write sent there by mistake fails instead of taking
+// the lock. PostgreSQL handles concurrency itself and shares db.
+func OpenReadPool(dialect Dialect, source string, db *sql.DB) (*sql.DB, error) {
+    if dialect != SQLite {
+        return db, nil
+    }
+
+    readDB, err := sql.Open(dialect.driverName(), sqliteDSN(source, "_query_only=true"))
     if err != nil {
-        return nil, fmt.Errorf("failed to open database: %w", err)
+        return nil, fmt.Errorf("failed to open read pool: %w", err)
     }
+    readDB.SetMaxOpenConns(max(4, runtime.NumCPU()))
+    readDB.SetMaxIdleConns(max(4, runtime.NumCPU()))
+    if err := readDB.Ping(); err != nil {
+        readDB.Close()
+        return nil, fmt.Errorf("failed to open read pool: %w", err)
+    }
+    return readDB, nil
+}
+
+// sqliteDSN adds the settings every SQLite connection needs, and params,
+// to the file name or file: URI of the database.
+func sqliteDSN(source string, params ...string) string {
+    busyTimeout := fmt.Sprintf("_busy_timeout=%d", sqliteBusyTimeout.Milliseconds())
+    params = append([]string{busyTimeout, "_foreign_keys=on"}, params...)
 
-    // Load schema
-    if err := RunSQLFromFile(db, "./database/schema.sql"); err != nil {
+    separator := "?"
+    if strings.Contains(source, "?") {
+        separator = "&"
+    }
+    return source + separator + strings.Join(params, "&")
+}
+
+// InitDatabase opens the database and applies any pending migration.
+// Demo data is only loaded by the seed command.
+func InitDatabase(dialect Dialect, source string) (*sql.DB, error) {
+    db, err := OpenDatabase(dialect, source)
+    if err != nil {
         return nil, err
     }
 
-    // Load seed data
-    if err := RunSQLFromFile(db, "./database/seed.sql"); err != nil {
+    applied, err := Migrate(db, false)
+    if err != nil {
+        db.Close()
         return nil, err
     }
+    for _, migration := range applied {
+        fmt.Printf("Applied migration %04d_%s\n", migration.Version, migration.Name)
+    }
 
     fmt.Println("Database initialized successfully!")
     return db, nil
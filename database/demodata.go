@@ -0,0 +1,203 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DemoSize is how much generated demo data GenerateDemoData inserts.
+type DemoSize struct {
+	Users    int
+	Posts    int
+	Comments int
+	Likes    int
+	Messages int
+}
+
+var demoWords = strings.Fields(`budget groceries recipe bike train coffee garden
+	phone laptop repair rent savings market weekend family school doctor
+	insurance deal store delivery lunch dinner soup salad bread cheap quick
+	easy healthy local fresh seasonal tip question idea plan review city`)
+
+var demoNames = strings.Fields(`Alex Sam Jo Lee Kim Max Noa Eli Ana Ben Mia Leo
+	Ivy Tom Zoe Ray Eva Dan Liv Hugo`)
+
+// GenerateDemoData inserts random users, posts, comments, likes and chat messages
+// in one transaction. Every user gets passwordHash, and usernames and post
+// titles carry a per-run prefix so the command can be run repeatedly.
+func GenerateDemoData(db *sql.DB, size DemoSize, passwordHash string, rng *rand.Rand) error {
+	if size.Users < 1 && (size.Posts > 0 || size.Comments > 0 || size.Likes > 0 || size.Messages > 0) {
+		return errors.New("demo posts, comments, likes and messages need at least one demo user")
+	}
+	if size.Messages > 0 && size.Users < 2 {
+		return errors.New("demo messages need at least two demo users")
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	dialect := DialectOf(db)
+
+	var topicIDs []int
+	rows, err := tx.Query("SELECT id FROM topics")
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		topicIDs = append(topicIDs, id)
+	}
+	rows.Close()
+	if len(topicIDs) == 0 && size.Posts > 0 {
+		return errors.New("demo posts need at least one topic")
+	}
+
+	run := uuid.New().String()[:6]
+	now := time.Now()
+	randomTime := func(after time.Time) time.Time {
+		span := now.Sub(after)
+		if span <= 0 {
+			return now
+		}
+		return after.Add(time.Duration(rng.Int63n(int64(span))))
+	}
+	since := now.AddDate(0, 0, -90)
+
+	userStmt, err := tx.Prepare(dialect.Rebind(`
+		INSERT INTO users (id, username, email, password_hash, first_name, last_name, age, gender, terms_accepted, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, TRUE, ?)`))
+	if err != nil {
+		return err
+	}
+	defer userStmt.Close()
+
+	genders := []string{"male", "female", "other"}
+	userIDs := make([]string, size.Users)
+	for i := range userIDs {
+		userIDs[i] = uuid.New().String()
+		username := fmt.Sprintf("demo_%s_%d", run, i+1)
+		_, err := userStmt.Exec(userIDs[i], username, username+"@example.com", passwordHash,
+			demoNames[rng.Intn(len(demoNames))], demoNames[rng.Intn(len(demoNames))],
+			18+rng.Intn(60), genders[rng.Intn(len(genders))], since)
+		if err != nil {
+			return fmt.Errorf("demo user: %w", err)
+		}
+	}
+
+	postStmt, err := tx.Prepare(dialect.Rebind("INSERT INTO posts (title, content, user_id, created_at, updated_at) VALUES (?, ?, ?, ?, ?) RETURNING id"))
+	if err != nil {
+		return err
+	}
+	defer postStmt.Close()
+	topicStmt, err := tx.Prepare(dialect.Rebind("INSERT INTO posts_topics (post_id, topic_id) VALUES (?, ?) ON CONFLICT DO NOTHING"))
+	if err != nil {
+		return err
+	}
+	defer topicStmt.Close()
+
+	type demoPost struct {
+		id        int64
+		createdAt time.Time
+	}
+	posts := make([]demoPost, 0, size.Posts)
+	for i := 0; i < size.Posts; i++ {
+		createdAt := randomTime(since)
+		title := fmt.Sprintf("%s (%s #%d)", demoSentence(rng, 3, 7), run, i+1)
+		var id int64
+		err := postStmt.QueryRow(title, demoParagraph(rng), userIDs[rng.Intn(len(userIDs))], createdAt, createdAt).Scan(&id)
+		if err != nil {
+			return fmt.Errorf("demo post: %w", err)
+		}
+		posts = append(posts, demoPost{id: id, createdAt: createdAt})
+
+		for n := 1 + rng.Intn(3); n > 0; n-- {
+			if _, err := topicStmt.Exec(id, topicIDs[rng.Intn(len(topicIDs))]); err != nil {
+				return fmt.Errorf("demo post topic: %w", err)
+			}
+		}
+	}
+
+	if size.Comments > 0 && len(posts) == 0 {
+		return errors.New("demo comments need demo posts")
+	}
+	commentStmt, err := tx.Prepare(dialect.Rebind("INSERT INTO comments (content, user_id, post_id, created_at) VALUES (?, ?, ?, ?)"))
+	if err != nil {
+		return err
+	}
+	defer commentStmt.Close()
+	for i := 0; i < size.Comments; i++ {
+		post := posts[rng.Intn(len(posts))]
+		_, err := commentStmt.Exec(demoSentence(rng, 5, 20), userIDs[rng.Intn(len(userIDs))], post.id, randomTime(post.createdAt))
+		if err != nil {
+			return fmt.Errorf("demo comment: %w", err)
+		}
+	}
+
+	if size.Likes > 0 && len(posts) == 0 {
+		return errors.New("demo likes need demo posts")
+	}
+	// A user likes a post once, so repeated picks are skipped
+	likeStmt, err := tx.Prepare(dialect.Rebind("INSERT INTO post_likes (post_id, user_id, created_at) VALUES (?, ?, ?) ON CONFLICT DO NOTHING"))
+	if err != nil {
+		return err
+	}
+	defer likeStmt.Close()
+	for i := 0; i < size.Likes; i++ {
+		post := posts[rng.Intn(len(posts))]
+		_, err := likeStmt.Exec(post.id, userIDs[rng.Intn(len(userIDs))], randomTime(post.createdAt))
+		if err != nil {
+			return fmt.Errorf("demo like: %w", err)
+		}
+	}
+
+	if size.Posts > 0 || size.Comments > 0 {
+		if _, err := tx.Exec(refreshTopicActivity); err != nil {
+			return fmt.Errorf("demo topic activity: %w", err)
+		}
+	}
+
+	messageStmt, err := tx.Prepare(dialect.Rebind("INSERT INTO chat_messages (sender_id, receiver_id, message, created_at, is_read) VALUES (?, ?, ?, ?, TRUE)"))
+	if err != nil {
+		return err
+	}
+	defer messageStmt.Close()
+	for i := 0; i < size.Messages; i++ {
+		sender := rng.Intn(len(userIDs))
+		receiver := (sender + 1 + rng.Intn(len(userIDs)-1)) % len(userIDs)
+		_, err := messageStmt.Exec(userIDs[sender], userIDs[receiver], demoSentence(rng, 2, 12), randomTime(since))
+		if err != nil {
+			return fmt.Errorf("demo message: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+func demoSentence(rng *rand.Rand, min, max int) string {
+	words := make([]string, min+rng.Intn(max-min+1))
+	for i := range words {
+		words[i] = demoWords[rng.Intn(len(demoWords))]
+	}
+	sentence := strings.Join(words, " ")
+	return strings.ToUpper(sentence[:1]) + sentence[1:]
+}
+
+func demoParagraph(rng *rand.Rand) string {
+	sentences := make([]string, 2+rng.Intn(4))
+	for i := range sentences {
+		sentences[i] = demoSentence(rng, 6, 16) + "."
+	}
+	return strings.Join(sentences, " ")
+}
@@ -0,0 +1,127 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+)
+
+// Dialect is the SQL flavour of a storage backend. Queries are written
+// once with ? placeholders and portable SQL; the dialect covers the few
+// places where SQLite and PostgreSQL differ.
+type Dialect string
+
+// Supported backends, chosen with the database driver setting.
+const (
+	SQLite   Dialect = "sqlite"
+	Postgres Dialect = "postgres"
+)
+
+// ParseDialect accepts the names used in the configuration.
+func ParseDialect(name string) (Dialect, error) {
+	switch strings.ToLower(name) {
+	case "sqlite", "sqlite3":
+		return SQLite, nil
+	case "postgres", "postgresql":
+		return Postgres, nil
+	}
+	return "", fmt.Errorf("unknown database driver %q, expected sqlite or postgres", name)
+}
+
+// DialectOf tells which backend an open database belongs to.
+func DialectOf(db *sql.DB) Dialect {
+	if _, ok := db.Driver().(*pq.Driver); ok {
+		return Postgres
+	}
+	return SQLite
+}
+
+// driverName is the database/sql driver of the dialect.
+func (d Dialect) driverName() string {
+	if d == Postgres {
+		return "postgres"
+	}
+	return "sqlite3"
+}
+
+// Rebind turns ? placeholders into PostgreSQL's $1, $2...; queries never
+// contain a literal question mark.
+func (d Dialect) Rebind(query string) string {
+	if d != Postgres {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// greatest is the larger of two values, MAX() in SQLite.
+func (d Dialect) greatest(a, b string) string {
+	if d == Postgres {
+		return "GREATEST(" + a + ", " + b + ")"
+	}
+	return "MAX(" + a + ", " + b + ")"
+}
+
+// isUniqueViolation reports whether err comes from a UNIQUE constraint.
+func isUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique ||
+			sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "23505"
+	}
+	return false
+}
+
+// nullTime scans timestamps from either backend. SQLite hands them back
+// as text whenever the column goes through COALESCE, a subquery or
+// another expression, PostgreSQL always as time.Time.
+type nullTime struct {
+	Time  time.Time
+	Valid bool
+}
+
+func (t *nullTime) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		t.Time, t.Valid = time.Time{}, false
+	case time.Time:
+		t.Time, t.Valid = v, true
+	case string:
+		t.Time, t.Valid = parseTimestamp(v), true
+	case []byte:
+		t.Time, t.Valid = parseTimestamp(string(v)), true
+	default:
+		return fmt.Errorf("cannot scan %T into a timestamp", value)
+	}
+	return nil
+}
+
+func parseTimestamp(value string) time.Time {
+	value = strings.TrimSuffix(value, "Z")
+	for _, format := range sqlite3.SQLiteTimestampFormats {
+		if t, err := time.Parse(format, value); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
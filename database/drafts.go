@@ -0,0 +1,214 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"realtimeforum/model"
+	"time"
+)
+
+const draftColumns = "d.id, d.title, d.content, d.content_format, d.revision, d.created_at, d.updated_at"
+
+type sqlDrafts struct{ sqlRepository }
+
+func scanDraft(row rowScanner) (*model.Draft, error) {
+	var d model.Draft
+	var createdAt, updatedAt nullTime
+	if err := row.Scan(&d.ID, &d.Title, &d.Content, &d.Format, &d.Revision, &createdAt, &updatedAt); err != nil {
+		return nil, err
+	}
+	d.CreatedAt, d.UpdatedAt = createdAt.Time, updatedAt.Time
+	d.Topics = []int{}
+	return &d, nil
+}
+
+func (r *sqlDrafts) Create(draft NewDraft) (*model.Draft, error) {
+	var created *model.Draft
+	err := r.inTx(func(tx sqlTx) error {
+		now := time.Now()
+		var id int
+		err := tx.queryRow(`
+			INSERT INTO drafts (user_id, title, content, content_format, revision, created_at, updated_at)
+			VALUES (?, ?, ?, ?, 1, ?, ?)
+			RETURNING id`,
+			draft.UserID, draft.Title, draft.Content, draft.Format, now, now,
+		).Scan(&id)
+		if err != nil {
+			return dbError(err)
+		}
+		if err := setDraftTopics(tx, id, draft.TopicIDs); err != nil {
+			return err
+		}
+		created, err = loadDraft(tx, id, draft.UserID)
+		return err
+	})
+	return created, err
+}
+
+func (r *sqlDrafts) Save(id, revision int, draft NewDraft) (*model.Draft, error) {
+	var saved *model.Draft
+	err := r.inTx(func(tx sqlTx) error {
+		result, err := tx.exec(`
+			UPDATE drafts SET title = ?, content = ?, content_format = ?, revision = revision + 1, updated_at = ?
+			WHERE id = ? AND user_id = ? AND revision = ?`,
+			draft.Title, draft.Content, draft.Format, time.Now(), id, draft.UserID, revision)
+		if err != nil {
+			return dbError(err)
+		}
+		if err := requireOneRow(result, ErrDraftConflict); err != nil {
+			if !errors.Is(err, ErrDraftConflict) {
+				return err
+			}
+			// Another revision, or no such draft
+			if _, err := loadDraft(tx, id, draft.UserID); err != nil {
+				return err
+			}
+			return ErrDraftConflict
+		}
+
+		if _, err := tx.exec("DELETE FROM drafts_topics WHERE draft_id = ?", id); err != nil {
+			return dbError(err)
+		}
+		if err := setDraftTopics(tx, id, draft.TopicIDs); err != nil {
+			return err
+		}
+		saved, err = loadDraft(tx, id, draft.UserID)
+		return err
+	})
+	return saved, err
+}
+
+func (r *sqlDrafts) Get(id int, userID string) (*model.Draft, error) {
+	return loadDraft(r, id, userID)
+}
+
+func (r *sqlDrafts) List(userID string) ([]model.Draft, error) {
+	rows, err := r.query(`
+		SELECT `+draftColumns+`
+		FROM drafts d
+		WHERE d.user_id = ?
+		ORDER BY d.updated_at DESC, d.id DESC`, userID)
+	if err != nil {
+		return nil, dbError(err)
+	}
+	defer rows.Close()
+
+	drafts := []model.Draft{}
+	for rows.Next() {
+		draft, err := scanDraft(rows)
+		if err != nil {
+			return nil, dbError(err)
+		}
+		drafts = append(drafts, *draft)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, dbError(err)
+	}
+	if len(drafts) == 0 {
+		return drafts, nil
+	}
+
+	ids := make([]interface{}, len(drafts))
+	for i, draft := range drafts {
+		ids[i] = draft.ID
+	}
+	topics, err := draftTopics(r, "("+placeholders(len(ids))+")", ids...)
+	if err != nil {
+		return nil, err
+	}
+	for i := range drafts {
+		if t := topics[drafts[i].ID]; t != nil {
+			drafts[i].Topics = t
+		}
+	}
+	return drafts, nil
+}
+
+func (r *sqlDrafts) Count(userID string) (int, error) {
+	var count int
+	if err := r.queryRow("SELECT COUNT(*) FROM drafts WHERE user_id = ?", userID).Scan(&count); err != nil {
+		return 0, dbError(err)
+	}
+	return count, nil
+}
+
+func (r *sqlDrafts) Delete(id int, userID string) error {
+	result, err := r.exec("DELETE FROM drafts WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		return dbError(err)
+	}
+	return requireOneRow(result, ErrDraftNotFound)
+}
+
+// loadDraft returns a draft of userID with its topics, or
+// ErrDraftNotFound.
+func loadDraft(q sqlReader, id int, userID string) (*model.Draft, error) {
+	draft, err := scanDraft(q.queryRow(`
+		SELECT `+draftColumns+`
+		FROM drafts d
+		WHERE d.id = ? AND d.user_id = ?`, id, userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrDraftNotFound
+	}
+	if err != nil {
+		return nil, dbError(err)
+	}
+
+	topics, err := draftTopics(q, "(?)", id)
+	if err != nil {
+		return nil, err
+	}
+	if t := topics[id]; t != nil {
+		draft.Topics = t
+	}
+	return draft, nil
+}
+
+// draftTopics returns the topic IDs of the drafts IN ids, a list of
+// placeholders, by draft ID.
+func draftTopics(q sqlReader, ids string, args ...interface{}) (map[int][]int, error) {
+	rows, err := q.query(`
+		SELECT draft_id, topic_id FROM drafts_topics
+		WHERE draft_id IN `+ids+`
+		ORDER BY draft_id, topic_id`, args...)
+	if err != nil {
+		return nil, dbError(err)
+	}
+	defer rows.Close()
+
+	topics := make(map[int][]int)
+	for rows.Next() {
+		var draftID, topicID int
+		if err := rows.Scan(&draftID, &topicID); err != nil {
+			return nil, dbError(err)
+		}
+		topics[draftID] = append(topics[draftID], topicID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, dbError(err)
+	}
+	return topics, nil
+}
+
+// setDraftTopics tags a draft with the topics of topicIDs that exist.
+// Archived ones are kept; publishing reports them.
+func setDraftTopics(tx sqlTx, draftID int, topicIDs []int) error {
+	seen := make(map[int]bool)
+	args := []interface{}{draftID}
+	for _, id := range topicIDs {
+		if !seen[id] {
+			seen[id] = true
+			args = append(args, id)
+		}
+	}
+	if len(args) == 1 {
+		return nil
+	}
+	_, err := tx.exec(`
+		INSERT INTO drafts_topics (draft_id, topic_id)
+		SELECT CAST(? AS INTEGER), id FROM topics WHERE id IN (`+placeholders(len(args)-1)+`)`, args...)
+	if err != nil {
+		return dbError(err)
+	}
+	return nil
+}
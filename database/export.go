@@ -0,0 +1,148 @@
+package database
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ExportManifest describes a JSON Lines export; it is written last, as
+// manifest.json, so a directory without one is an incomplete export.
+type ExportManifest struct {
+	ExportedAt    time.Time      `json:"exported_at"`
+	SchemaVersion int            `json:"schema_version"`
+	Tables        map[string]int `json:"tables"` // table name -> row count
+}
+
+// Export writes every table to dir/<table>.jsonl, one JSON object per row
+// keyed by column name. All tables are read in a single transaction so the
+// export is a consistent snapshot. Timestamps are RFC 3339 strings and
+// BLOBs are base64 encoded.
+func Export(ctx context.Context, db *sql.DB, dir string) (*ExportManifest, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	manifest := &ExportManifest{ExportedAt: time.Now().UTC(), Tables: make(map[string]int)}
+	if err := tx.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&manifest.SchemaVersion); err != nil {
+		return nil, fmt.Errorf("not a forum database: %w", err)
+	}
+
+	dialect := DialectOf(db)
+	tables, err := listTables(ctx, tx, dialect)
+	if err != nil {
+		return nil, err
+	}
+	for _, table := range tables {
+		count, err := exportTable(ctx, tx, dialect, table, filepath.Join(dir, table+".jsonl"))
+		if err != nil {
+			return nil, fmt.Errorf("exporting %s: %w", table, err)
+		}
+		manifest.Tables[table] = count
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return manifest, os.WriteFile(filepath.Join(dir, "manifest.json"), data, 0o644)
+}
+
+func listTables(ctx context.Context, tx *sql.Tx, dialect Dialect) ([]string, error) {
+	query := `
+		SELECT name FROM sqlite_master
+		WHERE type = 'table' AND name NOT LIKE 'sqlite_%'
+		ORDER BY name`
+	if dialect == Postgres {
+		query = `
+			SELECT table_name FROM information_schema.tables
+			WHERE table_schema = current_schema() AND table_type = 'BASE TABLE'
+			ORDER BY table_name`
+	}
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tables []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		tables = append(tables, name)
+	}
+	return tables, rows.Err()
+}
+
+func exportTable(ctx context.Context, tx *sql.Tx, dialect Dialect, table, path string) (int, error) {
+	// Table names come from the catalog; quote them anyway
+	query := fmt.Sprintf(`SELECT * FROM "%s" ORDER BY rowid`, table)
+	if dialect == Postgres {
+		// No rowid; a failed query would also abort the transaction
+		query = fmt.Sprintf(`SELECT * FROM "%s" ORDER BY 1`, table)
+	}
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil && dialect == SQLite {
+		// WITHOUT ROWID tables have no rowid to order by
+		rows, err = tx.QueryContext(ctx, fmt.Sprintf(`SELECT * FROM "%s"`, table))
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	out := bufio.NewWriter(file)
+	encoder := json.NewEncoder(out)
+
+	values := make([]interface{}, len(columns))
+	pointers := make([]interface{}, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+
+	count := 0
+	for rows.Next() {
+		if err := rows.Scan(pointers...); err != nil {
+			return count, err
+		}
+		row := make(map[string]interface{}, len(columns))
+		for i, column := range columns {
+			row[column] = values[i]
+		}
+		if err := encoder.Encode(row); err != nil {
+			return count, err
+		}
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return count, err
+	}
+
+	if err := out.Flush(); err != nil {
+		return count, err
+	}
+	return count, file.Close()
+}
@@ -0,0 +1,303 @@
+package database
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"realtimeforum/model"
+	"strings"
+	"time"
+)
+
+// FeedSort is the order of a feed.
+type FeedSort string
+
+// Feed orders. Ties are broken by the newest post.
+const (
+	SortNewest        FeedSort = "newest"
+	SortMostCommented FeedSort = "most_commented"
+	SortMostLiked     FeedSort = "most_liked"
+	// SortTrending only lists posts commented or liked within
+	// TrendingWindow, the most active first.
+	SortTrending FeedSort = "trending"
+)
+
+// TrendingWindow is how far back comments and likes count for trending.
+var TrendingWindow = 48 * time.Hour
+
+// ErrInvalidCursor is returned for cursors that were not issued for the
+// requested sort.
+var ErrInvalidCursor = errors.New("invalid feed cursor")
+
+// ParseFeedSort accepts the sort names of the API; empty means newest.
+func ParseFeedSort(name string) (FeedSort, error) {
+	switch sort := FeedSort(strings.ToLower(name)); sort {
+	case "":
+		return SortNewest, nil
+	case SortNewest, SortMostCommented, SortMostLiked, SortTrending:
+		return sort, nil
+	}
+	return "", fmt.Errorf("unknown sort %q, expected newest, most_commented, most_liked or trending", name)
+}
+
+// FeedQuery selects a page of the feed. Zero values don't filter.
+type FeedQuery struct {
+	TopicIDs []int  // posts tagged with any of these topics
+	Author   string // username of the author
+	// FollowedBy keeps the posts of users or topics this user follows,
+	// the "following" feed.
+	FollowedBy string
+	From       time.Time
+	To         time.Time // exclusive
+	Sort       FeedSort
+	Limit      int
+	// Cursor is the NextCursor of the previous page, empty for the first.
+	Cursor string
+	// ViewerID is the user the Liked and Bookmarked flags are computed
+	// for.
+	ViewerID string
+}
+
+// FeedPage is a page of the feed. NextCursor is empty on the last page.
+type FeedPage struct {
+	Posts      []model.FeedPost
+	NextCursor string
+}
+
+// feedCursor is the position after the last post of a page. It is handed
+// out base64 encoded and never interpreted by clients.
+type feedCursor struct {
+	Sort      FeedSort `json:"s"`
+	Score     int64    `json:"v,omitempty"`
+	CreatedAt string   `json:"t"`
+	ID        int      `json:"i"`
+	// Since keeps the trending window of the first page, so scores don't
+	// shift while scrolling
+	Since string `json:"w,omitempty"`
+}
+
+func (c feedCursor) encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeFeedCursor(token string, sort FeedSort) (feedCursor, error) {
+	var c feedCursor
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || json.Unmarshal(data, &c) != nil || c.Sort != sort || c.CreatedAt == "" {
+		return c, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+func (r *sqlPosts) Feed(q FeedQuery) (FeedPage, error) {
+	var page FeedPage
+	if q.Sort == "" {
+		q.Sort = SortNewest
+	}
+
+	var cursor *feedCursor
+	if q.Cursor != "" {
+		c, err := decodeFeedCursor(q.Cursor, q.Sort)
+		if err != nil {
+			return page, err
+		}
+		cursor = &c
+	}
+
+	since := time.Now().Add(-TrendingWindow)
+	if cursor != nil && cursor.Since != "" {
+		t, err := time.Parse(time.RFC3339Nano, cursor.Since)
+		if err != nil {
+			return page, ErrInvalidCursor
+		}
+		since = t
+	}
+
+	// The score is what posts are ranked by before their age
+	var score string
+	var args []interface{}
+	switch q.Sort {
+	case SortMostCommented:
+		score = "(SELECT COUNT(*) FROM comments c WHERE c.post_id = p.id)"
+	case SortMostLiked:
+		score = "(SELECT COUNT(*) FROM post_likes l WHERE l.post_id = p.id)"
+	case SortTrending:
+		score = `(SELECT COUNT(*) FROM comments c WHERE c.post_id = p.id AND c.created_at >= ?) +
+			(SELECT COUNT(*) FROM post_likes l WHERE l.post_id = p.id AND l.created_at >= ?)`
+		args = append(args, since, since)
+	default:
+		score = "0"
+	}
+
+	// Scheduled and expired posts are not in the feed
+	where := []string{visiblePost}
+	args = append(args, model.PostPublished, time.Now())
+	if len(q.TopicIDs) > 0 {
+		where = append(where, "p.id IN (SELECT post_id FROM posts_topics WHERE topic_id IN ("+placeholders(len(q.TopicIDs))+"))")
+		for _, id := range q.TopicIDs {
+			args = append(args, id)
+		}
+	}
+	if q.Author != "" {
+		where = append(where, "u.username = ?")
+		args = append(args, q.Author)
+	}
+	if q.FollowedBy != "" {
+		where = append(where, `(p.user_id IN (SELECT followee_id FROM user_follows WHERE follower_id = ?)
+			OR p.id IN (
+				SELECT pt.post_id FROM posts_topics pt
+				JOIN topic_follows tf ON tf.topic_id = pt.topic_id
+				WHERE tf.user_id = ?))`)
+		args = append(args, q.FollowedBy, q.FollowedBy)
+	}
+	if !q.From.IsZero() {
+		where = append(where, "p.created_at >= ?")
+		args = append(args, q.From)
+	}
+	if !q.To.IsZero() {
+		where = append(where, "p.created_at < ?")
+		args = append(args, q.To)
+	}
+	if q.Sort == SortTrending {
+		where = append(where, `p.id IN (
+			SELECT post_id FROM comments WHERE created_at >= ?
+			UNION
+			SELECT post_id FROM post_likes WHERE created_at >= ?)`)
+		args = append(args, since, since)
+	}
+
+	query := `
+		SELECT p.id, p.title, p.content, p.content_html, p.content_format, p.user_id, p.created_at, p.updated_at, p.expires_at, u.username,
+		       CAST(p.created_at AS TEXT) AS created_key, ` + score + ` AS score
+		FROM posts p
+		JOIN users u ON p.user_id = u.id
+		WHERE ` + strings.Join(where, " AND ")
+
+	if q.Sort == SortNewest {
+		// Without a score the index on created_at serves the order
+		if cursor != nil {
+			query += " AND (p.created_at, p.id) < (?, ?)"
+			args = append(args, cursor.CreatedAt, cursor.ID)
+		}
+		query += "\n\t\tORDER BY p.created_at DESC, p.id DESC"
+	} else {
+		query = "SELECT * FROM (" + query + "\n\t) feed"
+		if cursor != nil {
+			query += "\n\tWHERE (score, created_at, id) < (?, ?, ?)"
+			args = append(args, cursor.Score, cursor.CreatedAt, cursor.ID)
+		}
+		query += "\n\tORDER BY score DESC, created_at DESC, id DESC"
+	}
+	// One more than asked tells whether there is a next page
+	query += "\n\tLIMIT ?"
+	args = append(args, q.Limit+1)
+
+	rows, err := r.query(query, args...)
+	if err != nil {
+		return page, dbError(err)
+	}
+	defer rows.Close()
+
+	var last feedCursor
+	for rows.Next() {
+		var post model.FeedPost
+		var createdAt, updatedAt, expiresAt nullTime
+		var key feedCursor
+		err := rows.Scan(&post.ID, &post.Title, &post.Content, &post.ContentHTML, &post.ContentFormat, &post.UserID,
+			&createdAt, &updatedAt, &expiresAt, &post.Author, &key.CreatedAt, &key.Score)
+		if err != nil {
+			return page, dbError(err)
+		}
+		if len(page.Posts) == q.Limit {
+			page.NextCursor = last.encode()
+			break
+		}
+		post.CreatedAt = createdAt.Time.Format(time.RFC3339Nano)
+		post.UpdatedAt = updatedAt.Time.Format(time.RFC3339Nano)
+		if expiresAt.Valid {
+			post.ExpiresAt = expiresAt.Time.Format(time.RFC3339Nano)
+		}
+		page.Posts = append(page.Posts, post)
+
+		key.Sort, key.ID = q.Sort, post.ID
+		if q.Sort == SortTrending {
+			key.Since = since.Format(time.RFC3339Nano)
+		}
+		last = key
+	}
+	if err := rows.Err(); err != nil {
+		return page, dbError(err)
+	}
+	rows.Close()
+
+	if err := r.addFeedDetails(page.Posts, q.ViewerID); err != nil {
+		return page, err
+	}
+	return page, nil
+}
+
+// addFeedDetails loads the topics, attachments, counts, likes, bookmarks
+// and first comments of the posts in a fixed number of queries, whatever their
+// number.
+func (r *sqlPosts) addFeedDetails(posts []model.FeedPost, viewerID string) error {
+	if len(posts) == 0 {
+		return nil
+	}
+
+	ids := make([]interface{}, len(posts))
+	for i, post := range posts {
+		ids[i] = post.ID
+	}
+	in := "(" + placeholders(len(ids)) + ")"
+
+	topics, err := r.topicNames(in, ids...)
+	if err != nil {
+		return err
+	}
+	comments, err := r.countByPost("comments", in, ids...)
+	if err != nil {
+		return err
+	}
+	likes, err := r.countByPost("post_likes", in, ids...)
+	if err != nil {
+		return err
+	}
+	liked, err := r.markedBy("post_likes", viewerID, in, ids...)
+	if err != nil {
+		return err
+	}
+	bookmarked, err := r.markedBy("bookmarks", viewerID, in, ids...)
+	if err != nil {
+		return err
+	}
+	recent, err := r.firstComments(in, feedComments, ids...)
+	if err != nil {
+		return err
+	}
+	attachments, err := r.attachmentsOf("post_id", in, ids...)
+	if err != nil {
+		return err
+	}
+
+	for i := range posts {
+		post := &posts[i]
+		post.Topics = topics[post.ID]
+		post.Attachments = attachments[post.ID]
+		if post.Attachments == nil {
+			post.Attachments = []model.Attachment{}
+		}
+		post.CommentsCount = comments[post.ID]
+		post.LikesCount = likes[post.ID]
+		post.Liked = liked[post.ID]
+		post.Bookmarked = bookmarked[post.ID]
+		// Views are not tracked yet
+		post.ViewsCount = 0
+		post.RecentComments = recent[post.ID]
+	}
+	return nil
+}
+
+// feedComments is how many of the first comments each feed post shows.
+const feedComments = 3
@@ -0,0 +1,151 @@
+package database
+
+import (
+	"realtimeforum/model"
+	"time"
+)
+
+type sqlFollows struct{ sqlRepository }
+
+func (r *sqlFollows) SetUser(followerID, followeeID string, follow bool) error {
+	if followerID == followeeID {
+		return ErrFollowSelf
+	}
+	return r.inTx(func(tx sqlTx) error {
+		var exists bool
+		if err := tx.queryRow("SELECT EXISTS (SELECT 1 FROM users WHERE id = ?)", followeeID).Scan(&exists); err != nil {
+			return dbError(err)
+		}
+		if !exists {
+			return ErrUserNotFound
+		}
+
+		var err error
+		if follow {
+			_, err = tx.exec(`
+				INSERT INTO user_follows (follower_id, followee_id, created_at) VALUES (?, ?, ?)
+				ON CONFLICT DO NOTHING`,
+				followerID, followeeID, time.Now())
+		} else {
+			_, err = tx.exec("DELETE FROM user_follows WHERE follower_id = ? AND followee_id = ?", followerID, followeeID)
+		}
+		if err != nil {
+			return dbError(err)
+		}
+		return nil
+	})
+}
+
+func (r *sqlFollows) SetTopic(userID string, topicID int, follow bool) error {
+	return r.inTx(func(tx sqlTx) error {
+		var exists bool
+		if err := tx.queryRow("SELECT EXISTS (SELECT 1 FROM topics WHERE id = ?)", topicID).Scan(&exists); err != nil {
+			return dbError(err)
+		}
+		if !exists {
+			return ErrTopicNotFound
+		}
+
+		var err error
+		if follow {
+			_, err = tx.exec(`
+				INSERT INTO topic_follows (user_id, topic_id, created_at) VALUES (?, ?, ?)
+				ON CONFLICT DO NOTHING`,
+				userID, topicID, time.Now())
+		} else {
+			_, err = tx.exec("DELETE FROM topic_follows WHERE user_id = ? AND topic_id = ?", userID, topicID)
+		}
+		if err != nil {
+			return dbError(err)
+		}
+		return nil
+	})
+}
+
+func (r *sqlFollows) Counts(userID string) (model.FollowCounts, error) {
+	var counts model.FollowCounts
+	err := r.queryRow(`
+		SELECT
+			(SELECT COUNT(*) FROM user_follows WHERE followee_id = ?),
+			(SELECT COUNT(*) FROM user_follows WHERE follower_id = ?),
+			(SELECT COUNT(*) FROM topic_follows WHERE user_id = ?)`,
+		userID, userID, userID).Scan(&counts.Followers, &counts.Following, &counts.Topics)
+	if err != nil {
+		return counts, dbError(err)
+	}
+	return counts, nil
+}
+
+func (r *sqlFollows) IsFollowing(followerID, followeeID string) (bool, error) {
+	var following bool
+	err := r.queryRow("SELECT EXISTS (SELECT 1 FROM user_follows WHERE follower_id = ? AND followee_id = ?)", followerID, followeeID).Scan(&following)
+	if err != nil {
+		return false, dbError(err)
+	}
+	return following, nil
+}
+
+func (r *sqlFollows) Followers(userID string, limit, offset int) ([]model.FollowUser, error) {
+	return r.users(`
+		SELECT u.id, u.username, u.first_name, u.last_name, f.created_at
+		FROM user_follows f
+		JOIN users u ON u.id = f.follower_id
+		WHERE f.followee_id = ?
+		ORDER BY f.created_at DESC, u.username
+		LIMIT ? OFFSET ?`, userID, limit, offset)
+}
+
+func (r *sqlFollows) Following(userID string, limit, offset int) ([]model.FollowUser, error) {
+	return r.users(`
+		SELECT u.id, u.username, u.first_name, u.last_name, f.created_at
+		FROM user_follows f
+		JOIN users u ON u.id = f.followee_id
+		WHERE f.follower_id = ?
+		ORDER BY f.created_at DESC, u.username
+		LIMIT ? OFFSET ?`, userID, limit, offset)
+}
+
+func (r *sqlFollows) users(query string, args ...interface{}) ([]model.FollowUser, error) {
+	rows, err := r.query(query, args...)
+	if err != nil {
+		return nil, dbError(err)
+	}
+	defer rows.Close()
+
+	var users []model.FollowUser
+	for rows.Next() {
+		var user model.FollowUser
+		var followedAt nullTime
+		if err := rows.Scan(&user.ID, &user.Username, &user.FirstName, &user.LastName, &followedAt); err != nil {
+			return nil, dbError(err)
+		}
+		user.FollowedAt = followedAt.Time
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+func (r *sqlFollows) Topics(userID string) ([]model.FollowTopic, error) {
+	rows, err := r.query(`
+		SELECT t.id, t.name, t.emoji, f.created_at
+		FROM topic_follows f
+		JOIN topics t ON t.id = f.topic_id
+		WHERE f.user_id = ?
+		ORDER BY t.id`, userID)
+	if err != nil {
+		return nil, dbError(err)
+	}
+	defer rows.Close()
+
+	var topics []model.FollowTopic
+	for rows.Next() {
+		var topic model.FollowTopic
+		var followedAt nullTime
+		if err := rows.Scan(&topic.ID, &topic.Name, &topic.Emoji, &followedAt); err != nil {
+			return nil, dbError(err)
+		}
+		topic.FollowedAt = followedAt.Time
+		topics = append(topics, topic)
+	}
+	return topics, rows.Err()
+}
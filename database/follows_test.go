@@ -0,0 +1,76 @@
+package database_test
+
+import (
+	"realtimeforum/database"
+	"realtimeforum/model"
+	"testing"
+)
+
+func testFollows(t *testing.T) {
+	f := newFixture(t)
+	createPost(t, f.bob.ID, "Post of bob", f.topicIDs[0])
+	self := database.Follows.SetUser(f.alice.ID, f.alice.ID, true)
+	unknownUser := database.Follows.SetUser(f.alice.ID, "no such user", true)
+	unknownTopic := database.Follows.SetTopic(f.alice.ID, -1, true)
+
+	// Alice follows Bob, twice; Bob follows the last topic of the
+	// contract post
+	for i := 0; i < 2; i++ {
+		if err := database.Follows.SetUser(f.alice.ID, f.bob.ID, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := database.Follows.SetTopic(f.bob.ID, f.topicIDs[2], true); err != nil {
+		t.Fatal(err)
+	}
+
+	counts, err := database.Follows.Counts(f.bob.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	followers, err := database.Follows.Followers(f.bob.ID, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	following, err := database.Follows.Following(f.alice.ID, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	topics, err := database.Follows.Topics(f.bob.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(followers) != 1 || len(following) != 1 || len(topics) != 1 {
+		t.Fatalf("got %d followers, %d followed users and %d topics, want 1 each", len(followers), len(following), len(topics))
+	}
+
+	aliceFeed, err := database.Posts.Feed(database.FeedQuery{FollowedBy: f.alice.ID, Limit: 50})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bobFeed, err := database.Posts.Feed(database.FeedQuery{FollowedBy: f.bob.ID, Limit: 50})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.Follows.SetUser(f.alice.ID, f.bob.ID, false); err != nil {
+		t.Fatal(err)
+	}
+	unfollowed, err := database.Posts.Feed(database.FeedQuery{FollowedBy: f.alice.ID, Limit: 50})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(aliceFeed.Posts) != 1 || len(bobFeed.Posts) != 1 {
+		t.Fatalf("got %d posts of followed users and %d in followed topics, want 1 each", len(aliceFeed.Posts), len(bobFeed.Posts))
+	}
+
+	expectError(t, "self follow", self, database.ErrFollowSelf)
+	expectError(t, "unknown user", unknownUser, database.ErrUserNotFound)
+	expectError(t, "unknown topic", unknownTopic, database.ErrTopicNotFound)
+	expect(t, "counts", counts, model.FollowCounts{Followers: 1, Following: 0, Topics: 1})
+	expect(t, "follower", followers[0].Username, f.alice.Username)
+	expect(t, "followed user", following[0].Username, f.bob.Username)
+	expect(t, "followed topic", topics[0].ID, f.topicIDs[2])
+	expect(t, "post of the followed user", aliceFeed.Posts[0].Author, f.bob.Username)
+	expect(t, "post in the followed topic", bobFeed.Posts[0].ID, f.postID)
+	expect(t, "posts after unfollowing", len(unfollowed.Posts), 0)
+}
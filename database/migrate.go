@@ -0,0 +1,200 @@
+package database
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Migrations live in migrations/<dialect>/NNNN_description.sql and are
+// applied in version order, each in its own transaction. Both dialects
+// carry the same versions. Never edit a migration that has been released;
+// add a new one instead.
+//
+//go:embed migrations/sqlite/*.sql migrations/postgres/*.sql
+var migrationFiles embed.FS
+
+//go:embed seed.sql
+var seedSQL string
+
+// Migration is one versioned schema change.
+type Migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+// MigrationStatus tells whether a migration was applied, and when.
+type MigrationStatus struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// Migrations returns every embedded migration of the dialect in version
+// order.
+func Migrations(dialect Dialect) ([]Migration, error) {
+	dir := path.Join("migrations", string(dialect))
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var migrations []Migration
+	seen := make(map[int]string)
+	for _, entry := range entries {
+		filename := entry.Name()
+		prefix, name, ok := strings.Cut(strings.TrimSuffix(filename, ".sql"), "_")
+		version, err := strconv.Atoi(prefix)
+		if !ok || err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %s must be named NNNN_description.sql", filename)
+		}
+		if other, exists := seen[version]; exists {
+			return nil, fmt.Errorf("migrations %s and %s share version %d", other, filename, version)
+		}
+		seen[version] = filename
+
+		content, err := migrationFiles.ReadFile(path.Join(dir, filename))
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, Migration{Version: version, Name: name, SQL: string(content)})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+func ensureMigrationsTable(db *sql.DB) error {
+	timestamp := "DATETIME"
+	if DialectOf(db) == Postgres {
+		timestamp = "TIMESTAMPTZ"
+	}
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at ` + timestamp + ` NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)`)
+	return err
+}
+
+// MigrationStatuses lists every known migration with its applied time.
+func MigrationStatuses(db *sql.DB) ([]MigrationStatus, error) {
+	migrations, err := Migrations(DialectOf(db))
+	if err != nil {
+		return nil, err
+	}
+	if err := ensureMigrationsTable(db); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query("SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, len(migrations))
+	for i, migration := range migrations {
+		statuses[i].Migration = migration
+		if appliedAt, ok := applied[migration.Version]; ok {
+			statuses[i].AppliedAt = &appliedAt
+		}
+	}
+	return statuses, nil
+}
+
+// Migrate applies the pending migrations, each in its own transaction,
+// and returns them. With dryRun, all of them run inside one transaction
+// that is rolled back, so errors show up without changing the database.
+func Migrate(db *sql.DB, dryRun bool) ([]Migration, error) {
+	statuses, err := MigrationStatuses(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []Migration
+	for _, status := range statuses {
+		if status.AppliedAt == nil {
+			pending = append(pending, status.Migration)
+		}
+	}
+
+	if dryRun {
+		tx, err := db.Begin()
+		if err != nil {
+			return nil, err
+		}
+		defer tx.Rollback()
+
+		for _, migration := range pending {
+			if err := applyMigration(tx, DialectOf(db), migration); err != nil {
+				return nil, err
+			}
+		}
+		return pending, nil
+	}
+
+	for i, migration := range pending {
+		tx, err := db.Begin()
+		if err != nil {
+			return pending[:i], err
+		}
+		if err := applyMigration(tx, DialectOf(db), migration); err != nil {
+			tx.Rollback()
+			return pending[:i], err
+		}
+		if err := tx.Commit(); err != nil {
+			return pending[:i], err
+		}
+	}
+	return pending, nil
+}
+
+func applyMigration(tx *sql.Tx, dialect Dialect, migration Migration) error {
+	// The driver runs every statement of the file, semicolons in strings
+	// and trigger bodies included
+	if _, err := tx.Exec(migration.SQL); err != nil {
+		return fmt.Errorf("migration %04d_%s failed: %w", migration.Version, migration.Name, err)
+	}
+
+	_, err := tx.Exec(dialect.Rebind("INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)"),
+		migration.Version, migration.Name, time.Now())
+	return err
+}
+
+// Seed inserts the demo data of seed.sql. It can be run more than once.
+func Seed(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(seedSQL); err != nil {
+		return fmt.Errorf("seed failed: %w", err)
+	}
+	if _, err := tx.Exec(refreshTopicActivity); err != nil {
+		return fmt.Errorf("seed failed: %w", err)
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,99 @@
+package database_test
+
+import (
+	"fmt"
+	"realtimeforum/database"
+	"realtimeforum/database/dbtest"
+	"testing"
+)
+
+func versions(migrations []database.Migration) string {
+	var list []int
+	for _, migration := range migrations {
+		list = append(list, migration.Version)
+	}
+	return fmt.Sprint(list)
+}
+
+// applied lists the versions the status report marks as applied.
+func applied(t *testing.T, statuses []database.MigrationStatus) string {
+	t.Helper()
+	var list []database.Migration
+	for i, status := range statuses {
+		if i > 0 && status.Version <= statuses[i-1].Version {
+			t.Errorf("migration %d listed after %d", status.Version, statuses[i-1].Version)
+		}
+		if status.AppliedAt != nil {
+			list = append(list, status.Migration)
+		}
+	}
+	return versions(list)
+}
+
+// TestMigrate applies the first migrations by hand, as an older release
+// would have, then checks what a dry run and a real run do with the rest.
+func TestMigrate(t *testing.T) {
+	for _, dialect := range dbtest.Dialects {
+		t.Run(string(dialect), func(t *testing.T) {
+			db := dbtest.Empty(t, dialect)
+			migrations, err := database.Migrations(dialect)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(migrations) < 4 {
+				t.Fatalf("only %d migrations", len(migrations))
+			}
+			status := func() []database.MigrationStatus {
+				t.Helper()
+				statuses, err := database.MigrationStatuses(db)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return statuses
+			}
+
+			expect(t, "applied to an empty database", applied(t, status()), "[]")
+			pending, err := database.Migrate(db, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expect(t, "dry run on an empty database", versions(pending), versions(migrations))
+			expect(t, "applied after a dry run", applied(t, status()), "[]")
+			if _, err := db.Exec("SELECT COUNT(*) FROM users"); err == nil {
+				t.Error("the dry run created the users table")
+			}
+
+			old, newer := migrations[:3], migrations[3:]
+			for _, migration := range old {
+				if _, err := db.Exec(migration.SQL); err != nil {
+					t.Fatal(err)
+				}
+				if _, err := db.Exec(dialect.Rebind("INSERT INTO schema_migrations (version, name) VALUES (?, ?)"), migration.Version, migration.Name); err != nil {
+					t.Fatal(err)
+				}
+			}
+			statuses := status()
+			expect(t, "migrations listed", len(statuses), len(migrations))
+			expect(t, "applied by hand", applied(t, statuses), versions(old))
+
+			pending, err = database.Migrate(db, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expect(t, "dry run after a partial migrate", versions(pending), versions(newer))
+			expect(t, "applied after the second dry run", applied(t, status()), versions(old))
+
+			pending, err = database.Migrate(db, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expect(t, "migrated", versions(pending), versions(newer))
+			expect(t, "applied after migrating", applied(t, status()), versions(migrations))
+			pending, err = database.Migrate(db, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expect(t, "migrated twice", versions(pending), "[]")
+		})
+	}
+}
@@ -0,0 +1,9 @@
+-- Presence statuses chosen by the user, the automatic idle flag and the
+-- "last seen" privacy setting
+ALTER TABLE user_online
+ADD COLUMN status TEXT NOT NULL DEFAULT 'available' CHECK (
+        status IN ('available', 'away', 'dnd', 'invisible')
+    ),
+ADD COLUMN custom_status TEXT NOT NULL DEFAULT '',
+ADD COLUMN is_idle BOOLEAN NOT NULL DEFAULT FALSE,
+ADD COLUMN show_last_seen BOOLEAN NOT NULL DEFAULT TRUE;
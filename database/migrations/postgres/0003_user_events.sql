@@ -0,0 +1,16 @@
+-- Per-user log of events replayed when a client reconnects, and the last
+-- event each user acknowledged
+CREATE TABLE IF NOT EXISTS user_events (
+    seq BIGSERIAL PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    type TEXT NOT NULL,
+    payload TEXT NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_user_events_user_seq ON user_events(user_id, seq);
+CREATE INDEX IF NOT EXISTS idx_user_events_created_at ON user_events(created_at);
+CREATE TABLE IF NOT EXISTS user_sync_cursor (
+    user_id TEXT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    last_ack_seq BIGINT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,10 @@
+-- Posts and comments keep the text as written and, for Markdown, the
+-- sanitized HTML it renders to. Existing content is plain text.
+ALTER TABLE posts
+ADD COLUMN content_html TEXT NOT NULL DEFAULT '';
+ALTER TABLE posts
+ADD COLUMN content_format TEXT NOT NULL DEFAULT 'plain';
+ALTER TABLE comments
+ADD COLUMN content_html TEXT NOT NULL DEFAULT '';
+ALTER TABLE comments
+ADD COLUMN content_format TEXT NOT NULL DEFAULT 'plain';
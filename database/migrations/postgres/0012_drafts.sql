@@ -0,0 +1,20 @@
+-- Posts being written, saved by the author as they type. revision grows
+-- with every save so that saves from two devices cannot overwrite each
+-- other unnoticed.
+CREATE TABLE IF NOT EXISTS drafts (
+    id SERIAL PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    title TEXT NOT NULL DEFAULT '',
+    content TEXT NOT NULL DEFAULT '',
+    content_format TEXT NOT NULL DEFAULT 'markdown',
+    revision INTEGER NOT NULL DEFAULT 1,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_drafts_user ON drafts(user_id, updated_at);
+
+CREATE TABLE IF NOT EXISTS drafts_topics (
+    draft_id INTEGER NOT NULL REFERENCES drafts(id) ON DELETE CASCADE,
+    topic_id INTEGER NOT NULL REFERENCES topics(id) ON DELETE CASCADE,
+    PRIMARY KEY (draft_id, topic_id)
+);
@@ -0,0 +1,19 @@
+-- Posts users saved to read later, each at most once, optionally in one
+-- of their named collections. Deleting a collection keeps its bookmarks.
+CREATE TABLE IF NOT EXISTS bookmark_collections (
+    id SERIAL PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (user_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS bookmarks (
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    post_id INTEGER NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    collection_id INTEGER REFERENCES bookmark_collections(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, post_id)
+);
+CREATE INDEX IF NOT EXISTS idx_bookmarks_user ON bookmarks(user_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_bookmarks_collection ON bookmarks(collection_id);
@@ -0,0 +1,14 @@
+-- Public profiles: a bio, an avatar among the user's uploads, and which
+-- parts of the profile others may see. Everything is shown by default.
+ALTER TABLE users
+ADD COLUMN bio TEXT NOT NULL DEFAULT '';
+ALTER TABLE users
+ADD COLUMN avatar_id TEXT REFERENCES attachments(id) ON DELETE SET NULL;
+ALTER TABLE users
+ADD COLUMN show_name BOOLEAN NOT NULL DEFAULT TRUE;
+ALTER TABLE users
+ADD COLUMN show_join_date BOOLEAN NOT NULL DEFAULT TRUE;
+ALTER TABLE users
+ADD COLUMN show_counts BOOLEAN NOT NULL DEFAULT TRUE;
+ALTER TABLE users
+ADD COLUMN show_activity BOOLEAN NOT NULL DEFAULT TRUE;
@@ -0,0 +1,9 @@
+-- New email addresses waiting to be confirmed, at most one per user. The
+-- address only replaces the current one once its token is confirmed.
+CREATE TABLE IF NOT EXISTS email_changes (
+    user_id TEXT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    email TEXT NOT NULL,
+    token TEXT NOT NULL UNIQUE,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
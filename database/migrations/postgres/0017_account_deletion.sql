@@ -0,0 +1,15 @@
+-- Accounts their users asked to delete are removed once delete_after has
+-- passed. Their public posts and comments then belong to "deleted user",
+-- a placeholder nobody can log in as or register.
+ALTER TABLE users
+ADD COLUMN delete_after TIMESTAMPTZ;
+CREATE INDEX IF NOT EXISTS idx_users_delete_after ON users(delete_after);
+
+INSERT INTO users (
+    id, first_name, last_name, username, email, password_hash,
+    age, gender, terms_accepted, role, show_name, show_join_date, show_counts, show_activity
+) VALUES (
+    '00000000-0000-0000-0000-000000000000', 'Deleted', 'User', 'deleted user', 'deleted-user@invalid', '',
+    13, 'other', FALSE, 'user', FALSE, FALSE, FALSE, FALSE
+)
+ON CONFLICT (id) DO NOTHING;
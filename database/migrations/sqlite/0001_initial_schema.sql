@@ -1,5 +1,4 @@
--- Enable foreign key constraints
-PRAGMA foreign_keys = ON;
+-- Tables of the original forum: users, posts, topics, comments, sessions and chat
 -- Users table
 CREATE TABLE IF NOT EXISTS users (
     id TEXT PRIMARY KEY,
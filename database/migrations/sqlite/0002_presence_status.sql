@@ -0,0 +1,26 @@
+-- Presence statuses chosen by the user (available, away, do-not-disturb,
+-- invisible) with an optional custom text, the automatic idle flag and the
+-- "last seen" privacy setting. The table is rebuilt rather than altered so
+-- databases created from any earlier schema.sql end up identical, keeping
+-- the online state.
+CREATE TABLE user_online_new (
+    user_id TEXT PRIMARY KEY,
+    is_online BOOLEAN DEFAULT 0,
+    -- 1 if online, 0 if offline
+    status TEXT NOT NULL DEFAULT 'available' CHECK (
+        status IN ('available', 'away', 'dnd', 'invisible')
+    ),
+    -- status chosen by the user with the "presence" WebSocket event
+    custom_status TEXT NOT NULL DEFAULT '',
+    is_idle BOOLEAN NOT NULL DEFAULT 0,
+    -- 1 once the client has been inactive for longer than the away timeout
+    show_last_seen BOOLEAN NOT NULL DEFAULT 1,
+    -- privacy setting: 0 hides last_activity from other users
+    last_activity DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+INSERT INTO user_online_new (user_id, is_online, last_activity)
+SELECT user_id, is_online, last_activity
+FROM user_online;
+DROP TABLE user_online;
+ALTER TABLE user_online_new RENAME TO user_online;
@@ -0,0 +1,20 @@
+-- User_Events table: per-user log of events that must survive disconnects
+-- (messages, read receipts, notifications), replayed when a client reconnects
+CREATE TABLE IF NOT EXISTS user_events (
+    seq INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id TEXT NOT NULL,
+    type TEXT NOT NULL,
+    payload TEXT NOT NULL,
+    -- JSON "data" of the WebSocket message
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_user_events_user_seq ON user_events(user_id, seq);
+CREATE INDEX IF NOT EXISTS idx_user_events_created_at ON user_events(created_at);
+-- User_Sync_Cursor table: last user_events.seq each user has acknowledged
+CREATE TABLE IF NOT EXISTS user_sync_cursor (
+    user_id TEXT PRIMARY KEY,
+    last_ack_seq INTEGER NOT NULL DEFAULT 0,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
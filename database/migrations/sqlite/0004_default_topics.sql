@@ -0,0 +1,15 @@
+-- Topics every forum starts with; posts must have at least one
+INSERT
+    OR IGNORE INTO topics (name, emoji)
+VALUES ('Daily Essentials', '🛒'),
+    ('Home & Lifestyle', '🏠'),
+    ('Personal Well-being', '💖'),
+    ('Technology & Innovation', '💻'),
+    ('Leisure & Entertainment', '🎮'),
+    ('Commerce & Shopping', '🛍️'),
+    ('Mobility & Transportation', '🚗'),
+    ('Services & Support', '🤝'),
+    ('Culture & Community', '🌎'),
+    ('Information & Learning', '🎓'),
+    ('Quick Recipes', '🍳'),
+    ('Nutrition Insights', '🍎');
@@ -0,0 +1,3 @@
+-- Role of each user; admins are created with forumctl
+ALTER TABLE users
+ADD COLUMN role TEXT NOT NULL DEFAULT 'user' CHECK (role IN ('user', 'admin'));
@@ -0,0 +1,7 @@
+-- Indexes behind the feed, topic and profile lists: newest posts overall,
+-- of a topic and of a user, and the comments of a post or a user
+CREATE INDEX IF NOT EXISTS idx_posts_created_at ON posts(created_at);
+CREATE INDEX IF NOT EXISTS idx_posts_user_created ON posts(user_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_posts_topics_topic ON posts_topics(topic_id, post_id);
+CREATE INDEX IF NOT EXISTS idx_comments_post_created ON comments(post_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_comments_user_created ON comments(user_id, created_at);
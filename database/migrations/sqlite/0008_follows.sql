@@ -0,0 +1,20 @@
+-- Users following other users and topics, for the "following" feed
+CREATE TABLE IF NOT EXISTS user_follows (
+    follower_id TEXT NOT NULL,
+    followee_id TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (follower_id, followee_id),
+    CHECK (follower_id <> followee_id),
+    FOREIGN KEY(follower_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY(followee_id) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_user_follows_followee ON user_follows(followee_id, created_at);
+
+CREATE TABLE IF NOT EXISTS topic_follows (
+    user_id TEXT NOT NULL,
+    topic_id INTEGER NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, topic_id),
+    FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY(topic_id) REFERENCES topics(id) ON DELETE CASCADE
+);
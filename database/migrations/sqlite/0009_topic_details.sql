@@ -0,0 +1,44 @@
+-- Descriptions, manual ordering and archiving of topics; archived topics
+-- keep their posts but take no new ones. last_activity_at is the latest
+-- post or comment, kept up to date when they are created.
+ALTER TABLE topics
+ADD COLUMN description TEXT NOT NULL DEFAULT '';
+ALTER TABLE topics
+ADD COLUMN position INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE topics
+ADD COLUMN archived BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE topics
+ADD COLUMN last_activity_at DATETIME;
+
+UPDATE topics SET position = id;
+UPDATE topics
+SET description = CASE name
+        WHEN 'Daily Essentials' THEN 'Discuss everyday must-haves'
+        WHEN 'Home & Lifestyle' THEN 'Home decor, organization tips'
+        WHEN 'Personal Well-being' THEN 'Health, fitness, and mindfulness'
+        WHEN 'Technology & Innovation' THEN 'Gadgets, software, and future tech'
+        WHEN 'Leisure & Entertainment' THEN 'Games, movies, and hobbies'
+        WHEN 'Commerce & Shopping' THEN 'Deals, reviews, and shopping guides'
+        WHEN 'Mobility & Transportation' THEN 'Vehicles, public transit, and travel solutions'
+        WHEN 'Services & Support' THEN 'Professional services and community help'
+        WHEN 'Culture & Community' THEN 'Local events, traditions, and social groups'
+        WHEN 'Information & Learning' THEN 'Education, tutorials, and knowledge sharing'
+        WHEN 'Quick Recipes' THEN 'Make food quickly'
+        WHEN 'Nutrition Insights' THEN 'Healthy eating tips'
+        ELSE ''
+    END;
+UPDATE topics
+SET last_activity_at = (
+        SELECT MAX(activity)
+        FROM (
+                SELECT p.created_at AS activity
+                FROM posts_topics pt
+                    JOIN posts p ON p.id = pt.post_id
+                WHERE pt.topic_id = topics.id
+                UNION ALL
+                SELECT c.created_at
+                FROM posts_topics pt
+                    JOIN comments c ON c.post_id = pt.post_id
+                WHERE pt.topic_id = topics.id
+            ) activities
+    );
@@ -0,0 +1,24 @@
+-- Uploaded files. The blobs live in the blob store under blob_key (and
+-- thumbnail_key for images); a row belongs to its uploader until it is
+-- attached to one post or one chat message.
+CREATE TABLE IF NOT EXISTS attachments (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    filename TEXT NOT NULL,
+    content_type TEXT NOT NULL,
+    size INTEGER NOT NULL,
+    width INTEGER NOT NULL DEFAULT 0,
+    height INTEGER NOT NULL DEFAULT 0,
+    blob_key TEXT NOT NULL,
+    thumbnail_key TEXT NOT NULL DEFAULT '',
+    post_id INTEGER,
+    message_id INTEGER,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    CHECK (post_id IS NULL OR message_id IS NULL),
+    FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY(post_id) REFERENCES posts(id) ON DELETE CASCADE,
+    FOREIGN KEY(message_id) REFERENCES chat_messages(id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_attachments_post ON attachments(post_id);
+CREATE INDEX IF NOT EXISTS idx_attachments_message ON attachments(message_id);
+CREATE INDEX IF NOT EXISTS idx_attachments_user ON attachments(user_id, created_at);
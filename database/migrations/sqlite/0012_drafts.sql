@@ -0,0 +1,23 @@
+-- Posts being written, saved by the author as they type. revision grows
+-- with every save so that saves from two devices cannot overwrite each
+-- other unnoticed.
+CREATE TABLE IF NOT EXISTS drafts (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id TEXT NOT NULL,
+    title TEXT NOT NULL DEFAULT '',
+    content TEXT NOT NULL DEFAULT '',
+    content_format TEXT NOT NULL DEFAULT 'markdown',
+    revision INTEGER NOT NULL DEFAULT 1,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_drafts_user ON drafts(user_id, updated_at);
+
+CREATE TABLE IF NOT EXISTS drafts_topics (
+    draft_id INTEGER NOT NULL,
+    topic_id INTEGER NOT NULL,
+    PRIMARY KEY (draft_id, topic_id),
+    FOREIGN KEY(draft_id) REFERENCES drafts(id) ON DELETE CASCADE,
+    FOREIGN KEY(topic_id) REFERENCES topics(id) ON DELETE CASCADE
+);
@@ -0,0 +1,10 @@
+-- Posts can be scheduled: they stay hidden with status 'scheduled' until
+-- publish_at, when the scheduler publishes them. A post is hidden from
+-- the feed again after expires_at. Existing posts are published.
+ALTER TABLE posts
+ADD COLUMN status TEXT NOT NULL DEFAULT 'published';
+ALTER TABLE posts
+ADD COLUMN publish_at DATETIME;
+ALTER TABLE posts
+ADD COLUMN expires_at DATETIME;
+CREATE INDEX IF NOT EXISTS idx_posts_scheduled ON posts(status, publish_at);
@@ -0,0 +1,23 @@
+-- Posts users saved to read later, each at most once, optionally in one
+-- of their named collections. Deleting a collection keeps its bookmarks.
+CREATE TABLE IF NOT EXISTS bookmark_collections (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id TEXT NOT NULL,
+    name TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (user_id, name),
+    FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS bookmarks (
+    user_id TEXT NOT NULL,
+    post_id INTEGER NOT NULL,
+    collection_id INTEGER,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, post_id),
+    FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY(post_id) REFERENCES posts(id) ON DELETE CASCADE,
+    FOREIGN KEY(collection_id) REFERENCES bookmark_collections(id) ON DELETE SET NULL
+);
+CREATE INDEX IF NOT EXISTS idx_bookmarks_user ON bookmarks(user_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_bookmarks_collection ON bookmarks(collection_id);
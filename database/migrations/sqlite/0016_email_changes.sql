@@ -0,0 +1,10 @@
+-- New email addresses waiting to be confirmed, at most one per user. The
+-- address only replaces the current one once its token is confirmed.
+CREATE TABLE IF NOT EXISTS email_changes (
+    user_id TEXT PRIMARY KEY,
+    email TEXT NOT NULL,
+    token TEXT NOT NULL UNIQUE,
+    expires_at DATETIME NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
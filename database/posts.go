@@ -0,0 +1,531 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"realtimeforum/model"
+	"time"
+)
+
+type sqlPosts struct{ sqlRepository }
+
+func (r *sqlPosts) Create(post NewPost) (int, error) {
+	var postID int
+	err := r.inTx(func(tx sqlTx) error {
+		if err := checkPostTopics(tx, post.TopicIDs); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		status := model.PostPublished
+		if post.PublishAt.After(now) {
+			status = model.PostScheduled
+		}
+		err := tx.queryRow(`
+			INSERT INTO posts (title, content, content_html, content_format, user_id, status, publish_at, expires_at, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			RETURNING id`,
+			post.Title, post.Content.Text, post.Content.HTML, post.Content.Format, post.UserID,
+			status, timeArg(post.PublishAt), timeArg(post.ExpiresAt), now, now,
+		).Scan(&postID)
+		if isUniqueViolation(err) {
+			return ErrDuplicateTitle
+		}
+		if err != nil {
+			return err
+		}
+
+		for _, topicID := range post.TopicIDs {
+			_, err := tx.exec(`
+				INSERT INTO posts_topics (post_id, topic_id) VALUES (?, ?)
+				ON CONFLICT DO NOTHING`,
+				postID, topicID)
+			if err != nil {
+				return err
+			}
+		}
+		if err := attach(tx, "post_id", post.UserID, postID, post.AttachmentIDs); err != nil {
+			return err
+		}
+		if status == model.PostScheduled {
+			// The topics become active when it is published
+			return nil
+		}
+		_, err = tx.exec(`
+			UPDATE topics SET last_activity_at = ?
+			WHERE id IN (SELECT topic_id FROM posts_topics WHERE post_id = ?)`,
+			now, postID)
+		return err
+	})
+	return postID, err
+}
+
+// checkPostTopics returns ErrTopicNotFound or ErrTopicArchived unless
+// every topic exists and is open.
+func checkPostTopics(tx sqlTx, topicIDs []int) error {
+	if len(topicIDs) == 0 {
+		return nil
+	}
+	ids := make([]interface{}, 0, len(topicIDs))
+	seen := make(map[int]bool)
+	for _, id := range topicIDs {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+
+	var found, archived int
+	err := tx.queryRow(`
+		SELECT COUNT(*), COALESCE(SUM(CASE WHEN archived THEN 1 ELSE 0 END), 0)
+		FROM topics
+		WHERE id IN (`+placeholders(len(ids))+`)`, ids...).Scan(&found, &archived)
+	if err != nil {
+		return dbError(err)
+	}
+	if found < len(ids) {
+		return ErrTopicNotFound
+	}
+	if archived > 0 {
+		return ErrTopicArchived
+	}
+	return nil
+}
+
+// visiblePost holds for the posts p anyone may read: published and not
+// expired. Bind model.PostPublished and the current time.
+const visiblePost = "p.status = ? AND (p.expires_at IS NULL OR p.expires_at > ?)"
+
+// requireVisiblePost returns ErrPostNotFound unless anyone may read the
+// post, so scheduled and expired posts take no likes, comments or
+// bookmarks.
+func requireVisiblePost(tx sqlTx, id int) error {
+	var visible bool
+	err := tx.queryRow("SELECT EXISTS (SELECT 1 FROM posts p WHERE p.id = ? AND "+visiblePost+")",
+		id, model.PostPublished, time.Now()).Scan(&visible)
+	if err != nil {
+		return dbError(err)
+	}
+	if !visible {
+		return ErrPostNotFound
+	}
+	return nil
+}
+
+const postColumns = `p.id, p.title, p.content, p.content_html, p.content_format, p.user_id, p.created_at, u.username,
+	p.status, p.publish_at, p.expires_at`
+
+func scanPost(row rowScanner) (*model.Post, error) {
+	var post model.Post
+	var createdAt, publishAt, expiresAt nullTime
+	err := row.Scan(&post.ID, &post.Title, &post.Content, &post.ContentHTML, &post.ContentFormat,
+		&post.UserID, &createdAt, &post.Author, &post.Status, &publishAt, &expiresAt)
+	if err != nil {
+		return nil, err
+	}
+	post.CreatedAt = createdAt.Time
+	if publishAt.Valid {
+		post.PublishAt = &publishAt.Time
+	}
+	if expiresAt.Valid {
+		post.ExpiresAt = &expiresAt.Time
+	}
+	return &post, nil
+}
+
+// timeArg binds an optional timestamp: zero is NULL. Others are bound
+// in the local zone like time.Now, as SQLite compares timestamps as text.
+func timeArg(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t.Local()
+}
+
+func (r *sqlPosts) GetByID(id int) (*model.Post, error) {
+	return r.get("p.id = ?", id)
+}
+
+func (r *sqlPosts) GetVisible(id int, viewerID string) (*model.Post, error) {
+	return r.get("p.id = ? AND (p.user_id = ? OR "+visiblePost+")", id, viewerID, model.PostPublished, time.Now())
+}
+
+// get returns the post matching where, with its attachments.
+func (r *sqlPosts) get(where string, args ...interface{}) (*model.Post, error) {
+	post, err := scanPost(r.queryRow(`
+		SELECT `+postColumns+`
+		FROM posts p
+		JOIN users u ON p.user_id = u.id
+		WHERE `+where, args...))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrPostNotFound
+	}
+	if err != nil {
+		return nil, dbError(err)
+	}
+
+	attachments, err := r.attachmentsOf("post_id", "(?)", post.ID)
+	if err != nil {
+		return nil, err
+	}
+	post.Attachments = attachments[post.ID]
+	if post.Attachments == nil {
+		post.Attachments = []model.Attachment{}
+	}
+	return post, nil
+}
+
+func (r *sqlPosts) Count() (int, error) {
+	var count int
+	if err := r.queryRow("SELECT COUNT(*) FROM posts").Scan(&count); err != nil {
+		return 0, dbError(err)
+	}
+	return count, nil
+}
+
+func (r *sqlPosts) ByUser(userID string, limit int) ([]model.Post, error) {
+	query := `
+		SELECT ` + postColumns + `
+		FROM posts p
+		JOIN users u ON p.user_id = u.id
+		WHERE p.user_id = ?
+		ORDER BY p.created_at DESC, p.id DESC`
+	args := []interface{}{userID}
+	if limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, limit)
+	}
+	posts, err := r.list(query, args...)
+	if err != nil || len(posts) == 0 {
+		return posts, err
+	}
+
+	ids := make([]interface{}, len(posts))
+	for i, post := range posts {
+		ids[i] = post.ID
+	}
+	topics, err := r.topicNames("("+placeholders(len(ids))+")", ids...)
+	if err != nil {
+		return nil, err
+	}
+	for i := range posts {
+		posts[i].Topics = topics[posts[i].ID]
+	}
+	return posts, nil
+}
+
+func (r *sqlPosts) SetLike(postID int, userID string, liked bool) (int, error) {
+	var likes int
+	err := r.inTx(func(tx sqlTx) error {
+		if err := requireVisiblePost(tx, postID); err != nil {
+			return err
+		}
+
+		var err error
+		if liked {
+			_, err = tx.exec(`
+				INSERT INTO post_likes (post_id, user_id, created_at) VALUES (?, ?, ?)
+				ON CONFLICT DO NOTHING`,
+				postID, userID, time.Now())
+		} else {
+			_, err = tx.exec("DELETE FROM post_likes WHERE post_id = ? AND user_id = ?", postID, userID)
+		}
+		if err != nil {
+			return dbError(err)
+		}
+		if err := tx.queryRow("SELECT COUNT(*) FROM post_likes WHERE post_id = ?", postID).Scan(&likes); err != nil {
+			return dbError(err)
+		}
+		return nil
+	})
+	return likes, err
+}
+
+// topicNames returns the topic names of the posts IN postIDs, a list of
+// placeholders, by post ID.
+func (r *sqlPosts) topicNames(postIDs string, args ...interface{}) (map[int][]string, error) {
+	rows, err := r.query(`
+		SELECT pt.post_id, t.name
+		FROM posts_topics pt
+		JOIN topics t ON t.id = pt.topic_id
+		WHERE pt.post_id IN `+postIDs+`
+		ORDER BY pt.post_id, t.id`, args...)
+	if err != nil {
+		return nil, dbError(err)
+	}
+	defer rows.Close()
+
+	names := make(map[int][]string)
+	for rows.Next() {
+		var postID int
+		var name string
+		if err := rows.Scan(&postID, &name); err != nil {
+			return nil, dbError(err)
+		}
+		names[postID] = append(names[postID], name)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, dbError(err)
+	}
+	return names, nil
+}
+
+// countByPost counts the rows of table, comments or post_likes, for each
+// post IN postIDs.
+func (r *sqlPosts) countByPost(table, postIDs string, args ...interface{}) (map[int]int, error) {
+	rows, err := r.query(`
+		SELECT post_id, COUNT(*)
+		FROM `+table+`
+		WHERE post_id IN `+postIDs+`
+		GROUP BY post_id`, args...)
+	if err != nil {
+		return nil, dbError(err)
+	}
+	defer rows.Close()
+
+	counts := make(map[int]int)
+	for rows.Next() {
+		var postID, count int
+		if err := rows.Scan(&postID, &count); err != nil {
+			return nil, dbError(err)
+		}
+		counts[postID] = count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, dbError(err)
+	}
+	return counts, nil
+}
+
+// markedBy tells which posts IN postIDs userID has a row for in table,
+// post_likes or bookmarks; nobody is logged in when userID is empty.
+func (r *sqlPosts) markedBy(table, userID, postIDs string, args ...interface{}) (map[int]bool, error) {
+	marked := make(map[int]bool)
+	if userID == "" {
+		return marked, nil
+	}
+
+	rows, err := r.query(`
+		SELECT post_id FROM `+table+`
+		WHERE user_id = ? AND post_id IN `+postIDs, append([]interface{}{userID}, args...)...)
+	if err != nil {
+		return nil, dbError(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var postID int
+		if err := rows.Scan(&postID); err != nil {
+			return nil, dbError(err)
+		}
+		marked[postID] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, dbError(err)
+	}
+	return marked, nil
+}
+
+// firstComments returns the n oldest comments of each post IN postIDs,
+// by post ID.
+func (r *sqlPosts) firstComments(postIDs string, n int, args ...interface{}) (map[int][]model.FeedComment, error) {
+	rows, err := r.query(`
+		SELECT id, content, content_html, content_format, user_id, post_id, created_at, username
+		FROM (
+			SELECT c.id, c.content, c.content_html, c.content_format, c.user_id, c.post_id, c.created_at, u.username,
+			       ROW_NUMBER() OVER (PARTITION BY c.post_id ORDER BY c.created_at ASC, c.id ASC) AS rn
+			FROM comments c
+			JOIN users u ON c.user_id = u.id
+			WHERE c.post_id IN `+postIDs+`
+		) ranked
+		WHERE rn <= ?
+		ORDER BY post_id, rn`, append(args, n)...)
+	if err != nil {
+		return nil, dbError(err)
+	}
+	defer rows.Close()
+
+	comments := make(map[int][]model.FeedComment)
+	for rows.Next() {
+		var comment model.FeedComment
+		var createdAt nullTime
+		err := rows.Scan(&comment.ID, &comment.Content, &comment.ContentHTML, &comment.ContentFormat,
+			&comment.UserID, &comment.PostID, &createdAt, &comment.Author)
+		if err != nil {
+			return nil, dbError(err)
+		}
+		comment.CreatedAt = createdAt.Time.Format(time.RFC3339Nano)
+		comments[comment.PostID] = append(comments[comment.PostID], comment)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, dbError(err)
+	}
+	return comments, nil
+}
+
+func (r *sqlPosts) list(query string, args ...interface{}) ([]model.Post, error) {
+	rows, err := r.query(query, args...)
+	if err != nil {
+		return nil, dbError(err)
+	}
+	defer rows.Close()
+
+	var posts []model.Post
+	for rows.Next() {
+		post, err := scanPost(rows)
+		if err != nil {
+			return nil, dbError(err)
+		}
+		posts = append(posts, *post)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, dbError(err)
+	}
+	return posts, nil
+}
+
+type sqlComments struct{ sqlRepository }
+
+func (r *sqlComments) Create(content Content, userID string, postID int) (int, error) {
+	var id int
+	err := r.inTx(func(tx sqlTx) error {
+		if err := requireVisiblePost(tx, postID); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		err := tx.queryRow(`
+			INSERT INTO comments (content, content_html, content_format, user_id, post_id, created_at)
+			VALUES (?, ?, ?, ?, ?, ?)
+			RETURNING id`,
+			content.Text, content.HTML, content.Format, userID, postID, now).Scan(&id)
+		if err != nil {
+			return err
+		}
+		_, err = tx.exec(`
+			UPDATE topics SET last_activity_at = ?
+			WHERE id IN (SELECT topic_id FROM posts_topics WHERE post_id = ?)`,
+			now, postID)
+		return err
+	})
+	return id, err
+}
+
+func (r *sqlComments) ByPost(postID int) ([]model.Comment, error) {
+	rows, err := r.query(`
+		SELECT c.id, c.content, c.content_html, c.content_format, u.username, c.user_id, c.post_id, c.created_at
+		FROM comments c
+		JOIN users u ON c.user_id = u.id
+		WHERE c.post_id = ?
+		ORDER BY c.created_at ASC`, postID)
+	if err != nil {
+		return nil, dbError(err)
+	}
+	defer rows.Close()
+
+	var comments []model.Comment
+	for rows.Next() {
+		var comment model.Comment
+		var createdAt nullTime
+		err := rows.Scan(&comment.ID, &comment.Content, &comment.ContentHTML, &comment.ContentFormat,
+			&comment.Author, &comment.UserID, &comment.PostID, &createdAt)
+		if err != nil {
+			return nil, dbError(err)
+		}
+		comment.CreatedAt = createdAt.Time
+		comments = append(comments, comment)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, dbError(err)
+	}
+	return comments, nil
+}
+
+func (r *sqlComments) ByPostPage(postID, limit, offset int) ([]model.FeedComment, error) {
+	rows, err := r.query(`
+		SELECT c.id, c.content, c.content_html, c.content_format, c.user_id, c.post_id, c.created_at, u.username
+		FROM comments c
+		JOIN users u ON c.user_id = u.id
+		WHERE c.post_id = ?
+		ORDER BY c.created_at ASC
+		LIMIT ? OFFSET ?`, postID, limit, offset)
+	if err != nil {
+		return nil, dbError(err)
+	}
+	defer rows.Close()
+
+	var comments []model.FeedComment
+	for rows.Next() {
+		var comment model.FeedComment
+		var createdAt nullTime
+		err := rows.Scan(&comment.ID, &comment.Content, &comment.ContentHTML, &comment.ContentFormat,
+			&comment.UserID, &comment.PostID, &createdAt, &comment.Author)
+		if err != nil {
+			return nil, dbError(err)
+		}
+		comment.CreatedAt = createdAt.Time.Format(time.RFC3339Nano)
+		comments = append(comments, comment)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, dbError(err)
+	}
+	return comments, nil
+}
+
+func (r *sqlComments) CountByPost(postID int) (int, error) {
+	var count int
+	if err := r.queryRow("SELECT COUNT(*) FROM comments WHERE post_id = ?", postID).Scan(&count); err != nil {
+		return 0, dbError(err)
+	}
+	return count, nil
+}
+
+func (r *sqlComments) ByUser(userID string) ([]model.Comment, error) {
+	return r.userComments(`
+		SELECT c.id, c.content, c.content_html, c.content_format, c.created_at, c.post_id, p.title, u.username
+		FROM comments c
+		JOIN posts p ON c.post_id = p.id
+		JOIN users u ON c.user_id = u.id
+		WHERE c.user_id = ?
+		ORDER BY c.created_at DESC`, userID)
+}
+
+func (r *sqlComments) ByUserPage(userID string, limit, offset int) ([]model.Comment, error) {
+	return r.userComments(`
+		SELECT c.id, c.content, c.content_html, c.content_format, c.created_at, c.post_id, p.title, u.username
+		FROM comments c
+		JOIN posts p ON c.post_id = p.id
+		JOIN users u ON c.user_id = u.id
+		WHERE c.user_id = ? AND `+visiblePost+`
+		ORDER BY c.created_at DESC, c.id DESC
+		LIMIT ? OFFSET ?`, userID, model.PostPublished, time.Now(), limit, offset)
+}
+
+// userComments runs a query for the comments of the user given first in
+// args, with the title of their post.
+func (r *sqlComments) userComments(query string, args ...interface{}) ([]model.Comment, error) {
+	userID := args[0].(string)
+	rows, err := r.query(query, args...)
+	if err != nil {
+		return nil, dbError(err)
+	}
+	defer rows.Close()
+
+	var comments []model.Comment
+	for rows.Next() {
+		var comment model.Comment
+		var createdAt nullTime
+		err := rows.Scan(&comment.ID, &comment.Content, &comment.ContentHTML, &comment.ContentFormat,
+			&createdAt, &comment.PostID, &comment.PostTitle, &comment.Author)
+		if err != nil {
+			return nil, dbError(err)
+		}
+		comment.UserID = userID
+		comment.CreatedAt = createdAt.Time
+		comments = append(comments, comment)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, dbError(err)
+	}
+	return comments, nil
+}
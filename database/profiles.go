@@ -0,0 +1,71 @@
+package database
+
+import (
+	"realtimeforum/model"
+	"time"
+)
+
+func (r *sqlUsers) SetPrivacy(id string, privacy model.ProfilePrivacy) error {
+	result, err := r.exec(`
+		UPDATE users SET show_name = ?, show_join_date = ?, show_counts = ?, show_activity = ?
+		WHERE id = ?`,
+		privacy.ShowName, privacy.ShowJoinDate, privacy.ShowCounts, privacy.ShowActivity, id)
+	if err != nil {
+		return dbError(err)
+	}
+	return requireOneRow(result, ErrUserNotFound)
+}
+
+func (r *sqlUsers) ProfileCounts(id string) (model.ProfileCounts, error) {
+	var counts model.ProfileCounts
+	now := time.Now()
+	err := r.queryRow(`
+		SELECT
+			(SELECT COUNT(*) FROM posts p WHERE p.user_id = ? AND `+visiblePost+`),
+			(SELECT COUNT(*) FROM comments c JOIN posts p ON p.id = c.post_id WHERE c.user_id = ? AND `+visiblePost+`),
+			(SELECT COUNT(*) FROM user_follows WHERE followee_id = ?),
+			(SELECT COUNT(*) FROM user_follows WHERE follower_id = ?)`,
+		id, model.PostPublished, now, id, model.PostPublished, now, id, id).
+		Scan(&counts.Posts, &counts.Comments, &counts.Followers, &counts.Following)
+	if err != nil {
+		return counts, dbError(err)
+	}
+	return counts, nil
+}
+
+func (r *sqlUsers) Activity(id string, limit int) ([]model.Activity, error) {
+	now := time.Now()
+	rows, err := r.query(`
+		SELECT kind, post_id, post_title, comment_id, created_at FROM (
+			SELECT 'post' AS kind, p.id AS post_id, p.title AS post_title, 0 AS comment_id, p.created_at AS created_at
+			FROM posts p
+			WHERE p.user_id = ? AND `+visiblePost+`
+			UNION ALL
+			SELECT 'comment', p.id, p.title, c.id, c.created_at
+			FROM comments c
+			JOIN posts p ON p.id = c.post_id
+			WHERE c.user_id = ? AND `+visiblePost+`
+		) activity
+		ORDER BY created_at DESC
+		LIMIT ?`,
+		id, model.PostPublished, now, id, model.PostPublished, now, limit)
+	if err != nil {
+		return nil, dbError(err)
+	}
+	defer rows.Close()
+
+	activity := []model.Activity{}
+	for rows.Next() {
+		var item model.Activity
+		var createdAt nullTime
+		if err := rows.Scan(&item.Kind, &item.PostID, &item.PostTitle, &item.CommentID, &createdAt); err != nil {
+			return nil, dbError(err)
+		}
+		item.CreatedAt = createdAt.Time
+		activity = append(activity, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, dbError(err)
+	}
+	return activity, nil
+}
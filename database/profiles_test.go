@@ -0,0 +1,69 @@
+package database_test
+
+import (
+	"realtimeforum/database"
+	"realtimeforum/model"
+	"testing"
+	"time"
+)
+
+func testProfiles(t *testing.T) {
+	f := newFixture(t)
+	dana := createUser(t, "dana")
+	published := createPost(t, dana.ID, "Profile post", f.topicIDs[0])
+	// Neither counted nor listed until published
+	_, err := database.Posts.Create(database.NewPost{Title: "Hidden profile post", Content: plain("Not yet"),
+		UserID: dana.ID, TopicIDs: f.topicIDs[:1], PostSchedule: database.PostSchedule{PublishAt: time.Now().Add(time.Hour)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, postID := range []int{published, f.postID} {
+		time.Sleep(5 * time.Millisecond)
+		if _, err := database.Comments.Create(plain("Profile comment"), dana.ID, postID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := database.Follows.SetUser(f.bob.ID, dana.ID, true); err != nil {
+		t.Fatal(err)
+	}
+
+	counts, err := database.Users.ProfileCounts(dana.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "counts", counts, model.ProfileCounts{Posts: 1, Comments: 2, Followers: 1})
+	activity, err := database.Users.Activity(dana.ID, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(activity) != 2 {
+		t.Fatalf("got %d activities, want 2", len(activity))
+	}
+	expect(t, "latest activity", activity[0].Kind, "comment")
+	expect(t, "latest activity post", activity[0].PostID, f.postID)
+	expect(t, "latest activity comment", activity[0].CommentID != 0, true)
+	expect(t, "older activity post", activity[1].PostID, published)
+	comments, err := database.Comments.ByUserPage(dana.ID, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(comments) != 1 {
+		t.Fatalf("got %d comments on the second page, want 1", len(comments))
+	}
+	expect(t, "second comment page", comments[0].PostID, published)
+
+	stored, err := database.Users.GetByID(dana.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "privacy shown by default", stored.Privacy, model.ProfilePrivacy{ShowName: true, ShowJoinDate: true, ShowCounts: true, ShowActivity: true})
+	private := model.ProfilePrivacy{ShowJoinDate: true}
+	if err := database.Users.SetPrivacy(dana.ID, private); err != nil {
+		t.Fatal(err)
+	}
+	if stored, err = database.Users.GetByID(dana.ID); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "privacy saved", stored.Privacy, private)
+	expectError(t, "privacy of an unknown user", database.Users.SetPrivacy("nobody", private), database.ErrUserNotFound)
+}
@@ -0,0 +1,188 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"realtimeforum/model"
+	"time"
+)
+
+func (r *sqlPosts) Scheduled(userID string) ([]model.Post, error) {
+	posts, err := r.list(`
+		SELECT `+postColumns+`
+		FROM posts p
+		JOIN users u ON p.user_id = u.id
+		WHERE p.user_id = ? AND p.status = ?
+		ORDER BY p.publish_at, p.id`, userID, model.PostScheduled)
+	if err != nil || len(posts) == 0 {
+		return posts, err
+	}
+
+	ids := make([]interface{}, len(posts))
+	for i, post := range posts {
+		ids[i] = post.ID
+	}
+	topics, err := r.topicNames("("+placeholders(len(ids))+")", ids...)
+	if err != nil {
+		return nil, err
+	}
+	for i := range posts {
+		posts[i].Topics = topics[posts[i].ID]
+	}
+	return posts, nil
+}
+
+func (r *sqlPosts) Reschedule(id int, userID string, changes ScheduleChanges) error {
+	return r.inTx(func(tx sqlTx) error {
+		var status string
+		var publishAt, expiresAt nullTime
+		err := tx.queryRow("SELECT status, publish_at, expires_at FROM posts WHERE id = ? AND user_id = ?", id, userID).
+			Scan(&status, &publishAt, &expiresAt)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrPostNotFound
+		}
+		if err != nil {
+			return dbError(err)
+		}
+
+		if changes.PublishAt != nil {
+			if status == model.PostPublished {
+				return ErrPostPublished
+			}
+			publishAt.Time = *changes.PublishAt
+		}
+		switch {
+		case changes.ClearExpiry:
+			expiresAt.Time = time.Time{}
+		case changes.ExpiresAt != nil:
+			expiresAt.Time = *changes.ExpiresAt
+		}
+		// The expiry of a published post is checked against the present
+		// by the caller
+		if status != model.PostPublished && !expiresAt.Time.IsZero() && !expiresAt.Time.After(publishAt.Time) {
+			return ErrExpiryBeforePublish
+		}
+
+		_, err = tx.exec("UPDATE posts SET publish_at = ?, expires_at = ?, updated_at = ? WHERE id = ?",
+			timeArg(publishAt.Time), timeArg(expiresAt.Time), time.Now(), id)
+		if err != nil {
+			return dbError(err)
+		}
+		return nil
+	})
+}
+
+func (r *sqlPosts) Cancel(id int, userID string) ([]StoredAttachment, error) {
+	var attachments []StoredAttachment
+	err := r.inTx(func(tx sqlTx) error {
+		status, err := postStatus(tx, id, userID)
+		if err != nil {
+			return err
+		}
+		if status == model.PostPublished {
+			return ErrPostPublished
+		}
+
+		rows, err := tx.query(`
+			SELECT `+attachmentColumns+`
+			FROM attachments a
+			WHERE a.post_id = ?`, id)
+		if err != nil {
+			return dbError(err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			a, err := scanAttachment(rows)
+			if err != nil {
+				return dbError(err)
+			}
+			attachments = append(attachments, *a)
+		}
+		if err := rows.Err(); err != nil {
+			return dbError(err)
+		}
+		rows.Close()
+
+		// Topics and attachments go with it
+		if _, err := tx.exec("DELETE FROM posts WHERE id = ?", id); err != nil {
+			return dbError(err)
+		}
+		return nil
+	})
+	return attachments, err
+}
+
+func (r *sqlPosts) PublishDue(now time.Time) ([]model.Post, error) {
+	var published []model.Post
+	err := r.inTx(func(tx sqlTx) error {
+		rows, err := tx.query(`
+			SELECT `+postColumns+`
+			FROM posts p
+			JOIN users u ON p.user_id = u.id
+			WHERE p.status = ? AND p.publish_at <= ?
+			ORDER BY p.publish_at, p.id`, model.PostScheduled, timeArg(now))
+		if err != nil {
+			return dbError(err)
+		}
+		defer rows.Close()
+		var due []model.Post
+		for rows.Next() {
+			post, err := scanPost(rows)
+			if err != nil {
+				return dbError(err)
+			}
+			due = append(due, *post)
+		}
+		if err := rows.Err(); err != nil {
+			return dbError(err)
+		}
+		rows.Close()
+
+		for _, post := range due {
+			// The post is dated when it is published rather than when it
+			// was due, so that it lands ahead of the cursors handed out
+			// in the meantime instead of behind them
+			result, err := tx.exec(`
+				UPDATE posts SET status = ?, created_at = ?, updated_at = ?
+				WHERE id = ? AND status = ?`,
+				model.PostPublished, now, now, post.ID, model.PostScheduled)
+			if err != nil {
+				return dbError(err)
+			}
+			if count, err := result.RowsAffected(); err != nil {
+				return dbError(err)
+			} else if count == 0 {
+				// Another server got it first
+				continue
+			}
+
+			_, err = tx.exec(`
+				UPDATE topics SET last_activity_at = ?
+				WHERE id IN (SELECT topic_id FROM posts_topics WHERE post_id = ?)`,
+				now, post.ID)
+			if err != nil {
+				return dbError(err)
+			}
+			post.Status, post.CreatedAt = model.PostPublished, now
+			published = append(published, post)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return published, nil
+}
+
+// postStatus returns the status of a post of userID, or ErrPostNotFound.
+func postStatus(tx sqlTx, id int, userID string) (string, error) {
+	var status string
+	err := tx.queryRow("SELECT status FROM posts WHERE id = ? AND user_id = ?", id, userID).Scan(&status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrPostNotFound
+	}
+	if err != nil {
+		return "", dbError(err)
+	}
+	return status, nil
+}
@@ -1,19 +1,108 @@
 -- seed.sql
--- Dummy data for testing/development
-PRAGMA foreign_keys = ON;
--- Insert Topics
-INSERT
-    OR IGNORE INTO topics (name, emoji)
-VALUES ('Daily Essentials', '🛒'),
-    ('Home & Lifestyle', '🏠'),
-    ('Personal Well-being', '💖'),
-    ('Technology & Innovation', '💻'),
-    ('Leisure & Entertainment', '🎮'),
-    ('Commerce & Shopping', '🛍️'),
-    ('Mobility & Transportation', '🚗'),
-    ('Services & Support', '🤝'),
-    ('Culture & Community', '🌎'),
-    ('Information & Learning', '🎓'),
-    ('Quick Recipes', '🍳'),
-    ('Nutrition Insights', '🍎');
+-- Demo data for testing/development, only applied on request (`seed` command).
+-- Every demo user logs in with the password "password123".
 -- Insert Users with UUIDs
+INSERT INTO users (
+        id,
+        first_name,
+        last_name,
+        username,
+        email,
+        password_hash,
+        age,
+        gender,
+        terms_accepted
+    )
+VALUES (
+        '6f1c2a8e-1d4b-4c8a-9a57-0b5e3f6d2a01',
+        'Alice',
+        'Martin',
+        'alice_demo',
+        'alice@example.com',
+        '$2a$10$Go5rJ6x9fIxf9NhsW7.9me1H681ENR4tf/zG4nDBje4/AyEgaX.LK',
+        29,
+        'female',
+        TRUE
+    ),
+    (
+        '0b7d9e4c-5a2f-4e61-8c3d-7f2a1b9e6c02',
+        'Bruno',
+        'Silva',
+        'bruno_demo',
+        'bruno@example.com',
+        '$2a$10$Go5rJ6x9fIxf9NhsW7.9me1H681ENR4tf/zG4nDBje4/AyEgaX.LK',
+        41,
+        'male',
+        TRUE
+    ),
+    (
+        'c3e8f1a6-9b2d-4d7e-a5c4-2e6b8d0f4a03',
+        'Chloe',
+        'Nguyen',
+        'chloe_demo',
+        'chloe@example.com',
+        '$2a$10$Go5rJ6x9fIxf9NhsW7.9me1H681ENR4tf/zG4nDBje4/AyEgaX.LK',
+        35,
+        'other',
+        TRUE
+    ) ON CONFLICT DO NOTHING;
+-- Insert Posts
+INSERT INTO posts (title, content, user_id)
+VALUES (
+        'Weekly grocery budget that actually works',
+        'Plan meals first; then write the list. I keep a running total on my phone and stop at 80 euros.',
+        '6f1c2a8e-1d4b-4c8a-9a57-0b5e3f6d2a01'
+    ),
+    (
+        'Is an e-bike worth it for a 10 km commute?',
+        'I am tired of traffic jams. Anyone switched to an e-bike for daily commuting?',
+        '0b7d9e4c-5a2f-4e61-8c3d-7f2a1b9e6c02'
+    ),
+    (
+        'Fifteen minute lentil soup',
+        'Red lentils, onion, carrot, cumin; simmer for 15 minutes and blend half of it.',
+        'c3e8f1a6-9b2d-4d7e-a5c4-2e6b8d0f4a03'
+    ) ON CONFLICT DO NOTHING;
+-- Link Posts to Topics
+INSERT INTO posts_topics (post_id, topic_id)
+SELECT p.id,
+    t.id
+FROM posts p
+    JOIN topics t ON (
+        p.title = 'Weekly grocery budget that actually works'
+        AND t.name IN ('Daily Essentials', 'Commerce & Shopping')
+    )
+    OR (
+        p.title = 'Is an e-bike worth it for a 10 km commute?'
+        AND t.name = 'Mobility & Transportation'
+    )
+    OR (
+        p.title = 'Fifteen minute lentil soup'
+        AND t.name IN ('Quick Recipes', 'Nutrition Insights')
+    )
+WHERE true ON CONFLICT DO NOTHING;
+-- Insert Comments (only once, comments have no natural key)
+INSERT INTO comments (content, user_id, post_id)
+SELECT c.content,
+    c.user_id,
+    p.id
+FROM (
+        SELECT 'Great tip, the running total keeps me honest too.' AS content,
+            '0b7d9e4c-5a2f-4e61-8c3d-7f2a1b9e6c02' AS user_id,
+            'Weekly grocery budget that actually works' AS title
+        UNION ALL
+        SELECT 'Did it last year; best purchase I made.',
+            'c3e8f1a6-9b2d-4d7e-a5c4-2e6b8d0f4a03',
+            'Is an e-bike worth it for a 10 km commute?'
+        UNION ALL
+        SELECT 'Adding a squeeze of lemon at the end makes it.',
+            '6f1c2a8e-1d4b-4c8a-9a57-0b5e3f6d2a01',
+            'Fifteen minute lentil soup'
+    ) c
+    JOIN posts p ON p.title = c.title
+WHERE NOT EXISTS (
+        SELECT 1
+        FROM comments existing
+        WHERE existing.post_id = p.id
+            AND existing.content = c.content
+    );
@@ -0,0 +1,127 @@
+package database_test
+
+import (
+	"fmt"
+	"realtimeforum/database"
+	"realtimeforum/database/dbtest"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestSQLitePools(t *testing.T) {
+	dbtest.Open(t, database.SQLite)
+
+	var mode string
+	if err := database.DB.QueryRow("PRAGMA journal_mode").Scan(&mode); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "journal mode", mode, "wal")
+	expect(t, "write connections", database.DB.Stats().MaxOpenConnections, 1)
+
+	// A write sent to the read pool fails instead of taking the lock
+	if _, err := database.ReadDB.Exec("DELETE FROM users"); err == nil {
+		t.Error("the read pool accepted a write")
+	}
+}
+
+func TestSQLiteConcurrentChat(t *testing.T) {
+	dbtest.Open(t, database.SQLite)
+	const senders, messages = 20, 20
+	users := createUsers(t, senders)
+
+	// Readers load chat lists the whole time
+	done := make(chan struct{})
+	var readers sync.WaitGroup
+	var readErr atomic.Value
+	for i := 0; i < 4; i++ {
+		readers.Add(1)
+		go func(i int) {
+			defer readers.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				if _, err := database.Chat.Contacts(users[i]); err != nil {
+					readErr.Store(err)
+				}
+			}
+		}(i)
+	}
+
+	var senderGroup sync.WaitGroup
+	var failed atomic.Int64
+	for i := range users {
+		senderGroup.Add(1)
+		go func(i int) {
+			defer senderGroup.Done()
+			for m := 0; m < messages; m++ {
+				if err := send(users[i], users[(i+1)%len(users)], fmt.Sprintf("message %d from %d", m, i)); err != nil {
+					failed.Add(1)
+					t.Log(err)
+				}
+			}
+		}(i)
+	}
+	senderGroup.Wait()
+	close(done)
+	readers.Wait()
+
+	var stored int
+	if err := database.ReadDB.QueryRow("SELECT COUNT(*) FROM chat_messages").Scan(&stored); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "failed sends", failed.Load(), int64(0))
+	expect(t, "messages stored", stored, senders*messages)
+	if err, ok := readErr.Load().(error); ok {
+		t.Errorf("chat list read failed: %v", err)
+	}
+}
+
+// BenchmarkChatSend stores messages the way the hub does from many
+// senders at once; cmd/chatbench reports the latency distribution.
+func BenchmarkChatSend(b *testing.B) {
+	dbtest.Open(b, database.SQLite)
+	users := createUsers(b, 50)
+	var next atomic.Int64
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := int(next.Add(1))
+		sender, receiver := users[i%len(users)], users[(i+1)%len(users)]
+		for pb.Next() {
+			if err := send(sender, receiver, "benchmark message"); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
+
+// send stores a message like the hub's chat handler does.
+func send(senderID, receiverID, text string) error {
+	message, err := database.Chat.SaveMessage(senderID, receiverID, text)
+	if err != nil {
+		return err
+	}
+	if err := database.Chat.SetLastMessage(senderID, receiverID, message.ID); err != nil {
+		return err
+	}
+	_, err = database.Events.Append(receiverID, "new_message", `{"message":"`+text+`"}`)
+	return err
+}
+
+func createUsers(t testing.TB, n int) []string {
+	t.Helper()
+	ids := make([]string, n)
+	for i := range ids {
+		user := newUser(fmt.Sprintf("user_%d", i))
+		if err := database.Users.Create(user); err != nil {
+			t.Fatal(err)
+		}
+		ids[i] = user.ID
+	}
+	return ids
+}
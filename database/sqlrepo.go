@@ -0,0 +1,99 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// sqlRepository is shared by the repositories of both backends: queries
+// use ? placeholders and are rebound for the dialect. Writes go to db,
+// queries to the read pool.
+type sqlRepository struct {
+	db      *sql.DB
+	read    *sql.DB
+	dialect Dialect
+}
+
+func (r sqlRepository) exec(query string, args ...interface{}) (sql.Result, error) {
+	return r.db.Exec(r.dialect.Rebind(query), args...)
+}
+
+// insert runs a write that returns a row, INSERT ... RETURNING.
+func (r sqlRepository) insert(query string, args ...interface{}) *sql.Row {
+	return r.db.QueryRow(r.dialect.Rebind(query), args...)
+}
+
+func (r sqlRepository) query(query string, args ...interface{}) (*sql.Rows, error) {
+	return r.read.Query(r.dialect.Rebind(query), args...)
+}
+
+func (r sqlRepository) queryRow(query string, args ...interface{}) *sql.Row {
+	return r.read.QueryRow(r.dialect.Rebind(query), args...)
+}
+
+// inTx runs fn in a transaction on the write pool; exec and queryRow of
+// the returned helper are rebound like the repository's. fn must not use
+// the repository itself: with SQLite it would wait for the connection
+// the transaction holds.
+func (r sqlRepository) inTx(fn func(tx sqlTx) error) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(sqlTx{tx: tx, dialect: r.dialect}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+type sqlTx struct {
+	tx      *sql.Tx
+	dialect Dialect
+}
+
+func (t sqlTx) exec(query string, args ...interface{}) (sql.Result, error) {
+	return t.tx.Exec(t.dialect.Rebind(query), args...)
+}
+
+func (t sqlTx) queryRow(query string, args ...interface{}) *sql.Row {
+	return t.tx.QueryRow(t.dialect.Rebind(query), args...)
+}
+
+func (t sqlTx) query(query string, args ...interface{}) (*sql.Rows, error) {
+	return t.tx.Query(t.dialect.Rebind(query), args...)
+}
+
+func (t sqlTx) prepare(query string) (*sql.Stmt, error) {
+	return t.tx.Prepare(t.dialect.Rebind(query))
+}
+
+// sqlReader reads from a repository's read pool or inside a
+// transaction.
+type sqlReader interface {
+	query(query string, args ...interface{}) (*sql.Rows, error)
+	queryRow(query string, args ...interface{}) *sql.Row
+}
+
+// placeholders returns "?, ?, ?" for n values.
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// dbError wraps unexpected errors like the rest of the package does.
+func dbError(err error) error {
+	return fmt.Errorf("%w: %v", ErrDatabaseError, err)
+}
+
+func requireOneRow(result sql.Result, notFound error) error {
+	count, err := result.RowsAffected()
+	if err != nil {
+		return dbError(err)
+	}
+	if count == 0 {
+		return notFound
+	}
+	return nil
+}
@@ -0,0 +1,493 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"realtimeforum/model"
+	"time"
+)
+
+// DB is the global database connection
+var DB *sql.DB
+
+// ReadDB is the pool queries go through. With SQLite it is separate from
+// DB, which only writes; with PostgreSQL it is DB.
+var ReadDB *sql.DB
+
+// Repositories of the open database, set by Use. Handlers, auth and the
+// WebSocket hub go through these instead of writing SQL.
+var (
+	Users       UserRepository
+	Sessions    SessionRepository
+	Posts       PostRepository
+	Comments    CommentRepository
+	Topics      TopicRepository
+	Chat        ChatRepository
+	Presence    PresenceRepository
+	Events      EventRepository
+	Follows     FollowRepository
+	Attachments AttachmentRepository
+	Drafts      DraftRepository
+	Bookmarks   BookmarkRepository
+)
+
+// DeletedUserID is the account that keeps the posts and comments of
+// deleted accounts, shown as DeletedUsername. Nobody can log in as it,
+// and it is left out of the lists of users.
+const (
+	DeletedUserID   = "00000000-0000-0000-0000-000000000000"
+	DeletedUsername = "deleted user"
+)
+
+// Custom error types for better error handling
+var (
+	ErrUserNotFound        = errors.New("user not found")
+	ErrPostNotFound        = errors.New("post not found")
+	ErrTopicNotFound       = errors.New("topic not found")
+	ErrSessionNotFound     = errors.New("invalid session token")
+	ErrUnauthorized        = errors.New("unauthorized access")
+	ErrForbidden           = errors.New("forbidden access")
+	ErrDatabaseError       = errors.New("database error")
+	ErrFollowSelf          = errors.New("users cannot follow themselves")
+	ErrDuplicateTopic      = errors.New("a topic with this name or emoji already exists")
+	ErrInvalidTopic        = errors.New("invalid topic")
+	ErrTopicArchived       = errors.New("topic is archived")
+	ErrDuplicateTitle      = errors.New("a post with this title already exists")
+	ErrAttachmentNotFound  = errors.New("attachment not found")
+	ErrDraftNotFound       = errors.New("draft not found")
+	ErrDraftConflict       = errors.New("the draft was saved elsewhere in the meantime")
+	ErrPostPublished       = errors.New("post is already published")
+	ErrExpiryBeforePublish = errors.New("expiry must come after publication")
+	ErrCollectionNotFound  = errors.New("bookmark collection not found")
+	ErrDuplicateCollection = errors.New("a bookmark collection with this name already exists")
+	ErrInvalidCollection   = errors.New("invalid bookmark collection")
+	ErrUsernameTaken       = errors.New("username already exists")
+	ErrEmailTaken          = errors.New("email already exists")
+	ErrInvalidToken        = errors.New("invalid or expired token")
+)
+
+// UserRepository stores accounts.
+type UserRepository interface {
+	// GetByID and GetByIdentity return ErrUserNotFound for unknown users;
+	// an identity is a username or an email.
+	GetByID(id string) (*model.User, error)
+	GetByIdentity(identity string) (*model.User, error)
+	// GetByUsername only matches usernames, for public pages.
+	GetByUsername(username string) (*model.User, error)
+	// IDByIdentity returns "" when nobody has this username or email.
+	IDByIdentity(identity string) (string, error)
+	// Create inserts user, whose ID and PasswordHash must be set; an empty
+	// Role makes a regular user.
+	Create(user *model.User) error
+	// Update changes the public details of a user; a username already
+	// in use is ErrUsernameTaken.
+	Update(id, firstName, lastName, username, bio string) error
+	SetRole(id, role string) error
+	// ResetPassword stores a new hash and deletes every session of the
+	// user in the same transaction.
+	ResetPassword(id, passwordHash string) error
+	// SetPassword stores a new hash and deletes every session of the
+	// user but keepToken, the one changing it.
+	SetPassword(id, passwordHash, keepToken string) error
+	// RequestEmailChange records email as waiting for confirmation with
+	// token until expiry, replacing any earlier request of the user.
+	RequestEmailChange(id, email, token string, expiry time.Time) error
+	// CancelEmailChange forgets the request waiting for token, if any.
+	CancelEmailChange(id, token string) error
+	// PendingEmail returns the email waiting for confirmation, or "".
+	PendingEmail(id string) (string, error)
+	// ConfirmEmailChange makes the email of token the user's and returns
+	// the user ID. Unknown or expired tokens are ErrInvalidToken, an
+	// email taken since the request ErrEmailTaken.
+	ConfirmEmailChange(token string) (string, error)
+	// SetAvatar makes an image the user uploaded, attached to nothing,
+	// their avatar, "" removing it, and returns the previous one. Other
+	// attachments are ErrAttachmentNotFound.
+	SetAvatar(id, attachmentID string) (previous string, err error)
+	// ScheduleDeletion deletes the account at the given time, or cancels
+	// the deletion for a zero time.
+	ScheduleDeletion(id string, at time.Time) error
+	// DueForDeletion returns the accounts to delete by now.
+	DueForDeletion(now time.Time) ([]string, error)
+	// Purge deletes an account with everything that is only its own. Its
+	// published posts and comments, with their attachments, go to
+	// DeletedUserID; its private messages go with it, with the events of
+	// other users replaying them, and the notifications naming it name
+	// DeletedUserID instead. It returns the attachments deleted, so that
+	// their blobs can go too.
+	Purge(id string) ([]StoredAttachment, error)
+	List(adminsOnly bool) ([]UserSummary, error)
+	SetPrivacy(id string, privacy model.ProfilePrivacy) error
+	// ProfileCounts and Activity only count posts others can see: those
+	// published and not expired, and the comments on them.
+	ProfileCounts(id string) (model.ProfileCounts, error)
+	// Activity returns the latest posts and comments of a user, at most
+	// limit, newest first.
+	Activity(id string, limit int) ([]model.Activity, error)
+}
+
+// SessionRepository stores logins.
+type SessionRepository interface {
+	Create(userID, token string, expiry time.Time) error
+	// User returns the owner of a session that has not expired, or
+	// ErrSessionNotFound.
+	User(token string) (*model.User, error)
+	// Lookup returns the owner and expiry of a session, expired or not,
+	// or ErrSessionNotFound.
+	Lookup(token string) (userID string, expiry time.Time, err error)
+	List(userID string) ([]Session, error)
+	Delete(token string) (bool, error)
+	DeleteForUser(userID string) (int64, error)
+	DeleteExpired() (int64, error)
+}
+
+// PostRepository stores posts and their topics.
+type PostRepository interface {
+	// Create inserts the post with its topics and attachments and returns
+	// its ID. Unknown topics are ErrTopicNotFound, archived ones
+	// ErrTopicArchived, and titles are unique: ErrDuplicateTitle.
+	// Attachments must be unattached uploads of the author, or
+	// ErrAttachmentNotFound.
+	Create(post NewPost) (int, error)
+	// GetByID returns a post whatever its status; only its author may
+	// see it before it is published or once it expired.
+	GetByID(id int) (*model.Post, error)
+	// GetVisible returns a post if viewerID may read it: one of theirs,
+	// or a published post that has not expired. Others are
+	// ErrPostNotFound.
+	GetVisible(id int, viewerID string) (*model.Post, error)
+	Count() (int, error)
+	// Feed returns a page of the published posts matching query that
+	// have not expired, with their topics, counts and first comments, in
+	// a fixed number of queries. A cursor of another sort is
+	// ErrInvalidCursor.
+	Feed(query FeedQuery) (FeedPage, error)
+	// ByUser returns the newest posts of a user, at most limit or all
+	// for 0, with their topics, scheduled and expired ones included.
+	ByUser(userID string, limit int) ([]model.Post, error)
+	// SetLike likes or unlikes a post for userID and returns its number of
+	// likes, or ErrPostNotFound. Only published posts can be liked.
+	SetLike(postID int, userID string, liked bool) (int, error)
+	// Scheduled returns the posts of a user waiting for publication, the
+	// next one first.
+	Scheduled(userID string) ([]model.Post, error)
+	// Reschedule changes when a post of userID is published and when it
+	// expires, keeping what changes leaves unset. The publication time of
+	// a published post cannot change: ErrPostPublished. An expiry that
+	// does not come after the publication of a scheduled post is
+	// ErrExpiryBeforePublish.
+	Reschedule(id int, userID string, changes ScheduleChanges) error
+	// Cancel deletes a scheduled post of userID and returns its
+	// attachments, whose blobs must go too. A published post is
+	// ErrPostPublished.
+	Cancel(id int, userID string) ([]StoredAttachment, error)
+	// PublishDue publishes the scheduled posts whose time has come and
+	// returns them. Each post is returned by one call only, even with
+	// several servers on one database.
+	PublishDue(now time.Time) ([]model.Post, error)
+}
+
+// CommentRepository stores comments on posts.
+type CommentRepository interface {
+	// Create returns ErrPostNotFound unless the post is published.
+	Create(content Content, userID string, postID int) (int, error)
+	// ByPost returns every comment of a post, oldest first.
+	ByPost(postID int) ([]model.Comment, error)
+	ByPostPage(postID, limit, offset int) ([]model.FeedComment, error)
+	CountByPost(postID int) (int, error)
+	// ByUser returns every comment of a user with the post title, newest
+	// first.
+	ByUser(userID string) ([]model.Comment, error)
+	// ByUserPage returns a page of the comments of a user on published
+	// posts that have not expired, newest first.
+	ByUserPage(userID string, limit, offset int) ([]model.Comment, error)
+}
+
+// TopicRepository stores the topics posts are tagged with.
+type TopicRepository interface {
+	// List returns the topics by position, then ID, with their number of
+	// posts and last activity; archived ones only when asked.
+	List(includeArchived bool) ([]TopicSummary, error)
+	// Get returns a topic, archived or not, or ErrTopicNotFound.
+	Get(id int) (TopicSummary, error)
+	// Create validates a topic, places it last and returns its ID. Names
+	// are unique ignoring case and emojis are unique: ErrDuplicateTopic.
+	// Invalid fields are ErrInvalidTopic.
+	Create(name, emoji, description string) (int, error)
+	// Update applies the changes that are set, validated like Create.
+	Update(id int, changes TopicChanges) error
+	Delete(id int) error
+	// IDByName returns ErrTopicNotFound for unknown names.
+	IDByName(name string) (int, error)
+	// NamesForPost returns the names of the topics of a post.
+	NamesForPost(postID int) ([]string, error)
+}
+
+// ChatRepository stores private messages.
+type ChatRepository interface {
+	// SaveMessage stores an unread message with the given attachments,
+	// unattached uploads of the sender, and returns it with the sender's
+	// username. Other attachments are ErrAttachmentNotFound.
+	SaveMessage(senderID, receiverID, message string, attachmentIDs ...string) (*model.ChatMessage, error)
+	// SetLastMessage remembers the latest message between two users.
+	SetLastMessage(userID, otherID string, messageID int) error
+	// Conversation returns a page of messages between two users, newest
+	// first.
+	Conversation(userID, otherID string, limit, offset int) ([]model.ChatMessage, error)
+	// Messages returns every message userID sent or received, oldest
+	// first.
+	Messages(userID string) ([]model.ChatMessage, error)
+	// MarkRead marks what senderID sent to receiverID as read and returns
+	// how many messages changed.
+	MarkRead(receiverID, senderID string) (int64, error)
+	// Contacts returns every other user with their presence, the last
+	// message exchanged with userID and how many of theirs are unread.
+	Contacts(userID string) ([]ChatContact, error)
+}
+
+// PresenceRepository stores online statuses (the user_online table).
+type PresenceRepository interface {
+	// Load falls back to defaults for users that never connected.
+	Load(userID string) (PresenceRecord, error)
+	LoadMany(userIDs []string) ([]PresenceRecord, error)
+	// All returns the presence of every user, by username.
+	All() ([]PresenceRecord, error)
+	// Save stores the status, custom status and last seen setting.
+	Save(record PresenceRecord) error
+	SetIdle(userID string, idle bool) error
+	// SetOnline writes the online flag of several users in one
+	// transaction. Going online or offline clears the idle flag.
+	SetOnline(statuses map[string]bool) error
+}
+
+// EventRepository stores the per-user log of durable WebSocket events.
+type EventRepository interface {
+	// Append stores an event and returns its sequence number.
+	Append(userID, eventType, payload string) (int64, error)
+	// Ack moves the user's cursor forward, never back.
+	Ack(userID string, seq int64) error
+	// Cursor returns the last acknowledged sequence number and when it
+	// was stored; found is false for users that never acknowledged.
+	Cursor(userID string) (seq int64, updated time.Time, found bool, err error)
+	// Since returns events after seq created since a time, newest first,
+	// at most limit; Data holds the payload as json.RawMessage.
+	Since(userID string, seq int64, since time.Time, limit int) ([]model.WebSocketMessage, error)
+	Prune(before time.Time) (int64, error)
+}
+
+// FollowRepository stores which users and topics users follow.
+type FollowRepository interface {
+	// SetUser follows or unfollows followeeID; both can be repeated.
+	// Unknown users are ErrUserNotFound, following oneself ErrFollowSelf.
+	SetUser(followerID, followeeID string, follow bool) error
+	// SetTopic follows or unfollows a topic, or returns ErrTopicNotFound.
+	SetTopic(userID string, topicID int, follow bool) error
+	Counts(userID string) (model.FollowCounts, error)
+	// IsFollowing tells whether followerID follows followeeID.
+	IsFollowing(followerID, followeeID string) (bool, error)
+	// Followers and Following return a page of users, the latest
+	// followed first.
+	Followers(userID string, limit, offset int) ([]model.FollowUser, error)
+	Following(userID string, limit, offset int) ([]model.FollowUser, error)
+	// Topics returns every topic the user follows, by ID.
+	Topics(userID string) ([]model.FollowTopic, error)
+}
+
+// AttachmentRepository stores the records of uploaded files; their blobs
+// are in a blob.Store.
+type AttachmentRepository interface {
+	// Create records an upload of attachment.UserID, attached to nothing.
+	Create(attachment *StoredAttachment) error
+	// Get returns the attachment if userID may see it: its uploader, any
+	// user once it is an avatar or on a post anyone may read, or the two
+	// users of its chat message. Otherwise it is ErrAttachmentNotFound.
+	Get(id, userID string) (*StoredAttachment, error)
+	// Delete removes an upload of userID that is attached to nothing, nor
+	// an avatar, and returns it, so that its blobs can go too.
+	Delete(id, userID string) (*StoredAttachment, error)
+}
+
+// DraftRepository stores the drafts of each user. Every save bumps the
+// revision of a draft, and a save based on an older one fails, so that
+// two devices cannot overwrite each other's work.
+type DraftRepository interface {
+	Create(draft NewDraft) (*model.Draft, error)
+	// Save replaces the fields of a draft of draft.UserID whose revision
+	// is still revision, or returns ErrDraftConflict.
+	Save(id, revision int, draft NewDraft) (*model.Draft, error)
+	Get(id int, userID string) (*model.Draft, error)
+	// List returns the drafts of a user, last saved first.
+	List(userID string) ([]model.Draft, error)
+	Count(userID string) (int, error)
+	Delete(id int, userID string) error
+}
+
+// BookmarkRepository stores the posts users save to read later, each in
+// one of their named collections or in none.
+type BookmarkRepository interface {
+	// Set saves or unsaves a post for userID; both can be repeated. Saving
+	// a saved post moves it to collectionID, 0 for none, and keeps when it
+	// was saved. Only published posts can be saved, or ErrPostNotFound;
+	// collections of others are ErrCollectionNotFound.
+	Set(userID string, postID, collectionID int, saved bool) error
+	// List returns a page of the bookmarks of userID, the latest saved
+	// first, only those in collectionID unless it is 0, with how many
+	// there are in all. Expired posts are left out.
+	List(userID string, collectionID, limit, offset int) ([]model.Bookmark, int, error)
+	// Saved tells whether userID saved a post.
+	Saved(userID string, postID int) (bool, error)
+	// Collections returns the collections of userID by name.
+	Collections(userID string) ([]model.BookmarkCollection, error)
+	// CreateCollection and RenameCollection return ErrInvalidCollection
+	// for empty or long names and ErrDuplicateCollection for names the
+	// user already has.
+	CreateCollection(userID, name string) (*model.BookmarkCollection, error)
+	RenameCollection(id int, userID, name string) error
+	// DeleteCollection deletes a collection; its bookmarks stay, in none.
+	DeleteCollection(id int, userID string) error
+}
+
+// NewDraft is what a draft holds. Unknown topics are dropped.
+type NewDraft struct {
+	UserID   string
+	Title    string
+	Content  string
+	Format   string
+	TopicIDs []int
+}
+
+// NewPost is a post to create.
+type NewPost struct {
+	Title         string
+	Content       Content
+	UserID        string
+	TopicIDs      []int
+	AttachmentIDs []string
+	PostSchedule
+}
+
+// PostSchedule is when a post is published, now if zero or past, and
+// when it expires, never if zero.
+type PostSchedule struct {
+	PublishAt time.Time
+	ExpiresAt time.Time
+}
+
+// ScheduleChanges are the times of a post to update; nil ones are kept
+// and ClearExpiry removes the expiry.
+type ScheduleChanges struct {
+	PublishAt   *time.Time
+	ExpiresAt   *time.Time
+	ClearExpiry bool
+}
+
+// StoredAttachment is an attachment with its owner, its place in the
+// blob store and what it is attached to, 0 for nothing.
+type StoredAttachment struct {
+	model.Attachment
+	UserID       string
+	BlobKey      string
+	ThumbnailKey string
+	PostID       int
+	MessageID    int
+}
+
+// Content is the text of a post or comment as written, its format and,
+// for model.ContentMarkdown, the sanitized HTML it renders to.
+type Content struct {
+	Text   string
+	HTML   string
+	Format string
+}
+
+// UserSummary is a user as listed by the admin tool.
+type UserSummary struct {
+	Username  string
+	Email     string
+	Role      string
+	CreatedAt time.Time
+	Posts     int
+	Sessions  int
+}
+
+// Session is one login of a user.
+type Session struct {
+	Token     string
+	UserID    string
+	Username  string
+	Expiry    time.Time
+	CreatedAt time.Time
+}
+
+// TopicSummary is a topic with the number of posts tagged with it.
+type TopicSummary struct {
+	ID          int
+	Name        string
+	Emoji       string
+	Description string
+	Position    int
+	Archived    bool
+	PostCount   int
+	// LastActivity is the latest post or comment in the topic, zero
+	// without posts.
+	LastActivity time.Time
+}
+
+// TopicChanges are the fields of a topic to update; nil ones are kept.
+type TopicChanges struct {
+	Name        *string
+	Emoji       *string
+	Description *string
+	Position    *int
+	Archived    *bool
+}
+
+// PresenceRecord is one user_online row.
+type PresenceRecord struct {
+	UserID       string
+	Username     string
+	IsOnline     bool
+	Status       string
+	CustomStatus string
+	IsIdle       bool
+	ShowLastSeen bool
+	LastActivity time.Time
+}
+
+// ChatContact is a user in the chat list of another.
+type ChatContact struct {
+	Presence        PresenceRecord
+	LastMessage     string
+	LastMessageTime time.Time // the contact's creation time without messages
+	UnreadCount     int
+}
+
+// Use makes db the global database and creates the SQL repositories for
+// its dialect. Their queries go to readDB, see OpenReadPool.
+func Use(db, readDB *sql.DB) {
+	DB, ReadDB = db, readDB
+	base := sqlRepository{db: db, read: readDB, dialect: DialectOf(db)}
+	Users = &sqlUsers{base}
+	Sessions = &sqlSessions{base}
+	Posts = &sqlPosts{base}
+	Comments = &sqlComments{base}
+	Topics = &sqlTopics{base}
+	Chat = &sqlChat{base}
+	Presence = &sqlPresence{base}
+	Events = &sqlEvents{base}
+	Follows = &sqlFollows{base}
+	Attachments = &sqlAttachments{base}
+	Drafts = &sqlDrafts{base}
+	Bookmarks = &sqlBookmarks{base}
+}
+
+// Close closes the pools set by Use.
+func Close() error {
+	if ReadDB != nil && ReadDB != DB {
+		if err := ReadDB.Close(); err != nil {
+			DB.Close()
+			return err
+		}
+	}
+	return DB.Close()
+}
@@ -0,0 +1,253 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+type sqlTopics struct{ sqlRepository }
+
+// Limits of the topic fields, in characters.
+const (
+	TopicNameMax        = 50
+	TopicEmojiMax       = 16
+	TopicDescriptionMax = 300
+)
+
+const topicColumns = "t.id, t.name, t.emoji, t.description, t.position, t.archived"
+
+func (r *sqlTopics) List(includeArchived bool) ([]TopicSummary, error) {
+	if includeArchived {
+		return r.summaries("")
+	}
+	return r.summaries("WHERE NOT t.archived")
+}
+
+func (r *sqlTopics) Get(id int) (TopicSummary, error) {
+	topics, err := r.summaries("WHERE t.id = ?", id)
+	if err != nil {
+		return TopicSummary{}, err
+	}
+	if len(topics) == 0 {
+		return TopicSummary{}, ErrTopicNotFound
+	}
+	return topics[0], nil
+}
+
+// summaries returns the topics matching where with their counts of
+// published posts.
+func (r *sqlTopics) summaries(where string, args ...interface{}) ([]TopicSummary, error) {
+	rows, err := r.query(`
+		SELECT `+topicColumns+`, t.last_activity_at,
+		       (SELECT COUNT(*) FROM posts_topics pt JOIN posts p ON p.id = pt.post_id
+		        WHERE pt.topic_id = t.id AND p.status = 'published')
+		FROM topics t
+		`+where+`
+		ORDER BY t.position, t.id`, args...)
+	if err != nil {
+		return nil, dbError(err)
+	}
+	defer rows.Close()
+
+	var topics []TopicSummary
+	for rows.Next() {
+		var t TopicSummary
+		var lastActivity nullTime
+		err := rows.Scan(&t.ID, &t.Name, &t.Emoji, &t.Description, &t.Position, &t.Archived,
+			&lastActivity, &t.PostCount)
+		if err != nil {
+			return nil, dbError(err)
+		}
+		t.LastActivity = lastActivity.Time
+		topics = append(topics, t)
+	}
+	return topics, rows.Err()
+}
+
+// refreshTopicActivity recomputes last_activity_at of every topic, for
+// posts and comments inserted without going through the repositories.
+const refreshTopicActivity = `
+	UPDATE topics
+	SET last_activity_at = (
+		SELECT MAX(activity)
+		FROM (
+			SELECT p.created_at AS activity
+			FROM posts_topics pt
+			JOIN posts p ON p.id = pt.post_id
+			WHERE pt.topic_id = topics.id AND p.status = 'published'
+			UNION ALL
+			SELECT c.created_at
+			FROM posts_topics pt
+			JOIN comments c ON c.post_id = pt.post_id
+			WHERE pt.topic_id = topics.id
+		) activities
+	)`
+
+func (r *sqlTopics) Create(name, emoji, description string) (int, error) {
+	name, emoji, description = strings.TrimSpace(name), strings.TrimSpace(emoji), strings.TrimSpace(description)
+	if err := validateTopic(name, emoji, description); err != nil {
+		return 0, err
+	}
+
+	var id int
+	err := r.inTx(func(tx sqlTx) error {
+		if err := checkDuplicateTopic(tx, 0, name, emoji); err != nil {
+			return err
+		}
+		// New topics go last
+		return tx.queryRow(`
+			INSERT INTO topics (name, emoji, description, position)
+			VALUES (?, ?, ?, (SELECT COALESCE(MAX(position), 0) + 1 FROM topics))
+			RETURNING id`,
+			name, emoji, description).Scan(&id)
+	})
+	if err != nil {
+		if isUniqueViolation(err) {
+			return 0, ErrDuplicateTopic
+		}
+		if errors.Is(err, ErrDuplicateTopic) || errors.Is(err, ErrInvalidTopic) {
+			return 0, err
+		}
+		return 0, dbError(err)
+	}
+	return id, nil
+}
+
+func (r *sqlTopics) Update(id int, changes TopicChanges) error {
+	err := r.inTx(func(tx sqlTx) error {
+		var t TopicSummary
+		err := tx.queryRow("SELECT "+topicColumns+" FROM topics t WHERE t.id = ?", id).Scan(
+			&t.ID, &t.Name, &t.Emoji, &t.Description, &t.Position, &t.Archived)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrTopicNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		if changes.Name != nil {
+			t.Name = strings.TrimSpace(*changes.Name)
+		}
+		if changes.Emoji != nil {
+			t.Emoji = strings.TrimSpace(*changes.Emoji)
+		}
+		if changes.Description != nil {
+			t.Description = strings.TrimSpace(*changes.Description)
+		}
+		if changes.Position != nil {
+			t.Position = *changes.Position
+		}
+		if changes.Archived != nil {
+			t.Archived = *changes.Archived
+		}
+		if err := validateTopic(t.Name, t.Emoji, t.Description); err != nil {
+			return err
+		}
+		if err := checkDuplicateTopic(tx, id, t.Name, t.Emoji); err != nil {
+			return err
+		}
+
+		_, err = tx.exec(`
+			UPDATE topics
+			SET name = ?, emoji = ?, description = ?, position = ?, archived = ?
+			WHERE id = ?`,
+			t.Name, t.Emoji, t.Description, t.Position, t.Archived, id)
+		return err
+	})
+	switch {
+	case err == nil, errors.Is(err, ErrTopicNotFound), errors.Is(err, ErrDuplicateTopic), errors.Is(err, ErrInvalidTopic):
+		return err
+	case isUniqueViolation(err):
+		return ErrDuplicateTopic
+	default:
+		return dbError(err)
+	}
+}
+
+// validateTopic checks the trimmed fields of a topic.
+func validateTopic(name, emoji, description string) error {
+	switch {
+	case utf8.RuneCountInString(name) < 2 || utf8.RuneCountInString(name) > TopicNameMax:
+		return fmt.Errorf("%w: the name must be 2 to %d characters", ErrInvalidTopic, TopicNameMax)
+	case emoji == "" || utf8.RuneCountInString(emoji) > TopicEmojiMax || strings.ContainsAny(emoji, " \t\n"):
+		return fmt.Errorf("%w: the emoji must be 1 to %d characters without spaces", ErrInvalidTopic, TopicEmojiMax)
+	case utf8.RuneCountInString(description) > TopicDescriptionMax:
+		return fmt.Errorf("%w: the description must be at most %d characters", ErrInvalidTopic, TopicDescriptionMax)
+	}
+	return nil
+}
+
+// checkDuplicateTopic rejects names that only differ in case from another
+// topic's, which the UNIQUE constraint lets through, and taken emojis.
+func checkDuplicateTopic(tx sqlTx, id int, name, emoji string) error {
+	var taken bool
+	err := tx.queryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM topics
+			WHERE (LOWER(name) = LOWER(?) OR emoji = ?) AND id <> ?
+		)`, name, emoji, id).Scan(&taken)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return ErrDuplicateTopic
+	}
+	return nil
+}
+
+// Delete removes a topic. Posts only tagged with it keep existing but
+// lose the tag.
+func (r *sqlTopics) Delete(id int) error {
+	return r.inTx(func(tx sqlTx) error {
+		// posts_topics and topic_follows cascade only when foreign keys are enforced
+		if _, err := tx.exec("DELETE FROM posts_topics WHERE topic_id = ?", id); err != nil {
+			return dbError(err)
+		}
+		if _, err := tx.exec("DELETE FROM topic_follows WHERE topic_id = ?", id); err != nil {
+			return dbError(err)
+		}
+		result, err := tx.exec("DELETE FROM topics WHERE id = ?", id)
+		if err != nil {
+			return dbError(err)
+		}
+		return requireOneRow(result, ErrTopicNotFound)
+	})
+}
+
+func (r *sqlTopics) IDByName(name string) (int, error) {
+	var id int
+	err := r.queryRow("SELECT id FROM topics WHERE name = ?", name).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrTopicNotFound
+	}
+	if err != nil {
+		return 0, dbError(err)
+	}
+	return id, nil
+}
+
+func (r *sqlTopics) NamesForPost(postID int) ([]string, error) {
+	rows, err := r.query(`
+		SELECT t.name
+		FROM topics t
+		JOIN posts_topics pt ON t.id = pt.topic_id
+		WHERE pt.post_id = ?
+		ORDER BY t.id`, postID)
+	if err != nil {
+		return nil, dbError(err)
+	}
+	defer rows.Close()
+
+	var topics []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, dbError(err)
+		}
+		topics = append(topics, name)
+	}
+	return topics, rows.Err()
+}
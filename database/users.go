@@ -0,0 +1,248 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"realtimeforum/model"
+	"time"
+)
+
+type sqlUsers struct{ sqlRepository }
+
+const userColumns = `u.id, u.first_name, u.last_name, u.username, u.email, u.password_hash,
+	u.age, u.gender, u.terms_accepted, u.role, u.created_at, u.bio, COALESCE(u.avatar_id, ''),
+	u.show_name, u.show_join_date, u.show_counts, u.show_activity, u.delete_after`
+
+func scanUser(row rowScanner, extra ...interface{}) (*model.User, error) {
+	var user model.User
+	var createdAt, deleteAfter nullTime
+	privacy := &user.Privacy
+	dest := append([]interface{}{&user.ID, &user.FirstName, &user.LastName, &user.Username,
+		&user.Email, &user.PasswordHash, &user.Age, &user.Gender, &user.TermsAccepted,
+		&user.Role, &createdAt, &user.Bio, &user.AvatarID,
+		&privacy.ShowName, &privacy.ShowJoinDate, &privacy.ShowCounts, &privacy.ShowActivity, &deleteAfter}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+	user.CreatedAt = createdAt.Time
+	if deleteAfter.Valid {
+		user.DeleteAfter = &deleteAfter.Time
+	}
+	return &user, nil
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func (r *sqlUsers) get(where string, args ...interface{}) (*model.User, error) {
+	user, err := scanUser(r.queryRow("SELECT "+userColumns+" FROM users u WHERE "+where, args...))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, dbError(err)
+	}
+	return user, nil
+}
+
+func (r *sqlUsers) GetByID(id string) (*model.User, error) {
+	return r.get("u.id = ?", id)
+}
+
+func (r *sqlUsers) GetByIdentity(identity string) (*model.User, error) {
+	return r.get("u.username = ? OR u.email = ?", identity, identity)
+}
+
+func (r *sqlUsers) GetByUsername(username string) (*model.User, error) {
+	return r.get("u.username = ?", username)
+}
+
+func (r *sqlUsers) IDByIdentity(identity string) (string, error) {
+	var id string
+	err := r.queryRow("SELECT id FROM users WHERE username = ? OR email = ?", identity, identity).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return id, err
+}
+
+func (r *sqlUsers) Create(user *model.User) error {
+	if user.Role == "" {
+		user.Role = "user"
+	}
+	_, err := r.exec(`
+		INSERT INTO users (
+			id, username, email, password_hash,
+			first_name, last_name, age, gender, terms_accepted, role
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		user.ID, user.Username, user.Email, user.PasswordHash,
+		user.FirstName, user.LastName, user.Age, user.Gender, user.TermsAccepted, user.Role,
+	)
+	return err
+}
+
+func (r *sqlUsers) Update(id, firstName, lastName, username, bio string) error {
+	result, err := r.exec(`
+		UPDATE users
+		SET first_name = ?, last_name = ?, username = ?, bio = ?
+		WHERE id = ?`,
+		firstName, lastName, username, bio, id)
+	if isUniqueViolation(err) {
+		return ErrUsernameTaken
+	}
+	if err != nil {
+		return dbError(err)
+	}
+	return requireOneRow(result, ErrUserNotFound)
+}
+
+func (r *sqlUsers) SetRole(id, role string) error {
+	result, err := r.exec("UPDATE users SET role = ? WHERE id = ?", role, id)
+	if err != nil {
+		return dbError(err)
+	}
+	return requireOneRow(result, ErrUserNotFound)
+}
+
+func (r *sqlUsers) ResetPassword(id, passwordHash string) error {
+	return r.inTx(func(tx sqlTx) error {
+		result, err := tx.exec("UPDATE users SET password_hash = ? WHERE id = ?", passwordHash, id)
+		if err != nil {
+			return err
+		}
+		if err := requireOneRow(result, ErrUserNotFound); err != nil {
+			return err
+		}
+		_, err = tx.exec("DELETE FROM sessions WHERE user_id = ?", id)
+		return err
+	})
+}
+
+func (r *sqlUsers) List(adminsOnly bool) ([]UserSummary, error) {
+	query := `
+		SELECT u.username, u.email, u.role, u.created_at,
+		       (SELECT COUNT(*) FROM posts p WHERE p.user_id = u.id),
+		       (SELECT COUNT(*) FROM sessions s WHERE s.user_id = u.id)
+		FROM users u
+		WHERE u.id <> '` + DeletedUserID + `'`
+	if adminsOnly {
+		query += " AND u.role = 'admin'"
+	}
+	query += " ORDER BY u.username"
+
+	rows, err := r.query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []UserSummary
+	for rows.Next() {
+		var u UserSummary
+		var createdAt nullTime
+		if err := rows.Scan(&u.Username, &u.Email, &u.Role, &createdAt, &u.Posts, &u.Sessions); err != nil {
+			return nil, err
+		}
+		u.CreatedAt = createdAt.Time
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+type sqlSessions struct{ sqlRepository }
+
+func (r *sqlSessions) Create(userID, token string, expiry time.Time) error {
+	_, err := r.exec(`
+		INSERT INTO sessions (user_id, session_token, session_expiry)
+		VALUES (?, ?, ?)`,
+		userID, token, expiry)
+	return err
+}
+
+func (r *sqlSessions) User(token string) (*model.User, error) {
+	var expiry time.Time
+	user, err := scanUser(r.queryRow(`
+		SELECT `+userColumns+`, s.session_expiry
+		FROM users u
+		JOIN sessions s ON u.id = s.user_id
+		WHERE s.session_token = ? AND s.session_expiry > ?`,
+		token, time.Now()), &expiry)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, dbError(err)
+	}
+	user.SessionExpiry = &expiry
+	return user, nil
+}
+
+func (r *sqlSessions) Lookup(token string) (string, time.Time, error) {
+	var userID string
+	var expiry time.Time
+	err := r.queryRow("SELECT user_id, session_expiry FROM sessions WHERE session_token = ?", token).Scan(&userID, &expiry)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", time.Time{}, ErrSessionNotFound
+	}
+	if err != nil {
+		return "", time.Time{}, dbError(err)
+	}
+	return userID, expiry, nil
+}
+
+func (r *sqlSessions) List(userID string) ([]Session, error) {
+	query := `
+		SELECT s.session_token, s.user_id, u.username, s.session_expiry, s.created_at
+		FROM sessions s
+		JOIN users u ON u.id = s.user_id`
+	var args []interface{}
+	if userID != "" {
+		query += " WHERE s.user_id = ?"
+		args = append(args, userID)
+	}
+	query += " ORDER BY s.created_at DESC, s.id DESC"
+
+	rows, err := r.query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []Session
+	for rows.Next() {
+		var s Session
+		var createdAt nullTime
+		if err := rows.Scan(&s.Token, &s.UserID, &s.Username, &s.Expiry, &createdAt); err != nil {
+			return nil, err
+		}
+		s.CreatedAt = createdAt.Time
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+func (r *sqlSessions) Delete(token string) (bool, error) {
+	result, err := r.exec("DELETE FROM sessions WHERE session_token = ?", token)
+	if err != nil {
+		return false, err
+	}
+	count, err := result.RowsAffected()
+	return count > 0, err
+}
+
+func (r *sqlSessions) DeleteForUser(userID string) (int64, error) {
+	result, err := r.exec("DELETE FROM sessions WHERE user_id = ?", userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (r *sqlSessions) DeleteExpired() (int64, error) {
+	result, err := r.exec("DELETE FROM sessions WHERE session_expiry < ?", time.Now())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -7,6 +7,15 @@ toolchain go1.23.3
 require (
 	github.com/google/uuid v1.6.0
 	github.com/gorilla/websocket v1.5.3
+	github.com/lib/pq v1.12.3
 	github.com/mattn/go-sqlite3 v1.14.27
+	github.com/redis/go-redis/v9 v9.7.3
+	github.com/yuin/goldmark v1.8.6
 	golang.org/x/crypto v0.37.0
+	golang.org/x/image v0.25.0
+)
+
+require (
+	github.com/cespare/xxhash/v2 v2.2.0 // indirect
+	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
 )
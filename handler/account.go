@@ -7,7 +7,9 @@ import (
 	"realtimeforum/database"
 )
 
-// GetUserPostsHandler handles GET /api/user/posts
+// GetUserPostsHandler handles GET /api/user/posts, every post of the
+// logged in user including scheduled ones. Others see the published posts
+// of a user on /api/users/{username}/posts.
 func GetUserPostsHandler(w http.ResponseWriter, r *http.Request) {
 	// 400: Method validation
 	if r.Method != http.MethodGet {
@@ -29,24 +31,19 @@ func GetUserPostsHandler(w http.ResponseWriter, r *http.Request) {
 		userID = requestingUserID
 	}
 
-	// Get posts with authorization check
-	posts, err := database.GetUserPosts(userID, requestingUserID)
+	// Only the user's own posts for now (an admin check could go here)
+	if userID != requestingUserID {
+		HandleError(w, database.ErrForbidden)
+		return
+	}
+
+	posts, err := database.Posts.ByUser(userID, 10)
 	if err != nil {
 		// This will automatically map to 403, 404, or 500 based on error type
 		HandleError(w, err)
 		return
 	}
 
-	// For each post, get its topics
-	for i := range posts {
-		topics, err := getTopicsForPost(posts[i].ID)
-		if err != nil {
-			posts[i].Topics = []string{} // Empty topics if error
-		} else {
-			posts[i].Topics = topics
-		}
-	}
-
 	// Success response
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(posts)
@@ -68,7 +65,7 @@ func GetUserCommentsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get user comments
-	comments, err := database.GetUserComments(userID)
+	comments, err := database.Comments.ByUser(userID)
 	if err != nil {
 		// This will automatically map to 403, 404, or 500 based on error type
 		HandleError(w, err)
@@ -0,0 +1,193 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"realtimeforum/auth"
+	"realtimeforum/database"
+	"realtimeforum/service"
+	"strconv"
+	"strings"
+)
+
+// AttachmentsHandler serves /api/attachments:
+//
+//	POST   /api/attachments                upload the "file" field of a multipart form
+//	GET    /api/attachments/{id}           download, for whoever may see it
+//	GET    /api/attachments/{id}/thumbnail the thumbnail of an image
+//	DELETE /api/attachments/{id}           remove an upload that is on nothing yet
+//
+// Uploads are then attached by ID to a post or a chat message. Others than
+// the uploader see them once on a post, or on a chat message they sent or
+// received; anything else is not found.
+func AttachmentsHandler(uploads *service.Uploads) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		isLoggedIn, userID := auth.CheckUserLoggedIn(r)
+		if !isLoggedIn {
+			WriteAPIError(w, http.StatusUnauthorized, "You must be logged in to use attachments")
+			return
+		}
+
+		path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/attachments"), "/")
+		if path == "" {
+			if r.Method != http.MethodPost {
+				WriteAPIError(w, http.StatusMethodNotAllowed, "Only POST method is allowed")
+				return
+			}
+			uploadAttachment(w, r, uploads, userID)
+			return
+		}
+
+		parts := strings.Split(path, "/")
+		thumbnail := len(parts) == 2 && parts[1] == "thumbnail"
+		if len(parts) > 2 || (len(parts) == 2 && !thumbnail) {
+			WriteAPIError(w, http.StatusNotFound)
+			return
+		}
+
+		switch {
+		case r.Method == http.MethodGet:
+			downloadAttachment(w, r, uploads, parts[0], userID, thumbnail)
+		case r.Method == http.MethodDelete && !thumbnail:
+			if err := uploads.Delete(parts[0], userID); err != nil {
+				writeAttachmentError(w, err)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
+		default:
+			WriteAPIError(w, http.StatusMethodNotAllowed, "Only GET and DELETE methods are allowed")
+		}
+	}
+}
+
+func uploadAttachment(w http.ResponseWriter, r *http.Request, uploads *service.Uploads, userID string) {
+	filename, data, ok := readUpload(w, r, uploads.MaxSize())
+	if !ok {
+		return
+	}
+
+	attachment, err := uploads.Upload(r.Context(), userID, filename, data)
+	if writeUploadError(w, err) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":    true,
+		"attachment": attachment,
+	})
+}
+
+// readUpload reads the "file" field of a multipart form, up to the
+// maxSize bytes. Anything wrong is answered and ok is false.
+func readUpload(w http.ResponseWriter, r *http.Request, maxSize int64) (filename string, data []byte, ok bool) {
+	tooLarge := fmt.Sprintf("Files must be at most %d MB", maxSize>>20)
+	// Room for the multipart headers around the file
+	r.Body = http.MaxBytesReader(w, r.Body, maxSize+64<<10)
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		WriteAPIError(w, http.StatusBadRequest, "Send the file as multipart/form-data in a field named file")
+		return "", nil, false
+	}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			WriteAPIError(w, http.StatusBadRequest, "Send the file as multipart/form-data in a field named file")
+			return "", nil, false
+		}
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			WriteAPIError(w, http.StatusRequestEntityTooLarge, tooLarge)
+			return "", nil, false
+		}
+		if err != nil {
+			WriteAPIError(w, http.StatusBadRequest, "Invalid multipart form")
+			return "", nil, false
+		}
+		if part.FormName() != "file" {
+			part.Close()
+			continue
+		}
+
+		data, err := io.ReadAll(io.LimitReader(part, maxSize+1))
+		if errors.As(err, &maxBytesErr) || int64(len(data)) > maxSize {
+			WriteAPIError(w, http.StatusRequestEntityTooLarge, tooLarge)
+			return "", nil, false
+		}
+		if err != nil {
+			WriteAPIError(w, http.StatusBadRequest, "Invalid multipart form")
+			return "", nil, false
+		}
+		return part.FileName(), data, true
+	}
+}
+
+// writeUploadError answers a failed upload and returns true, or
+// returns false if err is nil: 413 for a file or image too large, 415
+// for a type that is not allowed and 400 for anything else wrong with it.
+func writeUploadError(w http.ResponseWriter, err error) bool {
+	if err == nil {
+		return false
+	}
+	var problems service.ValidationErrors
+	if errors.As(err, &problems) {
+		status := http.StatusBadRequest
+		switch {
+		case errors.Is(err, service.ErrFileTooLarge):
+			status = http.StatusRequestEntityTooLarge
+		case errors.Is(err, service.ErrFileNotAllowed):
+			status = http.StatusUnsupportedMediaType
+		}
+		WriteAPIError(w, status, problems.Error())
+		return true
+	}
+	log.Printf("❌ Upload failed: %v", err)
+	WriteAPIError(w, http.StatusInternalServerError, "Failed to store the file")
+	return true
+}
+
+func downloadAttachment(w http.ResponseWriter, r *http.Request, uploads *service.Uploads, id, userID string, thumbnail bool) {
+	attachment, content, err := uploads.Open(r.Context(), id, userID, thumbnail)
+	if err != nil {
+		writeAttachmentError(w, err)
+		return
+	}
+	defer content.Close()
+
+	contentType := attachment.ContentType
+	if thumbnail {
+		contentType = service.ThumbnailType(attachment.ContentType)
+	} else {
+		w.Header().Set("Content-Length", strconv.FormatInt(attachment.Size, 10))
+	}
+	// Images show in the page, anything else is saved; neither may run
+	disposition := "attachment"
+	if strings.HasPrefix(contentType, "image/") {
+		disposition = "inline"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": attachment.Filename}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; sandbox")
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	if _, err := io.Copy(w, content); err != nil {
+		log.Printf("⚠️ Download of attachment %s interrupted: %v", id, err)
+	}
+}
+
+func writeAttachmentError(w http.ResponseWriter, err error) {
+	if errors.Is(err, database.ErrAttachmentNotFound) {
+		WriteAPIError(w, http.StatusNotFound, "Attachment not found")
+		return
+	}
+	log.Printf("❌ Attachment error: %v", err)
+	HandleError(w, err)
+}
@@ -0,0 +1,83 @@
+package handler_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"realtimeforum/auth"
+	"realtimeforum/blob"
+	"realtimeforum/database"
+	"realtimeforum/database/dbtest"
+	"realtimeforum/handler"
+	"realtimeforum/service"
+)
+
+func TestUploadStatuses(t *testing.T) {
+	dbtest.Open(t, database.SQLite)
+	_, cookie := login(t, "uploader", auth.RoleUser)
+	store, err := blob.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	upload := handler.AttachmentsHandler(service.NewUploads(store, 1<<20))
+
+	var picture bytes.Buffer
+	if err := png.Encode(&picture, image.NewGray(image.Rect(0, 0, 64, 32))); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name string
+		data []byte
+		want int
+	}{
+		{"image", picture.Bytes(), http.StatusCreated},
+		{"text", []byte("Some notes"), http.StatusCreated},
+		{"empty", nil, http.StatusBadRequest},
+		{"broken image", append(pngHeader(64, 32)[:16], "not an image"...), http.StatusBadRequest},
+		{"too many pixels", pngHeader(10000, 5000), http.StatusRequestEntityTooLarge},
+		{"too large", bytes.Repeat([]byte("x"), 2<<20), http.StatusRequestEntityTooLarge},
+		{"executable", []byte("MZ\x90\x00\x03\x00\x00\x00\x04\x00"), http.StatusUnsupportedMediaType},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var body bytes.Buffer
+			form := multipart.NewWriter(&body)
+			part, err := form.CreateFormFile("file", tc.name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			part.Write(tc.data)
+			form.Close()
+
+			r := httptest.NewRequest(http.MethodPost, "/api/attachments", &body)
+			r.Header.Set("Content-Type", form.FormDataContentType())
+			r.AddCookie(cookie)
+			w := httptest.NewRecorder()
+			upload(w, r)
+			if w.Code != tc.want {
+				t.Errorf("got status %d, want %d: %s", w.Code, tc.want, strings.TrimSpace(w.Body.String()))
+			}
+		})
+	}
+}
+
+// pngHeader is the start of a PNG of the given size, enough to read its
+// dimensions but not its pixels.
+func pngHeader(width, height uint32) []byte {
+	ihdr := make([]byte, 17)
+	copy(ihdr, "IHDR")
+	binary.BigEndian.PutUint32(ihdr[4:], width)
+	binary.BigEndian.PutUint32(ihdr[8:], height)
+	ihdr[12], ihdr[13] = 8, 0 // 8 bit grayscale
+
+	header := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0d")
+	header = append(header, ihdr...)
+	return binary.BigEndian.AppendUint32(header, crc32.ChecksumIEEE(ihdr))
+}
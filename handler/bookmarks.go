@@ -0,0 +1,213 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"realtimeforum/auth"
+	"realtimeforum/database"
+	"realtimeforum/model"
+	"strconv"
+	"strings"
+)
+
+// BookmarkListResponse is a page of the bookmarks of the logged in user.
+type BookmarkListResponse struct {
+	Success   bool             `json:"success"`
+	Bookmarks []model.Bookmark `json:"bookmarks"`
+	Total     int              `json:"total"`
+	Limit     int              `json:"limit"`
+	Offset    int              `json:"offset"`
+}
+
+// BookmarksHandler serves /api/bookmarks, the posts the logged in user
+// saved to read later:
+//
+//	GET    /api/bookmarks                    the latest saved first, ?collection={id} for one collection
+//	PUT    /api/bookmarks/{post id}          save, or move with {"collection_id": n}, 0 for none
+//	DELETE /api/bookmarks/{post id}          unsave
+//	GET    /api/bookmarks/collections        the user's collections with their counts
+//	POST   /api/bookmarks/collections        create one from {"name": "..."}
+//	PUT    /api/bookmarks/collections/{id}   rename it
+//	DELETE /api/bookmarks/collections/{id}   delete it, keeping its bookmarks
+//
+// The list takes ?limit (up to 50, default 20) and ?offset.
+func BookmarksHandler(w http.ResponseWriter, r *http.Request) {
+	isLoggedIn, userID := auth.CheckUserLoggedIn(r)
+	if !isLoggedIn {
+		WriteAPIError(w, http.StatusUnauthorized, "You must be logged in to use bookmarks")
+		return
+	}
+
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/bookmarks"), "/")
+	parts := strings.Split(path, "/")
+	switch {
+	case path == "":
+		if r.Method != http.MethodGet {
+			WriteAPIError(w, http.StatusMethodNotAllowed, "Only GET method is allowed")
+			return
+		}
+		listBookmarks(w, r, userID)
+	case parts[0] == "collections" && len(parts) == 1:
+		collections(w, r, userID)
+	case parts[0] == "collections" && len(parts) == 2:
+		id, err := strconv.Atoi(parts[1])
+		if err != nil {
+			WriteAPIError(w, http.StatusNotFound)
+			return
+		}
+		collection(w, r, userID, id)
+	case len(parts) == 1:
+		postID, err := strconv.Atoi(parts[0])
+		if err != nil {
+			WriteAPIError(w, http.StatusNotFound)
+			return
+		}
+		setBookmark(w, r, userID, postID)
+	default:
+		WriteAPIError(w, http.StatusNotFound)
+	}
+}
+
+func listBookmarks(w http.ResponseWriter, r *http.Request, userID string) {
+	limit, offset, ok := parsePage(w, r)
+	if !ok {
+		return
+	}
+	var collectionID int
+	if value := r.URL.Query().Get("collection"); value != "" {
+		id, err := strconv.Atoi(value)
+		if err != nil || id < 1 {
+			WriteAPIError(w, http.StatusBadRequest, "Invalid collection ID")
+			return
+		}
+		collectionID = id
+	}
+
+	bookmarks, total, err := database.Bookmarks.List(userID, collectionID, limit, offset)
+	if err != nil {
+		writeBookmarkError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(BookmarkListResponse{
+		Success:   true,
+		Bookmarks: bookmarks,
+		Total:     total,
+		Limit:     limit,
+		Offset:    offset,
+	})
+}
+
+func setBookmark(w http.ResponseWriter, r *http.Request, userID string, postID int) {
+	if r.Method != http.MethodPut && r.Method != http.MethodDelete {
+		WriteAPIError(w, http.StatusMethodNotAllowed, "Only PUT and DELETE methods are allowed")
+		return
+	}
+
+	// The body is optional: without one a post is saved in no collection
+	var body struct {
+		CollectionID int `json:"collection_id"`
+	}
+	if r.Method == http.MethodPut && r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			WriteAPIError(w, http.StatusBadRequest, "Invalid JSON payload")
+			return
+		}
+	}
+
+	saved := r.Method == http.MethodPut
+	if err := database.Bookmarks.Set(userID, postID, body.CollectionID, saved); err != nil {
+		writeBookmarkError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":    true,
+		"post_id":    postID,
+		"bookmarked": saved,
+	})
+}
+
+func collections(w http.ResponseWriter, r *http.Request, userID string) {
+	switch r.Method {
+	case http.MethodGet:
+		list, err := database.Bookmarks.Collections(userID)
+		if err != nil {
+			writeBookmarkError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success":     true,
+			"collections": list,
+		})
+	case http.MethodPost:
+		name, ok := decodeCollectionName(w, r)
+		if !ok {
+			return
+		}
+		created, err := database.Bookmarks.CreateCollection(userID, name)
+		if err != nil {
+			writeBookmarkError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success":    true,
+			"collection": created,
+		})
+	default:
+		WriteAPIError(w, http.StatusMethodNotAllowed, "Only GET and POST methods are allowed")
+	}
+}
+
+func collection(w http.ResponseWriter, r *http.Request, userID string, id int) {
+	var err error
+	switch r.Method {
+	case http.MethodPut:
+		name, ok := decodeCollectionName(w, r)
+		if !ok {
+			return
+		}
+		err = database.Bookmarks.RenameCollection(id, userID, name)
+	case http.MethodDelete:
+		err = database.Bookmarks.DeleteCollection(id, userID)
+	default:
+		WriteAPIError(w, http.StatusMethodNotAllowed, "Only PUT and DELETE methods are allowed")
+		return
+	}
+	if err != nil {
+		writeBookmarkError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
+}
+
+func decodeCollectionName(w http.ResponseWriter, r *http.Request) (string, bool) {
+	var body struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		WriteAPIError(w, http.StatusBadRequest, "Invalid JSON payload")
+		return "", false
+	}
+	return body.Name, true
+}
+
+func writeBookmarkError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, database.ErrPostNotFound):
+		WriteAPIError(w, http.StatusNotFound, "Post not found")
+	case errors.Is(err, database.ErrCollectionNotFound):
+		WriteAPIError(w, http.StatusNotFound, "Collection not found")
+	case errors.Is(err, database.ErrInvalidCollection), errors.Is(err, database.ErrDuplicateCollection):
+		WriteAPIError(w, MapErrorToHTTPStatus(err), err.Error())
+	default:
+		log.Printf("❌ Bookmark error: %v", err)
+		HandleError(w, err)
+	}
+}
@@ -26,17 +26,38 @@ type RequestThrottler struct {
     limit    time.Duration
 }
 
-var (
-    // ✅ Global throttler instances
-    messageThrottler = &RequestThrottler{
-        requests: make(map[string]time.Time),
-        limit:    500 * time.Millisecond, // 500ms between message requests
+// ChatThrottle is the minimum time between two chat history requests and
+// between two user list requests of the same user.
+type ChatThrottle struct {
+    Messages time.Duration
+    UserList time.Duration
+}
+
+// Chat serves the chat API and the WebSocket endpoint of a hub.
+type Chat struct {
+    hub               *websocket.Hub
+    messageThrottler  *RequestThrottler
+    userListThrottler *RequestThrottler
+}
+
+// NewChat creates the chat handlers for hub, throttling each user's
+// requests as configured.
+func NewChat(hub *websocket.Hub, throttle ChatThrottle) *Chat {
+    c := &Chat{
+        hub:               hub,
+        messageThrottler:  newRequestThrottler(throttle.Messages),
+        userListThrottler: newRequestThrottler(throttle.UserList),
     }
-    userListThrottler = &RequestThrottler{
+    go c.cleanupThrottlers()
+    return c
+}
+
+func newRequestThrottler(limit time.Duration) *RequestThrottler {
+    return &RequestThrottler{
         requests: make(map[string]time.Time),
-        limit:    200 * time.Millisecond, // 200ms between user list requests
+        limit:    limit,
     }
-)
+}
 
 // ✅ Throttle check method
 func (rt *RequestThrottler) isAllowed(userID string) bool {
@@ -68,23 +89,21 @@ func (rt *RequestThrottler) cleanup() {
     }
 }
 
-// ✅ Start cleanup goroutine
-func init() {
-    go func() {
-        ticker := time.NewTicker(30 * time.Second)
-        defer ticker.Stop()
-        
-        for range ticker.C {
-            messageThrottler.cleanup()
-            userListThrottler.cleanup()
-        }
-    }()
+// ✅ Cleanup goroutine
+func (c *Chat) cleanupThrottlers() {
+    ticker := time.NewTicker(30 * time.Second)
+    defer ticker.Stop()
+
+    for range ticker.C {
+        c.messageThrottler.cleanup()
+        c.userListThrottler.cleanup()
+    }
 }
 
 
 
 
-func WebSocketHandler(w http.ResponseWriter, r *http.Request) {
+func (c *Chat) WebSocketHandler(w http.ResponseWriter, r *http.Request) {
     log.Printf("🔵 WebSocket connection attempt")
     
     isLoggedIn, userID := auth.CheckUserLoggedIn(r)
@@ -96,17 +115,17 @@ func WebSocketHandler(w http.ResponseWriter, r *http.Request) {
     
     log.Printf("✅ WebSocket: User authenticated - ID: %s", userID)
 
-    var username string
-    err := database.DB.QueryRow("SELECT username FROM users WHERE id = ?", userID).Scan(&username)
+    user, err := database.Users.GetByID(userID)
     if err != nil {
         log.Printf("❌ WebSocket: Error getting username: %v", err)
         http.Error(w, "User not found", http.StatusInternalServerError)
         return
     }
+    username := user.Username
     
     log.Printf("✅ WebSocket: Username found: %s", username)
 
-    conn, err := websocket.UpgradeConnection(w, r)
+    conn, err := c.hub.Upgrade(w, r)
     if err != nil {
         log.Printf("❌ WebSocket upgrade error: %v", err)
         return
@@ -114,19 +133,11 @@ func WebSocketHandler(w http.ResponseWriter, r *http.Request) {
     
     log.Printf("✅ WebSocket: Connection upgraded successfully")
 
-    client := &websocket.Client{
-        ID:       userID,
-        Username: username,
-        Conn:     conn,
-        Hub:      websocket.ChatHub,
-        Send:     make(chan []byte, 256),
-    }
+    client := websocket.NewClient(c.hub, userID, username, conn)
 
     log.Printf("✅ WebSocket: Client created - ID: %s, Username: %s", client.ID, client.Username)
     
-    // ✅ FIXED: Update status immediately before registering
-    websocket.UpdateUserOnlineStatus(userID, true)
-    
+    // The hub persists the online status and notifies other users
     client.Hub.Register <- client
     log.Printf("✅ WebSocket: Client registration sent to hub")
 
@@ -152,7 +163,7 @@ func GetPublicUsersHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // ✅ ENHANCED: GetChatUsersHandler with throttling
-func GetChatUsersHandler(w http.ResponseWriter, r *http.Request) {
+func (c *Chat) GetChatUsersHandler(w http.ResponseWriter, r *http.Request) {
     isLoggedIn, currentUserID := auth.CheckUserLoggedIn(r)
     if !isLoggedIn {
         w.Header().Set("Content-Type", "application/json")
@@ -161,7 +172,7 @@ func GetChatUsersHandler(w http.ResponseWriter, r *http.Request) {
     }
 
     // ✅ Apply throttling
-    if !userListThrottler.isAllowed(currentUserID) {
+    if !c.userListThrottler.isAllowed(currentUserID) {
         w.Header().Set("Content-Type", "application/json")
         json.NewEncoder(w).Encode([]model.ChatUser{})
         return
@@ -169,101 +180,32 @@ func GetChatUsersHandler(w http.ResponseWriter, r *http.Request) {
 
     log.Printf("📊 Loading chat users for user: %s", currentUserID)
 
-    query := `
-        SELECT DISTINCT 
-            u.id, 
-            u.username, 
-            COALESCE(uo.is_online, 0) as is_online,
-            COALESCE(uo.last_activity, u.created_at) as last_activity_str,
-            COALESCE(cm.message, '') as last_message,
-            COALESCE(cm.created_at, u.created_at) as last_message_time_str,
-            COALESCE(unread.count, 0) as unread_count
-        FROM users u
-        LEFT JOIN user_online uo ON u.id = uo.user_id
-        LEFT JOIN (
-            SELECT 
-                CASE 
-                    WHEN sender_id = ? THEN receiver_id
-                    ELSE sender_id
-                END as other_user_id,
-                message,
-                created_at,
-                ROW_NUMBER() OVER (
-                    PARTITION BY CASE 
-                        WHEN sender_id = ? THEN receiver_id
-                        ELSE sender_id
-                    END 
-                    ORDER BY created_at DESC
-                ) as rn
-            FROM chat_messages 
-            WHERE sender_id = ? OR receiver_id = ?
-        ) cm ON u.id = cm.other_user_id AND cm.rn = 1
-        LEFT JOIN (
-            SELECT receiver_id, COUNT(*) as count
-            FROM chat_messages 
-            WHERE sender_id != ? AND receiver_id = ? AND is_read = 0
-            GROUP BY receiver_id
-        ) unread ON u.id = unread.receiver_id
-        WHERE u.id != ?
-        ORDER BY 
-            CASE 
-                WHEN cm.created_at IS NOT NULL THEN cm.created_at 
-                ELSE u.username 
-            END DESC
-    `
-
-    rows, err := database.DB.Query(query, currentUserID, currentUserID, currentUserID, currentUserID, currentUserID, currentUserID, currentUserID)
+    contacts, err := database.Chat.Contacts(currentUserID)
     if err != nil {
         log.Printf("Error getting chat users: %v", err)
         w.Header().Set("Content-Type", "application/json")
         json.NewEncoder(w).Encode([]model.ChatUser{})
         return
     }
-    defer rows.Close()
 
-    users := make([]model.ChatUser, 0)
+    users := make([]model.ChatUser, 0, len(contacts))
     
-    for rows.Next() {
-        var user model.ChatUser
-        var lastActivityStr, lastMessageTimeStr string
-        
-        err := rows.Scan(
-            &user.ID, 
-            &user.Username, 
-            &user.IsOnline, 
-            &lastActivityStr,
-            &user.LastMessage, 
-            &lastMessageTimeStr, 
-            &user.UnreadCount,
-        )
-        if err != nil {
-            log.Printf("Error scanning user row: %v", err)
-            continue
-        }
-
-        if lastActivityStr != "" {
-            if parsedTime, err := time.Parse("2006-01-02 15:04:05", lastActivityStr); err == nil {
-                user.LastActivity = parsedTime
-            } else if parsedTime, err := time.Parse(time.RFC3339, lastActivityStr); err == nil {
-                user.LastActivity = parsedTime
-            } else {
-                user.LastActivity = time.Now()
-            }
-        } else {
-            user.LastActivity = time.Now()
+    for _, contact := range contacts {
+        user := model.ChatUser{
+            ID:              contact.Presence.UserID,
+            Username:        contact.Presence.Username,
+            LastMessage:     contact.LastMessage,
+            LastMessageTime: contact.LastMessageTime,
+            UnreadCount:     contact.UnreadCount,
+            LastActivity:    contact.Presence.LastActivity,
         }
 
-        if lastMessageTimeStr != "" {
-            if parsedTime, err := time.Parse("2006-01-02 15:04:05", lastMessageTimeStr); err == nil {
-                user.LastMessageTime = parsedTime
-            } else if parsedTime, err := time.Parse(time.RFC3339, lastMessageTimeStr); err == nil {
-                user.LastMessageTime = parsedTime
-            } else {
-                user.LastMessageTime = time.Now()
-            }
-        } else {
-            user.LastMessageTime = time.Now()
-        }
+        // Only expose what the user's status and privacy settings allow
+        public := websocket.PresenceState(contact.Presence).Public()
+        user.IsOnline = public.IsOnline
+        user.Status = public.Status
+        user.CustomStatus = public.CustomStatus
+        user.LastSeen = public.LastSeen
 
         users = append(users, user)
     }
@@ -288,7 +230,7 @@ func GetChatUsersHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // ✅ ENHANCED: GetChatMessagesHandler with throttling and pagination fixes
-func GetChatMessagesHandler(w http.ResponseWriter, r *http.Request) {
+func (c *Chat) GetChatMessagesHandler(w http.ResponseWriter, r *http.Request) {
     isLoggedIn, currentUserID := auth.CheckUserLoggedIn(r)
     if !isLoggedIn {
         http.Error(w, "Unauthorized", http.StatusUnauthorized)
@@ -296,7 +238,7 @@ func GetChatMessagesHandler(w http.ResponseWriter, r *http.Request) {
     }
 
     // ✅ Apply throttling
-    if !messageThrottler.isAllowed(currentUserID) {
+    if !c.messageThrottler.isAllowed(currentUserID) {
         log.Printf("🚫 Message request throttled for user %s", currentUserID)
         w.Header().Set("Content-Type", "application/json")
         json.NewEncoder(w).Encode(map[string]interface{}{
@@ -329,17 +271,7 @@ func GetChatMessagesHandler(w http.ResponseWriter, r *http.Request) {
     log.Printf("📥 Loading messages - User: %s, Other: %s, Page: %d, Limit: %d, Offset: %d", 
         currentUserID, otherUserID, page, limit, offset)
 
-    query := `
-        SELECT cm.id, cm.sender_id, cm.receiver_id, cm.message, cm.created_at, cm.is_read, u.username
-        FROM chat_messages cm
-        JOIN users u ON cm.sender_id = u.id
-        WHERE (cm.sender_id = ? AND cm.receiver_id = ?) 
-           OR (cm.sender_id = ? AND cm.receiver_id = ?)
-        ORDER BY cm.created_at DESC
-        LIMIT ? OFFSET ?
-    `
-
-    rows, err := database.DB.Query(query, currentUserID, otherUserID, otherUserID, currentUserID, limit, offset)
+    messages, err := database.Chat.Conversation(currentUserID, otherUserID, limit, offset)
     if err != nil {
         log.Printf("Error getting chat messages: %v", err)
         w.Header().Set("Content-Type", "application/json")
@@ -350,20 +282,6 @@ func GetChatMessagesHandler(w http.ResponseWriter, r *http.Request) {
         })
         return
     }
-    defer rows.Close()
-
-    messages := make([]model.ChatMessage, 0)
-    
-    for rows.Next() {
-        var msg model.ChatMessage
-        err := rows.Scan(&msg.ID, &msg.SenderID, &msg.ReceiverID, &msg.Message, 
-                        &msg.CreatedAt, &msg.IsRead, &msg.SenderName)
-        if err != nil {
-            log.Printf("Error scanning message: %v", err)
-            continue
-        }
-        messages = append(messages, msg)
-    }
 
     // Reverse to show oldest first
     for i := len(messages)/2 - 1; i >= 0; i-- {
@@ -375,7 +293,7 @@ func GetChatMessagesHandler(w http.ResponseWriter, r *http.Request) {
     hasMore := len(messages) == limit
 
     // Mark messages as read
-    markMessagesAsRead(currentUserID, otherUserID)
+    c.markMessagesAsRead(currentUserID, otherUserID)
 
     w.Header().Set("Content-Type", "application/json")
     json.NewEncoder(w).Encode(map[string]interface{}{
@@ -388,53 +306,49 @@ func GetChatMessagesHandler(w http.ResponseWriter, r *http.Request) {
         len(messages), currentUserID, otherUserID, page, hasMore)
 }
 
-func markMessagesAsRead(receiverID, senderID string) {
-    query := `UPDATE chat_messages SET is_read = 1 WHERE receiver_id = ? AND sender_id = ? AND is_read = 0`
-    result, err := database.DB.Exec(query, receiverID, senderID)
+func (c *Chat) markMessagesAsRead(receiverID, senderID string) {
+    rowsAffected, err := database.Chat.MarkRead(receiverID, senderID)
     if err != nil {
         log.Printf("Error marking messages as read: %v", err)
         return
     }
     
-    if rowsAffected, err := result.RowsAffected(); err == nil {
-        log.Printf("✅ Marked %d messages as read", rowsAffected)
+    log.Printf("✅ Marked %d messages as read", rowsAffected)
+
+    // Read receipt for the sender, replayed if they are offline
+    if rowsAffected > 0 {
+        c.hub.DeliverToUser(senderID, "messages_read", map[string]interface{}{
+            "reader_id": receiverID,
+            "count":     rowsAffected,
+            "read_at":   time.Now(),
+        })
     }
 }
 
+// WebSocketMetricsHandler reports how often slow clients had events
+// dropped or were disconnected. The queues of each user are only for
+// admins to see.
+func (c *Chat) WebSocketMetricsHandler(w http.ResponseWriter, r *http.Request) {
+    if !requireAdmin(w, r) {
+        return
+    }
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(c.hub.Metrics())
+}
+
 func DebugOnlineStatusHandler(w http.ResponseWriter, r *http.Request) {
     w.Header().Set("Content-Type", "application/json")
     
-    query := `
-        SELECT u.id, u.username, COALESCE(uo.is_online, 0) as is_online, 
-               COALESCE(uo.last_activity, '') as last_activity
-        FROM users u 
-        LEFT JOIN user_online uo ON u.id = uo.user_id
-        ORDER BY u.username
-    `
-    
-    rows, err := database.DB.Query(query)
+    states, err := database.Presence.All()
     if err != nil {
         http.Error(w, err.Error(), http.StatusInternalServerError)
         return
     }
-    defer rows.Close()
     
-    var users []map[string]interface{}
-    for rows.Next() {
-        var id, username, lastActivity string
-        var isOnline bool
-        
-        err := rows.Scan(&id, &username, &isOnline, &lastActivity)
-        if err != nil {
-            continue
-        }
-        
-        users = append(users, map[string]interface{}{
-            "id":            id,
-            "username":      username,
-            "is_online":     isOnline,
-            "last_activity": lastActivity,
-        })
+    // Only what every other user may see: invisible users look offline
+    users := make([]model.Presence, 0, len(states))
+    for _, state := range states {
+        users = append(users, websocket.PresenceState(state).Public())
     }
     
     json.NewEncoder(w).Encode(users)
@@ -2,67 +2,82 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+	"realtimeforum/auth"
 	"realtimeforum/database"
 	"realtimeforum/model"
+	"realtimeforum/service"
+	"realtimeforum/websocket"
 	"strconv"
 	"strings"
-	"time"
 )
 
 // CreateCommentHandler handles POST /api/comments/create
-func CreateCommentHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
-		return
-	}
+func CreateCommentHandler(hub *websocket.Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+			return
+		}
 
-	userID, err := getUserIDFromSession(r)
-	if err != nil {
-		http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
-		return
-	}
+		userID, err := getUserIDFromSession(r)
+		if err != nil {
+			http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+			return
+		}
 
-	var body struct {
-		Content string `json:"content"`
-		PostID  int    `json:"post_id"`
-	}
+		var body struct {
+			Content string `json:"content"`
+			Format  string `json:"format"`
+			PostID  int    `json:"post_id"`
+		}
 
-	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		http.Error(w, "Invalid JSON payload: "+err.Error(), http.StatusBadRequest)
-		return
-	}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "Invalid JSON payload: "+err.Error(), http.StatusBadRequest)
+			return
+		}
 
-	if len(strings.TrimSpace(body.Content)) < 1 {
-		http.Error(w, "Comment content cannot be empty", http.StatusBadRequest)
-		return
-	}
+		if len(strings.TrimSpace(body.Content)) < 1 {
+			http.Error(w, "Comment content cannot be empty", http.StatusBadRequest)
+			return
+		}
 
-	now := time.Now()
-	res, err := database.DB.Exec(
-		`INSERT INTO comments (content, user_id, post_id, created_at) VALUES (?, ?, ?, ?)`,
-		body.Content, userID, body.PostID, now,
-	)
-	if err != nil {
-		http.Error(w, "Failed to insert comment: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
+		content, err := service.NewContent(body.Content, body.Format)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 
-	commentID64, err := res.LastInsertId()
-	if err != nil {
-		http.Error(w, "Failed to get comment ID: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
+		commentID, err := database.Comments.Create(content, userID, body.PostID)
+		if errors.Is(err, database.ErrPostNotFound) {
+			http.Error(w, "Post not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to insert comment: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
 
-	commentID := int(commentID64)
+		// Notify the post author, replayed if they are offline
+		if post, err := database.Posts.GetByID(body.PostID); err == nil && post.UserID != userID {
+			hub.DeliverToUser(post.UserID, "notification", map[string]interface{}{
+				"kind":       "comment",
+				"post_id":    post.ID,
+				"post_title": post.Title,
+				"comment_id": commentID,
+				"user_id":    userID,
+			})
+		}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"success":    true,
-		"message":    "Comment created successfully",
-		"comment_id": commentID,
-	})
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success":    true,
+			"message":    "Comment created successfully",
+			"comment_id": commentID,
+		})
+	}
 }
 
 // GetSinglePostHandler handles GET /api/posts/{id}
@@ -87,27 +102,41 @@ func GetSinglePostHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get post from database
-	post, err := database.GetPostByID(postID)
+	// Scheduled and expired posts are only shown to their author
+	_, viewerID := auth.CheckUserLoggedIn(r)
+	post, err := database.Posts.GetVisible(postID, viewerID)
 	if err != nil {
 		http.Error(w, "Post not found", http.StatusNotFound)
 		return
 	}
 
 	// Get comments for this post
-	comments, err := database.GetCommentsByPostID(postID)
+	comments, err := database.Comments.ByPost(postID)
 	if err != nil {
 		comments = []model.Comment{} // Empty array if error
 	}
 
+	bookmarked, err := database.Bookmarks.Saved(viewerID, postID)
+	if err != nil {
+		HandleError(w, err)
+		return
+	}
+
 	response := map[string]interface{}{
 		"success": true,
 		"post": map[string]interface{}{
-			"id":      post.ID,
-			"title":   post.Title,
-			"content": post.Content,
-			"author":  post.Author,
-			"date":    post.CreatedAt,
+			"id":             post.ID,
+			"title":          post.Title,
+			"content":        post.Content,
+			"content_html":   post.ContentHTML,
+			"content_format": post.ContentFormat,
+			"author":         post.Author,
+			"date":           post.CreatedAt,
+			"attachments":    post.Attachments,
+			"status":         post.Status,
+			"publish_at":     post.PublishAt,
+			"expires_at":     post.ExpiresAt,
+			"bookmarked":     bookmarked,
 		},
 		"comments": comments,
 	}
@@ -143,7 +172,7 @@ func GetCommentsByPostHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	comments, err := database.GetCommentsByPostID(postID)
+	comments, err := database.Comments.ByPost(postID)
 	if err != nil {
 		http.Error(w, "Failed to fetch comments: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -0,0 +1,174 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"realtimeforum/auth"
+	"realtimeforum/database"
+	"realtimeforum/model"
+	"realtimeforum/service"
+	"strconv"
+	"strings"
+)
+
+// DraftsHandler serves /api/drafts, the drafts of the logged in user:
+//
+//	GET    /api/drafts              every draft, last saved first
+//	POST   /api/drafts              create from title, content, format and topics
+//	GET    /api/drafts/{id}
+//	PUT    /api/drafts/{id}         save, with the revision the save is based on
+//	DELETE /api/drafts/{id}
+//	POST   /api/drafts/{id}/publish create the post like /api/create-post, then delete the draft
+//
+// A save or publish based on an old revision is a 409 with the current
+// draft, for the client to reload or overwrite it with that revision.
+func DraftsHandler(w http.ResponseWriter, r *http.Request) {
+	isLoggedIn, userID := auth.CheckUserLoggedIn(r)
+	if !isLoggedIn {
+		WriteAPIError(w, http.StatusUnauthorized, "You must be logged in to use drafts")
+		return
+	}
+
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/drafts"), "/")
+	if path == "" {
+		switch r.Method {
+		case http.MethodGet:
+			drafts, err := database.Drafts.List(userID)
+			if err != nil {
+				writeDraftError(w, err)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"success": true,
+				"drafts":  drafts,
+			})
+		case http.MethodPost:
+			var input service.DraftInput
+			if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+				WriteAPIError(w, http.StatusBadRequest, "Invalid JSON payload")
+				return
+			}
+			draft, err := service.CreateDraft(userID, input)
+			writeDraft(w, http.StatusCreated, draft, err)
+		default:
+			WriteAPIError(w, http.StatusMethodNotAllowed, "Only GET and POST methods are allowed")
+		}
+		return
+	}
+
+	parts := strings.Split(path, "/")
+	id, err := strconv.Atoi(parts[0])
+	if err != nil || len(parts) > 2 || (len(parts) == 2 && parts[1] != "publish") {
+		WriteAPIError(w, http.StatusNotFound)
+		return
+	}
+
+	if len(parts) == 2 {
+		if r.Method != http.MethodPost {
+			WriteAPIError(w, http.StatusMethodNotAllowed, "Only POST method is allowed")
+			return
+		}
+		publishDraft(w, r, userID, id)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		draft, err := database.Drafts.Get(id, userID)
+		writeDraft(w, http.StatusOK, draft, err)
+	case http.MethodPut:
+		var input service.DraftInput
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			WriteAPIError(w, http.StatusBadRequest, "Invalid JSON payload")
+			return
+		}
+		draft, err := service.SaveDraft(userID, id, input)
+		if errors.Is(err, database.ErrDraftConflict) {
+			writeDraftConflict(w, id, userID)
+			return
+		}
+		writeDraft(w, http.StatusOK, draft, err)
+	case http.MethodDelete:
+		if err := database.Drafts.Delete(id, userID); err != nil {
+			writeDraftError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
+	default:
+		WriteAPIError(w, http.StatusMethodNotAllowed, "Only GET, PUT and DELETE methods are allowed")
+	}
+}
+
+func publishDraft(w http.ResponseWriter, r *http.Request, userID string, id int) {
+	// The body is optional: {"revision": n} refuses to publish another
+	// one, publish_at and expires_at schedule the post
+	var body struct {
+		Revision int `json:"revision"`
+		service.ScheduleInput
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			WriteAPIError(w, http.StatusBadRequest, "Invalid JSON payload")
+			return
+		}
+	}
+
+	post, err := service.PublishDraft(userID, id, body.Revision, body.ScheduleInput)
+	if errors.Is(err, database.ErrDraftConflict) {
+		writeDraftConflict(w, id, userID)
+		return
+	}
+	if writeValidationErrors(w, err) {
+		return
+	}
+	if err != nil {
+		writeDraftError(w, err)
+		return
+	}
+	writePostCreated(w, post)
+}
+
+func writeDraft(w http.ResponseWriter, status int, draft *model.Draft, err error) {
+	if writeValidationErrors(w, err) {
+		return
+	}
+	if err != nil {
+		writeDraftError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"draft":   draft,
+	})
+}
+
+// writeDraftConflict answers 409 with the draft as it is now saved.
+func writeDraftConflict(w http.ResponseWriter, id int, userID string) {
+	current, err := database.Drafts.Get(id, userID)
+	if err != nil {
+		writeDraftError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusConflict)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": false,
+		"message": "This draft was saved elsewhere in the meantime",
+		"draft":   current,
+	})
+}
+
+func writeDraftError(w http.ResponseWriter, err error) {
+	if errors.Is(err, database.ErrDraftNotFound) {
+		WriteAPIError(w, http.StatusNotFound, "Draft not found")
+		return
+	}
+	log.Printf("❌ Draft error: %v", err)
+	HandleError(w, err)
+}
@@ -24,7 +24,13 @@ var errorData = map[int]struct {
     401: {"Unauthorized", "You need to sign in to access this page."},
     403: {"Forbidden", "You don't have permission to access this page."},
     404: {"Page Not Found", "The page you are looking for does not exist."},
+    405: {"Method Not Allowed", "This method is not supported here."},
+    409: {"Conflict", "This conflicts with existing data."},
+    413: {"Payload Too Large", "The file is too large."},
+    415: {"Unsupported Media Type", "This type of file is not supported."},
     500: {"Server Error", "Something went wrong on our end. Please try again later."},
+    502: {"Bad Gateway", "A service the server relies on failed. Please try again later."},
+    503: {"Service Unavailable", "This is not available on this server."},
 }
 
 // MapErrorToHTTPStatus maps domain errors to HTTP status codes
@@ -34,6 +40,40 @@ func MapErrorToHTTPStatus(err error) int {
         return http.StatusNotFound
     case errors.Is(err, database.ErrPostNotFound):
         return http.StatusNotFound
+    case errors.Is(err, database.ErrTopicNotFound):
+        return http.StatusNotFound
+    case errors.Is(err, database.ErrInvalidCursor):
+        return http.StatusBadRequest
+    case errors.Is(err, database.ErrFollowSelf):
+        return http.StatusBadRequest
+    case errors.Is(err, database.ErrTopicArchived):
+        return http.StatusBadRequest
+    case errors.Is(err, database.ErrInvalidTopic):
+        return http.StatusBadRequest
+    case errors.Is(err, database.ErrDuplicateTopic):
+        return http.StatusConflict
+    case errors.Is(err, database.ErrDuplicateTitle):
+        return http.StatusConflict
+    case errors.Is(err, database.ErrAttachmentNotFound):
+        return http.StatusNotFound
+    case errors.Is(err, database.ErrDraftNotFound):
+        return http.StatusNotFound
+    case errors.Is(err, database.ErrDraftConflict):
+        return http.StatusConflict
+    case errors.Is(err, database.ErrPostPublished):
+        return http.StatusConflict
+    case errors.Is(err, database.ErrCollectionNotFound):
+        return http.StatusNotFound
+    case errors.Is(err, database.ErrDuplicateCollection):
+        return http.StatusConflict
+    case errors.Is(err, database.ErrInvalidCollection):
+        return http.StatusBadRequest
+    case errors.Is(err, database.ErrUsernameTaken):
+        return http.StatusConflict
+    case errors.Is(err, database.ErrEmailTaken):
+        return http.StatusConflict
+    case errors.Is(err, database.ErrInvalidToken):
+        return http.StatusBadRequest
     case errors.Is(err, database.ErrUnauthorized):
         return http.StatusUnauthorized
     case errors.Is(err, database.ErrForbidden):
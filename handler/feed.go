@@ -2,76 +2,164 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
+	"realtimeforum/auth"
 	"realtimeforum/database"
 	"realtimeforum/model"
 )
 
 // FeedResponse represents the feed API response
 type FeedResponse struct {
-	Success   bool              `json:"success"`
-	Posts     []model.FeedPost  `json:"posts"`
-	Page      int               `json:"page"`
-	Limit     int               `json:"limit"`
-	Total     int               `json:"total"`
-	HasMore   bool              `json:"has_more"`
+	Success    bool             `json:"success"`
+	Posts      []model.FeedPost `json:"posts"`
+	Limit      int              `json:"limit"`
+	Feed       string           `json:"feed"`
+	Sort       string           `json:"sort"`
+	HasMore    bool             `json:"has_more"`
+	NextCursor string           `json:"next_cursor,omitempty"`
 }
 
 // GetFeedHandler handles GET /api/feed/posts
+//
+//	?feed=following   only posts by followed users or in followed topics
+//	&topics=1,4       posts in any of these topics
+//	&author=alice     posts by this username
+//	&from=2025-01-01  created on or after (a date or RFC 3339 time)
+//	&to=2025-01-31    created before the end of this day, or before this time
+//	&sort=newest      or most_commented, most_liked, trending
+//	&limit=10         up to 50
+//	&cursor=...       next_cursor of the previous page
 func GetFeedHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Only GET method is allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	// Parse pagination parameters
-	pageStr := r.URL.Query().Get("page")
-	limitStr := r.URL.Query().Get("limit")
-	
-	page := 1
-	limit := 10
-	
-	if pageStr != "" {
-		if p, err := strconv.Atoi(pageStr); err == nil && p > 0 {
-			page = p
+	query, err := parseFeedQuery(r)
+	if err != nil {
+		WriteAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	switch r.URL.Query().Get("feed") {
+	case "", "all":
+	case "following":
+		isLoggedIn, userID := auth.CheckUserLoggedIn(r)
+		if !isLoggedIn {
+			WriteAPIError(w, http.StatusUnauthorized, "You must be logged in to see the posts you follow")
+			return
 		}
+		query.FollowedBy = userID
+	default:
+		WriteAPIError(w, http.StatusBadRequest, "feed must be all or following")
+		return
+	}
+	writeFeedPage(w, r, query)
+}
+
+// parseFeedQuery reads the filters, sort and page of a feed request.
+func parseFeedQuery(r *http.Request) (database.FeedQuery, error) {
+	params := r.URL.Query()
+	query := database.FeedQuery{
+		Author: strings.TrimSpace(params.Get("author")),
+		Limit:  10,
+		Cursor: params.Get("cursor"),
 	}
-	
-	if limitStr != "" {
-		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 && l <= 50 {
-			limit = l
+
+	if limitStr := params.Get("limit"); limitStr != "" {
+		l, err := strconv.Atoi(limitStr)
+		if err != nil || l < 1 || l > 50 {
+			return query, errors.New("limit must be between 1 and 50")
+		}
+		query.Limit = l
+	}
+
+	if topics := params.Get("topics"); topics != "" {
+		for _, part := range strings.Split(topics, ",") {
+			id, err := strconv.Atoi(strings.TrimSpace(part))
+			if err != nil || id < 1 {
+				return query, fmt.Errorf("invalid topic ID %q", part)
+			}
+			query.TopicIDs = append(query.TopicIDs, id)
 		}
 	}
 
-	// Calculate offset
-	offset := (page - 1) * limit
+	var err error
+	if query.From, err = parseFeedTime(params.Get("from"), false); err != nil {
+		return query, err
+	}
+	if query.To, err = parseFeedTime(params.Get("to"), true); err != nil {
+		return query, err
+	}
+	if !query.From.IsZero() && !query.To.IsZero() && !query.From.Before(query.To) {
+		return query, errors.New("from must be before to")
+	}
+
+	if query.Sort, err = database.ParseFeedSort(params.Get("sort")); err != nil {
+		return query, err
+	}
+	return query, nil
+}
 
-	// Get total count of posts
-	totalPosts, err := database.GetTotalPostsCount()
+// parseFeedTime accepts a date or an RFC 3339 time. A date as the end of
+// a range includes the whole day.
+func parseFeedTime(value string, end bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	day, err := time.ParseInLocation("2006-01-02", value, time.Local)
 	if err != nil {
-		http.Error(w, "Failed to get total posts count: "+err.Error(), http.StatusInternalServerError)
-		return
+		return time.Time{}, fmt.Errorf("invalid date %q, expected YYYY-MM-DD or an RFC 3339 time", value)
 	}
+	if end {
+		day = day.AddDate(0, 0, 1)
+	}
+	return day, nil
+}
 
-	// Get feed posts with pagination
-	posts, err := database.GetFeedPosts(limit, offset)
+// writeFeedPage loads a page of the feed for the logged in user, if any,
+// and writes it.
+func writeFeedPage(w http.ResponseWriter, r *http.Request, query database.FeedQuery) {
+	if isLoggedIn, userID := auth.CheckUserLoggedIn(r); isLoggedIn {
+		query.ViewerID = userID
+	}
+
+	page, err := database.Posts.Feed(query)
+	if errors.Is(err, database.ErrInvalidCursor) {
+		WriteAPIError(w, http.StatusBadRequest, "Invalid cursor, start again from the first page")
+		return
+	}
 	if err != nil {
 		http.Error(w, "Failed to fetch feed posts: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	// Determine if there are more posts
-	hasMore := (offset + len(posts)) < totalPosts
+	posts := page.Posts
+	if posts == nil {
+		posts = []model.FeedPost{}
+	}
+
+	feed := "all"
+	if query.FollowedBy != "" {
+		feed = "following"
+	}
 
-	// Create response
 	response := FeedResponse{
-		Success: true,
-		Posts:   posts,
-		Page:    page,
-		Limit:   limit,
-		Total:   totalPosts,
-		HasMore: hasMore,
+		Success:    true,
+		Posts:      posts,
+		Limit:      query.Limit,
+		Feed:       feed,
+		Sort:       string(query.Sort),
+		HasMore:    page.NextCursor != "",
+		NextCursor: page.NextCursor,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
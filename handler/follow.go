@@ -0,0 +1,236 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"realtimeforum/auth"
+	"realtimeforum/database"
+	"realtimeforum/model"
+	"strconv"
+	"strings"
+)
+
+// FollowListResponse is a page of followers or followed users. Counts
+// are left out for others if the user hides them.
+type FollowListResponse struct {
+	Success  bool                `json:"success"`
+	Username string              `json:"username"`
+	Counts   *model.FollowCounts `json:"counts,omitempty"`
+	Users    []model.FollowUser  `json:"users"`
+	Topics   []model.FollowTopic `json:"topics,omitempty"`
+	Limit    int                 `json:"limit"`
+	Offset   int                 `json:"offset"`
+}
+
+// FollowTopicHandler handles /api/topics/follow/{id}: GET tells whether
+// the user follows the topic, PUT follows it and DELETE unfollows it.
+func FollowTopicHandler(w http.ResponseWriter, r *http.Request) {
+	isLoggedIn, userID := auth.CheckUserLoggedIn(r)
+	if !isLoggedIn {
+		WriteAPIError(w, http.StatusUnauthorized, "You must be logged in to follow topics")
+		return
+	}
+
+	topicID, err := strconv.Atoi(strings.TrimPrefix(strings.Trim(r.URL.Path, "/"), "api/topics/follow/"))
+	if err != nil {
+		WriteAPIError(w, http.StatusBadRequest, "Invalid topic ID")
+		return
+	}
+
+	var following bool
+	switch r.Method {
+	case http.MethodGet:
+		topics, err := database.Follows.Topics(userID)
+		if err != nil {
+			HandleError(w, err)
+			return
+		}
+		for _, topic := range topics {
+			following = following || topic.ID == topicID
+		}
+	case http.MethodPut, http.MethodDelete:
+		following = r.Method == http.MethodPut
+		if err := database.Follows.SetTopic(userID, topicID, following); err != nil {
+			HandleError(w, err)
+			return
+		}
+	default:
+		WriteAPIError(w, http.StatusMethodNotAllowed, "Only GET, PUT and DELETE methods are allowed")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":   true,
+		"topic_id":  topicID,
+		"following": following,
+	})
+}
+
+// UsersHandler serves the pages of a user under /api/users/{username}:
+//
+//	GET /                    the public profile of the user
+//	GET /posts               their published posts, paged like the feed
+//	GET /comments            their comments, unless they hide their activity
+//	GET, PUT /privacy        what the logged in user shows on their profile
+//	PUT, DELETE /follow      follow or unfollow the user
+//	GET /followers           who follows the user
+//	GET /following           users and topics the user follows
+//
+// The other lists take ?limit (up to 50, default 20) and ?offset.
+//
+// Profiles and their lists can be read logged out, as anybody else sees
+// them; privacy and follow need a login.
+func UsersHandler(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(strings.Trim(r.URL.Path, "/"), "api/users/"), "/")
+	if len(parts) > 2 || parts[0] == "" {
+		WriteAPIError(w, http.StatusNotFound)
+		return
+	}
+	isLoggedIn, viewerID := auth.CheckUserLoggedIn(r)
+	if !isLoggedIn && (r.Method != http.MethodGet || (len(parts) == 2 && parts[1] == "privacy")) {
+		WriteAPIError(w, http.StatusUnauthorized, "You must be logged in to do this")
+		return
+	}
+
+	user, err := database.Users.GetByUsername(parts[0])
+	// The content of deleted accounts is kept, not the account itself
+	if err == nil && user.ID == database.DeletedUserID {
+		err = database.ErrUserNotFound
+	}
+	if errors.Is(err, database.ErrUserNotFound) {
+		WriteAPIError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	if err != nil {
+		HandleError(w, err)
+		return
+	}
+
+	if len(parts) == 1 {
+		if r.Method != http.MethodGet {
+			WriteAPIError(w, http.StatusMethodNotAllowed, "Only GET method is allowed")
+			return
+		}
+		writeProfile(w, viewerID, user)
+		return
+	}
+
+	switch parts[1] {
+	case "posts":
+		listProfilePosts(w, r, user)
+	case "comments":
+		listProfileComments(w, r, viewerID, user)
+	case "privacy":
+		profilePrivacy(w, r, viewerID, user)
+	case "follow":
+		followUser(w, r, viewerID, user)
+	case "followers", "following":
+		if r.Method != http.MethodGet {
+			WriteAPIError(w, http.StatusMethodNotAllowed, "Only GET method is allowed")
+			return
+		}
+		listFollows(w, r, viewerID, user, parts[1] == "following")
+	default:
+		WriteAPIError(w, http.StatusNotFound)
+	}
+}
+
+func followUser(w http.ResponseWriter, r *http.Request, viewerID string, user *model.User) {
+	if r.Method != http.MethodPut && r.Method != http.MethodDelete {
+		WriteAPIError(w, http.StatusMethodNotAllowed, "Only PUT and DELETE methods are allowed")
+		return
+	}
+
+	following := r.Method == http.MethodPut
+	err := database.Follows.SetUser(viewerID, user.ID, following)
+	if errors.Is(err, database.ErrFollowSelf) {
+		WriteAPIError(w, http.StatusBadRequest, "You cannot follow yourself")
+		return
+	}
+	if err != nil {
+		HandleError(w, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"success":   true,
+		"username":  user.Username,
+		"following": following,
+	}
+	if user.Privacy.ShowCounts {
+		counts, err := database.Follows.Counts(user.ID)
+		if err != nil {
+			HandleError(w, err)
+			return
+		}
+		response["followers"] = counts.Followers
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func listFollows(w http.ResponseWriter, r *http.Request, viewerID string, user *model.User, following bool) {
+	limit, offset, ok := parsePage(w, r)
+	if !ok {
+		return
+	}
+
+	response := FollowListResponse{
+		Success:  true,
+		Username: user.Username,
+		Limit:    limit,
+		Offset:   offset,
+	}
+	if viewerID == user.ID || user.Privacy.ShowCounts {
+		counts, err := database.Follows.Counts(user.ID)
+		if err != nil {
+			HandleError(w, err)
+			return
+		}
+		response.Counts = &counts
+	}
+	var err error
+	if following {
+		response.Users, err = database.Follows.Following(user.ID, limit, offset)
+		if err == nil {
+			response.Topics, err = database.Follows.Topics(user.ID)
+		}
+	} else {
+		response.Users, err = database.Follows.Followers(user.ID, limit, offset)
+	}
+	if err != nil {
+		HandleError(w, err)
+		return
+	}
+	if response.Users == nil {
+		response.Users = []model.FollowUser{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// parsePage reads ?limit, up to 50 and 20 by default, and ?offset of a
+// list. Invalid values are answered with a 400 and ok is false.
+func parsePage(w http.ResponseWriter, r *http.Request) (limit, offset int, ok bool) {
+	limit = 20
+	if value := r.URL.Query().Get("limit"); value != "" {
+		l, err := strconv.Atoi(value)
+		if err != nil || l < 1 || l > 50 {
+			WriteAPIError(w, http.StatusBadRequest, "limit must be between 1 and 50")
+			return 0, 0, false
+		}
+		limit = l
+	}
+	if value := r.URL.Query().Get("offset"); value != "" {
+		o, err := strconv.Atoi(value)
+		if err != nil || o < 0 {
+			WriteAPIError(w, http.StatusBadRequest, "offset must be a positive number")
+			return 0, 0, false
+		}
+		offset = o
+	}
+	return limit, offset, true
+}
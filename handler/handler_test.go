@@ -0,0 +1,70 @@
+package handler_test
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"realtimeforum/database"
+	"realtimeforum/model"
+
+	"github.com/google/uuid"
+)
+
+func TestMain(m *testing.M) {
+	// Handlers log every failed request
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// login creates a user with the role and a session, and returns the user
+// with the cookie that carries it.
+func login(t *testing.T, username, role string) (*model.User, *http.Cookie) {
+	t.Helper()
+	user := &model.User{
+		ID:            uuid.New().String(),
+		Username:      username,
+		Email:         username + "@example.com",
+		PasswordHash:  "hash",
+		FirstName:     "First",
+		LastName:      "Last",
+		Age:           30,
+		Gender:        "other",
+		TermsAccepted: true,
+		Role:          role,
+	}
+	if err := database.Users.Create(user); err != nil {
+		t.Fatal(err)
+	}
+	token := uuid.New().String()
+	if err := database.Sessions.Create(user.ID, token, time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	return user, &http.Cookie{Name: "session_token", Value: token}
+}
+
+// serve sends a request with an optional JSON body and cookie to h.
+func serve(h http.HandlerFunc, method, target, body string, cookie *http.Cookie) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	if body != "" {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	if cookie != nil {
+		r.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	h(w, r)
+	return w
+}
+
+func expect(t *testing.T, what string, got, want interface{}) {
+	t.Helper()
+	if got != want {
+		t.Errorf("%s = %v, want %v", what, got, want)
+	}
+}
@@ -0,0 +1,45 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"realtimeforum/auth"
+	"realtimeforum/database"
+	"strconv"
+	"strings"
+)
+
+// LikePostHandler handles PUT /api/posts/like/{id} to like a post and
+// DELETE to take the like back. Both can be repeated safely.
+func LikePostHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut && r.Method != http.MethodDelete {
+		WriteAPIError(w, http.StatusMethodNotAllowed, "Only PUT and DELETE methods are allowed")
+		return
+	}
+
+	isLoggedIn, userID := auth.CheckUserLoggedIn(r)
+	if !isLoggedIn {
+		WriteAPIError(w, http.StatusUnauthorized, "You must be logged in to like posts")
+		return
+	}
+
+	postID, err := strconv.Atoi(strings.TrimPrefix(strings.Trim(r.URL.Path, "/"), "api/posts/like/"))
+	if err != nil {
+		WriteAPIError(w, http.StatusBadRequest, "Invalid post ID")
+		return
+	}
+
+	liked := r.Method == http.MethodPut
+	likes, err := database.Posts.SetLike(postID, userID, liked)
+	if err != nil {
+		HandleError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":     true,
+		"liked":       liked,
+		"likes_count": likes,
+	})
+}
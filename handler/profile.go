@@ -0,0 +1,165 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"realtimeforum/database"
+	"realtimeforum/model"
+	"strings"
+)
+
+// ProfileActivityLimit is how many recent posts and comments a profile
+// shows.
+const ProfileActivityLimit = 10
+
+// ProfileCommentsResponse is a page of the comments of a user.
+type ProfileCommentsResponse struct {
+	Success  bool            `json:"success"`
+	Username string          `json:"username"`
+	Comments []model.Comment `json:"comments"`
+	Limit    int             `json:"limit"`
+	Offset   int             `json:"offset"`
+}
+
+// writeProfile writes the profile of user as viewerID, empty when logged
+// out, may see it: users see all of their own, others only what the
+// privacy settings show.
+func writeProfile(w http.ResponseWriter, viewerID string, user *model.User) {
+	self := viewerID == user.ID
+	privacy := user.Privacy
+	if self {
+		privacy = model.ProfilePrivacy{ShowName: true, ShowJoinDate: true, ShowCounts: true, ShowActivity: true}
+	}
+
+	profile := model.ProfileData{
+		Username:    user.Username,
+		DisplayName: user.Username,
+		Bio:         user.Bio,
+		IsSelf:      self,
+	}
+	if privacy.ShowName {
+		if name := strings.TrimSpace(user.FirstName + " " + user.LastName); name != "" {
+			profile.DisplayName = name
+		}
+	}
+	if privacy.ShowJoinDate {
+		joined := user.CreatedAt
+		profile.JoinedAt = &joined
+	}
+	// Attachments are only served to logged in users
+	if user.AvatarID != "" && viewerID != "" {
+		profile.AvatarURL = database.AttachmentPath + user.AvatarID + "/thumbnail"
+	}
+
+	var err error
+	if privacy.ShowCounts {
+		var counts model.ProfileCounts
+		if counts, err = database.Users.ProfileCounts(user.ID); err != nil {
+			HandleError(w, err)
+			return
+		}
+		profile.Counts = &counts
+	}
+	if privacy.ShowActivity {
+		if profile.RecentActivity, err = database.Users.Activity(user.ID, ProfileActivityLimit); err != nil {
+			HandleError(w, err)
+			return
+		}
+	}
+	if self {
+		profile.Privacy = &user.Privacy
+	} else if viewerID == "" {
+		// Nobody to follow them
+	} else if profile.Following, err = database.Follows.IsFollowing(viewerID, user.ID); err != nil {
+		HandleError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"profile": profile,
+	})
+}
+
+// listProfilePosts writes a page of the published posts of user. It takes
+// the same ?sort, ?limit and ?cursor as the feed.
+func listProfilePosts(w http.ResponseWriter, r *http.Request, user *model.User) {
+	if r.Method != http.MethodGet {
+		WriteAPIError(w, http.StatusMethodNotAllowed, "Only GET method is allowed")
+		return
+	}
+	query, err := parseFeedQuery(r)
+	if err != nil {
+		WriteAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	query.Author = user.Username
+	writeFeedPage(w, r, query)
+}
+
+// listProfileComments writes a page of the comments of user, which is
+// forbidden to others if the user hides their activity.
+func listProfileComments(w http.ResponseWriter, r *http.Request, viewerID string, user *model.User) {
+	if r.Method != http.MethodGet {
+		WriteAPIError(w, http.StatusMethodNotAllowed, "Only GET method is allowed")
+		return
+	}
+	if viewerID != user.ID && !user.Privacy.ShowActivity {
+		WriteAPIError(w, http.StatusForbidden, "This user keeps their activity private")
+		return
+	}
+	limit, offset, ok := parsePage(w, r)
+	if !ok {
+		return
+	}
+
+	comments, err := database.Comments.ByUserPage(user.ID, limit, offset)
+	if err != nil {
+		HandleError(w, err)
+		return
+	}
+	if comments == nil {
+		comments = []model.Comment{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ProfileCommentsResponse{
+		Success:  true,
+		Username: user.Username,
+		Comments: comments,
+		Limit:    limit,
+		Offset:   offset,
+	})
+}
+
+// profilePrivacy reads or replaces the privacy settings of the logged in
+// user, who is the only one who may.
+func profilePrivacy(w http.ResponseWriter, r *http.Request, viewerID string, user *model.User) {
+	if viewerID != user.ID {
+		WriteAPIError(w, http.StatusForbidden, "You can only change your own privacy settings")
+		return
+	}
+
+	privacy := user.Privacy
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		if err := json.NewDecoder(r.Body).Decode(&privacy); err != nil {
+			WriteAPIError(w, http.StatusBadRequest, "Invalid JSON payload")
+			return
+		}
+		if err := database.Users.SetPrivacy(user.ID, privacy); err != nil {
+			HandleError(w, err)
+			return
+		}
+	default:
+		WriteAPIError(w, http.StatusMethodNotAllowed, "Only GET and PUT methods are allowed")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"privacy": privacy,
+	})
+}
@@ -0,0 +1,117 @@
+package handler_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image"
+	"image/png"
+	"net/http"
+	"testing"
+
+	"realtimeforum/auth"
+	"realtimeforum/blob"
+	"realtimeforum/database"
+	"realtimeforum/database/dbtest"
+	"realtimeforum/handler"
+	"realtimeforum/model"
+	"realtimeforum/service"
+)
+
+func TestProfilesArePublic(t *testing.T) {
+	dbtest.Open(t, database.SQLite)
+	login(t, "dana", auth.RoleUser)
+	_, fanCookie := login(t, "fan", auth.RoleUser)
+
+	for _, tc := range []struct {
+		name, method, target string
+		cookie               *http.Cookie
+		want                 int
+	}{
+		{"profile", http.MethodGet, "/api/users/dana", nil, http.StatusOK},
+		{"posts", http.MethodGet, "/api/users/dana/posts", nil, http.StatusOK},
+		{"comments", http.MethodGet, "/api/users/dana/comments", nil, http.StatusOK},
+		{"followers", http.MethodGet, "/api/users/dana/followers", nil, http.StatusOK},
+		{"unknown user", http.MethodGet, "/api/users/nobody", nil, http.StatusNotFound},
+		{"privacy", http.MethodGet, "/api/users/dana/privacy", nil, http.StatusUnauthorized},
+		{"follow", http.MethodPut, "/api/users/dana/follow", nil, http.StatusUnauthorized},
+		{"follow logged in", http.MethodPut, "/api/users/dana/follow", fanCookie, http.StatusOK},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			w := serve(handler.UsersHandler, tc.method, tc.target, "", tc.cookie)
+			if w.Code != tc.want {
+				t.Errorf("got status %d, want %d: %s", w.Code, tc.want, w.Body)
+			}
+		})
+	}
+}
+
+func TestProfilePrivacy(t *testing.T) {
+	dbtest.Open(t, database.SQLite)
+	dana, danaCookie := login(t, "dana", auth.RoleUser)
+	fan, fanCookie := login(t, "fan", auth.RoleUser)
+	if err := database.Follows.SetUser(fan.ID, dana.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	if w := serve(handler.UsersHandler, http.MethodPut, "/api/users/dana/privacy", `{"show_name":false,"show_join_date":true,"show_counts":false,"show_activity":false}`, danaCookie); w.Code != http.StatusOK {
+		t.Fatalf("saving privacy: got status %d: %s", w.Code, w.Body)
+	}
+	store, err := blob.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var picture bytes.Buffer
+	if err := png.Encode(&picture, image.NewGray(image.Rect(0, 0, 64, 64))); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.SetAvatar(context.Background(), service.NewUploads(store, 1<<20), dana.ID, "me.png", picture.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, viewer := range []struct {
+		name   string
+		cookie *http.Cookie
+		self   bool
+	}{
+		{"logged out", nil, false},
+		{"another user", fanCookie, false},
+		{"the user", danaCookie, true},
+	} {
+		t.Run(viewer.name, func(t *testing.T) {
+			w := serve(handler.UsersHandler, http.MethodGet, "/api/users/dana", "", viewer.cookie)
+			var profile struct {
+				Profile model.ProfileData `json:"profile"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&profile); err != nil {
+				t.Fatal(err)
+			}
+			name := "dana"
+			if viewer.self {
+				name = "First Last"
+			}
+			expect(t, "display name", profile.Profile.DisplayName, name)
+			expect(t, "join date shown", profile.Profile.JoinedAt != nil, true)
+			expect(t, "counts shown", profile.Profile.Counts != nil, viewer.self)
+			// Attachments are only served with a session
+			expect(t, "avatar shown", profile.Profile.AvatarURL != "", viewer.cookie != nil)
+
+			w = serve(handler.UsersHandler, http.MethodGet, "/api/users/dana/followers", "", viewer.cookie)
+			var followers struct {
+				Counts *model.FollowCounts `json:"counts"`
+				Users  []model.FollowUser  `json:"users"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&followers); err != nil {
+				t.Fatal(err)
+			}
+			expect(t, "follower counts shown", followers.Counts != nil, viewer.self)
+			expect(t, "followers listed", len(followers.Users), 1)
+
+			w = serve(handler.UsersHandler, http.MethodGet, "/api/users/dana/comments", "", viewer.cookie)
+			status := http.StatusForbidden
+			if viewer.self {
+				status = http.StatusOK
+			}
+			expect(t, "comments status", w.Code, status)
+		})
+	}
+}
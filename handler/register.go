@@ -6,7 +6,6 @@ import (
 	"net/http"
 	
 	"realtimeforum/auth"
-	"realtimeforum/database"
 	"realtimeforum/utils"
 )
 
@@ -42,13 +41,12 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if existingID, _ := auth.UserExist(database.DB, req.Username); existingID != "" {
+	if existingID, _ := auth.UserExist(req.Username); existingID != "" {
 		respondWithJSON(w, http.StatusConflict, map[string]string{"error": "username already exists"})
 		return
 	}
 
 	if err := auth.AddUser(
-		database.DB,
 		req.Username,
 		req.Email,
 		req.Password,
@@ -0,0 +1,105 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"realtimeforum/auth"
+	"realtimeforum/database"
+	"realtimeforum/service"
+	"strconv"
+	"strings"
+)
+
+// ScheduledPostsHandler serves /api/posts/scheduled, the posts of the
+// logged in user waiting for publication:
+//
+//	GET    /api/posts/scheduled      every scheduled post, the next one first
+//	PUT    /api/posts/scheduled/{id} change publish_at or expires_at, null removes the expiry
+//	DELETE /api/posts/scheduled/{id} cancel, deleting the post
+//
+// Posts are scheduled with publish_at on /api/create-post. Once
+// published, only expires_at can still change; the rest is a 409.
+func ScheduledPostsHandler(uploads *service.Uploads) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		isLoggedIn, userID := auth.CheckUserLoggedIn(r)
+		if !isLoggedIn {
+			WriteAPIError(w, http.StatusUnauthorized, "You must be logged in to schedule posts")
+			return
+		}
+
+		path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/posts/scheduled"), "/")
+		if path == "" {
+			if r.Method != http.MethodGet {
+				WriteAPIError(w, http.StatusMethodNotAllowed, "Only GET method is allowed")
+				return
+			}
+			posts, err := database.Posts.Scheduled(userID)
+			if err != nil {
+				writeScheduleError(w, err)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"success": true,
+				"posts":   posts,
+			})
+			return
+		}
+
+		id, err := strconv.Atoi(path)
+		if err != nil {
+			WriteAPIError(w, http.StatusNotFound)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodPut:
+			var input service.RescheduleInput
+			if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+				WriteAPIError(w, http.StatusBadRequest, "Invalid JSON payload")
+				return
+			}
+			err := service.Reschedule(userID, id, input)
+			if writeValidationErrors(w, err) {
+				return
+			}
+			if err != nil {
+				writeScheduleError(w, err)
+				return
+			}
+			post, err := database.Posts.GetByID(id)
+			if err != nil {
+				writeScheduleError(w, err)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"success": true,
+				"post":    post,
+			})
+		case http.MethodDelete:
+			if err := service.CancelScheduled(uploads, userID, id); err != nil {
+				writeScheduleError(w, err)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
+		default:
+			WriteAPIError(w, http.StatusMethodNotAllowed, "Only PUT and DELETE methods are allowed")
+		}
+	}
+}
+
+func writeScheduleError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, database.ErrPostNotFound):
+		WriteAPIError(w, http.StatusNotFound, "Post not found")
+	case errors.Is(err, database.ErrPostPublished):
+		WriteAPIError(w, http.StatusConflict, "The post is already published")
+	default:
+		log.Printf("❌ Scheduled post error: %v", err)
+		HandleError(w, err)
+	}
+}
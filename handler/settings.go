@@ -0,0 +1,312 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"mime"
+	"net/http"
+	"realtimeforum/auth"
+	"realtimeforum/database"
+	"realtimeforum/mail"
+	"realtimeforum/model"
+	"realtimeforum/service"
+	"strings"
+)
+
+// AccountSettingsHandler serves /api/account, the settings of the logged
+// in user:
+//
+//	GET         /api/account           the account, with any email waiting for confirmation
+//	PUT         /api/account/profile   change first_name, last_name, username and bio; those left out stay
+//	PUT         /api/account/email     start changing the email to {"email": "..."}, mailing the confirmation with mailer
+//	PUT         /api/account/password  {"current_password": "...", "new_password": "..."}, signing out other sessions
+//	PUT, DELETE /api/account/avatar    upload the "file" field of a multipart form as the avatar, or remove it
+//	GET         /api/account/export    everything kept about the user as a ZIP of JSON files, ?format=json for one document
+//	POST        /api/account/delete    delete the account after a grace period, given {"password": "..."}
+//	DELETE      /api/account/delete    keep the account after all
+//
+// Invalid fields are a 400 listing every problem under "errors". Without
+// a mailer emails cannot be changed.
+func AccountSettingsHandler(uploads *service.Uploads, mailer mail.Sender) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		isLoggedIn, userID := auth.CheckUserLoggedIn(r)
+		if !isLoggedIn {
+			WriteAPIError(w, http.StatusUnauthorized, "You must be logged in to change your account")
+			return
+		}
+
+		path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/account"), "/")
+		switch path {
+		case "":
+			if r.Method != http.MethodGet {
+				WriteAPIError(w, http.StatusMethodNotAllowed, "Only GET method is allowed")
+				return
+			}
+			writeAccount(w, userID)
+		case "profile":
+			updateProfile(w, r, userID)
+		case "email":
+			changeEmail(w, r, mailer, userID)
+		case "password":
+			changePassword(w, r, userID)
+		case "avatar":
+			setAvatar(w, r, uploads, userID)
+		case "export":
+			exportAccount(w, r, userID)
+		case "delete":
+			deleteAccount(w, r, userID)
+		default:
+			WriteAPIError(w, http.StatusNotFound)
+		}
+	}
+}
+
+// VerifyEmailHandler handles POST /api/account/email/verify with the
+// {"token": "..."} sent to a new email. It needs no login, since the
+// token may be opened on another device.
+func VerifyEmailHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		WriteAPIError(w, http.StatusMethodNotAllowed, "Only POST method is allowed")
+		return
+	}
+	var body struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		WriteAPIError(w, http.StatusBadRequest, "Invalid JSON payload")
+		return
+	}
+	if err := service.ConfirmEmail(body.Token); err != nil {
+		writeAccountError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "Email confirmed",
+	})
+}
+
+func writeAccount(w http.ResponseWriter, userID string) {
+	user, err := database.Users.GetByID(userID)
+	if err != nil {
+		writeAccountError(w, err)
+		return
+	}
+	pending, err := database.Users.PendingEmail(userID)
+	if err != nil {
+		writeAccountError(w, err)
+		return
+	}
+	writeAccountUser(w, user, map[string]interface{}{"pending_email": pending})
+}
+
+func updateProfile(w http.ResponseWriter, r *http.Request, userID string) {
+	if r.Method != http.MethodPut {
+		WriteAPIError(w, http.StatusMethodNotAllowed, "Only PUT method is allowed")
+		return
+	}
+	var input service.ProfileInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		WriteAPIError(w, http.StatusBadRequest, "Invalid JSON payload")
+		return
+	}
+	user, err := service.UpdateProfile(userID, input)
+	if writeValidationErrors(w, err) {
+		return
+	}
+	if err != nil {
+		writeAccountError(w, err)
+		return
+	}
+	writeAccountUser(w, user, nil)
+}
+
+func changeEmail(w http.ResponseWriter, r *http.Request, mailer mail.Sender, userID string) {
+	if r.Method != http.MethodPut {
+		WriteAPIError(w, http.StatusMethodNotAllowed, "Only PUT method is allowed")
+		return
+	}
+	var body struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		WriteAPIError(w, http.StatusBadRequest, "Invalid JSON payload")
+		return
+	}
+	err := service.ChangeEmail(r.Context(), mailer, userID, body.Email)
+	if writeValidationErrors(w, err) {
+		return
+	}
+	if err != nil {
+		writeAccountError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":       true,
+		"message":       "Check your new email for the confirmation",
+		"pending_email": strings.TrimSpace(body.Email),
+	})
+}
+
+func changePassword(w http.ResponseWriter, r *http.Request, userID string) {
+	if r.Method != http.MethodPut {
+		WriteAPIError(w, http.StatusMethodNotAllowed, "Only PUT method is allowed")
+		return
+	}
+	var body struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		WriteAPIError(w, http.StatusBadRequest, "Invalid JSON payload")
+		return
+	}
+	// CheckUserLoggedIn found the cookie, this session stays signed in
+	cookie, _ := r.Cookie("session_token")
+	err := service.ChangePassword(userID, body.CurrentPassword, body.NewPassword, cookie.Value)
+	if writeValidationErrors(w, err) {
+		return
+	}
+	if err != nil {
+		writeAccountError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "Password changed, your other sessions were signed out",
+	})
+}
+
+func setAvatar(w http.ResponseWriter, r *http.Request, uploads *service.Uploads, userID string) {
+	switch r.Method {
+	case http.MethodPut:
+		filename, data, ok := readUpload(w, r, uploads.MaxSize())
+		if !ok {
+			return
+		}
+		attachment, err := service.SetAvatar(r.Context(), uploads, userID, filename, data)
+		if writeUploadError(w, err) {
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success":    true,
+			"avatar_url": attachment.ThumbnailURL,
+		})
+	case http.MethodDelete:
+		if err := service.RemoveAvatar(uploads, userID); err != nil {
+			writeAccountError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
+	default:
+		WriteAPIError(w, http.StatusMethodNotAllowed, "Only PUT and DELETE methods are allowed")
+	}
+}
+
+func exportAccount(w http.ResponseWriter, r *http.Request, userID string) {
+	if r.Method != http.MethodGet {
+		WriteAPIError(w, http.StatusMethodNotAllowed, "Only GET method is allowed")
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "zip" && format != "json" {
+		WriteAPIError(w, http.StatusBadRequest, "format must be zip or json")
+		return
+	}
+	export, err := service.ExportAccount(userID)
+	if err != nil {
+		writeAccountError(w, err)
+		return
+	}
+
+	name := "forum-export-" + export.Profile.Username + "-" + export.ExportedAt.Format("20060102")
+	if format == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name + ".json"}))
+		json.NewEncoder(w).Encode(export)
+		return
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name + ".zip"}))
+	if err := export.WriteZip(w); err != nil {
+		// The headers are gone, the client sees a truncated archive
+		log.Printf("❌ Writing the export of %s failed: %v", userID, err)
+	}
+}
+
+func deleteAccount(w http.ResponseWriter, r *http.Request, userID string) {
+	switch r.Method {
+	case http.MethodPost:
+		var body struct {
+			Password string `json:"password"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			WriteAPIError(w, http.StatusBadRequest, "Invalid JSON payload")
+			return
+		}
+		at, err := service.RequestDeletion(userID, body.Password)
+		if err != nil {
+			writeAccountError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success":      true,
+			"message":      "Your account will be deleted; log in and cancel before then to keep it",
+			"delete_after": at,
+		})
+	case http.MethodDelete:
+		if err := service.CancelDeletion(userID); err != nil {
+			writeAccountError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true,
+			"message": "Your account will not be deleted",
+		})
+	default:
+		WriteAPIError(w, http.StatusMethodNotAllowed, "Only POST and DELETE methods are allowed")
+	}
+}
+
+// writeAccountUser writes user with the URL of their avatar and extra.
+func writeAccountUser(w http.ResponseWriter, user *model.User, extra map[string]interface{}) {
+	response := map[string]interface{}{
+		"success": true,
+		"user":    user,
+	}
+	if user.AvatarID != "" {
+		response["avatar_url"] = database.AttachmentPath + user.AvatarID + "/thumbnail"
+	}
+	for key, value := range extra {
+		response[key] = value
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func writeAccountError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrWrongPassword):
+		WriteAPIError(w, http.StatusForbidden, "Current password is incorrect")
+	case errors.Is(err, database.ErrUsernameTaken), errors.Is(err, database.ErrEmailTaken), errors.Is(err, database.ErrInvalidToken):
+		WriteAPIError(w, MapErrorToHTTPStatus(err), err.Error())
+	case errors.Is(err, service.ErrNoMailer):
+		WriteAPIError(w, http.StatusServiceUnavailable, "Email changes are turned off: this server sends no mail")
+	case errors.Is(err, service.ErrMailNotSent):
+		log.Printf("❌ Account settings error: %v", err)
+		WriteAPIError(w, http.StatusBadGateway, "The confirmation email could not be sent, try again later")
+	default:
+		log.Printf("❌ Account settings error: %v", err)
+		HandleError(w, err)
+	}
+}
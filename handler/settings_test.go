@@ -0,0 +1,34 @@
+package handler_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"realtimeforum/auth"
+	"realtimeforum/blob"
+	"realtimeforum/database"
+	"realtimeforum/database/dbtest"
+	"realtimeforum/handler"
+	"realtimeforum/service"
+)
+
+func TestChangeEmailWithoutMailer(t *testing.T) {
+	dbtest.Open(t, database.SQLite)
+	user, cookie := login(t, "mailless", auth.RoleUser)
+	store, err := blob.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings := handler.AccountSettingsHandler(service.NewUploads(store, 0), nil)
+
+	rec := serve(settings, http.MethodPut, "/api/account/email", `{"email": "mailless_new@example.com"}`, cookie)
+	expect(t, "status", rec.Code, http.StatusServiceUnavailable)
+	expect(t, "says why", strings.Contains(rec.Body.String(), "sends no mail"), true)
+
+	pending, err := database.Users.PendingEmail(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "pending email", pending, "")
+}
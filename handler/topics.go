@@ -0,0 +1,209 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"realtimeforum/auth"
+	"realtimeforum/database"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TopicResponse is a topic as listed by the topics API.
+type TopicResponse struct {
+	ID           int        `json:"id"`
+	Name         string     `json:"name"`
+	Emoji        string     `json:"emoji"`
+	Description  string     `json:"description"`
+	Position     int        `json:"position"`
+	Archived     bool       `json:"archived"`
+	PostCount    int        `json:"post_count"`
+	LastActivity *time.Time `json:"last_activity"`
+}
+
+// topicRequest is the body of POST and PATCH; PATCH only changes the
+// fields that are present.
+type topicRequest struct {
+	Name        *string `json:"name"`
+	Emoji       *string `json:"emoji"`
+	Description *string `json:"description"`
+	Position    *int    `json:"position"`
+	Archived    *bool   `json:"archived"`
+}
+
+// TopicsHandler serves /api/topics:
+//
+//	GET    /api/topics        open topics in order, ?archived=true adds archived ones
+//	GET    /api/topics/{id}
+//	POST   /api/topics        admins: create from name, emoji and description, placed last
+//	PATCH  /api/topics/{id}   admins: change name, emoji, description, position or archived
+//	DELETE /api/topics/{id}   admins: delete, posts lose the tag
+func TopicsHandler(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/topics"), "/")
+	if path == "" {
+		switch r.Method {
+		case http.MethodGet:
+			listTopics(w, r)
+		case http.MethodPost:
+			if requireAdmin(w, r) {
+				createTopic(w, r)
+			}
+		default:
+			WriteAPIError(w, http.StatusMethodNotAllowed, "Only GET and POST methods are allowed")
+		}
+		return
+	}
+
+	id, err := strconv.Atoi(path)
+	if err != nil {
+		WriteAPIError(w, http.StatusNotFound)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		writeTopic(w, http.StatusOK, id)
+	case http.MethodPatch:
+		if requireAdmin(w, r) {
+			updateTopic(w, r, id)
+		}
+	case http.MethodDelete:
+		if !requireAdmin(w, r) {
+			return
+		}
+		if err := database.Topics.Delete(id); err != nil {
+			writeTopicError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
+	default:
+		WriteAPIError(w, http.StatusMethodNotAllowed, "Only GET, PATCH and DELETE methods are allowed")
+	}
+}
+
+func listTopics(w http.ResponseWriter, r *http.Request) {
+	topics, err := database.Topics.List(r.URL.Query().Get("archived") == "true")
+	if err != nil {
+		HandleError(w, err)
+		return
+	}
+
+	response := make([]TopicResponse, len(topics))
+	for i, topic := range topics {
+		response[i] = newTopicResponse(topic)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"topics":  response,
+	})
+}
+
+func createTopic(w http.ResponseWriter, r *http.Request) {
+	var body topicRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		WriteAPIError(w, http.StatusBadRequest, "Invalid JSON payload")
+		return
+	}
+	if body.Name == nil || body.Emoji == nil {
+		WriteAPIError(w, http.StatusBadRequest, "A topic needs a name and an emoji")
+		return
+	}
+	var description string
+	if body.Description != nil {
+		description = *body.Description
+	}
+
+	// The new topic goes last; position and archived are set by PATCH
+	id, err := database.Topics.Create(*body.Name, *body.Emoji, description)
+	if err != nil {
+		writeTopicError(w, err)
+		return
+	}
+	writeTopic(w, http.StatusCreated, id)
+}
+
+func updateTopic(w http.ResponseWriter, r *http.Request, id int) {
+	var body topicRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		WriteAPIError(w, http.StatusBadRequest, "Invalid JSON payload")
+		return
+	}
+
+	changes := database.TopicChanges(body)
+	if changes == (database.TopicChanges{}) {
+		WriteAPIError(w, http.StatusBadRequest, "Nothing to change")
+		return
+	}
+	if err := database.Topics.Update(id, changes); err != nil {
+		writeTopicError(w, err)
+		return
+	}
+	writeTopic(w, http.StatusOK, id)
+}
+
+func writeTopic(w http.ResponseWriter, status, id int) {
+	topic, err := database.Topics.Get(id)
+	if err != nil {
+		writeTopicError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"topic":   newTopicResponse(topic),
+	})
+}
+
+// writeTopicError explains validation errors and duplicates.
+func writeTopicError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, database.ErrTopicNotFound):
+		WriteAPIError(w, http.StatusNotFound, "Topic not found")
+	case errors.Is(err, database.ErrInvalidTopic):
+		WriteAPIError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, database.ErrDuplicateTopic):
+		WriteAPIError(w, http.StatusConflict, err.Error())
+	default:
+		HandleError(w, err)
+	}
+}
+
+func newTopicResponse(topic database.TopicSummary) TopicResponse {
+	response := TopicResponse{
+		ID:          topic.ID,
+		Name:        topic.Name,
+		Emoji:       topic.Emoji,
+		Description: topic.Description,
+		Position:    topic.Position,
+		Archived:    topic.Archived,
+		PostCount:   topic.PostCount,
+	}
+	if !topic.LastActivity.IsZero() {
+		response.LastActivity = &topic.LastActivity
+	}
+	return response
+}
+
+// requireAdmin writes a 401 or 403 and returns false unless an admin is
+// logged in.
+func requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	isLoggedIn, userID := auth.CheckUserLoggedIn(r)
+	if !isLoggedIn {
+		WriteAPIError(w, http.StatusUnauthorized, "You must be logged in as an admin")
+		return false
+	}
+	user, err := database.Users.GetByID(userID)
+	if err != nil {
+		HandleError(w, err)
+		return false
+	}
+	if user.Role != auth.RoleAdmin {
+		WriteAPIError(w, http.StatusForbidden, "Only admins can do this")
+		return false
+	}
+	return true
+}
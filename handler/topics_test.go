@@ -0,0 +1,104 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"realtimeforum/auth"
+	"realtimeforum/database"
+	"realtimeforum/database/dbtest"
+	"realtimeforum/handler"
+)
+
+func TestTopicsNeedAnAdmin(t *testing.T) {
+	dbtest.Open(t, database.SQLite)
+	_, member := login(t, "member", auth.RoleUser)
+	_, admin := login(t, "admin", auth.RoleAdmin)
+	id, err := database.Topics.Create("Go", "🐹", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := `{"name":"Rust","emoji":"🦀"}`
+	for _, tc := range []struct {
+		name, method, target, body string
+		cookie                     *http.Cookie
+		want                       int
+	}{
+		{"anonymous create", http.MethodPost, "/api/topics", body, nil, http.StatusUnauthorized},
+		{"member create", http.MethodPost, "/api/topics", body, member, http.StatusForbidden},
+		{"member rename", http.MethodPatch, "/api/topics/" + itoa(id), `{"name":"Golang"}`, member, http.StatusForbidden},
+		{"member delete", http.MethodDelete, "/api/topics/" + itoa(id), "", member, http.StatusForbidden},
+		{"admin create", http.MethodPost, "/api/topics", body, admin, http.StatusCreated},
+		{"duplicate name", http.MethodPost, "/api/topics", `{"name":"go","emoji":"🦫"}`, admin, http.StatusConflict},
+		{"missing emoji", http.MethodPost, "/api/topics", `{"name":"Zig"}`, admin, http.StatusBadRequest},
+		{"empty change", http.MethodPatch, "/api/topics/" + itoa(id), `{}`, admin, http.StatusBadRequest},
+		{"unknown topic", http.MethodPatch, "/api/topics/999", `{"name":"Gone"}`, admin, http.StatusNotFound},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			w := serve(handler.TopicsHandler, tc.method, tc.target, tc.body, tc.cookie)
+			if w.Code != tc.want {
+				t.Errorf("got status %d, want %d: %s", w.Code, tc.want, w.Body)
+			}
+		})
+	}
+}
+
+func TestTopicsOrderAndArchive(t *testing.T) {
+	dbtest.Open(t, database.SQLite)
+	_, admin := login(t, "admin", auth.RoleAdmin)
+	var ids []int
+	for _, topic := range [][2]string{{"First", "1️⃣"}, {"Second", "2️⃣"}, {"Third", "3️⃣"}} {
+		w := serve(handler.TopicsHandler, http.MethodPost, "/api/topics", `{"name":"`+topic[0]+`","emoji":"`+topic[1]+`"}`, admin)
+		var created struct {
+			Topic handler.TopicResponse `json:"topic"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&created); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, created.Topic.ID)
+	}
+
+	// Move the last topic to the front and archive the middle one
+	for _, change := range []struct{ id, body string }{
+		{itoa(ids[2]), `{"position":-1}`},
+		{itoa(ids[1]), `{"archived":true}`},
+	} {
+		if w := serve(handler.TopicsHandler, http.MethodPatch, "/api/topics/"+change.id, change.body, admin); w.Code != http.StatusOK {
+			t.Fatalf("PATCH %s: got status %d: %s", change.body, w.Code, w.Body)
+		}
+	}
+
+	// The migrations add default topics, only the new ones are compared
+	created := map[string]bool{"First": true, "Second": true, "Third": true}
+	list := func(target string) []string {
+		t.Helper()
+		w := serve(handler.TopicsHandler, http.MethodGet, target, "", nil)
+		var listed struct {
+			Topics []handler.TopicResponse `json:"topics"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&listed); err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, topic := range listed.Topics {
+			if created[topic.Name] {
+				names = append(names, topic.Name)
+			}
+		}
+		return names
+	}
+	if got, want := fmt.Sprint(list("/api/topics")), "[Third First]"; got != want {
+		t.Errorf("open topics: got %s, want %s", got, want)
+	}
+	if got, want := fmt.Sprint(list("/api/topics?archived=true")), "[Third First Second]"; got != want {
+		t.Errorf("all topics: got %s, want %s", got, want)
+	}
+}
+
+func itoa(id int) string {
+	return strconv.Itoa(id)
+}
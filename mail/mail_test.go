@@ -0,0 +1,118 @@
+package mail
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeSMTP accepts one message on a local port and returns the port and
+// a channel receiving the envelope and data of the message.
+func fakeSMTP(t *testing.T) (int, <-chan []string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	received := make(chan []string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+		var lines []string
+		reply("220 fake ESMTP")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+			switch command := strings.ToUpper(strings.Fields(line + " x")[0]); command {
+			case "EHLO", "HELO":
+				reply("250 fake")
+			case "MAIL", "RCPT":
+				lines = append(lines, line)
+				reply("250 OK")
+			case "DATA":
+				reply("354 go ahead")
+				for {
+					data, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if data == ".\r\n" {
+						break
+					}
+					lines = append(lines, data)
+				}
+				reply("250 queued")
+			case "QUIT":
+				reply("221 bye")
+				received <- lines
+				return
+			default:
+				reply("502 not implemented")
+			}
+		}
+	}()
+	return ln.Addr().(*net.TCPAddr).Port, received
+}
+
+func TestSMTPSender(t *testing.T) {
+	port, received := fakeSMTP(t)
+	sender, err := NewSMTPSender(SMTPConfig{Host: "127.0.0.1", Port: port, From: "Forum <forum@example.com>"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender.now = func() time.Time { return time.Date(2025, time.January, 2, 3, 4, 5, 0, time.UTC) }
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err = sender.Send(ctx, Message{To: "erin@example.com", Subject: "Confirm your email", Body: "Line one\nLine two"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var lines []string
+	select {
+	case lines = <-received:
+	case <-ctx.Done():
+		t.Fatal("no message received")
+	}
+	got := strings.Join(lines, "\n")
+	for _, want := range []string{
+		"MAIL FROM:<forum@example.com>",
+		"RCPT TO:<erin@example.com>",
+		"From: \"Forum\" <forum@example.com>\r\n",
+		"To: <erin@example.com>\r\n",
+		"Subject: Confirm your email\r\n",
+		"Date: Thu, 02 Jan 2025 03:04:05 +0000\r\n",
+		"\r\n\nLine one\r\n\nLine two\r\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("message lacks %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestNewSMTPSender(t *testing.T) {
+	for _, cfg := range []SMTPConfig{
+		{Port: 587, From: "forum@example.com"},
+		{Host: "smtp.example.com", Port: 0, From: "forum@example.com"},
+		{Host: "smtp.example.com", Port: 587, From: "not an address"},
+	} {
+		if _, err := NewSMTPSender(cfg); err == nil {
+			t.Errorf("%+v was accepted", cfg)
+		}
+	}
+}
@@ -3,20 +3,44 @@ package main
 import (
 	"fmt"
 	"log"
+	"os"
+	"realtimeforum/config"
 	"realtimeforum/database"
 	"realtimeforum/server"
 )
 
 func main() {
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	cfg.SetupLogging()
 
-	db, err := database.InitDatabase()
+	if len(cfg.Command) > 0 {
+		fmt.Fprintf(os.Stderr, "unexpected argument %q; migrations and seeding are done with forumctl\n", cfg.Command[0])
+		os.Exit(2)
+	}
+
+	dialect := database.Dialect(cfg.DatabaseDriver)
+	db, err := database.InitDatabase(dialect, cfg.DatabaseSource())
+	if err != nil {
+		log.Fatal("Database initialization failed:", err)
+	}
+	readDB, err := database.OpenReadPool(dialect, cfg.DatabaseSource(), db)
 	if err != nil {
 		log.Fatal("Database initialization failed:", err)
 	}
-	defer db.Close()
 
-	database.DB = db
+	database.Use(db, readDB)
 	fmt.Println("Connected and initialized DB!")
-		server.StartServer()
+	err = server.StartServer(cfg)
 
+	// The hub has marked everyone offline, nothing else uses the DB now
+	if closeErr := database.Close(); closeErr != nil {
+		log.Printf("❌ Error closing database: %v", closeErr)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
 }
@@ -0,0 +1,112 @@
+// Package markdown renders the Markdown of posts and comments to HTML
+// that is safe to insert into a page.
+//
+// Only a subset of CommonMark is parsed: paragraphs, emphasis, code spans
+// and blocks, links, lists, block quotes and thematic breaks. Anything
+// else, raw HTML included, stays text and is escaped. Images become their
+// alt text, links keep only http, https, mailto and relative URLs, and
+// every link gets rel="nofollow ugc".
+package markdown
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// LinkRel is the rel attribute of every link.
+const LinkRel = "nofollow ugc"
+
+var allowedSchemes = map[string]bool{"": true, "http": true, "https": true, "mailto": true}
+
+var converter = goldmark.New(
+	goldmark.WithParser(parser.NewParser(
+		parser.WithBlockParsers(
+			util.Prioritized(parser.NewThematicBreakParser(), 200),
+			util.Prioritized(parser.NewListParser(), 300),
+			util.Prioritized(parser.NewListItemParser(), 400),
+			util.Prioritized(parser.NewCodeBlockParser(), 500),
+			util.Prioritized(parser.NewFencedCodeBlockParser(), 700),
+			util.Prioritized(parser.NewBlockquoteParser(), 800),
+			util.Prioritized(parser.NewParagraphParser(), 1000),
+		),
+		parser.WithInlineParsers(
+			util.Prioritized(parser.NewCodeSpanParser(), 100),
+			util.Prioritized(parser.NewLinkParser(), 200),
+			util.Prioritized(parser.NewAutoLinkParser(), 300),
+			util.Prioritized(parser.NewEmphasisParser(), 500),
+		),
+		parser.WithParagraphTransformers(parser.DefaultParagraphTransformers()...),
+		parser.WithASTTransformers(util.Prioritized(linkPolicy{}, 100)),
+	)),
+	// Line breaks are kept, as they were when posts were plain text
+	goldmark.WithRendererOptions(html.WithHardWraps()),
+)
+
+// Render converts source to sanitized HTML.
+func Render(source string) (string, error) {
+	var buf bytes.Buffer
+	if err := converter.Convert([]byte(source), &buf); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// linkPolicy unwraps images and links to URLs of other schemes, and marks
+// the links that are left.
+type linkPolicy struct{}
+
+func (linkPolicy) Transform(doc *ast.Document, reader text.Reader, _ parser.Context) {
+	var unwrap []ast.Node
+	ast.Walk(doc, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n := node.(type) {
+		case *ast.Image:
+			unwrap = append(unwrap, n)
+		case *ast.Link:
+			if allowedURL(string(n.Destination)) {
+				n.SetAttributeString("rel", []byte(LinkRel))
+			} else {
+				unwrap = append(unwrap, n)
+			}
+		case *ast.AutoLink:
+			if allowedURL(string(n.URL(reader.Source()))) {
+				n.SetAttributeString("rel", []byte(LinkRel))
+			} else {
+				unwrap = append(unwrap, n)
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+
+	for _, node := range unwrap {
+		parent := node.Parent()
+		if link, ok := node.(*ast.AutoLink); ok {
+			parent.InsertBefore(parent, node, ast.NewString(link.Label(reader.Source())))
+		}
+		for child := node.FirstChild(); child != nil; {
+			next := child.NextSibling()
+			parent.InsertBefore(parent, node, child)
+			child = next
+		}
+		parent.RemoveChild(parent, node)
+	}
+}
+
+// allowedURL accepts relative URLs and the schemes of allowedSchemes.
+func allowedURL(raw string) bool {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return false
+	}
+	return allowedSchemes[strings.ToLower(u.Scheme)]
+}
@@ -0,0 +1,39 @@
+package markdown_test
+
+import (
+	"testing"
+
+	"realtimeforum/markdown"
+)
+
+func TestRender(t *testing.T) {
+	for _, tc := range []struct {
+		name, source, want string
+	}{
+		{"emphasis and code", "Some *emphasis*, **strong** and `code`", "<p>Some <em>emphasis</em>, <strong>strong</strong> and <code>code</code></p>\n"},
+		{"line breaks are kept", "one\ntwo", "<p>one<br>\ntwo</p>\n"},
+		{"link", "[a link](https://example.com)", `<p><a href="https://example.com" rel="nofollow ugc">a link</a></p>` + "\n"},
+		{"relative link", "[home](/posts/1)", `<p><a href="/posts/1" rel="nofollow ugc">home</a></p>` + "\n"},
+		{"mailto link", "[mail](mailto:a@example.com)", `<p><a href="mailto:a@example.com" rel="nofollow ugc">mail</a></p>` + "\n"},
+		{"autolink", "<https://example.com>", `<p><a href="https://example.com" rel="nofollow ugc">https://example.com</a></p>` + "\n"},
+		{"javascript link", "[bad](javascript:alert(1))", "<p>bad</p>\n"},
+		{"javascript link in capitals", "[bad](JavaScript:alert(1))", "<p>bad</p>\n"},
+		{"data link", "[bad](data:text/html;base64,PHNjcmlwdD4=)", "<p>bad</p>\n"},
+		{"unsafe autolink", "<javascript:alert(1)>", "<p>javascript:alert(1)</p>\n"},
+		{"image", "![alt](https://example.com/x.png)", "<p>alt</p>\n"},
+		{"script", "<script>alert(1)</script>", "<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>\n"},
+		{"inline html", `a <img src=x onerror="alert(1)"> b`, "<p>a &lt;img src=x onerror=&quot;alert(1)&quot;&gt; b</p>\n"},
+		{"heading stays text", "# Title", "<p># Title</p>\n"},
+		{"quote and list", "> quoted\n\n- one\n- two", "<blockquote>\n<p>quoted</p>\n</blockquote>\n<ul>\n<li>one</li>\n<li>two</li>\n</ul>\n"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := markdown.Render(tc.source)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Errorf("Render(%q)\n got %q\nwant %q", tc.source, got, tc.want)
+			}
+		})
+	}
+}
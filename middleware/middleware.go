@@ -22,14 +22,7 @@ func RequireAuth(next http.HandlerFunc) http.HandlerFunc {
 		}
 
 		// Check if session exists and is valid
-		var userID string
-		var expiresAt time.Time
-
-		err = database.DB.QueryRow(
-			"SELECT user_id, session_expiry FROM sessions WHERE session_token = ?",
-			cookie.Value,
-		).Scan(&userID, &expiresAt)
-
+		userID, expiresAt, err := database.Sessions.Lookup(cookie.Value)
 		if err != nil || time.Now().After(expiresAt) {
 			handler.WriteAPIError(w, http.StatusUnauthorized, "Invalid or expired session")
 			return
@@ -4,6 +4,19 @@ import (
 	"time"
 )
 
+// Formats of the content of posts and comments
+const (
+	ContentPlain    = "plain"
+	ContentMarkdown = "markdown"
+)
+
+// Statuses of posts: scheduled posts are only seen by their author until
+// they are published.
+const (
+	PostPublished = "published"
+	PostScheduled = "scheduled"
+)
+
 
 
 type HomePageData struct {
@@ -19,14 +32,47 @@ type SubmitPostData struct {
 	User   *User   `json:"user,omitempty"`
 }
 
+// ProfileData is the public profile of a user. What the user keeps
+// private is left out, except for themselves.
 type ProfileData struct {
-	Title      string   `json:"title"`
-	User       *User    `json:"user,omitempty"`
-	Posts      []*Post  `json:"posts"`
-	Topics     []Topic  `json:"topics"`
-	IsLoggedIn bool     `json:"is_logged_in"`
-	Success    bool     `json:"success"`
-	Error      string   `json:"error"`
+	Username       string          `json:"username"`
+	DisplayName    string          `json:"display_name"`
+	JoinedAt       *time.Time      `json:"joined_at,omitempty"`
+	Bio            string          `json:"bio"`
+	AvatarURL      string          `json:"avatar_url,omitempty"`
+	Counts         *ProfileCounts  `json:"counts,omitempty"`
+	RecentActivity []Activity      `json:"recent_activity,omitempty"`
+	IsSelf         bool            `json:"is_self"`
+	Following      bool            `json:"following"`
+	// Privacy is only shown to the user themselves
+	Privacy *ProfilePrivacy `json:"privacy,omitempty"`
+}
+
+// ProfilePrivacy is which parts of their profile a user shows others.
+type ProfilePrivacy struct {
+	ShowName     bool `json:"show_name"`
+	ShowJoinDate bool `json:"show_join_date"`
+	ShowCounts   bool `json:"show_counts"`
+	// ShowActivity covers the recent activity and the list of comments
+	ShowActivity bool `json:"show_activity"`
+}
+
+// ProfileCounts are the published posts, the comments on them and the
+// follows of a user.
+type ProfileCounts struct {
+	Posts     int `json:"posts"`
+	Comments  int `json:"comments"`
+	Followers int `json:"followers"`
+	Following int `json:"following"`
+}
+
+// Activity is a post or a comment of a user, Kind telling which.
+type Activity struct {
+	Kind      string    `json:"kind"`
+	PostID    int       `json:"post_id"`
+	PostTitle string    `json:"post_title"`
+	CommentID int       `json:"comment_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
 }
 
 type Topic struct {
@@ -45,9 +91,15 @@ type User struct {
 	Age           int        `json:"age"`
 	Gender        string     `json:"gender"`
 	TermsAccepted bool       `json:"terms_accepted"`
+	Role          string     `json:"role"`
 	SessionToken  *string    `json:"session_token,omitempty"`
 	SessionExpiry *time.Time `json:"session_expiry,omitempty"`
 	CreatedAt     time.Time  `json:"created_at"`
+	Bio           string     `json:"bio"`
+	AvatarID      string     `json:"avatar_id,omitempty"`
+	Privacy       ProfilePrivacy `json:"privacy"`
+	// DeleteAfter is when the account is deleted, if its user asked
+	DeleteAfter *time.Time `json:"delete_after,omitempty"`
 }
 
 type Post struct {
@@ -55,8 +107,14 @@ type Post struct {
 	Author    string    `json:"author"`
 	Title     string    `json:"title"`
 	Content   string    `json:"content"`
+	ContentHTML   string `json:"content_html"`
+	ContentFormat string `json:"content_format"`
 	UserID    string       `json:"user_id"`
 	Topics    []string   `json:"topics"`
+	Attachments []Attachment `json:"attachments"`
+	Status    string     `json:"status"`
+	PublishAt *time.Time `json:"publish_at,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 
@@ -74,6 +132,8 @@ type Post struct {
 type Comment struct {
 	ID        int       `json:"id"`
 	Content   string    `json:"content"`
+	ContentHTML   string `json:"content_html"`
+	ContentFormat string `json:"content_format"`
 	Author    string    `json:"author"`
 	UserID    string       `json:"user_id"`
 	PostID    int       `json:"post_id"`
@@ -93,20 +153,97 @@ type FeedPost struct {
 	ID            int           `json:"id"`
 	Title         string        `json:"title"`
 	Content       string        `json:"content"`
+	ContentHTML   string        `json:"content_html"`
+	ContentFormat string        `json:"content_format"`
 	Author        string        `json:"author"`
 	UserID        string        `json:"user_id"`
 	CreatedAt     string        `json:"created_at"`
 	UpdatedAt     string        `json:"updated_at"`
+	ExpiresAt     string        `json:"expires_at,omitempty"`
 	Topics        []string      `json:"topics"`
+	Attachments   []Attachment  `json:"attachments"`
 	CommentsCount int           `json:"comments_count"`
+	LikesCount    int           `json:"likes_count"`
+	Liked         bool          `json:"liked"`
+	Bookmarked    bool          `json:"bookmarked"`
 	ViewsCount    int           `json:"views_count"`
 	RecentComments []FeedComment `json:"comments"`
 }
 
+// Attachment is an uploaded file on a post or a chat message. URL and
+// ThumbnailURL need a session that may see it.
+type Attachment struct {
+	ID           string    `json:"id"`
+	Filename     string    `json:"filename"`
+	ContentType  string    `json:"content_type"`
+	Size         int64     `json:"size"`
+	Width        int       `json:"width,omitempty"`
+	Height       int       `json:"height,omitempty"`
+	URL          string    `json:"url"`
+	ThumbnailURL string    `json:"thumbnail_url,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// Draft is a post being written. Revision is bumped by every save and
+// must be sent back with the next one.
+type Draft struct {
+	ID        int       `json:"id"`
+	Title     string    `json:"title"`
+	Content   string    `json:"content"`
+	Format    string    `json:"format"`
+	Topics    []int     `json:"topics"`
+	Revision  int       `json:"revision"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Bookmark is a post a user saved to read later, in one of their
+// collections or in none.
+type Bookmark struct {
+	Post         Post      `json:"post"`
+	CollectionID int       `json:"collection_id,omitempty"`
+	Collection   string    `json:"collection,omitempty"`
+	SavedAt      time.Time `json:"saved_at"`
+}
+
+// BookmarkCollection is a named group of the bookmarks of a user.
+type BookmarkCollection struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	Count     int       `json:"count"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// FollowUser is a user in a followers or following list
+type FollowUser struct {
+	ID         string    `json:"id"`
+	Username   string    `json:"username"`
+	FirstName  string    `json:"first_name"`
+	LastName   string    `json:"last_name"`
+	FollowedAt time.Time `json:"followed_at"`
+}
+
+// FollowTopic is a topic a user follows
+type FollowTopic struct {
+	ID         int       `json:"id"`
+	Name       string    `json:"name"`
+	Emoji      string    `json:"emoji"`
+	FollowedAt time.Time `json:"followed_at"`
+}
+
+// FollowCounts are shown on user profiles
+type FollowCounts struct {
+	Followers int `json:"followers"`
+	Following int `json:"following"`
+	Topics    int `json:"topics"`
+}
+
 // FeedComment represents a comment in the feed
 type FeedComment struct {
 	ID        int    `json:"id"`
 	Content   string `json:"content"`
+	ContentHTML   string `json:"content_html"`
+	ContentFormat string `json:"content_format"`
 	Author    string `json:"author"`
 	UserID    string `json:"user_id"`
 	PostID    int    `json:"post_id"`
@@ -132,6 +269,7 @@ type ChatMessage struct {
     SenderID   string    `json:"sender_id"`
     ReceiverID string    `json:"receiver_id"`
     Message    string    `json:"message"`
+    Attachments []Attachment `json:"attachments"`
     CreatedAt  time.Time `json:"created_at"`
     IsRead     bool      `json:"is_read"`
     SenderName string    `json:"sender_name"`
@@ -141,13 +279,28 @@ type ChatUser struct {
     ID               string    `json:"id"`
     Username         string    `json:"username"`
     IsOnline         bool      `json:"is_online"`
-    LastActivity     time.Time `json:"last_activity"`
+    Status           string     `json:"status"`
+    CustomStatus     string     `json:"custom_status,omitempty"`
+    LastSeen         *time.Time `json:"last_seen,omitempty"`
+    LastActivity     time.Time `json:"-"` // exposed as LastSeen, subject to privacy settings
     LastMessage      string    `json:"last_message,omitempty"`
     LastMessageTime  time.Time `json:"last_message_time"`
     UnreadCount      int       `json:"unread_count"`
 	  HasMessages      bool      `json:"has_messages"` // Helper for sorting
 }
 
+// Presence is the status of a user as seen by other users.
+// Status is one of "available", "away", "dnd" or "offline";
+// invisible users are reported as offline.
+type Presence struct {
+    UserID       string     `json:"user_id"`
+    Username     string     `json:"username,omitempty"`
+    IsOnline     bool       `json:"is_online"`
+    Status       string     `json:"status"`
+    CustomStatus string     `json:"custom_status,omitempty"`
+    LastSeen     *time.Time `json:"last_seen,omitempty"`
+}
+
 type TypingEvent struct {
     UserID     string `json:"user_id"`
     Username   string `json:"username"`
@@ -160,4 +313,13 @@ type WebSocketMessage struct {
     Data    interface{} `json:"data"`
     UserID  string      `json:"user_id"`
     ChatID  string      `json:"chat_id,omitempty"`
+    Seq     int64       `json:"seq,omitempty"` // set on durable events, acknowledged with an "ack" message
+}
+
+// SyncBatch is sent to a client right after it connects with every
+// event it missed since its last acknowledged sequence number.
+type SyncBatch struct {
+    Events    []WebSocketMessage `json:"events"`
+    LastSeq   int64              `json:"last_seq"`
+    Truncated bool               `json:"truncated"` // older events fell outside the replay window
 }
@@ -1,37 +1,96 @@
 package server
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"net/url"
+	"os"
+	"os/signal"
 	"realtimeforum/auth"
+	"realtimeforum/blob"
+	"realtimeforum/config"
+	"realtimeforum/database"
 	"realtimeforum/handler"
+	"realtimeforum/mail"
 	"realtimeforum/middleware"
+	"realtimeforum/service"
 	"realtimeforum/websocket"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
-// StartServer starts the HTTP server
-func StartServer() {
+// StartServer starts the HTTP server and blocks until it fails or the
+// process receives SIGINT or SIGTERM. In-flight requests then get up to
+// the configured shutdown timeout to finish, and WebSocket clients are
+// told the server is restarting.
+func StartServer(cfg *config.Config) error {
+	sessions := auth.Sessions{
+		Lifetime: time.Duration(cfg.SessionLifetime),
+		Secure:   cfg.TLS.Enabled(),
+	}
+	hub := websocket.NewHub(websocket.HubConfig{
+		AllowedOrigins:     cfg.AllowedOrigins,
+		SendBufferSize:     cfg.SendBufferSize,
+		MaxPendingMessages: cfg.MaxPendingMessages,
+	})
+	chat := handler.NewChat(hub, handler.ChatThrottle{
+		Messages: time.Duration(cfg.Throttle.Messages),
+		UserList: time.Duration(cfg.Throttle.UserList),
+	})
+
+	store, err := newBlobStore(cfg.Uploads)
+	if err != nil {
+		return err
+	}
+	uploads := service.NewUploads(store, int64(cfg.Uploads.MaxSize))
+	mailer, err := newMailer(cfg.Mail)
+	if err != nil {
+		return err
+	}
+
 	// Serve static files from the "assets" folder
 	http.Handle("/assets/", http.StripPrefix("/assets/", http.FileServer(http.Dir("assets"))))
 
 	// Define API routes (these take priority)
-	http.HandleFunc("/api/login", handler.LoginHandler)
+	http.HandleFunc("/api/login", handler.LoginHandler(sessions))
 
 	http.HandleFunc("/api/create-post", middleware.RequireAuth(handler.CreatePostHandler))
-
-	http.HandleFunc("/api/submit-post", middleware.RequireAuth(handler.SubmitPostHandler))
+	// Older clients still post here
+	http.HandleFunc("/api/submit-post", middleware.RequireAuth(handler.CreatePostHandler))
 	http.HandleFunc("/api/register", handler.RegisterHandler)
 	http.HandleFunc("/api/check-session", auth.CheckSessionHandler)
 
 	http.HandleFunc("/api/user/posts", middleware.RequireAuth(handler.GetUserPostsHandler))
 
 	http.HandleFunc("/api/posts/topic/", handler.GetPostsByTopicHandler)
+	http.HandleFunc("/api/posts/like/", middleware.RequireAuth(handler.LikePostHandler))
+	http.HandleFunc("/api/posts/scheduled", middleware.RequireAuth(handler.ScheduledPostsHandler(uploads)))
+	http.HandleFunc("/api/posts/scheduled/", middleware.RequireAuth(handler.ScheduledPostsHandler(uploads)))
+	http.HandleFunc("/api/topics", handler.TopicsHandler)
+	http.HandleFunc("/api/topics/", handler.TopicsHandler)
+	http.HandleFunc("/api/topics/follow/", middleware.RequireAuth(handler.FollowTopicHandler))
+	// Profiles are public, the handler asks for a login to change anything
+	http.HandleFunc("/api/users/", handler.UsersHandler)
+
+	http.HandleFunc("/api/attachments", middleware.RequireAuth(handler.AttachmentsHandler(uploads)))
+	http.HandleFunc("/api/attachments/", middleware.RequireAuth(handler.AttachmentsHandler(uploads)))
+	http.HandleFunc("/api/drafts", middleware.RequireAuth(handler.DraftsHandler))
+	http.HandleFunc("/api/drafts/", middleware.RequireAuth(handler.DraftsHandler))
+	http.HandleFunc("/api/bookmarks", middleware.RequireAuth(handler.BookmarksHandler))
+	http.HandleFunc("/api/bookmarks/", middleware.RequireAuth(handler.BookmarksHandler))
+	http.HandleFunc("/api/account", middleware.RequireAuth(handler.AccountSettingsHandler(uploads, mailer)))
+	http.HandleFunc("/api/account/", middleware.RequireAuth(handler.AccountSettingsHandler(uploads, mailer)))
+	// Confirmed from the link sent to the new email, maybe logged out
+	http.HandleFunc("/api/account/email/verify", handler.VerifyEmailHandler)
 
-	http.HandleFunc("/api/comments/create", middleware.RequireAuth(handler.CreateCommentHandler))
+	http.HandleFunc("/api/comments/create", middleware.RequireAuth(handler.CreateCommentHandler(hub)))
 	http.HandleFunc("/api/posts/", middleware.RequireAuth(handler.GetSinglePostHandler))
 
 	http.HandleFunc("/api/feed/posts", middleware.RequireAuth(handler.GetFeedHandler))
@@ -42,11 +101,12 @@ func StartServer() {
 
 	// Chat routes
 	http.HandleFunc("/api/debug/online-status", handler.DebugOnlineStatusHandler)
-	http.HandleFunc("/ws", middleware.RequireAuth(handler.WebSocketHandler))
+	http.HandleFunc("/api/debug/websocket-metrics", chat.WebSocketMetricsHandler)
+	http.HandleFunc("/ws", middleware.RequireAuth(chat.WebSocketHandler))
 
-	http.HandleFunc("/api/chat/users", middleware.RequireAuth(handler.GetChatUsersHandler))
+	http.HandleFunc("/api/chat/users", middleware.RequireAuth(chat.GetChatUsersHandler))
 
-	http.HandleFunc("/api/chat/messages/", middleware.RequireAuth(handler.GetChatMessagesHandler))
+	http.HandleFunc("/api/chat/messages/", middleware.RequireAuth(chat.GetChatMessagesHandler))
 	http.HandleFunc("/api/chat/public-users", handler.GetPublicUsersHandler)
 
 	// SPA Catch-all handler (MUST be last)
@@ -74,15 +134,128 @@ func StartServer() {
 		http.ServeFile(w, r, "./index.html")
 	})
 
+	// Share WebSocket events with other server instances through Redis
+	if cfg.BrokerURL != "" {
+		broker, err := websocket.NewRedisBroker(cfg.BrokerURL, "realtimeforum:hub")
+		if err != nil {
+			return fmt.Errorf("broker error: %w", err)
+		}
+		hub.SetBroker(broker)
+		log.Println("✅ WebSocket Hub connected to broker")
+	}
+
+	// Background jobs share one context. They announce posts and close
+	// connections through the hub, so they are stopped before it is.
+	jobsCtx, cancelJobs := context.WithCancel(context.Background())
+	var jobs sync.WaitGroup
+	runJob := func(job func(ctx context.Context)) {
+		jobs.Add(1)
+		go func() {
+			defer jobs.Done()
+			job(jobsCtx)
+		}()
+	}
+	stopJobs := func() {
+		// A backup in progress is abandoned; the DB is closed right after
+		cancelJobs()
+		jobs.Wait()
+	}
+	defer stopJobs()
+
+	// Back the database up in the background when configured
+	if cfg.Backup.Interval > 0 && database.DialectOf(database.DB) == database.SQLite {
+		runJob(func(ctx context.Context) {
+			database.ScheduleBackups(ctx, database.ReadDB, cfg.Backup.Dir, time.Duration(cfg.Backup.Interval), cfg.Backup.Keep)
+		})
+		log.Printf("💾 Backing up to %s every %s", cfg.Backup.Dir, time.Duration(cfg.Backup.Interval))
+	}
+
+	// Publish scheduled posts as they fall due
+	runJob(func(ctx context.Context) {
+		service.SchedulePosts(ctx, hub.AnnouncePost)
+	})
+
+	// Delete the accounts whose grace period is over
+	runJob(func(ctx context.Context) {
+		service.PurgeAccounts(ctx, uploads, hub.Disconnect)
+	})
+
 	// Initialize WebSocket hub
 	log.Println("🔵 Starting WebSocket Hub...")
-	go websocket.ChatHub.Run()
+	hub.Start()
 	log.Println("✅ WebSocket Hub started")
 
 	// Start the server
-	log.Println("Server started on http://localhost:8080")
-	err := http.ListenAndServe(":8080", nil)
+	host := cfg.ListenAddr
+	if strings.HasPrefix(host, ":") {
+		host = "localhost" + host
+	}
+
+	srv := &http.Server{Addr: cfg.ListenAddr}
+	serveErr := make(chan error, 1)
+	go func() {
+		if cfg.TLS.Enabled() {
+			log.Printf("Server started on https://%s", host)
+			serveErr <- srv.ListenAndServeTLS(cfg.TLS.CertFile, cfg.TLS.KeyFile)
+		} else {
+			log.Printf("Server started on http://%s", host)
+			serveErr <- srv.ListenAndServe()
+		}
+	}()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(stop)
+
+	select {
+	case err := <-serveErr:
+		return fmt.Errorf("server error: %w", err)
+	case sig := <-stop:
+		log.Printf("🔴 Received %s, shutting down...", sig)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.ShutdownTimeout))
+	defer cancel()
+
+	// Stop accepting connections and let in-flight requests finish
+	if err := srv.Shutdown(ctx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Printf("⚠️ HTTP shutdown did not complete: %v", err)
+	}
+
+	stopJobs()
+
+	// WebSockets are hijacked connections the HTTP server no longer tracks
+	if err := hub.Shutdown(ctx); err != nil {
+		log.Printf("⚠️ WebSocket shutdown did not complete: %v", err)
+	}
+
+	log.Println("✅ Server stopped")
+	return nil
+}
+
+// newBlobStore opens the store of uploads.
+func newBlobStore(cfg config.Uploads) (blob.Store, error) {
+	if cfg.Store == "s3" {
+		store, err := blob.NewS3Store(blob.S3Config(cfg.S3))
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("📦 Storing uploads in S3 bucket %s at %s", cfg.S3.Bucket, cfg.S3.Endpoint)
+		return store, nil
+	}
+	return blob.NewLocalStore(cfg.Dir)
+}
+
+// newMailer returns nil, sending no mail, when no SMTP host is set.
+func newMailer(cfg config.Mail) (mail.Sender, error) {
+	if cfg.Host == "" {
+		log.Println("⚠️ No SMTP host: the server sends no mail and emails cannot be changed")
+		return nil, nil
+	}
+	sender, err := mail.NewSMTPSender(mail.SMTPConfig(cfg))
 	if err != nil {
-		log.Fatal("Server error:", err)
+		return nil, err
 	}
+	log.Printf("📧 Sending mail through %s", sender.Addr())
+	return sender, nil
 }
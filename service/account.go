@@ -0,0 +1,218 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"realtimeforum/database"
+	"realtimeforum/mail"
+	"realtimeforum/model"
+	"realtimeforum/utils"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+// BioMax is the longest bio, in characters.
+const BioMax = 500
+
+// EmailChangeLifetime is how long a new email can be confirmed.
+const EmailChangeLifetime = 24 * time.Hour
+
+// ErrWrongPassword is a current password that does not match.
+var ErrWrongPassword = errors.New("current password is incorrect")
+
+// Errors of email changes: a server without a mail.Sender cannot confirm
+// new emails, and ErrMailNotSent wraps the error of a sender that failed.
+var (
+	ErrNoMailer    = errors.New("email changes are turned off: the server sends no mail")
+	ErrMailNotSent = errors.New("the confirmation email could not be sent")
+)
+
+// ProfileInput changes the public details of an account. Fields left
+// out keep their value.
+type ProfileInput struct {
+	FirstName *string `json:"first_name"`
+	LastName  *string `json:"last_name"`
+	Username  *string `json:"username"`
+	Bio       *string `json:"bio"`
+}
+
+// UpdateProfile applies input to the account of userID and returns it
+// updated. Invalid fields are ValidationErrors with the messages of
+// registration; a username in use is database.ErrUsernameTaken.
+func UpdateProfile(userID string, input ProfileInput) (*model.User, error) {
+	user, err := database.Users.GetByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var problems ValidationErrors
+	if input.FirstName != nil {
+		user.FirstName = strings.TrimSpace(*input.FirstName)
+		if err := utils.ValidateName("first name", user.FirstName); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	if input.LastName != nil {
+		user.LastName = strings.TrimSpace(*input.LastName)
+		if err := utils.ValidateName("last name", user.LastName); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	renamed := false
+	if input.Username != nil {
+		username := strings.TrimSpace(*input.Username)
+		renamed = username != user.Username
+		user.Username = username
+		if err := utils.ValidateUsername(username); err != nil {
+			problems = append(problems, err.Error())
+			renamed = false
+		}
+	}
+	if input.Bio != nil {
+		user.Bio = strings.TrimSpace(*input.Bio)
+		if utf8.RuneCountInString(user.Bio) > BioMax {
+			problems = append(problems, fmt.Sprintf("bio must be at most %d characters", BioMax))
+		}
+	}
+	if len(problems) > 0 {
+		return nil, problems
+	}
+
+	// Usernames and emails share the login field, so neither may be the
+	// other's
+	if renamed {
+		if existingID, err := database.Users.IDByIdentity(user.Username); err != nil {
+			return nil, err
+		} else if existingID != "" && existingID != userID {
+			return nil, database.ErrUsernameTaken
+		}
+	}
+	if err := database.Users.Update(userID, user.FirstName, user.LastName, user.Username, user.Bio); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// ChangeEmail starts replacing the email of userID: the new one is only
+// used once confirmed with the token mailer sends to it. Without a mailer
+// it is ErrNoMailer.
+func ChangeEmail(ctx context.Context, mailer mail.Sender, userID, email string) error {
+	if mailer == nil {
+		return ErrNoMailer
+	}
+	user, err := database.Users.GetByID(userID)
+	if err != nil {
+		return err
+	}
+	email = strings.TrimSpace(email)
+	if err := utils.ValidateEmail(email); err != nil {
+		return ValidationErrors{err.Error()}
+	}
+	if strings.EqualFold(email, user.Email) {
+		return ValidationErrors{"this is already your email"}
+	}
+	if existingID, err := database.Users.IDByIdentity(email); err != nil {
+		return err
+	} else if existingID != "" {
+		return database.ErrEmailTaken
+	}
+
+	token := uuid.New().String()
+	if err := database.Users.RequestEmailChange(userID, email, token, time.Now().Add(EmailChangeLifetime)); err != nil {
+		return err
+	}
+	err = mailer.Send(ctx, mail.Message{
+		To:      email,
+		Subject: "Confirm your new email",
+		Body: fmt.Sprintf("Hello %s,\n\n"+
+			"To use %s for your forum account, confirm it within %d hours with this code:\n\n"+
+			"%s\n\n"+
+			"The forum takes it at POST /api/account/email/verify as {\"token\": \"<code>\"}, logged in or not.\n"+
+			"If you did not ask for this change, ignore this email and your account keeps its current one.\n",
+			user.Username, email, int(EmailChangeLifetime.Hours()), token),
+	})
+	if err != nil {
+		// The token reached no one, so nothing waits for it
+		if cancelErr := database.Users.CancelEmailChange(userID, token); cancelErr != nil {
+			log.Printf("⚠️ Could not cancel the email change of %s: %v", userID, cancelErr)
+		}
+		return fmt.Errorf("%w: %w", ErrMailNotSent, err)
+	}
+	return nil
+}
+
+// ConfirmEmail makes the email waiting for token the one of its user.
+func ConfirmEmail(token string) error {
+	if strings.TrimSpace(token) == "" {
+		return database.ErrInvalidToken
+	}
+	userID, err := database.Users.ConfirmEmailChange(token)
+	if err != nil {
+		return err
+	}
+	log.Printf("📧 Email of user %s confirmed", userID)
+	return nil
+}
+
+// ChangePassword replaces the password of userID, given the current one,
+// and signs out every session but keepToken.
+func ChangePassword(userID, current, next, keepToken string) error {
+	user, err := database.Users.GetByID(userID)
+	if err != nil {
+		return err
+	}
+	if !utils.CheckPasswordHash(current, user.PasswordHash) {
+		return ErrWrongPassword
+	}
+	if err := utils.ValidatePassword(next); err != nil {
+		return ValidationErrors{err.Error()}
+	}
+	hash, err := utils.HashPassword(next)
+	if err != nil {
+		return err
+	}
+	return database.Users.SetPassword(userID, hash, keepToken)
+}
+
+// SetAvatar uploads an image and makes it the avatar of userID, deleting
+// the previous one.
+func SetAvatar(ctx context.Context, uploads *Uploads, userID, filename string, data []byte) (*model.Attachment, error) {
+	if len(data) > 0 && !strings.HasPrefix(sniffType(data), "image/") {
+		return nil, uploadProblem(ErrFileNotAllowed, "avatar must be an image")
+	}
+	attachment, err := uploads.Upload(ctx, userID, filename, data)
+	if err != nil {
+		return nil, err
+	}
+	previous, err := database.Users.SetAvatar(userID, attachment.ID)
+	if err != nil {
+		uploads.Delete(attachment.ID, userID)
+		return nil, err
+	}
+	deleteAvatar(uploads, userID, previous)
+	return attachment, nil
+}
+
+// RemoveAvatar deletes the avatar of userID, if any.
+func RemoveAvatar(uploads *Uploads, userID string) error {
+	previous, err := database.Users.SetAvatar(userID, "")
+	if err != nil {
+		return err
+	}
+	deleteAvatar(uploads, userID, previous)
+	return nil
+}
+
+func deleteAvatar(uploads *Uploads, userID, id string) {
+	if id == "" {
+		return
+	}
+	if err := uploads.Delete(id, userID); err != nil && !errors.Is(err, database.ErrAttachmentNotFound) {
+		log.Printf("⚠️ Could not delete the previous avatar %s: %v", id, err)
+	}
+}
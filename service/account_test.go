@@ -0,0 +1,208 @@
+package service_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/png"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"realtimeforum/database"
+	"realtimeforum/mail"
+	"realtimeforum/service"
+	"realtimeforum/utils"
+)
+
+// mailbox is a mail.Sender keeping what it is given, or failing with err.
+type mailbox struct {
+	sent []mail.Message
+	err  error
+}
+
+func (m *mailbox) Send(_ context.Context, msg mail.Message) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+var tokenPattern = regexp.MustCompile(`[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}`)
+
+// token is the confirmation token of the last message sent.
+func (m *mailbox) token(t *testing.T) string {
+	t.Helper()
+	if len(m.sent) == 0 {
+		t.Fatal("no email sent")
+	}
+	token := tokenPattern.FindString(m.sent[len(m.sent)-1].Body)
+	if token == "" {
+		t.Fatal("the email holds no token")
+	}
+	return token
+}
+
+func TestUpdateProfile(t *testing.T) {
+	f := newFixture(t)
+
+	name, renamed := "Erin", "erin_renamed"
+	updated, err := service.UpdateProfile(f.alice.ID, service.ProfileInput{FirstName: &name, Username: &renamed})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "username", updated.Username, renamed)
+	expect(t, "first name", updated.FirstName, "Erin")
+	expect(t, "last name kept", updated.LastName, "Last")
+
+	badName, bio := "no spaces allowed", strings.Repeat("b", service.BioMax+1)
+	_, err = service.UpdateProfile(f.alice.ID, service.ProfileInput{Username: &badName, Bio: &bio})
+	var problems service.ValidationErrors
+	if !errors.As(err, &problems) {
+		t.Fatalf("got %v, want validation errors", err)
+	}
+	expect(t, "invalid fields", len(problems), 2)
+	expect(t, "invalid username message", problems[0], "username can only contain letters, numbers and underscores")
+
+	taken := createUser(t, "carol").Username
+	_, err = service.UpdateProfile(f.alice.ID, service.ProfileInput{Username: &taken})
+	expectError(t, "username taken", err, database.ErrUsernameTaken)
+}
+
+// TestChangeEmail checks that the email only changes once confirmed with
+// the token mailed to it, and that each token works once.
+func TestChangeEmail(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+	mailer := &mailbox{}
+
+	if err := service.ChangeEmail(ctx, mailer, f.alice.ID, "alice_new@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "emails sent", len(mailer.sent), 1)
+	expect(t, "sent to", mailer.sent[0].To, "alice_new@example.com")
+	token := mailer.token(t)
+	pending, err := database.Users.PendingEmail(f.alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, err := database.Users.GetByID(f.alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "pending email", pending, "alice_new@example.com")
+	expect(t, "email before confirmation", before.Email, f.alice.Email)
+
+	expectError(t, "email taken", service.ChangeEmail(ctx, mailer, f.alice.ID, f.bob.Email), database.ErrEmailTaken)
+	if err := service.ConfirmEmail(token); err != nil {
+		t.Fatal(err)
+	}
+	expectError(t, "token reused", service.ConfirmEmail(token), database.ErrInvalidToken)
+	if err := database.Users.RequestEmailChange(f.alice.ID, "late@example.com", "expired", time.Now().Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	expectError(t, "token expired", service.ConfirmEmail("expired"), database.ErrInvalidToken)
+	after, err := database.Users.GetByID(f.alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "confirmed email", after.Email, "alice_new@example.com")
+}
+
+func TestChangeEmailNeedsAMailer(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+
+	expectError(t, "no mailer", service.ChangeEmail(ctx, nil, f.bob.ID, "bob_new@example.com"), service.ErrNoMailer)
+	failing := &mailbox{err: errors.New("connection refused")}
+	expectError(t, "failed mailer", service.ChangeEmail(ctx, failing, f.bob.ID, "bob_new@example.com"), service.ErrMailNotSent)
+
+	// Nothing waits for a confirmation that was never sent
+	pending, err := database.Users.PendingEmail(f.bob.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "pending email", pending, "")
+}
+
+func TestChangePassword(t *testing.T) {
+	f := newFixture(t)
+	hash, err := utils.HashPassword("old password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.Users.SetPassword(f.alice.ID, hash, ""); err != nil {
+		t.Fatal(err)
+	}
+	for _, token := range []string{"kept", "other"} {
+		if err := database.Sessions.Create(f.alice.ID, token, time.Now().Add(time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expectError(t, "wrong current password", service.ChangePassword(f.alice.ID, "not the password", "new password", "kept"), service.ErrWrongPassword)
+	var problems service.ValidationErrors
+	if err := service.ChangePassword(f.alice.ID, "old password", "short", "kept"); !errors.As(err, &problems) {
+		t.Errorf("short password: got %v, want validation errors", err)
+	}
+	if err := service.ChangePassword(f.alice.ID, "old password", "new password", "kept"); err != nil {
+		t.Fatal(err)
+	}
+	_, _, keptErr := database.Sessions.Lookup("kept")
+	_, _, otherErr := database.Sessions.Lookup("other")
+	changed, err := database.Users.GetByID(f.alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "new password", utils.CheckPasswordHash("new password", changed.PasswordHash), true)
+	expect(t, "current session kept", keptErr, nil)
+	expectError(t, "other session signed out", otherErr, database.ErrSessionNotFound)
+}
+
+func TestAvatar(t *testing.T) {
+	f := newFixture(t)
+	uploads := newUploads(t)
+	ctx := context.Background()
+	var picture bytes.Buffer
+	if err := png.Encode(&picture, image.NewGray(image.Rect(0, 0, 64, 64))); err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := service.SetAvatar(ctx, uploads, f.alice.ID, "me.png", picture.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, notImage := service.SetAvatar(ctx, uploads, f.alice.ID, "me.txt", []byte("Not a picture"))
+	second, err := service.SetAvatar(ctx, uploads, f.alice.ID, "me.png", picture.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, replaced := database.Attachments.Get(first.ID, f.alice.ID)
+	_, seen := database.Attachments.Get(second.ID, f.bob.ID)
+	_, deleteAvatar := database.Attachments.Delete(second.ID, f.alice.ID)
+	_, attachAvatar := service.CreatePost(f.alice.ID, service.PostInput{
+		Title:         "Avatar post",
+		Content:       "Posting my own avatar again",
+		Topics:        []service.TopicRef{{ID: f.topicIDs[0]}, {ID: f.topicIDs[1]}, {ID: f.topicIDs[2]}},
+		AttachmentIDs: []string{second.ID},
+	})
+	if err := service.RemoveAvatar(uploads, f.alice.ID); err != nil {
+		t.Fatal(err)
+	}
+	_, removed := database.Attachments.Get(second.ID, f.alice.ID)
+	withoutAvatar, err := database.Users.GetByID(f.alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectError(t, "not an image", notImage, service.ErrFileNotAllowed)
+	expectError(t, "replaced avatar deleted", replaced, database.ErrAttachmentNotFound)
+	expect(t, "avatar seen by others", seen, nil)
+	expectError(t, "avatar deleted as an upload", deleteAvatar, database.ErrAttachmentNotFound)
+	expect(t, "avatar attached to a post", attachAvatar != nil, true)
+	expectError(t, "removed avatar deleted", removed, database.ErrAttachmentNotFound)
+	expect(t, "avatar cleared", withoutAvatar.AvatarID, "")
+}
@@ -0,0 +1,264 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"realtimeforum/blob"
+	"realtimeforum/database"
+	"realtimeforum/model"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// Limits of uploads.
+const (
+	DefaultMaxUploadSize = 10 << 20
+	MaxAttachments       = 10
+	// MaxImagePixels keeps a small file from decoding to a huge image
+	MaxImagePixels = 40_000_000
+	ThumbnailSize  = 320
+	FilenameMax    = 255
+)
+
+// Upload wraps these around the ValidationErrors of a file that is too
+// large or of a type that is not allowed, so that they can be told apart
+// from other problems.
+var (
+	ErrFileTooLarge   = errors.New("file too large")
+	ErrFileNotAllowed = errors.New("file type not allowed")
+)
+
+// uploadTypes are the types files may have, as sniffed from their first
+// bytes, with the extension of their default name.
+var uploadTypes = map[string]string{
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+	"image/gif":       ".gif",
+	"image/webp":      ".webp",
+	"application/pdf": ".pdf",
+	"text/plain":      ".txt",
+}
+
+// Uploads stores the files users attach to posts and messages.
+type Uploads struct {
+	store   blob.Store
+	maxSize int64
+}
+
+// NewUploads keeps uploads in store, accepting files of up to maxSize
+// bytes, or DefaultMaxUploadSize when maxSize is not positive.
+func NewUploads(store blob.Store, maxSize int64) *Uploads {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxUploadSize
+	}
+	return &Uploads{store: store, maxSize: maxSize}
+}
+
+// MaxSize is the largest upload accepted, in bytes.
+func (u *Uploads) MaxSize() int64 {
+	return u.maxSize
+}
+
+// Upload checks and stores a file of userID, with a thumbnail for images,
+// and records it unattached. The type comes from the content, whatever
+// the name says; problems with the file are ValidationErrors, wrapped
+// with ErrFileTooLarge or ErrFileNotAllowed where they apply.
+func (u *Uploads) Upload(ctx context.Context, userID, filename string, data []byte) (*model.Attachment, error) {
+	if len(data) == 0 {
+		return nil, ValidationErrors{"The file is empty"}
+	}
+	if int64(len(data)) > u.maxSize {
+		return nil, uploadProblem(ErrFileTooLarge, fmt.Sprintf("Files must be at most %d MB", u.maxSize>>20))
+	}
+
+	contentType := sniffType(data)
+	ext, ok := uploadTypes[contentType]
+	if !ok {
+		return nil, uploadProblem(ErrFileNotAllowed, fmt.Sprintf("Files of type %s are not allowed", contentType))
+	}
+
+	attachment := &database.StoredAttachment{
+		Attachment: model.Attachment{
+			ID:          uuid.New().String(),
+			Filename:    cleanFilename(filename, ext),
+			ContentType: contentType,
+			Size:        int64(len(data)),
+		},
+		UserID: userID,
+	}
+	attachment.BlobKey = "attachments/" + attachment.ID + "/original"
+
+	var thumbnail []byte
+	if strings.HasPrefix(contentType, "image/") {
+		config, _, err := image.DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			return nil, ValidationErrors{"The image could not be read"}
+		}
+		if config.Width*config.Height > MaxImagePixels {
+			return nil, uploadProblem(ErrFileTooLarge, fmt.Sprintf("Images must be at most %d megapixels", MaxImagePixels/1_000_000))
+		}
+		attachment.Width, attachment.Height = config.Width, config.Height
+
+		thumbnail, err = makeThumbnail(data, contentType)
+		if err != nil {
+			return nil, ValidationErrors{"The image could not be read"}
+		}
+		attachment.ThumbnailKey = "attachments/" + attachment.ID + "/thumbnail"
+	}
+
+	if err := u.store.Put(ctx, attachment.BlobKey, data, contentType); err != nil {
+		return nil, err
+	}
+	if thumbnail != nil {
+		if err := u.store.Put(ctx, attachment.ThumbnailKey, thumbnail, ThumbnailType(contentType)); err != nil {
+			u.deleteBlobs(attachment)
+			return nil, err
+		}
+	}
+	if err := database.Attachments.Create(attachment); err != nil {
+		u.deleteBlobs(attachment)
+		return nil, err
+	}
+	return &attachment.Attachment, nil
+}
+
+// Open returns an attachment userID may see with its content, or its
+// thumbnail, to be closed by the caller.
+func (u *Uploads) Open(ctx context.Context, id, userID string, thumbnail bool) (*database.StoredAttachment, io.ReadCloser, error) {
+	attachment, err := database.Attachments.Get(id, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	key := attachment.BlobKey
+	if thumbnail {
+		if attachment.ThumbnailKey == "" {
+			return nil, nil, database.ErrAttachmentNotFound
+		}
+		key = attachment.ThumbnailKey
+	}
+	content, err := u.store.Get(ctx, key)
+	if errors.Is(err, blob.ErrNotFound) {
+		return nil, nil, database.ErrAttachmentNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return attachment, content, nil
+}
+
+// Delete removes an upload of userID that is attached to nothing.
+func (u *Uploads) Delete(id, userID string) error {
+	attachment, err := database.Attachments.Delete(id, userID)
+	if err != nil {
+		return err
+	}
+	u.deleteBlobs(attachment)
+	return nil
+}
+
+// ThumbnailType is the type of the thumbnails of images of contentType:
+// PNG keeps the transparency of PNG and GIF images.
+func ThumbnailType(contentType string) string {
+	if contentType == "image/png" || contentType == "image/gif" {
+		return "image/png"
+	}
+	return "image/jpeg"
+}
+
+// checkAttachments limits how many files go with a post or message.
+func checkAttachments(ids []string) ValidationErrors {
+	if len(ids) > MaxAttachments {
+		return ValidationErrors{fmt.Sprintf("At most %d attachments are allowed", MaxAttachments)}
+	}
+	return nil
+}
+
+func (u *Uploads) deleteBlobs(attachment *database.StoredAttachment) {
+	for _, key := range []string{attachment.BlobKey, attachment.ThumbnailKey} {
+		if key == "" {
+			continue
+		}
+		if err := u.store.Delete(context.Background(), key); err != nil && !errors.Is(err, blob.ErrNotFound) {
+			log.Printf("⚠️ Could not delete blob %s: %v", key, err)
+		}
+	}
+}
+
+// uploadProblem is the ValidationErrors of message, wrapped with kind.
+func uploadProblem(kind error, message string) error {
+	return fmt.Errorf("%w: %w", kind, ValidationErrors{message})
+}
+
+// sniffType names the type of data from its first bytes, without
+// parameters. Text is only text in UTF-8.
+func sniffType(data []byte) string {
+	contentType := http.DetectContentType(data)
+	if contentType == "text/plain; charset=utf-8" {
+		return "text/plain"
+	}
+	return contentType
+}
+
+// cleanFilename keeps the base name of filename without control
+// characters, shortened, or names the file after its type.
+func cleanFilename(filename, ext string) string {
+	name := strings.TrimSpace(filepath.Base(strings.ReplaceAll(filename, "\\", "/")))
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == '"' {
+			return -1
+		}
+		return r
+	}, name)
+	if name == "" || name == "." || name == "/" {
+		return "file" + ext
+	}
+	for utf8.RuneCountInString(name) > FilenameMax {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	return name
+}
+
+// makeThumbnail scales an image down to fit ThumbnailSize, keeping its
+// proportions; smaller images are only re-encoded.
+func makeThumbnail(data []byte, contentType string) ([]byte, error) {
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width > ThumbnailSize || height > ThumbnailSize {
+		if width >= height {
+			width, height = ThumbnailSize, max(1, height*ThumbnailSize/width)
+		} else {
+			width, height = max(1, width*ThumbnailSize/height), ThumbnailSize
+		}
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, draw.Src, nil)
+
+	var buf bytes.Buffer
+	if ThumbnailType(contentType) == "image/png" {
+		err = png.Encode(&buf, dst)
+	} else {
+		err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 80})
+	}
+	return buf.Bytes(), err
+}
@@ -0,0 +1,142 @@
+package service_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"testing"
+
+	"realtimeforum/blob"
+	"realtimeforum/database"
+	"realtimeforum/service"
+)
+
+func newUploads(t *testing.T) *service.Uploads {
+	t.Helper()
+	store, err := blob.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return service.NewUploads(store, 0)
+}
+
+func TestUploadChecksTheFile(t *testing.T) {
+	f := newFixture(t)
+	uploads := newUploads(t)
+
+	for _, tc := range []struct {
+		name string
+		data []byte
+		kind error
+	}{
+		{"empty", nil, nil},
+		{"too large", bytes.Repeat([]byte("x"), service.DefaultMaxUploadSize+1), service.ErrFileTooLarge},
+		{"executable", []byte("MZ\x90\x00\x03\x00\x00\x00\x04\x00"), service.ErrFileNotAllowed},
+		{"broken image", []byte("\x89PNG\r\n\x1a\nnot an image"), nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := uploads.Upload(context.Background(), f.alice.ID, tc.name, tc.data)
+			var problems service.ValidationErrors
+			if !errors.As(err, &problems) {
+				t.Fatalf("got %v, want validation errors", err)
+			}
+			for _, kind := range []error{service.ErrFileTooLarge, service.ErrFileNotAllowed} {
+				expect(t, fmt.Sprintf("is %v", kind), errors.Is(err, kind), kind == tc.kind)
+			}
+		})
+	}
+}
+
+func TestAttachments(t *testing.T) {
+	f := newFixture(t)
+	uploads := newUploads(t)
+	ctx := context.Background()
+	topics := []service.TopicRef{{ID: f.topicIDs[0]}, {ID: f.topicIDs[1]}, {ID: f.topicIDs[2]}}
+
+	var picture bytes.Buffer
+	if err := png.Encode(&picture, image.NewGray(image.Rect(0, 0, 640, 320))); err != nil {
+		t.Fatal(err)
+	}
+	photo, err := uploads.Upload(ctx, f.alice.ID, "../holiday.png", picture.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "image type", photo.ContentType, "image/png")
+	expect(t, "image size", fmt.Sprintf("%dx%d", photo.Width, photo.Height), "640x320")
+	expect(t, "filename", photo.Filename, "holiday.png")
+
+	notes, err := uploads.Upload(ctx, f.bob.ID, "notes.txt", []byte("Notes for alice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "text type", notes.ContentType, "text/plain")
+	expect(t, "text thumbnail", notes.ThumbnailURL, "")
+
+	// An upload is the uploader's alone until it is on a post
+	_, err = database.Attachments.Get(photo.ID, f.bob.ID)
+	expect(t, "unattached upload of another user", errors.Is(err, database.ErrAttachmentNotFound), true)
+
+	post, err := service.CreatePost(f.alice.ID, service.PostInput{
+		Title:         "Attachment post",
+		Content:       "A picture from the holidays",
+		Topics:        topics,
+		AttachmentIDs: []string{photo.ID},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "post attachments", len(post.Attachments), 1)
+	_, err = service.CreatePost(f.alice.ID, service.PostInput{
+		Title:         "Reused attachment post",
+		Content:       "The same picture once more",
+		Topics:        topics,
+		AttachmentIDs: []string{photo.ID},
+	})
+	var problems service.ValidationErrors
+	expect(t, "reused attachment error", errors.As(err, &problems), true)
+
+	onPost, err := database.Attachments.Get(photo.ID, f.bob.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "attachment post", onPost.PostID, post.ID)
+	_, err = database.Attachments.Delete(photo.ID, f.alice.ID)
+	expect(t, "delete of an attached upload", errors.Is(err, database.ErrAttachmentNotFound), true)
+
+	_, thumbnail, err := uploads.Open(ctx, photo.ID, f.bob.ID, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	size, _, err := image.DecodeConfig(thumbnail)
+	thumbnail.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "thumbnail size", fmt.Sprintf("%dx%d", size.Width, size.Height), "320x160")
+
+	// On a chat message it is seen by the sender and the receiver only
+	carol := createUser(t, "carol")
+	message, err := database.Chat.SaveMessage(f.bob.ID, f.alice.ID, "See attached", notes.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "message attachments", len(message.Attachments), 1)
+	if _, err := database.Attachments.Get(notes.ID, f.alice.ID); err != nil {
+		t.Errorf("receiver: %v", err)
+	}
+	_, err = database.Attachments.Get(notes.ID, carol.ID)
+	expect(t, "message attachment of an outsider", errors.Is(err, database.ErrAttachmentNotFound), true)
+
+	spare, err := uploads.Upload(ctx, f.alice.ID, "spare.txt", []byte("Not needed after all"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := uploads.Delete(spare.ID, f.alice.ID); err != nil {
+		t.Fatal(err)
+	}
+	_, err = database.Attachments.Get(spare.ID, f.alice.ID)
+	expect(t, "deleted upload", errors.Is(err, database.ErrAttachmentNotFound), true)
+}
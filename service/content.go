@@ -0,0 +1,27 @@
+package service
+
+import (
+	"realtimeforum/database"
+	"realtimeforum/markdown"
+	"realtimeforum/model"
+)
+
+// NewContent prepares text written in format, plain text when empty, for
+// storage. Plain text has no HTML; clients show it as text. Markdown is
+// opt-in, so clients that predate formats keep posting what they mean.
+func NewContent(text, format string) (database.Content, error) {
+	content := database.Content{Text: text, Format: format}
+	switch format {
+	case model.ContentMarkdown:
+		html, err := markdown.Render(text)
+		if err != nil {
+			return content, err
+		}
+		content.HTML = html
+	case "", model.ContentPlain:
+		content.Format = model.ContentPlain
+	default:
+		return content, ValidationErrors{"Format must be " + model.ContentMarkdown + " or " + model.ContentPlain}
+	}
+	return content, nil
+}
@@ -0,0 +1,66 @@
+package service_test
+
+import (
+	"errors"
+	"testing"
+
+	"realtimeforum/model"
+	"realtimeforum/service"
+)
+
+func TestNewContent(t *testing.T) {
+	for _, tc := range []struct {
+		name, format     string
+		wantFormat, html string
+	}{
+		{"plain by default", "", model.ContentPlain, ""},
+		{"plain", model.ContentPlain, model.ContentPlain, ""},
+		{"markdown", model.ContentMarkdown, model.ContentMarkdown, "<p>Some <em>emphasis</em></p>\n"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			content, err := service.NewContent("Some *emphasis*", tc.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expect(t, "text", content.Text, "Some *emphasis*")
+			expect(t, "format", content.Format, tc.wantFormat)
+			expect(t, "HTML", content.HTML, tc.html)
+		})
+	}
+
+	_, err := service.NewContent("text", "html")
+	var problems service.ValidationErrors
+	if !errors.As(err, &problems) {
+		t.Errorf("unknown format: got %v, want validation errors", err)
+	}
+}
+
+func TestMarkdownPost(t *testing.T) {
+	f := newFixture(t)
+	source := "Some *emphasis*, [a link](https://example.com) and <script>alert(1)</script>"
+	topics := []service.TopicRef{{ID: f.topicIDs[0]}, {ID: f.topicIDs[1]}, {ID: f.topicIDs[2]}}
+
+	post, err := service.CreatePost(f.alice.ID, service.PostInput{
+		Title:   "Markdown post",
+		Content: source,
+		Format:  model.ContentMarkdown,
+		Topics:  topics,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "format", post.ContentFormat, model.ContentMarkdown)
+	expect(t, "source", post.Content, source)
+	expect(t, "HTML", post.ContentHTML, `<p>Some <em>emphasis</em>, <a href="https://example.com" rel="nofollow ugc">a link</a> and &lt;script&gt;alert(1)&lt;/script&gt;</p>`+"\n")
+
+	plain, err := service.CreatePost(f.alice.ID, service.PostInput{
+		Title:   "Plain post",
+		Content: source,
+		Topics:  topics,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "default format", plain.ContentFormat, model.ContentPlain)
+	expect(t, "plain HTML", plain.ContentHTML, "")
+}
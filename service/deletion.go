@@ -0,0 +1,187 @@
+package service
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"realtimeforum/database"
+	"realtimeforum/model"
+	"realtimeforum/utils"
+	"time"
+)
+
+// DeletionGracePeriod is how long an account waits for deletion, during
+// which its user can log in and change their mind.
+const DeletionGracePeriod = 14 * 24 * time.Hour
+
+// PurgeInterval is how often PurgeAccounts looks for accounts that are
+// due for deletion.
+var PurgeInterval = time.Hour
+
+// RequestDeletion schedules the account of userID for deletion after
+// DeletionGracePeriod, given its password, and returns when.
+func RequestDeletion(userID, password string) (time.Time, error) {
+	user, err := database.Users.GetByID(userID)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if !utils.CheckPasswordHash(password, user.PasswordHash) {
+		return time.Time{}, ErrWrongPassword
+	}
+	at := time.Now().Add(DeletionGracePeriod)
+	if err := database.Users.ScheduleDeletion(userID, at); err != nil {
+		return time.Time{}, err
+	}
+	log.Printf("🗑️ Account %s will be deleted on %s", userID, at.Format(time.RFC3339))
+	return at, nil
+}
+
+// CancelDeletion keeps the account of userID.
+func CancelDeletion(userID string) error {
+	return database.Users.ScheduleDeletion(userID, time.Time{})
+}
+
+// DeleteAccount deletes the account of userID now: its sessions are
+// signed out, disconnect closes its live connections, its scheduled
+// posts are cancelled and its published posts and comments are kept
+// under database.DeletedUsername. Its files are deleted from uploads.
+func DeleteAccount(uploads *Uploads, userID string, disconnect func(userID string)) error {
+	if userID == database.DeletedUserID {
+		return database.ErrForbidden
+	}
+	scheduled, err := database.Posts.Scheduled(userID)
+	if err != nil {
+		return err
+	}
+	for _, post := range scheduled {
+		if err := CancelScheduled(uploads, userID, post.ID); err != nil && !errors.Is(err, database.ErrPostNotFound) && !errors.Is(err, database.ErrPostPublished) {
+			return err
+		}
+	}
+
+	if _, err := database.Sessions.DeleteForUser(userID); err != nil {
+		return err
+	}
+	if disconnect != nil {
+		disconnect(userID)
+	}
+	attachments, err := database.Users.Purge(userID)
+	if err != nil {
+		return err
+	}
+	for i := range attachments {
+		uploads.deleteBlobs(&attachments[i])
+	}
+	log.Printf("🗑️ Deleted account %s", userID)
+	return nil
+}
+
+// PurgeAccounts deletes the accounts whose grace period is over every
+// PurgeInterval until ctx is cancelled, calling disconnect with each.
+func PurgeAccounts(ctx context.Context, uploads *Uploads, disconnect func(userID string)) {
+	ticker := time.NewTicker(PurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		ids, err := database.Users.DueForDeletion(time.Now())
+		if err != nil {
+			log.Printf("❌ Looking for accounts to delete failed: %v", err)
+			continue
+		}
+		for _, id := range ids {
+			if err := DeleteAccount(uploads, id, disconnect); err != nil {
+				log.Printf("❌ Deleting account %s failed: %v", id, err)
+			}
+		}
+	}
+}
+
+// AccountExport is everything the forum keeps about a user.
+type AccountExport struct {
+	ExportedAt time.Time           `json:"exported_at"`
+	Profile    *model.User         `json:"profile"`
+	Posts      []model.Post        `json:"posts"`
+	Comments   []model.Comment     `json:"comments"`
+	Messages   []model.ChatMessage `json:"messages"`
+	Sessions   []ExportedSession   `json:"sessions"`
+}
+
+// ExportedSession is a login, without its token.
+type ExportedSession struct {
+	CreatedAt time.Time `json:"created_at"`
+	Expiry    time.Time `json:"expiry"`
+}
+
+// ExportAccount gathers the profile, posts, comments, chat messages and
+// sessions of userID.
+func ExportAccount(userID string) (*AccountExport, error) {
+	export := AccountExport{
+		ExportedAt: time.Now(),
+		Sessions:   []ExportedSession{},
+	}
+	var err error
+	if export.Profile, err = database.Users.GetByID(userID); err != nil {
+		return nil, err
+	}
+	if export.Posts, err = database.Posts.ByUser(userID, 0); err != nil {
+		return nil, err
+	}
+	if export.Comments, err = database.Comments.ByUser(userID); err != nil {
+		return nil, err
+	}
+	if export.Messages, err = database.Chat.Messages(userID); err != nil {
+		return nil, err
+	}
+	// Empty parts are empty lists in the archive, not null
+	if export.Posts == nil {
+		export.Posts = []model.Post{}
+	}
+	if export.Comments == nil {
+		export.Comments = []model.Comment{}
+	}
+	sessions, err := database.Sessions.List(userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, session := range sessions {
+		export.Sessions = append(export.Sessions, ExportedSession{CreatedAt: session.CreatedAt, Expiry: session.Expiry})
+	}
+	return &export, nil
+}
+
+// WriteZip writes the export as a ZIP archive with one JSON file per
+// part.
+func (e *AccountExport) WriteZip(w io.Writer) error {
+	archive := zip.NewWriter(w)
+	files := []struct {
+		name string
+		data interface{}
+	}{
+		{"profile.json", e.Profile},
+		{"posts.json", e.Posts},
+		{"comments.json", e.Comments},
+		{"messages.json", e.Messages},
+		{"sessions.json", e.Sessions},
+	}
+	for _, file := range files {
+		f, err := archive.CreateHeader(&zip.FileHeader{Name: file.name, Method: zip.Deflate, Modified: e.ExportedAt})
+		if err != nil {
+			return err
+		}
+		encoder := json.NewEncoder(f)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(file.data); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
@@ -0,0 +1,220 @@
+package service_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"realtimeforum/database"
+	"realtimeforum/service"
+	"realtimeforum/utils"
+)
+
+func TestExportAccount(t *testing.T) {
+	f := newFixture(t)
+	uploads := newUploads(t)
+	if _, err := service.CreatePost(f.bob.ID, service.PostInput{
+		Title:   "Bob's only post",
+		Content: "Something worth exporting",
+		Topics:  []service.TopicRef{{ID: f.topicIDs[0]}, {ID: f.topicIDs[1]}, {ID: f.topicIDs[2]}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.Comments.Create(plain("Bob's only comment"), f.bob.ID, f.postID); err != nil {
+		t.Fatal(err)
+	}
+	for _, message := range []struct{ from, to string }{{f.bob.ID, f.alice.ID}, {f.alice.ID, f.bob.ID}} {
+		if _, err := database.Chat.SaveMessage(message.from, message.to, "Hello"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := database.Sessions.Create(f.bob.ID, "bob-session", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := uploads.Upload(context.Background(), f.bob.ID, "notes.txt", []byte("Private notes")); err != nil {
+		t.Fatal(err)
+	}
+
+	export, err := service.ExportAccount(f.bob.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var archive bytes.Buffer
+	if err := export.WriteZip(&archive); err != nil {
+		t.Fatal(err)
+	}
+	files, err := zip.NewReader(bytes.NewReader(archive.Bytes()), int64(archive.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "posts", len(export.Posts), 1)
+	expect(t, "comments", len(export.Comments), 1)
+	expect(t, "messages", len(export.Messages), 2)
+	expect(t, "sessions", len(export.Sessions), 1)
+	expect(t, "files", len(files.File), 5)
+	sessions, err := json.Marshal(export.Sessions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "session token left out", strings.Contains(string(sessions), "bob-session"), false)
+}
+
+func TestDeletionGracePeriod(t *testing.T) {
+	f := newFixture(t)
+	hash, err := utils.HashPassword("bob password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.Users.SetPassword(f.bob.ID, hash, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	_, wrong := service.RequestDeletion(f.bob.ID, "not the password")
+	expectError(t, "wrong password", wrong, service.ErrWrongPassword)
+	at, err := service.RequestDeletion(f.bob.ID, "bob password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dueNow, err := database.Users.DueForDeletion(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dueLater, err := database.Users.DueForDeletion(at.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "due during the grace period", slices.Contains(dueNow, f.bob.ID), false)
+	expect(t, "due after the grace period", slices.Contains(dueLater, f.bob.ID), true)
+
+	if err := service.CancelDeletion(f.bob.ID); err != nil {
+		t.Fatal(err)
+	}
+	cancelled, err := database.Users.GetByID(f.bob.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "deletion cancelled", cancelled.DeleteAfter == nil, true)
+}
+
+// TestDeleteAccount deletes bob, who posted, commented on alice's post,
+// chatted with her and uploaded a file.
+func TestDeleteAccount(t *testing.T) {
+	f := newFixture(t)
+	uploads := newUploads(t)
+	post, err := service.CreatePost(f.bob.ID, service.PostInput{
+		Title:   "Leaving soon",
+		Content: "My last post before leaving",
+		Topics:  []service.TopicRef{{ID: f.topicIDs[0]}, {ID: f.topicIDs[1]}, {ID: f.topicIDs[2]}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	commentID, err := database.Comments.Create(plain("My last comment"), f.bob.ID, f.postID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.Sessions.Create(f.bob.ID, "bob-session", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	upload, err := uploads.Upload(context.Background(), f.bob.ID, "notes.txt", []byte("Private notes"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The events the hub stores for alice, as it would
+	deliver := func(userID, eventType string, data interface{}) {
+		t.Helper()
+		payload, err := json.Marshal(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := database.Events.Append(userID, eventType, string(payload)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	goodbye, err := database.Chat.SaveMessage(f.bob.ID, f.alice.ID, "Goodbye alice, my secret is 1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+	deliver(f.alice.ID, "new_message", goodbye)
+	reply, err := database.Chat.SaveMessage(f.alice.ID, f.bob.ID, "Bye bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	deliver(f.bob.ID, "new_message", reply)
+	deliver(f.alice.ID, "messages_read", map[string]interface{}{"reader_id": f.bob.ID, "count": 1})
+	deliver(f.alice.ID, "notification", map[string]interface{}{
+		"kind": "comment", "post_id": f.postID, "post_title": "Fixture post", "comment_id": commentID, "user_id": f.bob.ID,
+	})
+	deliver(f.alice.ID, "notification", map[string]interface{}{"kind": "post_published", "post_id": f.postID, "post_title": "Fixture post"})
+
+	var disconnected string
+	if err := service.DeleteAccount(uploads, f.bob.ID, func(id string) { disconnected = id }); err != nil {
+		t.Fatal(err)
+	}
+	_, gone := database.Users.GetByID(f.bob.ID)
+	_, _, session := database.Sessions.Lookup("bob-session")
+	_, uploadGone := database.Attachments.Get(upload.ID, f.bob.ID)
+	kept, err := database.Posts.GetByID(post.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	comments, err := database.Comments.ByUser(database.DeletedUserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages, err := database.Chat.Messages(f.alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contacts, err := database.Chat.Contacts(f.alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, err := database.Events.Since(f.alice.ID, 0, time.Time{}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect(t, "disconnected", disconnected, f.bob.ID)
+	expectError(t, "account gone", gone, database.ErrUserNotFound)
+	expectError(t, "session gone", session, database.ErrSessionNotFound)
+	expectError(t, "upload gone", uploadGone, database.ErrAttachmentNotFound)
+	expect(t, "post kept", kept.Author, database.DeletedUsername)
+	expect(t, "comment kept", len(comments) == 1 && comments[0].ID == commentID && comments[0].Author == database.DeletedUsername, true)
+	expect(t, "messages gone", len(messages), 0)
+	for _, contact := range contacts {
+		if contact.Presence.UserID == f.bob.ID || contact.Presence.UserID == database.DeletedUserID {
+			t.Errorf("alice still lists %s", contact.Presence.UserID)
+		}
+	}
+
+	// Alice is replayed the notifications only, neither naming bob
+	var types []string
+	for _, event := range events {
+		types = append(types, event.Type)
+		payload := string(event.Data.(json.RawMessage))
+		if strings.Contains(payload, f.bob.ID) || strings.Contains(payload, "secret") {
+			t.Errorf("%s event still has bob's data: %s", event.Type, payload)
+		}
+	}
+	expect(t, "events left", strings.Join(types, ","), "notification,notification")
+	var commenter interface{}
+	for _, event := range events {
+		var notification map[string]interface{}
+		if err := json.Unmarshal(event.Data.(json.RawMessage), &notification); err != nil {
+			t.Fatal(err)
+		}
+		if notification["kind"] == "comment" {
+			commenter = notification["user_id"]
+		}
+	}
+	expect(t, "comment notification from", commenter, database.DeletedUserID)
+
+	expectError(t, "placeholder deleted", service.DeleteAccount(uploads, database.DeletedUserID, nil), database.ErrForbidden)
+}
@@ -0,0 +1,112 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"realtimeforum/database"
+	"realtimeforum/model"
+	"strings"
+	"unicode/utf8"
+)
+
+// MaxDrafts is how many drafts a user may keep.
+const MaxDrafts = 50
+
+// DraftInput is a save of a draft. Unlike a post it may be incomplete,
+// but not longer than a post may be. Revision is the revision the save
+// is based on; it is ignored when a draft is created.
+type DraftInput struct {
+	Title    string `json:"title"`
+	Content  string `json:"content"`
+	Format   string `json:"format"`
+	Topics   []int  `json:"topics"`
+	Revision int    `json:"revision"`
+}
+
+// CreateDraft stores a new draft of userID.
+func CreateDraft(userID string, input DraftInput) (*model.Draft, error) {
+	draft, err := newDraft(userID, input)
+	if err != nil {
+		return nil, err
+	}
+	count, err := database.Drafts.Count(userID)
+	if err != nil {
+		return nil, err
+	}
+	if count >= MaxDrafts {
+		return nil, ValidationErrors{fmt.Sprintf("You can keep at most %d drafts; publish or delete some first", MaxDrafts)}
+	}
+	return database.Drafts.Create(draft)
+}
+
+// SaveDraft replaces a draft of userID if nobody saved it since
+// input.Revision, or returns database.ErrDraftConflict.
+func SaveDraft(userID string, id int, input DraftInput) (*model.Draft, error) {
+	draft, err := newDraft(userID, input)
+	if err != nil {
+		return nil, err
+	}
+	return database.Drafts.Save(id, input.Revision, draft)
+}
+
+// PublishDraft creates a post from a draft of userID through CreatePost,
+// then deletes the draft, now or as scheduled. A revision other than 0
+// must be the current one, so that a device does not publish what it has
+// not seen.
+func PublishDraft(userID string, id, revision int, schedule ScheduleInput) (*model.Post, error) {
+	draft, err := database.Drafts.Get(id, userID)
+	if err != nil {
+		return nil, err
+	}
+	if revision != 0 && revision != draft.Revision {
+		return nil, database.ErrDraftConflict
+	}
+
+	input := PostInput{
+		Title:     draft.Title,
+		Content:   draft.Content,
+		Format:    draft.Format,
+		PublishAt: schedule.PublishAt,
+		ExpiresAt: schedule.ExpiresAt,
+	}
+	for _, topicID := range draft.Topics {
+		input.Topics = append(input.Topics, TopicRef{ID: topicID})
+	}
+	post, err := CreatePost(userID, input)
+	if err != nil {
+		return nil, err
+	}
+	if err := database.Drafts.Delete(id, userID); err != nil {
+		log.Printf("⚠️ Draft %d was published as post %d but not deleted: %v", id, post.ID, err)
+	}
+	return post, nil
+}
+
+func newDraft(userID string, input DraftInput) (database.NewDraft, error) {
+	draft := database.NewDraft{
+		UserID:   userID,
+		Title:    strings.TrimSpace(input.Title),
+		Content:  input.Content,
+		Format:   input.Format,
+		TopicIDs: input.Topics,
+	}
+
+	var problems ValidationErrors
+	if utf8.RuneCountInString(draft.Title) > TitleMax {
+		problems = append(problems, fmt.Sprintf("Title must be at most %d characters long", TitleMax))
+	}
+	if utf8.RuneCountInString(draft.Content) > ContentMax {
+		problems = append(problems, fmt.Sprintf("Content must be at most %d characters long", ContentMax))
+	}
+	switch draft.Format {
+	case "":
+		draft.Format = model.ContentPlain
+	case model.ContentMarkdown, model.ContentPlain:
+	default:
+		problems = append(problems, "Format must be "+model.ContentMarkdown+" or "+model.ContentPlain)
+	}
+	if len(problems) > 0 {
+		return draft, problems
+	}
+	return draft, nil
+}
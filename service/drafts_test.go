@@ -0,0 +1,134 @@
+package service_test
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"realtimeforum/database"
+	"realtimeforum/model"
+	"realtimeforum/service"
+)
+
+func TestDraftRevisions(t *testing.T) {
+	f := newFixture(t)
+	draft, err := service.CreateDraft(f.alice.ID, service.DraftInput{
+		Title:  "Half written",
+		Topics: []int{f.topicIDs[0], -1, f.topicIDs[0]},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "first revision", draft.Revision, 1)
+	expect(t, "known topics kept once", fmt.Sprint(draft.Topics), fmt.Sprint(f.topicIDs[:1]))
+	expect(t, "default format", draft.Format, model.ContentPlain)
+
+	// Two devices save on top of the first revision, the second one loses
+	input := service.DraftInput{
+		Title:    "Draft post",
+		Content:  "Content written on the first device",
+		Topics:   f.topicIDs,
+		Revision: draft.Revision,
+	}
+	saved, err := service.SaveDraft(f.alice.ID, draft.ID, input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "saved revision", saved.Revision, 2)
+	expect(t, "saved topics", len(saved.Topics), 3)
+	input.Content = "Content written on the second device"
+	_, err = service.SaveDraft(f.alice.ID, draft.ID, input)
+	expectError(t, "stale save", err, database.ErrDraftConflict)
+	_, err = service.PublishDraft(f.alice.ID, draft.ID, draft.Revision, service.ScheduleInput{})
+	expectError(t, "publish of an old revision", err, database.ErrDraftConflict)
+
+	current, err := database.Drafts.Get(draft.ID, f.alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "content after the conflict", current.Content, "Content written on the first device")
+	_, err = database.Drafts.Get(draft.ID, f.bob.ID)
+	expectError(t, "draft of another user", err, database.ErrDraftNotFound)
+	_, err = service.SaveDraft(f.bob.ID, draft.ID, service.DraftInput{Title: "Taken over", Revision: saved.Revision})
+	expectError(t, "save by another user", err, database.ErrDraftNotFound)
+
+	post, err := service.PublishDraft(f.alice.ID, draft.ID, saved.Revision, service.ScheduleInput{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "published content", post.Content, "Content written on the first device")
+	expect(t, "published topics", len(post.Topics), 3)
+	_, err = database.Drafts.Get(draft.ID, f.alice.ID)
+	expectError(t, "published draft", err, database.ErrDraftNotFound)
+}
+
+func TestDraftConcurrentSaves(t *testing.T) {
+	f := newFixture(t)
+	draft, err := service.CreateDraft(f.alice.ID, service.DraftInput{Title: "Contested draft"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const devices = 8
+	var wg sync.WaitGroup
+	errs := make([]error, devices)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = service.SaveDraft(f.alice.ID, draft.ID, service.DraftInput{
+				Title:    "Contested draft",
+				Content:  fmt.Sprintf("Written on device %d", i),
+				Revision: draft.Revision,
+			})
+		}(i)
+	}
+	wg.Wait()
+
+	saved := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			saved++
+		case !errors.Is(err, database.ErrDraftConflict):
+			t.Errorf("save failed: %v", err)
+		}
+	}
+	expect(t, "saves that won", saved, 1)
+	current, err := database.Drafts.Get(draft.ID, f.alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "revision", current.Revision, 2)
+}
+
+func TestDraftValidation(t *testing.T) {
+	f := newFixture(t)
+	_, err := service.CreateDraft(f.alice.ID, service.DraftInput{Title: strings.Repeat("x", service.TitleMax+1)})
+	var problems service.ValidationErrors
+	expect(t, "long title error", errors.As(err, &problems), true)
+	_, err = service.CreateDraft(f.alice.ID, service.DraftInput{Title: "Draft", Format: "html"})
+	expect(t, "unknown format error", errors.As(err, &problems), true)
+
+	// Incomplete drafts are kept but not published
+	short, err := service.CreateDraft(f.alice.ID, service.DraftInput{Title: "Too short"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = service.PublishDraft(f.alice.ID, short.ID, 0, service.ScheduleInput{})
+	if !errors.As(err, &problems) {
+		t.Fatalf("got %v, want validation errors", err)
+	}
+	expect(t, "publish errors", problems.Error(), "Title must be 10 to 200 characters long; "+
+		"Content must be 20 to 20000 characters long; Select at least 3 different topics")
+	if err := database.Drafts.Delete(short.ID, f.alice.ID); err != nil {
+		t.Fatal(err)
+	}
+	left, err := database.Drafts.Count(f.alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "drafts left", left, 0)
+}
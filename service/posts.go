@@ -0,0 +1,175 @@
+// Package service holds the rules of the forum that more than one entry
+// point shares, on top of the repositories of package database.
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"realtimeforum/database"
+	"realtimeforum/model"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Limits of a post, in characters.
+const (
+	TitleMin   = 10
+	TitleMax   = 200
+	ContentMin = 20
+	ContentMax = 20000
+	TopicsMin  = 3
+)
+
+// ValidationErrors lists everything wrong with a request, in the order
+// of its fields.
+type ValidationErrors []string
+
+func (e ValidationErrors) Error() string {
+	return strings.Join(e, "; ")
+}
+
+// TopicRef is a topic given by ID or by name. In JSON it is a number or
+// a string.
+type TopicRef struct {
+	ID   int
+	Name string
+}
+
+func (t *TopicRef) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &t.Name); err == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, &t.ID); err != nil {
+		return errors.New("a topic is an ID or a name")
+	}
+	return nil
+}
+
+func (t TopicRef) String() string {
+	if t.Name != "" {
+		return strconv.Quote(t.Name)
+	}
+	return strconv.Itoa(t.ID)
+}
+
+// PostInput is what an author submits.
+type PostInput struct {
+	Title   string     `json:"title"`
+	Content string     `json:"content"`
+	Topics  []TopicRef `json:"topics"`
+	// Format is model.ContentPlain, the default, or model.ContentMarkdown
+	Format string `json:"format"`
+	// AttachmentIDs are uploads of the author, see Upload
+	AttachmentIDs []string `json:"attachment_ids"`
+	// PublishAt schedules the post for later, ExpiresAt hides it from
+	// then on; both are optional
+	PublishAt *time.Time `json:"publish_at"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// CreatePost validates input against the schema and stores it as a post
+// of authorID, who must come from the session, published now or at
+// PublishAt. Problems with the input are ValidationErrors.
+func CreatePost(authorID string, input PostInput) (*model.Post, error) {
+	author, err := database.Users.GetByID(authorID)
+	if err != nil {
+		return nil, err
+	}
+
+	title := strings.TrimSpace(input.Title)
+	content := strings.TrimSpace(input.Content)
+
+	var problems ValidationErrors
+	if n := utf8.RuneCountInString(title); n < TitleMin || n > TitleMax {
+		problems = append(problems, fmt.Sprintf("Title must be %d to %d characters long", TitleMin, TitleMax))
+	}
+	if n := utf8.RuneCountInString(content); n < ContentMin || n > ContentMax {
+		problems = append(problems, fmt.Sprintf("Content must be %d to %d characters long", ContentMin, ContentMax))
+	}
+	topicIDs, topicProblems, err := resolveTopics(input.Topics)
+	if err != nil {
+		return nil, err
+	}
+	problems = append(problems, topicProblems...)
+	problems = append(problems, checkAttachments(input.AttachmentIDs)...)
+	schedule, scheduleProblems := checkSchedule(input.PublishAt, input.ExpiresAt, time.Now())
+	problems = append(problems, scheduleProblems...)
+	rendered, err := NewContent(content, input.Format)
+	var formatProblems ValidationErrors
+	if errors.As(err, &formatProblems) {
+		problems = append(problems, formatProblems...)
+	} else if err != nil {
+		return nil, err
+	}
+	if len(problems) > 0 {
+		return nil, problems
+	}
+
+	postID, err := database.Posts.Create(database.NewPost{
+		Title:         title,
+		Content:       rendered,
+		UserID:        author.ID,
+		TopicIDs:      topicIDs,
+		AttachmentIDs: input.AttachmentIDs,
+		PostSchedule:  schedule,
+	})
+	switch {
+	case errors.Is(err, database.ErrDuplicateTitle):
+		return nil, ValidationErrors{"A post with this title already exists"}
+	case errors.Is(err, database.ErrAttachmentNotFound):
+		return nil, ValidationErrors{"Attachments must be your own new uploads"}
+	case errors.Is(err, database.ErrTopicNotFound), errors.Is(err, database.ErrTopicArchived):
+		// A topic changed since it was resolved
+		return nil, ValidationErrors{"Topics: " + err.Error()}
+	case err != nil:
+		return nil, err
+	}
+
+	post, err := database.Posts.GetByID(postID)
+	if err != nil {
+		return nil, err
+	}
+	if post.Topics, err = database.Topics.NamesForPost(postID); err != nil {
+		return nil, err
+	}
+	post.UpdatedAt = post.CreatedAt
+	post.Comments = []model.Comment{}
+	return post, nil
+}
+
+// resolveTopics turns references into distinct open topics, in the order
+// given.
+func resolveTopics(refs []TopicRef) (ids []int, problems ValidationErrors, err error) {
+	topics, err := database.Topics.List(true)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	seen := make(map[int]bool)
+	for _, ref := range refs {
+		var topic *database.TopicSummary
+		for i := range topics {
+			if (ref.Name != "" && strings.EqualFold(topics[i].Name, strings.TrimSpace(ref.Name))) ||
+				(ref.Name == "" && topics[i].ID == ref.ID) {
+				topic = &topics[i]
+				break
+			}
+		}
+		switch {
+		case topic == nil:
+			problems = append(problems, "Unknown topic "+ref.String())
+		case topic.Archived:
+			problems = append(problems, fmt.Sprintf("Topic %q is archived", topic.Name))
+		case !seen[topic.ID]:
+			seen[topic.ID] = true
+			ids = append(ids, topic.ID)
+		}
+	}
+	if len(ids) < TopicsMin && len(problems) == 0 {
+		problems = append(problems, fmt.Sprintf("Select at least %d different topics", TopicsMin))
+	}
+	return ids, problems, nil
+}
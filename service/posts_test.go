@@ -0,0 +1,72 @@
+package service_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"realtimeforum/database"
+	"realtimeforum/service"
+)
+
+func TestCreatePost(t *testing.T) {
+	f := newFixture(t)
+
+	// Topics by ID or case-insensitive name, duplicates count once
+	var input service.PostInput
+	body := fmt.Sprintf(`{"title": "Service post", "content": "Content of the service post", "user_id": %q,
+		"topics": [%d, "topic 1", " Topic 2 ", %d]}`, f.bob.ID, f.topicIDs[0], f.topicIDs[0])
+	if err := json.Unmarshal([]byte(body), &input); err != nil {
+		t.Fatal(err)
+	}
+	post, err := service.CreatePost(f.alice.ID, input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "author", post.UserID, f.alice.ID)
+	expect(t, "topics", fmt.Sprint(post.Topics), "[Topic 0 Topic 1 Topic 2]")
+
+	oldID, err := database.Topics.Create("Old topic", "📼", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	archived := true
+	if err := database.Topics.Update(oldID, database.TopicChanges{Archived: &archived}); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name  string
+		input service.PostInput
+		want  service.ValidationErrors
+	}{
+		{"duplicate title", input, service.ValidationErrors{"A post with this title already exists"}},
+		{"everything wrong", service.PostInput{
+			Title:  "Short",
+			Topics: []service.TopicRef{{ID: f.topicIDs[0]}, {Name: "No such topic"}},
+		}, service.ValidationErrors{
+			"Title must be 10 to 200 characters long",
+			"Content must be 20 to 20000 characters long",
+			`Unknown topic "No such topic"`,
+		}},
+		{"too few topics", service.PostInput{
+			Title:   "Two topics only",
+			Content: "Content of the service post",
+			Topics:  []service.TopicRef{{ID: f.topicIDs[0]}, {ID: f.topicIDs[1]}, {ID: f.topicIDs[0]}},
+		}, service.ValidationErrors{"Select at least 3 different topics"}},
+		{"archived topic", service.PostInput{
+			Title:   "Archived topic",
+			Content: "Content of the service post",
+			Topics:  []service.TopicRef{{ID: f.topicIDs[0]}, {ID: f.topicIDs[1]}, {ID: oldID}},
+		}, service.ValidationErrors{`Topic "Old topic" is archived`}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := service.CreatePost(f.bob.ID, tc.input)
+			var problems service.ValidationErrors
+			if !errors.As(err, &problems) {
+				t.Fatalf("got %v, want validation errors", err)
+			}
+			expect(t, "problems", problems.Error(), tc.want.Error())
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"realtimeforum/database"
+	"realtimeforum/model"
+	"time"
+)
+
+// MaxScheduleAhead is how far ahead a post may be scheduled.
+const MaxScheduleAhead = 365 * 24 * time.Hour
+
+// PublishInterval is how often SchedulePosts looks for posts that are due.
+var PublishInterval = 15 * time.Second
+
+// ScheduleInput is a new publication time or expiry, both optional.
+type ScheduleInput struct {
+	PublishAt *time.Time `json:"publish_at"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// RescheduleInput changes the schedule of a post. Times left out keep
+// their value; in JSON, "expires_at": null removes the expiry.
+type RescheduleInput struct {
+	PublishAt   *time.Time
+	ExpiresAt   *time.Time
+	ClearExpiry bool
+}
+
+func (in *RescheduleInput) UnmarshalJSON(data []byte) error {
+	var fields struct {
+		PublishAt *time.Time      `json:"publish_at"`
+		ExpiresAt json.RawMessage `json:"expires_at"`
+	}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	*in = RescheduleInput{PublishAt: fields.PublishAt}
+	switch {
+	case string(fields.ExpiresAt) == "null":
+		in.ClearExpiry = true
+	case fields.ExpiresAt != nil:
+		return json.Unmarshal(fields.ExpiresAt, &in.ExpiresAt)
+	}
+	return nil
+}
+
+// Reschedule changes when a post of userID is published or expires. Only
+// the expiry of a published post can change; anything else is
+// database.ErrPostPublished.
+func Reschedule(userID string, postID int, input RescheduleInput) error {
+	schedule, problems := checkSchedule(input.PublishAt, input.ExpiresAt, time.Now())
+	if len(problems) > 0 {
+		return problems
+	}
+	changes := database.ScheduleChanges{ClearExpiry: input.ClearExpiry}
+	if input.PublishAt != nil {
+		changes.PublishAt = &schedule.PublishAt
+	}
+	if input.ExpiresAt != nil {
+		changes.ExpiresAt = &schedule.ExpiresAt
+	}
+	err := database.Posts.Reschedule(postID, userID, changes)
+	if errors.Is(err, database.ErrExpiryBeforePublish) {
+		return ValidationErrors{"Expiry must come after publication"}
+	}
+	return err
+}
+
+// CancelScheduled deletes a post of userID before it is published, with
+// the files attached to it.
+func CancelScheduled(uploads *Uploads, userID string, postID int) error {
+	attachments, err := database.Posts.Cancel(postID, userID)
+	if err != nil {
+		return err
+	}
+	for i := range attachments {
+		uploads.deleteBlobs(&attachments[i])
+	}
+	return nil
+}
+
+// SchedulePosts publishes the scheduled posts that are due every
+// PublishInterval until ctx is cancelled, calling published with each.
+func SchedulePosts(ctx context.Context, published func(model.Post)) {
+	ticker := time.NewTicker(PublishInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		posts, err := database.Posts.PublishDue(time.Now())
+		if err != nil {
+			log.Printf("❌ Publishing scheduled posts failed: %v", err)
+			continue
+		}
+		for _, post := range posts {
+			log.Printf("🗓️ Published scheduled post %d %q", post.ID, post.Title)
+			if published != nil {
+				published(post)
+			}
+		}
+	}
+}
+
+// checkSchedule validates an optional publication time, which must be in
+// the future, and an optional expiry, which must come after it or after
+// now.
+func checkSchedule(publishAt, expiresAt *time.Time, now time.Time) (database.PostSchedule, ValidationErrors) {
+	var schedule database.PostSchedule
+	var problems ValidationErrors
+	start := now
+	if publishAt != nil {
+		switch {
+		case !publishAt.After(now):
+			problems = append(problems, "Publication time must be in the future")
+		case publishAt.Sub(now) > MaxScheduleAhead:
+			problems = append(problems, "Posts can be scheduled at most a year ahead")
+		default:
+			schedule.PublishAt, start = *publishAt, *publishAt
+		}
+	}
+	if expiresAt != nil {
+		if !expiresAt.After(start) {
+			problems = append(problems, "Expiry must come after publication")
+		} else {
+			schedule.ExpiresAt = *expiresAt
+		}
+	}
+	return schedule, problems
+}
@@ -0,0 +1,269 @@
+package service_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"realtimeforum/database"
+	"realtimeforum/model"
+	"realtimeforum/service"
+)
+
+// schedule creates a post of alice published at publishAt, expiring at
+// expiresAt unless it is zero.
+func schedule(t *testing.T, f fixture, title string, publishAt, expiresAt time.Time, attachmentIDs ...string) *model.Post {
+	t.Helper()
+	input := service.PostInput{
+		Title:         title,
+		Content:       "Content of a scheduled post",
+		Topics:        []service.TopicRef{{ID: f.topicIDs[0]}, {ID: f.topicIDs[1]}, {ID: f.topicIDs[2]}},
+		PublishAt:     &publishAt,
+		AttachmentIDs: attachmentIDs,
+	}
+	if !expiresAt.IsZero() {
+		input.ExpiresAt = &expiresAt
+	}
+	post, err := service.CreatePost(f.alice.ID, input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return post
+}
+
+func TestScheduledPosts(t *testing.T) {
+	f := newFixture(t)
+	uploads := newUploads(t)
+	now := time.Now()
+	later, expiry := now.Add(time.Hour), now.Add(2*time.Hour)
+
+	var files []*model.Attachment
+	for _, name := range []string{"plan.txt", "flyer.txt"} {
+		file, err := uploads.Upload(context.Background(), f.alice.ID, name, []byte("Attached to a scheduled post"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, file)
+	}
+	plan, flyer := files[0].ID, files[1].ID
+
+	post := schedule(t, f, "Scheduled post", later, expiry)
+	expect(t, "status", post.Status, model.PostScheduled)
+	cancelled := schedule(t, f, "Cancelled post", later.Add(time.Minute), time.Time{}, plan)
+	expired, err := database.Posts.Create(database.NewPost{Title: "Expiring post", Content: database.Content{Text: "Published for a moment", Format: model.ContentPlain},
+		UserID: f.alice.ID, TopicIDs: f.topicIDs[:1], AttachmentIDs: []string{flyer}, PostSchedule: database.PostSchedule{ExpiresAt: now.Add(200 * time.Millisecond)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the author sees a post, and its attachments, before it is
+	// published or once it expired
+	visible := func(postID int, attachmentID string) string {
+		t.Helper()
+		var seen string
+		for _, user := range []*model.User{f.alice, f.bob} {
+			_, postErr := database.Posts.GetVisible(postID, user.ID)
+			_, fileErr := database.Attachments.Get(attachmentID, user.ID)
+			switch {
+			case postErr == nil && fileErr == nil:
+				seen += user.Username + " "
+			case !errors.Is(postErr, database.ErrPostNotFound) || !errors.Is(fileErr, database.ErrAttachmentNotFound):
+				t.Errorf("%s sees post %d: %v, attachment: %v", user.Username, postID, postErr, fileErr)
+			}
+		}
+		return seen
+	}
+	expect(t, "seeing a scheduled post", visible(cancelled.ID, plan), "alice ")
+	expect(t, "seeing a published post", visible(expired, flyer), "alice bob ")
+
+	inFeed := func() string {
+		t.Helper()
+		page, err := database.Posts.Feed(database.FeedQuery{Author: f.alice.Username, Limit: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []int
+		for _, post := range page.Posts {
+			ids = append(ids, post.ID)
+		}
+		return fmt.Sprint(ids)
+	}
+	expect(t, "feed before publication", inFeed(), fmt.Sprint([]int{expired, f.postID}))
+	_, err = database.Comments.Create(database.Content{Text: "Too early", Format: model.ContentPlain}, f.bob.ID, post.ID)
+	expectError(t, "comment before publication", err, database.ErrPostNotFound)
+	_, err = database.Posts.SetLike(post.ID, f.bob.ID, true)
+	expectError(t, "like before publication", err, database.ErrPostNotFound)
+
+	scheduled, err := database.Posts.Scheduled(f.alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "scheduled posts", len(scheduled), 2)
+	expect(t, "next first", scheduled[0].ID, post.ID)
+	expect(t, "topics", len(scheduled[0].Topics), 3)
+
+	past := now.Add(-time.Minute)
+	_, err = service.CreatePost(f.alice.ID, service.PostInput{
+		Title: "Post in the past", Content: "Content scheduled in the past",
+		Topics:    []service.TopicRef{{ID: f.topicIDs[0]}, {ID: f.topicIDs[1]}, {ID: f.topicIDs[2]}},
+		PublishAt: &past, ExpiresAt: &past,
+	})
+	var problems service.ValidationErrors
+	if !errors.As(err, &problems) {
+		t.Fatalf("past schedule: got %v, want validation errors", err)
+	}
+	expect(t, "past schedule errors", len(problems), 2)
+	expectError(t, "reschedule by another user", service.Reschedule(f.bob.ID, post.ID, service.RescheduleInput{}), database.ErrPostNotFound)
+
+	// Each due post is published by one run only
+	first, err := database.Posts.PublishDue(later)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := database.Posts.PublishDue(later)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "published by the first run", len(first), 1)
+	expect(t, "published post", first[0].ID, post.ID)
+	expect(t, "published by the second run", len(second), 0)
+	time.Sleep(250 * time.Millisecond)
+	expect(t, "feed after expiry", inFeed(), fmt.Sprint([]int{post.ID, f.postID}))
+	expect(t, "seeing an expired post", visible(expired, flyer), "alice ")
+	_, err = database.Comments.Create(database.Content{Text: "Too late", Format: model.ContentPlain}, f.bob.ID, expired)
+	expectError(t, "comment after expiry", err, database.ErrPostNotFound)
+	_, err = database.Posts.SetLike(expired, f.bob.ID, true)
+	expectError(t, "like after expiry", err, database.ErrPostNotFound)
+	expectError(t, "bookmark after expiry", database.Bookmarks.Set(f.bob.ID, expired, 0, true), database.ErrPostNotFound)
+
+	expectError(t, "moving a published post", service.Reschedule(f.alice.ID, post.ID, service.RescheduleInput{PublishAt: &later}), database.ErrPostPublished)
+	expectError(t, "cancelling a published post", service.CancelScheduled(uploads, f.alice.ID, post.ID), database.ErrPostPublished)
+	if err := service.CancelScheduled(uploads, f.alice.ID, cancelled.ID); err != nil {
+		t.Fatal(err)
+	}
+	_, err = database.Posts.GetByID(cancelled.ID)
+	expectError(t, "cancelled post", err, database.ErrPostNotFound)
+}
+
+func TestRescheduleKeepsOmittedTimes(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	publishAt, expiresAt := now.Add(time.Hour), now.Add(3*time.Hour)
+	sooner, later := now.Add(30*time.Minute), now.Add(2*time.Hour)
+	for _, tc := range []struct {
+		name       string
+		published  bool
+		input      string
+		wantStatus string
+		// wantPublish and wantExpiry are zero for none
+		wantPublish, wantExpiry time.Time
+		wantErr                 error
+	}{
+		{"only expiry", false, `{"expires_at":"` + later.Format(time.RFC3339) + `"}`, model.PostScheduled, publishAt, later, nil},
+		{"only publication", false, `{"publish_at":"` + sooner.Format(time.RFC3339) + `"}`, model.PostScheduled, sooner, expiresAt, nil},
+		{"expiry removed", false, `{"expires_at":null}`, model.PostScheduled, publishAt, time.Time{}, nil},
+		{"nothing", false, `{}`, model.PostScheduled, publishAt, expiresAt, nil},
+		{"publication after the stored expiry", false, `{"publish_at":"` + now.Add(4*time.Hour).Format(time.RFC3339) + `"}`, "", time.Time{}, time.Time{}, service.ValidationErrors{}},
+		{"published, nothing", true, `{}`, model.PostPublished, publishAt, expiresAt, nil},
+		{"published, only expiry", true, `{"expires_at":"` + later.Format(time.RFC3339) + `"}`, model.PostPublished, publishAt, later, nil},
+		{"published, expiry removed", true, `{"expires_at":null}`, model.PostPublished, publishAt, time.Time{}, nil},
+		{"published, publication", true, `{"publish_at":"` + sooner.Format(time.RFC3339) + `"}`, "", time.Time{}, time.Time{}, database.ErrPostPublished},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f := newFixture(t)
+			post := schedule(t, f, "Scheduled post", publishAt, expiresAt)
+			if tc.published {
+				if _, err := database.Posts.PublishDue(publishAt); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var input service.RescheduleInput
+			if err := json.Unmarshal([]byte(tc.input), &input); err != nil {
+				t.Fatal(err)
+			}
+			err := service.Reschedule(f.alice.ID, post.ID, input)
+			switch want := tc.wantErr.(type) {
+			case nil:
+				if err != nil {
+					t.Fatal(err)
+				}
+			case service.ValidationErrors:
+				if !errors.As(err, &want) {
+					t.Fatalf("got %v, want validation errors", err)
+				}
+				return
+			default:
+				expectError(t, "reschedule", err, want)
+				return
+			}
+
+			stored, err := database.Posts.GetByID(post.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expect(t, "status", stored.Status, tc.wantStatus)
+			expect(t, "publish_at", formatTime(stored.PublishAt), formatTime(&tc.wantPublish))
+			expect(t, "expires_at", formatTime(stored.ExpiresAt), formatTime(&tc.wantExpiry))
+		})
+	}
+}
+
+// TestPublishDueLandsAheadOfCursors pages through the feed while a
+// scheduled post goes out: it must not turn up behind the cursor.
+func TestPublishDueLandsAheadOfCursors(t *testing.T) {
+	f := newFixture(t)
+	post := schedule(t, f, "Scheduled post", time.Now().Add(time.Second), time.Time{})
+	for i := 0; i < 3; i++ {
+		createPostNow(t, f, fmt.Sprintf("Published post %d", i))
+	}
+
+	page, err := database.Posts.Feed(database.FeedQuery{Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	due := time.Now().Add(2 * time.Second)
+	published, err := database.Posts.PublishDue(due)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "published", len(published), 1)
+	expect(t, "dated at publication", published[0].CreatedAt.Equal(due), true)
+
+	rest, err := database.Posts.Feed(database.FeedQuery{Limit: 10, Cursor: page.NextCursor})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range rest.Posts {
+		if p.ID == post.ID {
+			t.Error("the published post showed up behind the cursor")
+		}
+	}
+	top, err := database.Posts.Feed(database.FeedQuery{Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "top of the feed", top.Posts[0].ID, post.ID)
+}
+
+func createPostNow(t *testing.T, f fixture, title string) {
+	t.Helper()
+	_, err := database.Posts.Create(database.NewPost{
+		Title:    title,
+		Content:  database.Content{Text: "Content of a published post", Format: model.ContentPlain},
+		UserID:   f.bob.ID,
+		TopicIDs: f.topicIDs[:1],
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil || t.IsZero() {
+		return "none"
+	}
+	return t.UTC().Format(time.RFC3339)
+}
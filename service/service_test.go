@@ -0,0 +1,83 @@
+package service_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"realtimeforum/database"
+	"realtimeforum/database/dbtest"
+	"realtimeforum/model"
+
+	"github.com/google/uuid"
+)
+
+// fixture is what most service tests start from.
+type fixture struct {
+	alice, bob *model.User
+	topicIDs   []int
+	postID     int
+}
+
+// newFixture opens a fresh SQLite database with alice and bob, three
+// topics and a post of alice in all of them.
+func newFixture(t *testing.T) fixture {
+	t.Helper()
+	dbtest.Open(t, database.SQLite)
+	f := fixture{alice: createUser(t, "alice"), bob: createUser(t, "bob")}
+	for i, emoji := range []string{"🧪", "🧫", "🧬"} {
+		id, err := database.Topics.Create(fmt.Sprintf("Topic %d", i), emoji, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.topicIDs = append(f.topicIDs, id)
+	}
+	var err error
+	f.postID, err = database.Posts.Create(database.NewPost{
+		Title:    "Fixture post",
+		Content:  database.Content{Text: "Content of the fixture post", Format: model.ContentPlain},
+		UserID:   f.alice.ID,
+		TopicIDs: f.topicIDs,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func createUser(t *testing.T, name string) *model.User {
+	t.Helper()
+	user := &model.User{
+		ID:            uuid.New().String(),
+		Username:      name,
+		Email:         name + "@example.com",
+		PasswordHash:  "hash",
+		FirstName:     "First",
+		LastName:      "Last",
+		Age:           30,
+		Gender:        "other",
+		TermsAccepted: true,
+	}
+	if err := database.Users.Create(user); err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func plain(text string) database.Content {
+	return database.Content{Text: text, Format: model.ContentPlain}
+}
+
+func expect(t *testing.T, what string, got, want interface{}) {
+	t.Helper()
+	if got != want {
+		t.Errorf("%s = %v, want %v", what, got, want)
+	}
+}
+
+func expectError(t *testing.T, what string, err, want error) {
+	t.Helper()
+	if !errors.Is(err, want) {
+		t.Errorf("%s: got %v, want %v", what, err, want)
+	}
+}
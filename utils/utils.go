@@ -22,23 +22,20 @@ var (
 
 // ValidateInputs checks if the provided inputs are valid
 func ValidateInputs(username, email, password, firstName, lastName string, age int, gender string, termsAccepted bool) error {
-	if len(username) < 4 {
-		return errors.New("username must be at least 4 characters")
+	if err := ValidateUsername(username); err != nil {
+		return err
 	}
-	if !usernameRegex.MatchString(username) {
-		return errors.New("username can only contain letters, numbers and underscores")
+	if err := ValidateEmail(email); err != nil {
+		return err
 	}
-	if !emailRegex.MatchString(email) {
-		return errors.New("invalid email format")
-	}
-	if len(password) < 8 {
-		return errors.New("password must be at least 8 characters")
+	if err := ValidatePassword(password); err != nil {
+		return err
 	}
-	if len(firstName) < 2 {
-		return errors.New("first name must be at least 2 characters")
+	if err := ValidateName("first name", firstName); err != nil {
+		return err
 	}
-	if len(lastName) < 2 {
-		return errors.New("last name must be at least 2 characters")
+	if err := ValidateName("last name", lastName); err != nil {
+		return err
 	}
 	if age < 13 {
 		return errors.New("you must be at least 13 years old")
@@ -52,6 +49,41 @@ func ValidateInputs(username, email, password, firstName, lastName string, age i
 	return nil
 }
 
+// ValidateUsername checks a username as ValidateInputs does.
+func ValidateUsername(username string) error {
+	if len(username) < 4 {
+		return errors.New("username must be at least 4 characters")
+	}
+	if !usernameRegex.MatchString(username) {
+		return errors.New("username can only contain letters, numbers and underscores")
+	}
+	return nil
+}
+
+// ValidateEmail checks an email as ValidateInputs does.
+func ValidateEmail(email string) error {
+	if !emailRegex.MatchString(email) {
+		return errors.New("invalid email format")
+	}
+	return nil
+}
+
+// ValidatePassword checks a password as ValidateInputs does.
+func ValidatePassword(password string) error {
+	if len(password) < 8 {
+		return errors.New("password must be at least 8 characters")
+	}
+	return nil
+}
+
+// ValidateName checks a first or last name, field naming it in the error.
+func ValidateName(field, name string) error {
+	if len(name) < 2 {
+		return errors.New(field + " must be at least 2 characters")
+	}
+	return nil
+}
+
 // CheckPasswordHash verifies if the provided password matches the stored hash
 func CheckPasswordHash(password, hash string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
@@ -0,0 +1,202 @@
+// websocket/backpressure.go
+package websocket
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+// Slow consumer policy. A client may have HubConfig.SendBufferSize
+// messages waiting to be written. Past that, presence and typing events replace the oldest
+// pending event of the same kind (or are dropped), while every other
+// event is still queued. A client that lets HubConfig.MaxPendingMessages
+// pile up is disconnected with CloseSlowConsumer; durable events reach it
+// again through the sync replay when it reconnects.
+const (
+	DefaultSendBufferSize     = 256
+	DefaultMaxPendingMessages = 1024
+)
+
+// CloseSlowConsumer is the close code sent to clients that could not keep
+// up with their messages.
+const CloseSlowConsumer = 4008
+
+// droppableEvents are only worth delivering while they are current.
+var droppableEvents = map[string]bool{
+	"user_status": true,
+	"typing":      true,
+}
+
+// outbound is a message waiting to be written, with its event type so
+// the policy does not have to decode it again.
+type outbound struct {
+	data  []byte
+	event string
+}
+
+func newOutbound(message []byte) outbound {
+	var header struct {
+		Type string `json:"type"`
+	}
+	json.Unmarshal(message, &header)
+	if header.Type == "" {
+		header.Type = "unknown"
+	}
+	return outbound{data: message, event: header.Type}
+}
+
+// outbox is the queue between the hub and a client's WritePump. Unlike a
+// channel it can be closed any number of times from any goroutine, and
+// sending to a closed outbox is a no-op.
+type outbox struct {
+	mutex     sync.Mutex
+	queue     []outbound
+	ready     chan struct{}
+	closed    bool
+	closeCode int
+	closeText string
+
+	sendBufferSize int
+	maxPending     int
+}
+
+func newOutbox(sendBufferSize, maxPending int) *outbox {
+	return &outbox{ready: make(chan struct{}, 1), sendBufferSize: sendBufferSize, maxPending: maxPending}
+}
+
+// push applies the slow consumer policy. It returns the event type of the
+// message that had to be dropped, if any, and whether the client must be
+// disconnected.
+func (o *outbox) push(msg outbound) (dropped string, overflow bool) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if o.closed {
+		return "", false
+	}
+
+	if len(o.queue) >= o.sendBufferSize {
+		if droppableEvents[msg.event] {
+			dropped = o.dropOldest(msg.event)
+			if dropped == "" {
+				return msg.event, false
+			}
+		} else if len(o.queue) >= o.maxPending {
+			return "", true
+		}
+	}
+
+	o.queue = append(o.queue, msg)
+	select {
+	case o.ready <- struct{}{}:
+	default:
+	}
+	return dropped, false
+}
+
+// dropOldest removes the oldest pending event of the given type and
+// returns its type, or "" when there is none.
+func (o *outbox) dropOldest(event string) string {
+	for i, pending := range o.queue {
+		if pending.event == event {
+			o.queue = append(o.queue[:i], o.queue[i+1:]...)
+			return event
+		}
+	}
+	return ""
+}
+
+// close discards pending messages and makes the WritePump send a close
+// frame with the given code. Only the first call has an effect.
+func (o *outbox) close(code int, text string) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if o.closed {
+		return
+	}
+	o.closed = true
+	o.closeCode = code
+	o.closeText = text
+	o.queue = nil
+	select {
+	case o.ready <- struct{}{}:
+	default:
+	}
+}
+
+// next waits for pending messages. It returns false once the outbox is
+// closed, along with the close code and text.
+func (o *outbox) next() ([]outbound, bool) {
+	for {
+		o.mutex.Lock()
+		if o.closed {
+			o.mutex.Unlock()
+			return nil, false
+		}
+		if len(o.queue) > 0 {
+			batch := o.queue
+			o.queue = nil
+			o.mutex.Unlock()
+			return batch, true
+		}
+		o.mutex.Unlock()
+		<-o.ready
+	}
+}
+
+func (o *outbox) closeFrame() (int, string) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	return o.closeCode, o.closeText
+}
+
+// Metrics counts what the slow consumer policy did since startup.
+type Metrics struct {
+	mutex       sync.Mutex
+	dropped     map[string]int64
+	disconnects int64
+}
+
+// MetricsSnapshot is the JSON form of Metrics.
+type MetricsSnapshot struct {
+	ConnectedClients        int              `json:"connected_clients"`
+	DroppedByEvent          map[string]int64 `json:"dropped_by_event"`
+	SlowConsumerDisconnects int64            `json:"slow_consumer_disconnects"`
+}
+
+func newMetrics() *Metrics {
+	return &Metrics{dropped: make(map[string]int64)}
+}
+
+func (m *Metrics) recordDrop(event string) {
+	m.mutex.Lock()
+	m.dropped[event]++
+	m.mutex.Unlock()
+}
+
+func (m *Metrics) recordDisconnect() {
+	m.mutex.Lock()
+	m.disconnects++
+	m.mutex.Unlock()
+}
+
+// Metrics returns the slow consumer counters of this instance.
+func (h *Hub) Metrics() MetricsSnapshot {
+	h.mutex.RLock()
+	connected := len(h.Clients)
+	h.mutex.RUnlock()
+
+	h.metrics.mutex.Lock()
+	defer h.metrics.mutex.Unlock()
+
+	dropped := make(map[string]int64, len(h.metrics.dropped))
+	for event, count := range h.metrics.dropped {
+		dropped[event] = count
+	}
+	return MetricsSnapshot{
+		ConnectedClients:        connected,
+		DroppedByEvent:          dropped,
+		SlowConsumerDisconnects: h.metrics.disconnects,
+	}
+}
@@ -0,0 +1,104 @@
+package websocket
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// slowClient connects a client of hub that writes nothing until its
+// WritePump is started, and returns it with the remote end it writes to.
+func slowClient(t *testing.T, hub *Hub, userID string) (*Client, *websocket.Conn) {
+	t.Helper()
+	accepted := make(chan *websocket.Conn, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := hub.upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		accepted <- conn
+	}))
+	t.Cleanup(srv.Close)
+
+	remote, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { remote.Close() })
+	return NewClient(hub, userID, userID, <-accepted), remote
+}
+
+func event(eventType, name string) outbound {
+	data, _ := json.Marshal(map[string]string{"type": eventType, "data": name})
+	return newOutbound(data)
+}
+
+func TestSlowConsumerPolicy(t *testing.T) {
+	hub := NewHub(HubConfig{SendBufferSize: 2, MaxPendingMessages: 4})
+
+	// Past the buffer, stale events give way to newer ones of their kind
+	// while chat messages queue up to the limit
+	client, remote := slowClient(t, hub, "erin")
+	for _, msg := range []outbound{
+		event("typing", "t1"),
+		event("user_status", "s1"),
+		event("new_message", "m1"),
+		event("typing", "t2"),
+		event("user_status", "s2"),
+		event("new_message", "m2"),
+		event("typing", "t3"),
+	} {
+		client.enqueue(msg)
+	}
+	go client.WritePump()
+	var got []string
+	remote.SetReadDeadline(time.Now().Add(10 * time.Second))
+	for len(got) < 4 {
+		var msg struct {
+			Data string `json:"data"`
+		}
+		if err := remote.ReadJSON(&msg); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, msg.Data)
+	}
+	if strings.Join(got, ",") != "m1,s2,m2,t3" {
+		t.Errorf("delivered %v, want m1,s2,m2,t3", got)
+	}
+	client.out.close(websocket.CloseNormalClosure, "")
+	<-client.done
+
+	// A stale event with nothing to replace is dropped, and a client with
+	// too many chat messages pending is disconnected
+	slow, slowRemote := slowClient(t, hub, "frank")
+	for _, msg := range []outbound{
+		event("new_message", "m1"),
+		event("new_message", "m2"),
+		event("typing", "t1"),
+		event("new_message", "m3"),
+		event("new_message", "m4"),
+		event("new_message", "m5"),
+		event("new_message", "m6"),
+	} {
+		slow.enqueue(msg)
+	}
+	go slow.WritePump()
+	slowRemote.SetReadDeadline(time.Now().Add(10 * time.Second))
+	_, _, err := slowRemote.ReadMessage()
+	if !websocket.IsCloseError(err, CloseSlowConsumer) {
+		t.Errorf("got %v, want close code %d", err, CloseSlowConsumer)
+	}
+
+	metrics := hub.Metrics()
+	if metrics.DroppedByEvent["typing"] != 3 || metrics.DroppedByEvent["user_status"] != 1 || metrics.DroppedByEvent["new_message"] != 0 {
+		t.Errorf("dropped %v, want 3 typing and 1 user_status", metrics.DroppedByEvent)
+	}
+	if metrics.SlowConsumerDisconnects != 1 {
+		t.Errorf("%d slow consumers disconnected, want 1", metrics.SlowConsumerDisconnects)
+	}
+}
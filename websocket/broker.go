@@ -0,0 +1,131 @@
+// websocket/broker.go
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Envelope kinds exchanged between server instances.
+const (
+	envelopeUser       = "user"       // Message goes to every connection of UserID
+	envelopeBroadcast  = "broadcast"  // Message goes to every connection except those of Except
+	envelopePresence   = "presence"   // Users lists everyone connected to Instance
+	envelopeDisconnect = "disconnect" // the connections of UserID are closed
+)
+
+// Envelope is a hub event shared with the other server instances.
+type Envelope struct {
+	Instance string          `json:"instance"`
+	Kind     string          `json:"kind"`
+	UserID   string          `json:"user_id,omitempty"`
+	Except   string          `json:"except,omitempty"`
+	Message  json.RawMessage `json:"message,omitempty"`
+	Users    []string        `json:"users,omitempty"`
+}
+
+// Broker carries envelopes between the hubs of every server instance.
+// Subscribers receive every published envelope, including their own, and
+// are expected to skip the ones carrying their own instance ID.
+type Broker interface {
+	Publish(env Envelope) error
+	Subscribe(handle func(Envelope)) error
+	Close() error
+}
+
+// MemoryBroker connects hubs living in the same process. It is the
+// default and, with a single hub, simply delivers nothing.
+type MemoryBroker struct {
+	mutex    sync.RWMutex
+	handlers []func(Envelope)
+}
+
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{}
+}
+
+func (b *MemoryBroker) Publish(env Envelope) error {
+	b.mutex.RLock()
+	handlers := b.handlers
+	b.mutex.RUnlock()
+
+	for _, handle := range handlers {
+		handle(env)
+	}
+	return nil
+}
+
+func (b *MemoryBroker) Subscribe(handle func(Envelope)) error {
+	b.mutex.Lock()
+	b.handlers = append(b.handlers, handle)
+	b.mutex.Unlock()
+	return nil
+}
+
+func (b *MemoryBroker) Close() error {
+	return nil
+}
+
+// RedisBroker shares envelopes through a Redis (or Redis-protocol
+// compatible) server using PUBLISH/SUBSCRIBE on a single channel.
+type RedisBroker struct {
+	client  *redis.Client
+	channel string
+	pubsub  *redis.PubSub
+}
+
+// NewRedisBroker connects to a server given as redis://[:password@]host:port/db.
+func NewRedisBroker(url, channel string) (*RedisBroker, error) {
+	options, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid broker URL: %w", err)
+	}
+
+	client := redis.NewClient(options)
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to reach broker: %w", err)
+	}
+
+	return &RedisBroker{client: client, channel: channel}, nil
+}
+
+func (b *RedisBroker) Publish(env Envelope) error {
+	data, err := json.Marshal(env)
+	if err != nil {
+		return err
+	}
+	return b.client.Publish(context.Background(), b.channel, data).Err()
+}
+
+func (b *RedisBroker) Subscribe(handle func(Envelope)) error {
+	b.pubsub = b.client.Subscribe(context.Background(), b.channel)
+	// Wait for the subscription so nothing published afterwards is missed
+	if _, err := b.pubsub.Receive(context.Background()); err != nil {
+		return fmt.Errorf("failed to subscribe to %s: %w", b.channel, err)
+	}
+
+	go func() {
+		for msg := range b.pubsub.Channel() {
+			var env Envelope
+			if err := json.Unmarshal([]byte(msg.Payload), &env); err != nil {
+				log.Printf("❌ Broker: invalid envelope: %v", err)
+				continue
+			}
+			handle(env)
+		}
+	}()
+	return nil
+}
+
+func (b *RedisBroker) Close() error {
+	if b.pubsub != nil {
+		b.pubsub.Close()
+	}
+	return b.client.Close()
+}
@@ -0,0 +1,124 @@
+// websocket/cluster.go
+package websocket
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+)
+
+// How often each instance announces its connected users, and how long
+// the announcement stays valid if the instance goes silent.
+const (
+	presenceHeartbeat = 10 * time.Second
+	remoteTTL         = 3 * presenceHeartbeat
+)
+
+// remoteInstance is the last presence announcement of another instance.
+type remoteInstance struct {
+	users map[string]bool
+	seen  time.Time
+}
+
+// SetBroker replaces the default in-memory broker. It must be called
+// before Run.
+func (h *Hub) SetBroker(broker Broker) {
+	h.broker = broker
+}
+
+func (h *Hub) publish(env Envelope) {
+	env.Instance = h.instance
+	if err := h.broker.Publish(env); err != nil {
+		log.Printf("❌ Broker: failed to publish %s envelope: %v", env.Kind, err)
+	}
+}
+
+// handleEnvelope applies an event published by another instance.
+func (h *Hub) handleEnvelope(env Envelope) {
+	if env.Instance == h.instance {
+		return
+	}
+
+	switch env.Kind {
+	case envelopeUser:
+		h.sendToLocalUser(env.UserID, env.Message)
+	case envelopeBroadcast:
+		h.broadcastLocal(env.Message, env.Except)
+	case envelopePresence:
+		h.setRemoteUsers(env.Instance, env.Users)
+	case envelopeDisconnect:
+		h.disconnectLocal(env.UserID)
+	}
+}
+
+// BroadcastToOthers sends a message to every connection on every
+// instance, except those of the given user.
+func (h *Hub) BroadcastToOthers(message []byte, exceptUserID string) {
+	h.broadcastLocal(message, exceptUserID)
+	h.publish(Envelope{Kind: envelopeBroadcast, Except: exceptUserID, Message: json.RawMessage(message)})
+}
+
+// publishPresence announces the users connected to this instance.
+func (h *Hub) publishPresence() {
+	h.mutex.RLock()
+	users := make([]string, 0, len(h.Clients))
+	for id := range h.Clients {
+		users = append(users, id)
+	}
+	h.mutex.RUnlock()
+
+	h.publish(Envelope{Kind: envelopePresence, Users: users})
+}
+
+func (h *Hub) setRemoteUsers(instance string, users []string) {
+	set := make(map[string]bool, len(users))
+	for _, id := range users {
+		set[id] = true
+	}
+
+	h.mutex.Lock()
+	h.remote[instance] = &remoteInstance{users: set, seen: time.Now()}
+	h.mutex.Unlock()
+}
+
+// expireRemoteInstances forgets instances that stopped announcing
+// themselves and returns the users they had, whose status must be
+// recomputed.
+func (h *Hub) expireRemoteInstances() []string {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	var users []string
+	for instance, remote := range h.remote {
+		if time.Since(remote.seen) > remoteTTL {
+			log.Printf("⚠️ Hub: instance %s stopped responding", instance)
+			delete(h.remote, instance)
+			for id := range remote.users {
+				users = append(users, id)
+			}
+		}
+	}
+	return users
+}
+
+// connectedUserIDs returns every user connected to any instance.
+func (h *Hub) connectedUserIDs() []string {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	seen := make(map[string]bool, len(h.Clients))
+	for id := range h.Clients {
+		seen[id] = true
+	}
+	for _, remote := range h.remote {
+		for id := range remote.users {
+			seen[id] = true
+		}
+	}
+
+	ids := make([]string, 0, len(seen))
+	for id := range seen {
+		ids = append(ids, id)
+	}
+	return ids
+}
@@ -0,0 +1,29 @@
+package websocket
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestExpireRemoteInstances(t *testing.T) {
+	h := NewHub(DefaultHubConfig())
+	h.handleEnvelope(Envelope{Instance: "dead", Kind: envelopePresence, Users: []string{"carol", "dave"}})
+	h.handleEnvelope(Envelope{Instance: "alive", Kind: envelopePresence, Users: []string{"erin"}})
+	h.handleEnvelope(Envelope{Instance: h.instance, Kind: envelopePresence, Users: []string{"frank"}})
+	h.remote["dead"].seen = time.Now().Add(-remoteTTL - time.Second)
+
+	expired := h.expireRemoteInstances()
+	slices.Sort(expired)
+	if !slices.Equal(expired, []string{"carol", "dave"}) {
+		t.Errorf("expired %v, want the users of the dead instance", expired)
+	}
+	for user, want := range map[string]bool{"carol": false, "dave": false, "erin": true, "frank": false} {
+		if got := h.isConnected(user); got != want {
+			t.Errorf("%s connected = %v, want %v", user, got, want)
+		}
+	}
+	if again := h.expireRemoteInstances(); len(again) != 0 {
+		t.Errorf("expired %v twice", again)
+	}
+}
@@ -2,25 +2,63 @@
 package websocket
 
 import (
+	"context"
 	"encoding/json"
 	"log"
 	"net/http"
+	"net/url"
 	"realtimeforum/model"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 )
 
-var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
-		return true // Allow all origins in development
-	},
+// writeWait bounds a single write so a stalled connection cannot block
+// its WritePump forever.
+const writeWait = 10 * time.Second
+
+// HubConfig holds the WebSocket settings of a hub.
+type HubConfig struct {
+	// AllowedOrigins may open WebSockets besides the server's own origin;
+	// "*" allows every origin.
+	AllowedOrigins []string
+	// SendBufferSize and MaxPendingMessages bound the outbox of each
+	// client, see the slow consumer policy in backpressure.go.
+	SendBufferSize     int
+	MaxPendingMessages int
 }
 
-// UpgradeConnection upgrades HTTP connection to WebSocket
-func UpgradeConnection(w http.ResponseWriter, r *http.Request) (*websocket.Conn, error) {
-	return upgrader.Upgrade(w, r, nil)
+// DefaultHubConfig returns the settings used when the configuration does
+// not override them.
+func DefaultHubConfig() HubConfig {
+	return HubConfig{
+		SendBufferSize:     DefaultSendBufferSize,
+		MaxPendingMessages: DefaultMaxPendingMessages,
+	}
+}
+
+func (h *Hub) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true // Not a browser
+	}
+	for _, allowed := range h.config.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return true
+		}
+	}
+
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+// Upgrade upgrades an HTTP connection to a WebSocket for this hub
+func (h *Hub) Upgrade(w http.ResponseWriter, r *http.Request) (*websocket.Conn, error) {
+	return h.upgrader.Upgrade(w, r, nil)
 }
 
 type Client struct {
@@ -28,7 +66,45 @@ type Client struct {
 	Username string
 	Conn     *websocket.Conn
 	Hub      *Hub
-	Send     chan []byte
+
+	out          *outbox
+	done         chan struct{} // closed when the WritePump returns
+	lastActivity atomic.Int64  // unix nanoseconds of the last inbound message
+	idle         atomic.Bool
+}
+
+// NewClient wraps an upgraded connection. Register it with the hub, then
+// start its WritePump and ReadPump.
+func NewClient(hub *Hub, userID, username string, conn *websocket.Conn) *Client {
+	return &Client{
+		ID:       userID,
+		Username: username,
+		Conn:     conn,
+		Hub:      hub,
+		out:      newOutbox(hub.config.SendBufferSize, hub.config.MaxPendingMessages),
+		done:     make(chan struct{}),
+	}
+}
+
+// enqueue hands a message to the WritePump under the slow consumer policy.
+func (c *Client) enqueue(msg outbound) {
+	dropped, overflow := c.out.push(msg)
+	if dropped != "" {
+		c.Hub.metrics.recordDrop(dropped)
+	}
+	if overflow {
+		log.Printf("⚠️ Hub: Disconnecting slow client %s (%d pending messages)", c.Username, c.Hub.config.MaxPendingMessages)
+		c.Hub.metrics.recordDisconnect()
+		c.out.close(CloseSlowConsumer, "too many pending messages")
+	}
+}
+
+// touch records client activity and clears the away state if it was set.
+func (c *Client) touch() {
+	c.lastActivity.Store(time.Now().UnixNano())
+	if c.idle.CompareAndSwap(true, false) {
+		c.Hub.setUserIdle(c.ID, false)
+	}
 }
 
 type Hub struct {
@@ -37,185 +113,293 @@ type Hub struct {
 	Unregister chan *Client
 	Broadcast  chan []byte
 	mutex      sync.RWMutex
+
+	// User IDs whose online status changed, persisted by writePresence.
+	// The hub loop only records them and never waits for the writer.
+	presenceMutex   sync.Mutex
+	presencePending map[string]bool
+	presenceOrder   []string
+	presenceReady   chan struct{}
+
+	// Other server instances are reached through the broker
+	broker   Broker
+	instance string
+	remote   map[string]*remoteInstance
+
+	metrics *Metrics
+
+	config   HubConfig
+	upgrader websocket.Upgrader
+
+	// Shutdown closes quit and waits for the goroutines of Start to return
+	quit    chan struct{}
+	running sync.WaitGroup
+}
+
+// NewHub creates a hub with the given settings. Start it with Start.
+func NewHub(cfg HubConfig) *Hub {
+	h := &Hub{
+		Clients:         make(map[string]*Client),
+		Register:        make(chan *Client, 10), // ✅ BUFFERED CHANNEL
+		Unregister:      make(chan *Client, 10), // ✅ BUFFERED CHANNEL
+		Broadcast:       make(chan []byte, 100), // ✅ BUFFERED CHANNEL
+		presencePending: make(map[string]bool),
+		presenceReady:   make(chan struct{}, 1),
+		broker:          NewMemoryBroker(),
+		instance:        uuid.New().String(),
+		remote:          make(map[string]*remoteInstance),
+		metrics:         newMetrics(),
+		quit:            make(chan struct{}),
+		config:          cfg,
+	}
+	h.upgrader = websocket.Upgrader{CheckOrigin: h.checkOrigin}
+	return h
 }
 
-func NewHub() *Hub {
-	return &Hub{
-		Clients:    make(map[string]*Client),
-		Register:   make(chan *Client, 10), // ✅ BUFFERED CHANNEL
-		Unregister: make(chan *Client, 10), // ✅ BUFFERED CHANNEL
-		Broadcast:  make(chan []byte, 100), // ✅ BUFFERED CHANNEL
+// Start subscribes to the broker and starts the hub's goroutines. They
+// are counted before they start, so Shutdown may be called as soon as
+// Start returns.
+func (h *Hub) Start() {
+	if err := h.broker.Subscribe(h.handleEnvelope); err != nil {
+		log.Printf("❌ Hub: broker subscription failed, running standalone: %v", err)
 	}
+	h.running.Add(3)
+	go h.run()
+	go h.writePresence()
+	go h.maintain()
 }
 
-// ✅ ENHANCED: Updated Run method with immediate status sync and force refresh
-func (h *Hub) Run() {
-	log.Printf("🔵 Hub.Run() started - listening for clients...")
+// run is the hub event loop. It only touches the clients map; database
+// writes, periodic maintenance and per-client welcome messages run on
+// other goroutines so a burst of connections never stalls message
+// delivery.
+func (h *Hub) run() {
+	log.Printf("🔵 Hub.run() started - listening for clients...")
+	defer h.running.Done()
 
 	for {
 		select {
+		case <-h.quit:
+			return
+
 		case client := <-h.Register:
 			log.Printf("🔵 Hub: Registering client %s (ID: %s)", client.Username, client.ID)
+			client.lastActivity.Store(time.Now().UnixNano())
 
-			// 1. Add to clients map first
+			// A reconnect replaces the user's previous connection
 			h.mutex.Lock()
+			if previous, ok := h.Clients[client.ID]; ok && previous != client {
+				previous.out.close(websocket.CloseNormalClosure, "replaced by a newer connection")
+			}
 			h.Clients[client.ID] = client
 			h.mutex.Unlock()
 
-			// 2. Critical: Force update database status immediately
-			log.Printf("🔄 FORCING database update for user %s (ID: %s)", client.Username, client.ID)
-			UpdateUserOnlineStatus(client.ID, true)
-
-			// 3. Send current online users to new client immediately
-			h.sendOnlineUsersToNewClient(client)
-
-			// 4. Broadcast status to all clients
-			log.Printf("📢 Broadcasting online status for user %s", client.Username)
-			h.broadcastOnlineStatus(client.ID, client.Username, true)
-
-			// 5. Force all clients to refresh their user lists
-			time.Sleep(500 * time.Millisecond)
-			h.broadcastForceRefresh()
-
-			log.Printf("✅ Hub: Client %s connected and online status updated", client.Username)
+			h.queuePresenceChange(client.ID)
+			go h.welcome(client)
 
 		case client := <-h.Unregister:
 			log.Printf("🔴 Hub: Unregistering client %s (ID: %s)", client.Username, client.ID)
 			h.mutex.Lock()
-			if _, ok := h.Clients[client.ID]; ok {
+			// Ignore connections that were already replaced by a newer one
+			if current, ok := h.Clients[client.ID]; ok && current == client {
 				delete(h.Clients, client.ID)
-				close(client.Send)
+				client.out.close(websocket.CloseNormalClosure, "")
 				h.mutex.Unlock()
-
-				// Update database status
-				UpdateUserOnlineStatus(client.ID, false)
-
-				// Broadcast offline status
-				h.broadcastOnlineStatus(client.ID, client.Username, false)
-
-				log.Printf("✅ Hub: Client %s disconnected and offline status updated", client.Username)
+				h.queuePresenceChange(client.ID)
 			} else {
 				h.mutex.Unlock()
 			}
 
 		case message := <-h.Broadcast:
-			log.Printf("🔵 Hub: Broadcasting message to %d clients", len(h.Clients))
-			h.mutex.RLock()
-			for clientID, client := range h.Clients {
-				select {
-				case client.Send <- message:
-					// Message sent successfully
-				default:
-					log.Printf("⚠️ Hub: Failed to send message to client %s, removing", clientID)
-					close(client.Send)
-					delete(h.Clients, clientID)
-				}
-			}
-			h.mutex.RUnlock()
+			h.BroadcastToOthers(message, "")
 			log.Printf("✅ Hub: Broadcast completed")
 		}
 	}
 }
 
-// ✅ NEW: Add this new method to Hub for force refresh
-func (h *Hub) broadcastForceRefresh() {
-	message := model.WebSocketMessage{
-		Type: "force_refresh",
-		Data: map[string]interface{}{
-			"timestamp": time.Now(),
-		},
+// Shutdown stops the hub: every client gets a "server restarting" close
+// frame, and the users connected here are marked offline unless they are
+// still connected to another instance. It returns once the close frames
+// are written or the context expires.
+func (h *Hub) Shutdown(ctx context.Context) error {
+	close(h.quit)
+	h.running.Wait()
+
+	h.mutex.Lock()
+	clients := make([]*Client, 0, len(h.Clients))
+	for _, client := range h.Clients {
+		clients = append(clients, client)
+	}
+	h.Clients = make(map[string]*Client)
+	h.mutex.Unlock()
+
+	log.Printf("🔴 Hub: Closing %d connections", len(clients))
+	for _, client := range clients {
+		client.out.close(websocket.CloseServiceRestart, "server restarting")
+	}
+
+	var err error
+	for _, client := range clients {
+		select {
+		case <-client.done:
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	// Tell the other instances right away instead of letting us expire
+	h.publishPresence()
+
+	statuses := make(map[string]bool, len(clients))
+	userIDs := make([]string, 0, len(clients))
+	for _, client := range clients {
+		statuses[client.ID] = h.isConnected(client.ID)
+		userIDs = append(userIDs, client.ID)
+	}
+	if saveErr := saveOnlineStatuses(statuses); saveErr != nil {
+		log.Printf("❌ ERROR marking %d users offline: %v", len(statuses), saveErr)
+	} else {
+		h.broadcastPresenceDeltas(userIDs)
 	}
 
-	data, _ := json.Marshal(message)
-	h.Broadcast <- data
+	if closeErr := h.broker.Close(); closeErr != nil {
+		log.Printf("⚠️ Hub: failed to close broker: %v", closeErr)
+	}
+	return err
 }
 
-// ✅ NEW: Send current online users to newly connected client
-func (h *Hub) sendOnlineUsersToNewClient(newClient *Client) {
-	h.mutex.RLock()
-	defer h.mutex.RUnlock()
+// maintain runs the periodic work of the hub that goes to the database,
+// away from the event loop: marking inactive clients away and pruning
+// events that fell out of the replay window.
+func (h *Hub) maintain() {
+	defer h.running.Done()
 
-	log.Printf("📤 Sending current online users to new client %s", newClient.Username)
+	idleTicker := time.NewTicker(30 * time.Second)
+	defer idleTicker.Stop()
+	pruneTicker := time.NewTicker(time.Hour)
+	defer pruneTicker.Stop()
 
-	for clientID, client := range h.Clients {
-		if clientID != newClient.ID {
-			// Send each online user's status to the new client
-			message := model.WebSocketMessage{
-				Type: "user_status",
-				Data: map[string]interface{}{
-					"user_id":   clientID,
-					"username":  client.Username,
-					"is_online": true,
-				},
-			}
+	for {
+		select {
+		case <-h.quit:
+			return
+		case <-idleTicker.C:
+			h.markIdleClients()
+		case <-pruneTicker.C:
+			pruneUserEvents()
+		}
+	}
+}
 
-			data, _ := json.Marshal(message)
-			select {
-			case newClient.Send <- data:
-				log.Printf("✅ Sent online status of %s to new client %s", client.Username, newClient.Username)
-			default:
-				log.Printf("⚠️ Failed to send online status to new client %s", newClient.Username)
-			}
+// markIdleClients flags clients that have been inactive for longer than
+// AwayAfter so other users see them as away.
+func (h *Hub) markIdleClients() {
+	h.mutex.RLock()
+	var idle []*Client
+	for _, client := range h.Clients {
+		if time.Since(time.Unix(0, client.lastActivity.Load())) > AwayAfter && client.idle.CompareAndSwap(false, true) {
+			idle = append(idle, client)
 		}
 	}
+	h.mutex.RUnlock()
+
+	for _, client := range idle {
+		log.Printf("💤 Hub: Client %s is now away", client.Username)
+		h.setUserIdle(client.ID, true)
+	}
 }
 
-func (h *Hub) SendToUser(userID string, message []byte) {
+// welcome sends a newly registered client the presence of everyone
+// online and the events it missed while disconnected.
+func (h *Hub) welcome(client *Client) {
+	h.sendPresenceSnapshot(client)
+	h.sendMissedEvents(client)
+	log.Printf("✅ Hub: Client %s connected", client.Username)
+}
+
+// sendTo delivers a message to a specific connection if it is still
+// registered, without blocking.
+func (h *Hub) sendTo(client *Client, message []byte) bool {
 	h.mutex.RLock()
-	defer h.mutex.RUnlock()
+	registered := h.Clients[client.ID] == client
+	h.mutex.RUnlock()
 
-	if client, ok := h.Clients[userID]; ok {
-		select {
-		case client.Send <- message:
-		default:
-			close(client.Send)
-			delete(h.Clients, userID)
-		}
+	if !registered {
+		return false
 	}
+	client.enqueue(newOutbound(message))
+	return true
+}
+
+// SendToUser delivers a message to the user on whichever instance they
+// are connected to.
+func (h *Hub) SendToUser(userID string, message []byte) {
+	h.sendToLocalUser(userID, message)
+	h.publish(Envelope{Kind: envelopeUser, UserID: userID, Message: json.RawMessage(message)})
+}
+
+// CloseAccountDeleted is the close code sent to the connections of a
+// deleted account.
+const CloseAccountDeleted = 4009
+
+// Disconnect closes the connections of a deleted account on every
+// instance.
+func (h *Hub) Disconnect(userID string) {
+	h.disconnectLocal(userID)
+	h.publish(Envelope{Kind: envelopeDisconnect, UserID: userID})
 }
 
-// ✅ ENHANCED: Better online status broadcasting with forced delivery
-func (h *Hub) broadcastOnlineStatus(userID, username string, isOnline bool) {
-	log.Printf("📢 Broadcasting status change: %s is %s", username, map[bool]string{true: "online", false: "offline"}[isOnline])
-
-	message := model.WebSocketMessage{
-		Type: "user_status",
-		Data: map[string]interface{}{
-			"user_id":   userID,
-			"username":  username,
-			"is_online": isOnline,
-		},
+// disconnectLocal closes the user's connection on this instance; its
+// ReadPump then unregisters it.
+func (h *Hub) disconnectLocal(userID string) {
+	h.mutex.RLock()
+	client, ok := h.Clients[userID]
+	h.mutex.RUnlock()
+
+	if ok {
+		client.out.close(CloseAccountDeleted, "account deleted")
 	}
+}
 
-	data, _ := json.Marshal(message)
+// broadcastLocal sends a message to every connection of this instance
+// except those of exceptUserID.
+func (h *Hub) broadcastLocal(message []byte, exceptUserID string) {
+	msg := newOutbound(message)
 
-	// ✅ ENHANCED: Send directly to each client instead of using broadcast channel
 	h.mutex.RLock()
-	clientCount := len(h.Clients)
-	successCount := 0
+	defer h.mutex.RUnlock()
 
 	for clientID, client := range h.Clients {
-		// Don't send status update to the user whose status changed
-		if clientID != userID {
-			select {
-			case client.Send <- data:
-				successCount++
-				log.Printf("✅ Status update sent to client %s", clientID)
-			default:
-				log.Printf("⚠️ Failed to send status update to client %s", clientID)
-			}
+		if clientID != exceptUserID {
+			client.enqueue(msg)
 		}
 	}
+}
+
+// sendToLocalUser delivers a message to the user's connection on this
+// instance. A slow client is disconnected by its WritePump; the hub only
+// forgets it once the ReadPump unregisters it.
+func (h *Hub) sendToLocalUser(userID string, message []byte) {
+	h.mutex.RLock()
+	client, ok := h.Clients[userID]
 	h.mutex.RUnlock()
 
-	log.Printf("📢 Status broadcast completed: sent to %d/%d clients", successCount, clientCount-1)
+	if ok {
+		client.enqueue(newOutbound(message))
+	}
 }
 
 // EXPORTED METHODS (Capital letters) - These can be called from handler package
 func (c *Client) ReadPump() {
 	defer func() {
 		log.Printf("🔌 Client %s disconnecting from ReadPump", c.Username)
-		c.Hub.Unregister <- c
+		select {
+		case c.Hub.Unregister <- c:
+		case <-c.Hub.quit:
+		}
 		c.Conn.Close()
 	}()
 
@@ -239,6 +423,7 @@ func (c *Client) ReadPump() {
 
 		log.Printf("📨 Parsed message from %s: Type=%s, Data=%+v", c.Username, wsMessage.Type, wsMessage.Data)
 		wsMessage.UserID = c.ID
+		c.touch()
 
 		switch wsMessage.Type {
 		case "chat_message":
@@ -247,6 +432,12 @@ func (c *Client) ReadPump() {
 		case "typing":
 			log.Printf("⌨️ Routing to handleTypingEvent")
 			handleTypingEvent(c, wsMessage)
+		case "presence":
+			handlePresenceEvent(c, wsMessage)
+		case "ack":
+			handleAck(c, wsMessage)
+		case "activity":
+			// Heartbeat sent by the page on user input; touch() already recorded it
 		default:
 			log.Printf("❓ Unknown message type: %s", wsMessage.Type)
 		}
@@ -254,19 +445,24 @@ func (c *Client) ReadPump() {
 }
 
 func (c *Client) WritePump() {
+	defer close(c.done)
 	defer c.Conn.Close()
 
 	for {
-		select {
-		case message, ok := <-c.Send:
-			if !ok {
-				c.Conn.WriteMessage(websocket.CloseMessage, []byte{})
+		batch, ok := c.out.next()
+		if !ok {
+			code, text := c.out.closeFrame()
+			c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+			c.Conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(code, text))
+			return
+		}
+
+		for _, msg := range batch {
+			c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.Conn.WriteMessage(websocket.TextMessage, msg.data); err != nil {
+				log.Printf("❌ WritePump error for client %s: %v", c.Username, err)
 				return
 			}
-			c.Conn.WriteMessage(websocket.TextMessage, message)
 		}
 	}
 }
-
-// Global hub instance
-var ChatHub = NewHub()
@@ -0,0 +1,471 @@
+package websocket_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"realtimeforum/database"
+	"realtimeforum/database/dbtest"
+	"realtimeforum/handler"
+	"realtimeforum/model"
+	"realtimeforum/websocket"
+
+	"github.com/google/uuid"
+	gorilla "github.com/gorilla/websocket"
+)
+
+func TestMain(m *testing.M) {
+	// The hub logs every connection
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// server starts a hub behind the real WebSocket handler and returns its
+// ws:// URL.
+func server(t testing.TB) (*websocket.Hub, string) {
+	t.Helper()
+	return serverOn(t, nil)
+}
+
+// serverOn is server with a hub sharing the given broker, or its own
+// in-memory one when broker is nil.
+func serverOn(t testing.TB, broker websocket.Broker) (*websocket.Hub, string) {
+	t.Helper()
+	hub := websocket.NewHub(websocket.DefaultHubConfig())
+	if broker != nil {
+		hub.SetBroker(broker)
+	}
+	hub.Start()
+	chat := handler.NewChat(hub, handler.ChatThrottle{})
+	srv := httptest.NewServer(http.HandlerFunc(chat.WebSocketHandler))
+	t.Cleanup(func() {
+		srv.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		hub.Shutdown(ctx)
+	})
+	return hub, "ws" + strings.TrimPrefix(srv.URL, "http")
+}
+
+// createUsers adds n users with a session each and returns them with
+// their session tokens.
+func createUsers(t testing.TB, n int) ([]*model.User, []string) {
+	t.Helper()
+	users := make([]*model.User, n)
+	tokens := make([]string, n)
+	for i := range users {
+		users[i] = &model.User{
+			ID:            uuid.New().String(),
+			Username:      fmt.Sprintf("user_%d", i),
+			Email:         fmt.Sprintf("user_%d@example.com", i),
+			PasswordHash:  "hash",
+			FirstName:     "First",
+			LastName:      "Last",
+			Age:           30,
+			Gender:        "other",
+			TermsAccepted: true,
+		}
+		if err := database.Users.Create(users[i]); err != nil {
+			t.Fatal(err)
+		}
+		tokens[i] = uuid.New().String()
+		if err := database.Sessions.Create(users[i].ID, tokens[i], time.Now().Add(time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return users, tokens
+}
+
+func dial(url, token string) (*gorilla.Conn, error) {
+	header := http.Header{}
+	header.Set("Cookie", "session_token="+token)
+	conn, _, err := gorilla.DefaultDialer.Dial(url, header)
+	return conn, err
+}
+
+// waitFor reads until an event of the given type arrives.
+func waitFor(conn *gorilla.Conn, eventType string) error {
+	_, err := receive(conn, eventType)
+	return err
+}
+
+// receive reads until an event of the given type arrives and returns it.
+func receive(conn *gorilla.Conn, eventType string) ([]byte, error) {
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return nil, err
+		}
+		var message struct {
+			Type string `json:"type"`
+		}
+		json.Unmarshal(data, &message)
+		if message.Type == eventType {
+			return data, nil
+		}
+	}
+}
+
+// receiveSync reads the replay sent to a client when it connects.
+func receiveSync(t *testing.T, conn *gorilla.Conn) model.SyncBatch {
+	t.Helper()
+	data, err := receive(conn, "sync")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var message struct {
+		Data model.SyncBatch `json:"data"`
+	}
+	if err := json.Unmarshal(data, &message); err != nil {
+		t.Fatal(err)
+	}
+	return message.Data
+}
+
+func expect(t *testing.T, what string, got, want interface{}) {
+	t.Helper()
+	if got != want {
+		t.Errorf("%s = %v, want %v", what, got, want)
+	}
+}
+
+func TestHubWelcomesABurstOfClients(t *testing.T) {
+	dbtest.Open(t, database.SQLite)
+	_, url := server(t)
+	const clients = 50
+	users, tokens := createUsers(t, clients)
+
+	var wg sync.WaitGroup
+	conns := make([]*gorilla.Conn, clients)
+	errs := make([]error, clients)
+	for i, token := range tokens {
+		wg.Add(1)
+		go func(i int, token string) {
+			defer wg.Done()
+			if conns[i], errs[i] = dial(url, token); errs[i] == nil {
+				errs[i] = waitFor(conns[i], "sync")
+			}
+		}(i, token)
+	}
+	wg.Wait()
+	defer func() {
+		for _, conn := range conns {
+			if conn != nil {
+				conn.Close()
+			}
+		}
+	}()
+	for _, err := range errs {
+		if err != nil {
+			t.Fatalf("client not welcomed: %v", err)
+		}
+	}
+
+	// The presence writer runs behind the hub loop
+	ids := make([]string, len(users))
+	for i, user := range users {
+		ids[i] = user.ID
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		states, err := database.Presence.LoadMany(ids)
+		if err != nil {
+			t.Fatal(err)
+		}
+		online := 0
+		for _, state := range states {
+			if state.IsOnline {
+				online++
+			}
+		}
+		if online == clients {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d of %d clients marked online", online, clients)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestHubDisconnectsDeletedAccounts(t *testing.T) {
+	dbtest.Open(t, database.SQLite)
+	hub, url := server(t)
+	users, tokens := createUsers(t, 1)
+
+	conn, err := dial(url, tokens[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err := waitFor(conn, "sync"); err != nil {
+		t.Fatal(err)
+	}
+
+	hub.Disconnect(users[0].ID)
+	err = waitFor(conn, "never sent")
+	if !gorilla.IsCloseError(err, websocket.CloseAccountDeleted) {
+		t.Fatalf("got %v, want close code %d", err, websocket.CloseAccountDeleted)
+	}
+}
+
+// TestHubReplaysMissedEvents acknowledges one event, misses three while
+// disconnected and then more than a replay holds.
+func TestHubReplaysMissedEvents(t *testing.T) {
+	dbtest.Open(t, database.SQLite)
+	hub, url := server(t)
+	users, tokens := createUsers(t, 1)
+	user := users[0].ID
+	connect := func() *gorilla.Conn {
+		t.Helper()
+		conn, err := dial(url, tokens[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return conn
+	}
+	replayed := func(batch model.SyncBatch) string {
+		var names []string
+		for _, event := range batch.Events {
+			data, _ := event.Data.(map[string]interface{})
+			names = append(names, fmt.Sprint(data["name"]))
+		}
+		return strings.Join(names, ",")
+	}
+
+	conn := connect()
+	if batch := receiveSync(t, conn); len(batch.Events) != 0 {
+		t.Fatalf("new user replayed %d events", len(batch.Events))
+	}
+	hub.DeliverToUser(user, "notification", map[string]string{"name": "seen"})
+	data, err := receive(conn, "notification")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var seen model.WebSocketMessage
+	json.Unmarshal(data, &seen)
+	ack, _ := json.Marshal(model.WebSocketMessage{Type: "ack", Data: map[string]int64{"seq": seen.Seq}})
+	if err := conn.WriteMessage(gorilla.TextMessage, ack); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		cursor, _, _, err := database.Events.Cursor(user)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cursor == seen.Seq {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("cursor at %d, want %d", cursor, seen.Seq)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	conn.Close()
+
+	for _, name := range []string{"first", "second", "third"} {
+		hub.DeliverToUser(user, "notification", map[string]string{"name": name})
+	}
+	conn = connect()
+	batch := receiveSync(t, conn)
+	conn.Close()
+	if replayed(batch) != "first,second,third" {
+		t.Fatalf("replayed %q, want the three missed events", replayed(batch))
+	}
+	expect(t, "truncated", batch.Truncated, false)
+	expect(t, "last seq", batch.LastSeq, batch.Events[2].Seq)
+	expect(t, "in order", batch.Events[0].Seq < batch.Events[1].Seq && batch.Events[1].Seq < batch.Events[2].Seq, true)
+
+	defer func(max int) { websocket.MaxReplayEvents = max }(websocket.MaxReplayEvents)
+	websocket.MaxReplayEvents = 4
+	for _, name := range []string{"fourth", "fifth"} {
+		hub.DeliverToUser(user, "notification", map[string]string{"name": name})
+	}
+	conn = connect()
+	defer conn.Close()
+	batch = receiveSync(t, conn)
+	expect(t, "latest events", replayed(batch), "second,third,fourth,fifth")
+	expect(t, "truncated", batch.Truncated, true)
+}
+
+// TestHubsShareABroker connects alice and bob to two instances and checks
+// that each sees the other online and that events reach the other
+// instance. The Redis broker is tested too when FORUM_TEST_REDIS_URL
+// names a server.
+func TestHubsShareABroker(t *testing.T) {
+	// Each test gets the brokers of both instances
+	brokers := map[string]func(t *testing.T) (websocket.Broker, websocket.Broker){
+		"memory": func(t *testing.T) (websocket.Broker, websocket.Broker) {
+			shared := websocket.NewMemoryBroker()
+			return shared, shared
+		},
+		"redis": func(t *testing.T) (websocket.Broker, websocket.Broker) {
+			url := os.Getenv("FORUM_TEST_REDIS_URL")
+			if url == "" {
+				t.Skip("FORUM_TEST_REDIS_URL is not set")
+			}
+			channel := "forum-test-" + uuid.New().String()
+			var pair [2]websocket.Broker
+			for i := range pair {
+				broker, err := websocket.NewRedisBroker(url, channel)
+				if err != nil {
+					t.Fatal(err)
+				}
+				pair[i] = broker
+			}
+			return pair[0], pair[1]
+		},
+	}
+	for name, newBroker := range brokers {
+		t.Run(name, func(t *testing.T) {
+			dbtest.Open(t, database.SQLite)
+			firstBroker, secondBroker := newBroker(t)
+			first, firstURL := serverOn(t, firstBroker)
+			_, secondURL := serverOn(t, secondBroker)
+			users, tokens := createUsers(t, 2)
+			alice, bob := users[0].ID, users[1].ID
+
+			aliceConn, err := dial(firstURL, tokens[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer aliceConn.Close()
+			if err := waitFor(aliceConn, "sync"); err != nil {
+				t.Fatal(err)
+			}
+			// Alice is announced to the other instance before she is
+			// marked online
+			deadline := time.Now().Add(5 * time.Second)
+			for {
+				state, err := database.Presence.Load(alice)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if state.IsOnline {
+					break
+				}
+				if time.Now().After(deadline) {
+					t.Fatal("alice never marked online")
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			bobConn, err := dial(secondURL, tokens[1])
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer bobConn.Close()
+			data, err := receive(bobConn, "presence_snapshot")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var snapshot struct {
+				Data []model.Presence `json:"data"`
+			}
+			if err := json.Unmarshal(data, &snapshot); err != nil {
+				t.Fatal(err)
+			}
+			expect(t, "bob sees", len(snapshot.Data) == 1 && snapshot.Data[0].UserID == alice, true)
+
+			first.DeliverToUser(bob, "notification", map[string]string{"kind": "from_the_first_instance"})
+			data, err = receive(bobConn, "notification")
+			if err != nil {
+				t.Fatal(err)
+			}
+			expect(t, "bob notified", strings.Contains(string(data), "from_the_first_instance"), true)
+		})
+	}
+}
+
+// BenchmarkHubConnect times a client connecting, getting its welcome and
+// leaving, with the presence writes that go with it.
+func BenchmarkHubConnect(b *testing.B) {
+	dbtest.Open(b, database.SQLite)
+	_, url := server(b)
+	_, tokens := createUsers(b, 1)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		conn, err := dial(url, tokens[0])
+		if err != nil {
+			b.Fatal(err)
+		}
+		if err := waitFor(conn, "sync"); err != nil {
+			b.Fatal(err)
+		}
+		conn.Close()
+	}
+}
+
+// BenchmarkHubSendToUser times a message to a connected user until it is
+// read from the socket.
+func BenchmarkHubSendToUser(b *testing.B) {
+	dbtest.Open(b, database.SQLite)
+	hub, url := server(b)
+	users, tokens := createUsers(b, 1)
+
+	conn, err := dial(url, tokens[0])
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer conn.Close()
+	if err := waitFor(conn, "sync"); err != nil {
+		b.Fatal(err)
+	}
+	message, _ := json.Marshal(model.WebSocketMessage{Type: "benchmark"})
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		hub.SendToUser(users[0].ID, message)
+		if err := waitFor(conn, "benchmark"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestHubRejectsMalformedEvents(t *testing.T) {
+	dbtest.Open(t, database.SQLite)
+	_, url := server(t)
+	_, tokens := createUsers(t, 1)
+
+	conn, err := dial(url, tokens[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err := waitFor(conn, "sync"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every event is answered with an error and the connection stays up
+	for _, event := range []string{
+		`{"type":"chat_message","data":"hello"}`,
+		`{"type":"chat_message","data":{"message":"hello"}}`,
+		`{"type":"chat_message","data":{"receiver_id":42,"message":"hello"}}`,
+		`{"type":"chat_message","data":{"receiver_id":"someone","message":"  "}}`,
+		`{"type":"presence","data":"away"}`,
+		`{"type":"presence","data":{"status":"sleeping"}}`,
+		`{"type":"typing"}`,
+		`{"type":"typing","data":{"is_typing":true}}`,
+		`{"type":"typing","data":{"receiver_id":"someone","is_typing":"yes"}}`,
+	} {
+		if err := conn.WriteMessage(gorilla.TextMessage, []byte(event)); err != nil {
+			t.Fatal(err)
+		}
+		if err := waitFor(conn, "error"); err != nil {
+			t.Fatalf("%s: %v", event, err)
+		}
+	}
+}
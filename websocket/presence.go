@@ -0,0 +1,311 @@
+// websocket/presence.go
+package websocket
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"realtimeforum/database"
+	"realtimeforum/model"
+	"strings"
+	"time"
+)
+
+// Statuses a user can choose with the "presence" event. StatusOffline is
+// only ever reported to other users, never stored.
+const (
+	StatusAvailable = "available"
+	StatusAway      = "away"
+	StatusDND       = "dnd"
+	StatusInvisible = "invisible"
+	StatusOffline   = "offline"
+)
+
+const maxCustomStatusLength = 100
+
+// AwayAfter is how long a client can go without activity before an
+// available user is shown as away.
+var AwayAfter = 5 * time.Minute
+
+// PresenceState is the stored presence of a user (one user_online row).
+type PresenceState database.PresenceRecord
+
+// Public returns the presence other users are allowed to see: invisible
+// users look offline and last seen is only set when the user allows it.
+func (s PresenceState) Public() model.Presence {
+	p := model.Presence{
+		UserID:   s.UserID,
+		Username: s.Username,
+		Status:   StatusOffline,
+	}
+	if s.Status == StatusInvisible {
+		return p
+	}
+
+	p.CustomStatus = s.CustomStatus
+	if s.IsOnline {
+		p.IsOnline = true
+		p.Status = s.Status
+		if s.Status == StatusAvailable && s.IsIdle {
+			p.Status = StatusAway
+		}
+		return p
+	}
+
+	if s.ShowLastSeen && !s.LastActivity.IsZero() {
+		lastSeen := s.LastActivity
+		p.LastSeen = &lastSeen
+	}
+	return p
+}
+
+// Own returns the presence as the user themselves sees it, including
+// the invisible status.
+func (s PresenceState) Own() model.Presence {
+	p := model.Presence{
+		UserID:       s.UserID,
+		Username:     s.Username,
+		IsOnline:     s.IsOnline,
+		Status:       s.Status,
+		CustomStatus: s.CustomStatus,
+	}
+	if s.ShowLastSeen && !s.LastActivity.IsZero() {
+		lastSeen := s.LastActivity
+		p.LastSeen = &lastSeen
+	}
+	return p
+}
+
+// LoadPresence reads the presence of a user, falling back to defaults for
+// users that never connected.
+func LoadPresence(userID string) (PresenceState, error) {
+	record, err := database.Presence.Load(userID)
+	return PresenceState(record), err
+}
+
+// LoadPresences reads the presence of several users in one query.
+func LoadPresences(userIDs []string) ([]PresenceState, error) {
+	records, err := database.Presence.LoadMany(userIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	states := make([]PresenceState, len(records))
+	for i, record := range records {
+		states[i] = PresenceState(record)
+	}
+	return states, nil
+}
+
+func savePresence(state PresenceState) error {
+	return database.Presence.Save(database.PresenceRecord(state))
+}
+
+func (h *Hub) setUserIdle(userID string, idle bool) {
+	if err := database.Presence.SetIdle(userID, idle); err != nil {
+		log.Printf("❌ ERROR updating idle state for user %s: %v", userID, err)
+		return
+	}
+	h.broadcastPresence(userID)
+}
+
+// broadcastPresence sends the public presence of a user to every other
+// connected client.
+func (h *Hub) broadcastPresence(userID string) {
+	h.broadcastPresenceDeltas([]string{userID})
+}
+
+// broadcastPresenceDeltas sends one "user_status" event per changed user
+// to every other connected client.
+func (h *Hub) broadcastPresenceDeltas(userIDs []string) {
+	states, err := LoadPresences(userIDs)
+	if err != nil {
+		log.Printf("❌ ERROR loading presence for %d users: %v", len(userIDs), err)
+		return
+	}
+
+	for _, state := range states {
+		data, _ := json.Marshal(model.WebSocketMessage{
+			Type: "user_status",
+			Data: state.Public(),
+		})
+		h.BroadcastToOthers(data, state.UserID)
+	}
+}
+
+// sendPresenceSnapshot sends a new client the presence of every other
+// connected user, on any instance, as a single "presence_snapshot" event.
+func (h *Hub) sendPresenceSnapshot(client *Client) {
+	var userIDs []string
+	for _, id := range h.connectedUserIDs() {
+		if id != client.ID {
+			userIDs = append(userIDs, id)
+		}
+	}
+
+	states, err := LoadPresences(userIDs)
+	if err != nil {
+		log.Printf("❌ ERROR loading presence snapshot for %s: %v", client.Username, err)
+		return
+	}
+
+	snapshot := make([]model.Presence, 0, len(states))
+	for _, state := range states {
+		// Invisible users are connected but must not show up here
+		if public := state.Public(); public.IsOnline {
+			snapshot = append(snapshot, public)
+		}
+	}
+
+	data, _ := json.Marshal(model.WebSocketMessage{Type: "presence_snapshot", Data: snapshot})
+	if !h.sendTo(client, data) {
+		log.Printf("⚠️ Failed to send presence snapshot to %s", client.Username)
+	}
+}
+
+// isConnected reports whether the user has a client on this or any
+// other instance.
+func (h *Hub) isConnected(userID string) bool {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	if _, ok := h.Clients[userID]; ok {
+		return true
+	}
+	for _, remote := range h.remote {
+		if remote.users[userID] {
+			return true
+		}
+	}
+	return false
+}
+
+// writePresence persists online/offline changes queued by the hub loop.
+// Changes that pile up while a write is in progress are coalesced into a
+// single transaction, and each user's status is taken from the clients
+// maps at write time so a quick connect/disconnect can never leave a user
+// marked online. It also announces this instance's users to the others.
+func (h *Hub) writePresence() {
+	heartbeat := time.NewTicker(presenceHeartbeat)
+	defer heartbeat.Stop()
+
+	defer h.running.Done()
+
+	for {
+		var order []string
+		select {
+		case <-h.quit:
+			return
+		case <-h.presenceReady:
+			order = h.takePresenceChanges()
+		case <-heartbeat.C:
+			order = h.expireRemoteInstances()
+		}
+
+		// Other instances need our users before they compute statuses
+		h.publishPresence()
+		if len(order) == 0 {
+			continue
+		}
+
+		statuses := make(map[string]bool, len(order))
+		for _, id := range order {
+			statuses[id] = h.isConnected(id)
+		}
+
+		if err := saveOnlineStatuses(statuses); err != nil {
+			log.Printf("❌ ERROR updating online status of %d users: %v", len(order), err)
+			continue
+		}
+		h.broadcastPresenceDeltas(order)
+	}
+}
+
+// queuePresenceChange records that the online status of a user changed
+// and wakes writePresence, without ever blocking the caller.
+func (h *Hub) queuePresenceChange(userID string) {
+	h.presenceMutex.Lock()
+	if !h.presencePending[userID] {
+		h.presencePending[userID] = true
+		h.presenceOrder = append(h.presenceOrder, userID)
+	}
+	h.presenceMutex.Unlock()
+
+	select {
+	case h.presenceReady <- struct{}{}:
+	default: // writePresence is already due to look
+	}
+}
+
+// takePresenceChanges returns the changes queued since the last call,
+// each user once, in the order they were first queued.
+func (h *Hub) takePresenceChanges() []string {
+	h.presenceMutex.Lock()
+	defer h.presenceMutex.Unlock()
+
+	order := h.presenceOrder
+	h.presenceOrder = nil
+	h.presencePending = make(map[string]bool)
+	return order
+}
+
+func validatePresence(state PresenceState) error {
+	switch state.Status {
+	case StatusAvailable, StatusAway, StatusDND, StatusInvisible:
+	default:
+		return errors.New("invalid status")
+	}
+	if len([]rune(state.CustomStatus)) > maxCustomStatusLength {
+		return errors.New("custom status is too long")
+	}
+	return nil
+}
+
+// handlePresenceEvent applies a "presence" event. Every field is optional:
+// {"status": "dnd", "custom_status": "In a meeting", "show_last_seen": false}
+func handlePresenceEvent(client *Client, wsMessage model.WebSocketMessage) {
+	data, ok := wsMessage.Data.(map[string]interface{})
+	if !ok {
+		sendError(client, "A presence event needs a data object")
+		return
+	}
+
+	state, err := LoadPresence(client.ID)
+	if err != nil {
+		log.Printf("❌ ERROR loading presence for user %s: %v", client.ID, err)
+		return
+	}
+
+	if status, ok := data["status"].(string); ok {
+		state.Status = status
+	}
+	if customStatus, ok := data["custom_status"].(string); ok {
+		state.CustomStatus = strings.TrimSpace(customStatus)
+	}
+	if showLastSeen, ok := data["show_last_seen"].(bool); ok {
+		state.ShowLastSeen = showLastSeen
+	}
+
+	if err := validatePresence(state); err != nil {
+		sendError(client, err.Error())
+		return
+	}
+
+	if err := savePresence(state); err != nil {
+		log.Printf("❌ ERROR saving presence for user %s: %v", client.ID, err)
+		return
+	}
+
+	// Confirm the new state to the user, then tell everyone else
+	own, _ := json.Marshal(model.WebSocketMessage{Type: "presence", Data: state.Own()})
+	client.Hub.SendToUser(client.ID, own)
+	client.Hub.broadcastPresence(client.ID)
+}
+
+func sendError(client *Client, message string) {
+	data, _ := json.Marshal(model.WebSocketMessage{
+		Type: "error",
+		Data: map[string]string{"message": message},
+	})
+	client.Hub.SendToUser(client.ID, data)
+}
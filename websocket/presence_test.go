@@ -0,0 +1,59 @@
+package websocket
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPresenceVisibility(t *testing.T) {
+	seen := time.Date(2025, time.March, 4, 5, 6, 7, 0, time.UTC)
+	for _, test := range []struct {
+		name       string
+		state      PresenceState
+		public     string
+		publicSeen bool
+		own        string
+		ownSeen    bool
+	}{
+		{"available", PresenceState{IsOnline: true, Status: StatusAvailable, ShowLastSeen: true, LastActivity: seen}, StatusAvailable, false, StatusAvailable, true},
+		{"idle", PresenceState{IsOnline: true, Status: StatusAvailable, IsIdle: true}, StatusAway, false, StatusAvailable, false},
+		{"idle and busy", PresenceState{IsOnline: true, Status: StatusDND, IsIdle: true}, StatusDND, false, StatusDND, false},
+		{"invisible", PresenceState{IsOnline: true, Status: StatusInvisible, ShowLastSeen: true, LastActivity: seen}, StatusOffline, false, StatusInvisible, true},
+		{"offline", PresenceState{Status: StatusAvailable, ShowLastSeen: true, LastActivity: seen}, StatusOffline, true, StatusAvailable, true},
+		{"last seen hidden", PresenceState{Status: StatusAvailable, LastActivity: seen}, StatusOffline, false, StatusAvailable, false},
+		{"never connected", PresenceState{Status: StatusAvailable, ShowLastSeen: true}, StatusOffline, false, StatusAvailable, false},
+	} {
+		public, own := test.state.Public(), test.state.Own()
+		if public.Status != test.public || (public.LastSeen != nil) != test.publicSeen {
+			t.Errorf("%s: public presence is %s, last seen %v", test.name, public.Status, public.LastSeen)
+		}
+		if own.Status != test.own || (own.LastSeen != nil) != test.ownSeen {
+			t.Errorf("%s: own presence is %s, last seen %v", test.name, own.Status, own.LastSeen)
+		}
+		if public.IsOnline && test.state.Status == StatusInvisible {
+			t.Errorf("%s: shown online", test.name)
+		}
+	}
+}
+
+func TestValidatePresence(t *testing.T) {
+	for _, test := range []struct {
+		state PresenceState
+		want  string
+	}{
+		{PresenceState{Status: StatusAway, CustomStatus: "Lunch"}, ""},
+		{PresenceState{Status: StatusInvisible, CustomStatus: strings.Repeat("é", maxCustomStatusLength)}, ""},
+		{PresenceState{Status: StatusOffline}, "invalid status"},
+		{PresenceState{Status: ""}, "invalid status"},
+		{PresenceState{Status: StatusDND, CustomStatus: strings.Repeat("a", maxCustomStatusLength+1)}, "custom status is too long"},
+	} {
+		var got string
+		if err := validatePresence(test.state); err != nil {
+			got = err.Error()
+		}
+		if got != test.want {
+			t.Errorf("%s %q: got %q, want %q", test.state.Status, test.state.CustomStatus, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+// websocket/sync.go
+package websocket
+
+import (
+	"encoding/json"
+	"log"
+	"realtimeforum/database"
+	"realtimeforum/model"
+	"time"
+)
+
+// Bounds of the replay sent to a reconnecting client. Events older than
+// ReplayWindow are pruned; a client that missed more than MaxReplayEvents
+// gets a truncated batch and should reload its state over HTTP.
+var (
+	ReplayWindow    = 7 * 24 * time.Hour
+	MaxReplayEvents = 500
+)
+
+// DeliverToUser stores an event in the user's event log and sends it if
+// the user is connected. Unlike SendToUser, the event is replayed when the
+// user reconnects if it was never acknowledged.
+func (h *Hub) DeliverToUser(userID, eventType string, data interface{}) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("❌ Error encoding %s event for user %s: %v", eventType, userID, err)
+		return
+	}
+
+	message := model.WebSocketMessage{
+		Type: eventType,
+		Data: json.RawMessage(payload),
+	}
+
+	seq, err := database.Events.Append(userID, eventType, string(payload))
+	if err != nil {
+		// Still try live delivery, the event just won't be replayed
+		log.Printf("❌ Error storing %s event for user %s: %v", eventType, userID, err)
+	} else {
+		message.Seq = seq
+	}
+
+	encoded, _ := json.Marshal(message)
+	h.SendToUser(userID, encoded)
+}
+
+// handleAck moves the user's sync cursor forward: {"seq": 42}
+func handleAck(client *Client, wsMessage model.WebSocketMessage) {
+	data, ok := wsMessage.Data.(map[string]interface{})
+	if !ok {
+		return
+	}
+	seq, ok := data["seq"].(float64)
+	if !ok || seq <= 0 {
+		return
+	}
+
+	if err := database.Events.Ack(client.ID, int64(seq)); err != nil {
+		log.Printf("❌ Error saving sync cursor for user %s: %v", client.ID, err)
+	}
+}
+
+// loadMissedEvents returns the events a user has not acknowledged yet,
+// bounded by ReplayWindow and MaxReplayEvents.
+func loadMissedEvents(userID string) (*model.SyncBatch, error) {
+	batch := &model.SyncBatch{Events: []model.WebSocketMessage{}}
+	windowStart := time.Now().Add(-ReplayWindow)
+
+	lastSeq, cursorUpdated, found, err := database.Events.Cursor(userID)
+	if err != nil {
+		return nil, err
+	}
+	batch.LastSeq = lastSeq
+	if found && cursorUpdated.Before(windowStart) {
+		// Anything missed before the window has already been pruned
+		batch.Truncated = true
+	}
+
+	// Newest first so a backlog larger than the bound keeps the latest events
+	events, err := database.Events.Since(userID, batch.LastSeq, windowStart, MaxReplayEvents+1)
+	if err != nil {
+		return nil, err
+	}
+	batch.Events = append(batch.Events, events...)
+
+	if len(batch.Events) > MaxReplayEvents {
+		batch.Truncated = true
+		batch.Events = batch.Events[:MaxReplayEvents]
+	}
+
+	// Replay in the order the events happened
+	for i, j := 0, len(batch.Events)-1; i < j; i, j = i+1, j-1 {
+		batch.Events[i], batch.Events[j] = batch.Events[j], batch.Events[i]
+	}
+	if len(batch.Events) > 0 {
+		batch.LastSeq = batch.Events[len(batch.Events)-1].Seq
+	}
+	return batch, nil
+}
+
+// sendMissedEvents replays everything the client missed as one "sync"
+// message. It is sent even when empty so the client knows it is caught up.
+func (h *Hub) sendMissedEvents(client *Client) {
+	batch, err := loadMissedEvents(client.ID)
+	if err != nil {
+		log.Printf("❌ Error loading missed events for %s: %v", client.Username, err)
+		return
+	}
+
+	data, _ := json.Marshal(model.WebSocketMessage{Type: "sync", Data: batch})
+	if h.sendTo(client, data) {
+		log.Printf("📬 Replayed %d missed events to %s", len(batch.Events), client.Username)
+	} else {
+		log.Printf("⚠️ Failed to send missed events to %s", client.Username)
+	}
+}
+
+// pruneUserEvents deletes events that fell out of the replay window.
+func pruneUserEvents() {
+	n, err := database.Events.Prune(time.Now().Add(-ReplayWindow))
+	if err != nil {
+		log.Printf("❌ Error pruning user events: %v", err)
+		return
+	}
+	if n > 0 {
+		log.Printf("🧹 Pruned %d expired user events", n)
+	}
+}
+
+// AnnouncePost tells everyone connected that a scheduled post went out,
+// and its author with a replayable notification.
+func (h *Hub) AnnouncePost(post model.Post) {
+	data, _ := json.Marshal(model.WebSocketMessage{
+		Type: "post_published",
+		Data: map[string]interface{}{
+			"post_id": post.ID,
+			"title":   post.Title,
+			"author":  post.Author,
+		},
+	})
+	h.BroadcastToOthers(data, post.UserID)
+
+	h.DeliverToUser(post.UserID, "notification", map[string]interface{}{
+		"kind":       "post_published",
+		"post_id":    post.ID,
+		"post_title": post.Title,
+	})
+}